@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/brk3/habits/internal/apiclient"
+	"github.com/spf13/cobra"
+)
+
+var accountCmd = &cobra.Command{
+	Use:   "account",
+	Short: "Manage your account and its logins",
+}
+
+var accountExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export everything the server stores about you as JSON",
+	Long: `The "account export" command writes your habits, as "habits export" does,
+together with your account details, API keys and sessions. Secrets such as
+passwords and keys themselves are never included.
+
+For example:
+  habits account export -o account.json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apiclient := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
+		export, err := apiclient.ExportAccount(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to export: %w", err)
+		}
+
+		out, _ := cmd.Flags().GetString("output")
+		w := cmd.OutOrStdout()
+		if out != "" && out != "-" {
+			f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(export)
+	},
+}
+
+var accountDeleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Delete your account and all of your data",
+	Long: `The "account delete" command deletes everything the server stores about
+you: habits, settings, API keys, sessions and your login. It can't be undone,
+so run "habits account export" first if you want a copy.
+
+Logged in with an API key, the key needs the account:delete scope. Keys
+created before that scope existed don't have it; run "habits login" for one
+that does.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		yes, _ := cmd.Flags().GetBool("yes")
+		if !yes && !confirm(cmd, "Delete your account and all of your data? This can't be undone.") {
+			return errors.New("not confirmed")
+		}
+		apiclient := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
+		if err := apiclient.DeleteAccount(cmd.Context()); err != nil {
+			return err
+		}
+		cmd.Println("Your account has been deleted")
+		return nil
+	},
+}
+
+var accountLoginsCmd = &cobra.Command{
+	Use:   "logins",
+	Short: "List the OIDC logins linked to your account",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apiclient := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
+		identities, err := apiclient.ListIdentities(cmd.Context())
+		if err != nil {
+			return err
+		}
+		for _, ident := range identities {
+			cmd.Printf("%-22s  %-12s  %-30s  linked %s  last login %s\n",
+				ident.ID, ident.ProviderID, cmp.Or(ident.Email, ident.Subject),
+				formatKeyTime(ident.CreatedAt), formatKeyTime(ident.LastLoginAt))
+		}
+		return nil
+	},
+}
+
+var accountLinkCmd = &cobra.Command{
+	Use:   "link <provider>",
+	Short: "Link a login with another provider to your account",
+	Long: `The "account link" command prints the page to open in a browser where you
+are logged in to habits. Logging in there with the other provider links it
+to your account, so either login reaches the same habits.
+
+If you already logged in with that provider and got a second, separate
+account, its habits, settings and API keys are merged into this one.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Printf("Open %s/auth/link/%s\n", strings.TrimRight(cfg.APIBaseURL, "/"), url.PathEscape(args[0]))
+	},
+}
+
+var accountUnlinkCmd = &cobra.Command{
+	Use:   "unlink <login-id>",
+	Short: "Unlink a login from your account",
+	Long: `The "account unlink" command removes a login listed by "habits account
+logins" from your account and logs out its sessions. Logging in with it
+again starts a new, empty account.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apiclient := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
+		if err := apiclient.UnlinkIdentity(cmd.Context(), args[0]); err != nil {
+			return err
+		}
+		cmd.Printf("Unlinked %s\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(accountCmd)
+	accountCmd.AddCommand(accountExportCmd)
+	accountCmd.AddCommand(accountDeleteCmd)
+	accountCmd.AddCommand(accountLoginsCmd)
+	accountCmd.AddCommand(accountLinkCmd)
+	accountCmd.AddCommand(accountUnlinkCmd)
+	accountExportCmd.Flags().StringP("output", "o", "", "File to write to (default stdout)")
+	accountDeleteCmd.Flags().BoolP("yes", "y", false, "Don't ask for confirmation")
+}
@@ -0,0 +1,493 @@
+package cmd
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/brk3/habits/internal/apiclient"
+	"github.com/brk3/habits/internal/config"
+	"github.com/brk3/habits/internal/server"
+	"github.com/brk3/habits/internal/storage"
+	"github.com/brk3/habits/internal/storage/bolt"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var adminCmd = &cobra.Command{
+	Use:         "admin",
+	Short:       "Server administration commands",
+	Annotations: skipSync,
+}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Download a consistent snapshot of the server's database",
+	Long: `The "backup" command downloads a snapshot of the database from the server at
+api_base_url while it keeps running. The snapshot is checked before it is
+kept. Only users listed in admin.users may take backups.
+
+For example:
+  habits admin backup -o /backups/habits-nightly.db`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+		if out == "" {
+			out = fmt.Sprintf("habits-%s.db", time.Now().UTC().Format("20060102-150405"))
+		}
+		return backup(cmd, out)
+	},
+}
+
+func backup(cmd *cobra.Command, out string) error {
+	// download next to the destination so the final rename is atomic
+	f, err := os.CreateTemp(filepath.Dir(out), ".habits-backup-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	apiclient := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
+	n, err := apiclient.Backup(cmd.Context(), f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to download backup: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := bolt.ValidateFile(f.Name()); err != nil {
+		return fmt.Errorf("downloaded backup is invalid: %w", err)
+	}
+	if err := os.Rename(f.Name(), out); err != nil {
+		return err
+	}
+	cmd.Printf("Wrote %d bytes to %s\n", n, out)
+	return nil
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <backup-file>",
+	Short: "Replace the database at db_path with a backup",
+	Long: `The "restore" command validates a backup taken with "habits admin backup" and
+swaps it in for the database at db_path. The previous database is kept
+next to it with a .bak suffix.
+
+Stop the server first; the restore refuses to run while the database is
+in use.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if cfg.Storage.Driver != "bolt" {
+			return fmt.Errorf("restore is only supported for the bolt driver, not %s", cfg.Storage.Driver)
+		}
+		if err := bolt.Restore(args[0], cfg.DBPath); err != nil {
+			return err
+		}
+		cmd.Printf("Restored %s from %s\n", cfg.DBPath, args[0])
+		return nil
+	},
+}
+
+var rotateSessionKeysCmd = newRotateKeysCmd("rotate-session-keys", "session cookie key",
+	`The "rotate-session-keys" command puts a freshly generated key at the front of
+session.key_file, creating the file if needed. New session cookies are
+signed with it once the server restarts, while the previous keys are kept
+so existing sessions stay valid. Keys beyond --keep are dropped, logging out
+sessions that still depend on them.
+
+Sessions last at most 24 hours, so keeping one old key is enough if
+rotations are further apart than that.
+
+A replica restarted with a new key at the front signs cookies that replicas
+still running with the old file reject, so with several replicas a rolling
+restart would log users out.`,
+	keyRotation[config.SessionKey]{
+		setting:  "session.key_file",
+		path:     func() string { return cfg.Session.KeyFile },
+		read:     config.ReadSessionKeyFile,
+		write:    config.WriteSessionKeyFile,
+		generate: config.NewSessionKey,
+		staged:   func(k *config.SessionKey) *bool { return &k.Staged },
+		restart:  "start signing sessions with it",
+	})
+
+var rotateEncryptionKeysCmd = newRotateKeysCmd("rotate-encryption-keys", "encryption key",
+	`The "rotate-encryption-keys" command puts a freshly generated key at the front
+of encryption.key_file, creating the file if needed. When the server next
+starts it encrypts new refresh and ID tokens with it, and re-encrypts the stored
+ones that are still under an older key or not encrypted at all. The
+previous keys are kept so tokens can be read until then. Keys beyond --keep
+are dropped.
+
+Only drop a key once the server has started with a newer one; tokens still
+encrypted with a dropped key can't be read, and the server refuses to start
+until they are deleted with "habits admin purge-undecryptable-tokens". The
+default of keeping one old key is safe as long as the server is restarted
+between rotations.
+
+A replica restarted with a new key at the front re-encrypts the stored
+tokens with it, which replicas still running with the old file can't read,
+so with several replicas a rolling restart would log users out.`,
+	keyRotation[config.EncryptionKey]{
+		setting:  "encryption.key_file",
+		path:     func() string { return cfg.Encryption.KeyFile },
+		read:     config.ReadEncryptionKeyFile,
+		write:    config.WriteEncryptionKeyFile,
+		generate: config.NewEncryptionKey,
+		staged:   func(k *config.EncryptionKey) *bool { return &k.Staged },
+		restart:  "re-encrypt stored tokens with it",
+	})
+
+var purgeUndecryptableTokensCmd = &cobra.Command{
+	Use:   "purge-undecryptable-tokens",
+	Short: "Delete stored tokens the encryption keys can't decrypt",
+	Long: `The "purge-undecryptable-tokens" command deletes the refresh tokens and
+sessions in the database configured for the server that are encrypted with
+a key no longer in encryption.keys or encryption.key_file. The server
+refuses to start while there are any. Their users have to log in again.
+
+Only run this once the key is really gone; putting it back lets the server
+start without anyone being logged out.
+
+With the bolt driver, stop the server first; only one process can have the
+database open.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		e, ok := store.(storage.Encrypter)
+		if !ok {
+			return fmt.Errorf("storage driver %s doesn't support encryption", cfg.Storage.Driver)
+		}
+		n, err := e.PurgeUndecryptableSecrets()
+		if err != nil {
+			return err
+		}
+		cmd.Printf("Deleted %d refresh tokens and sessions\n", n)
+		return nil
+	},
+}
+
+// keyRotation describes a key file for newRotateKeysCmd. The first key in
+// the file is the one in use; the rest are only read with.
+type keyRotation[K any] struct {
+	setting  string
+	path     func() string
+	read     func(path string) ([]K, error)
+	write    func(path string, keys []K) error
+	generate func() K
+	// staged points at a key's Staged field.
+	staged func(k *K) *bool
+	// restart is what the server does with a new key once restarted.
+	restart string
+}
+
+// newRotateKeysCmd builds a command that rotates the keys in a key file,
+// either in one step or, for several replicas, staging the new key before
+// promoting it. long describes the key file, and why a rolling restart
+// after a one step rotation goes wrong.
+func newRotateKeysCmd[K any](use, noun, long string, r keyRotation[K]) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: "Add a new " + noun + " and retire old ones",
+		Long: long + `
+
+Instead, first add the new key with --stage, which puts it second: every
+replica can use it once restarted, but keeps using the current key. Once all
+replicas have restarted, run the command again with --promote to move the
+staged key to the front, and restart them again. Replicas that haven't
+restarted yet can then still read what the restarted ones write with the
+new key, and the other way around.
+
+For example:
+  habits admin ` + use + ` --keep 1
+
+  habits admin ` + use + ` --stage
+  # restart every replica
+  habits admin ` + use + ` --promote --keep 1
+  # restart every replica`,
+		Args: cobra.NoArgs,
+	}
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		path := r.path()
+		if path == "" {
+			return fmt.Errorf("%s is not set; rotation manages keys kept in that file", r.setting)
+		}
+		keep, _ := cmd.Flags().GetInt("keep")
+		if keep < 0 {
+			return errors.New("--keep must not be negative")
+		}
+		stage, _ := cmd.Flags().GetBool("stage")
+		promote, _ := cmd.Flags().GetBool("promote")
+
+		old, err := r.read(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if stage && len(old) > 0 {
+			// nothing is dropped until the staged key is promoted
+			staged := r.generate()
+			*r.staged(&staged) = true
+			keys := append([]K{old[0], staged}, old[1:]...)
+			if err := r.write(path, keys); err != nil {
+				return err
+			}
+			cmd.Printf("Staged a new %s in %s\n", noun, path)
+			cmd.Println("Restart every replica, then run this command again with --promote.")
+			return nil
+		}
+		// without a current key there is nothing to stay compatible with, so
+		// a staged key is used straight away
+		next, previous := r.generate(), old
+		written := "Wrote a new " + noun + " to"
+		if promote {
+			i := slices.IndexFunc(old, func(k K) bool { return *r.staged(&k) })
+			if i < 0 {
+				return fmt.Errorf("%s has no staged key to promote", path)
+			}
+			next, previous = old[i], slices.Delete(slices.Clone(old), i, i+1)
+			*r.staged(&next) = false
+			written = "Promoted the staged " + noun + " in"
+		}
+		keys := append([]K{next}, previous[:min(len(previous), keep)]...)
+		if err := r.write(path, keys); err != nil {
+			return err
+		}
+		cmd.Printf("%s %s, keeping %d old and dropping %d\n",
+			written, path, len(keys)-1, len(previous)-(len(keys)-1))
+		cmd.Printf("Restart the server to %s.\n", r.restart)
+		return nil
+	}
+	cmd.Flags().Int("keep", 1, "Number of previous keys to keep")
+	cmd.Flags().Bool("stage", false, "Add the new key second, to be used once promoted")
+	cmd.Flags().Bool("promote", false, "Move the staged key to the front instead of adding one")
+	cmd.MarkFlagsMutuallyExclusive("stage", "promote")
+	return cmd
+}
+
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage users",
+}
+
+var userAddCmd = &cobra.Command{
+	Use:   "add <username>",
+	Short: "Create an account for the username and password login",
+	Long: `The "user add" command creates an account for logging in with local_auth,
+writing it straight to the database configured for the server. The password
+is prompted for, or read from the first line of stdin when that isn't a
+terminal.
+
+With the bolt driver, stop the server first; only one process can have the
+database open.
+
+For example:
+  habits admin user add alice`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		username := args[0]
+		password, err := readNewPassword(cmd)
+		if err != nil {
+			return err
+		}
+		u, err := server.NewLocalUser(username, password)
+		if err != nil {
+			return err
+		}
+
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		if _, found, err := store.GetLocalUser(username); err != nil {
+			return err
+		} else if found {
+			return fmt.Errorf("user %s already exists", username)
+		}
+		if err := store.PutLocalUser(u); err != nil {
+			return err
+		}
+		cmd.Printf("Created user %s with user ID %s\n", u.Username, u.UserID)
+		if !cfg.LocalAuth.Enabled {
+			cmd.Println("Set local_auth.enabled in the server's config to let them log in.")
+		}
+		return nil
+	},
+}
+
+var userListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List users with their habit counts and last activity",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apiclient := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
+		users, err := apiclient.ListUsers(cmd.Context())
+		if err != nil {
+			return err
+		}
+		for _, u := range users {
+			var flags []string
+			if u.Admin {
+				flags = append(flags, "admin")
+			}
+			if u.Disabled {
+				flags = append(flags, "DISABLED")
+			}
+			cmd.Printf("%-22s  %-30s  %3d habits  %5d entries  last active %s  %s\n",
+				u.UserID, cmp.Or(u.Email, u.Username, u.Name, "-"), u.HabitCount, u.EntryCount,
+				formatKeyTime(u.LastActiveAt), strings.Join(flags, ","))
+		}
+		return nil
+	},
+}
+
+var userDisableCmd = &cobra.Command{
+	Use:   "disable <user-id>",
+	Short: "Stop a user from logging in or using their API keys",
+	Long: `The "user disable" command logs a user out everywhere and refuses their
+logins and API keys until "habits admin user enable" is run for them. Their
+data is kept.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apiclient := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
+		if err := apiclient.SetUserDisabled(cmd.Context(), args[0], true); err != nil {
+			return err
+		}
+		cmd.Printf("Disabled %s\n", args[0])
+		return nil
+	},
+}
+
+var userEnableCmd = &cobra.Command{
+	Use:   "enable <user-id>",
+	Short: "Let a disabled user back in",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apiclient := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
+		if err := apiclient.SetUserDisabled(cmd.Context(), args[0], false); err != nil {
+			return err
+		}
+		cmd.Printf("Enabled %s\n", args[0])
+		return nil
+	},
+}
+
+var userDeleteCmd = &cobra.Command{
+	Use:   "delete <user-id>",
+	Short: "Delete a user and all of their data",
+	Long: `The "user delete" command deletes everything stored for a user: habits,
+settings, API keys, sessions and their login. It can't be undone, so take a
+backup first if in doubt.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		yes, _ := cmd.Flags().GetBool("yes")
+		if !yes && !confirm(cmd, fmt.Sprintf("Delete %s and all of their data?", args[0])) {
+			return errors.New("not confirmed")
+		}
+		apiclient := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
+		if err := apiclient.DeleteUser(cmd.Context(), args[0]); err != nil {
+			return err
+		}
+		cmd.Printf("Deleted %s\n", args[0])
+		return nil
+	},
+}
+
+var userMergeCmd = &cobra.Command{
+	Use:   "merge <user-id> <into-user-id>",
+	Short: "Merge a duplicate user into another",
+	Long: `The "user merge" command moves a user's habits, settings, API keys,
+sessions and logins into another user, then deletes their account. Use it
+for people who logged in with a second provider before linking it; they can
+also do this themselves with "habits account link".
+
+Where both users have the same habit, or both have settings, the ones of
+<into-user-id> are kept; entries from both are kept.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		yes, _ := cmd.Flags().GetBool("yes")
+		if !yes && !confirm(cmd, fmt.Sprintf("Merge %s into %s?", args[0], args[1])) {
+			return errors.New("not confirmed")
+		}
+		apiclient := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
+		if err := apiclient.MergeUser(cmd.Context(), args[0], args[1]); err != nil {
+			return err
+		}
+		cmd.Printf("Merged %s into %s\n", args[0], args[1])
+		return nil
+	},
+}
+
+// confirm asks a yes/no question on stdin, defaulting to no.
+func confirm(cmd *cobra.Command, question string) bool {
+	cmd.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// readNewPassword prompts for a password twice on a terminal, or reads a
+// single line from piped stdin.
+func readNewPassword(cmd *cobra.Command) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	cmd.Print("Password: ")
+	password, err := term.ReadPassword(fd)
+	cmd.Println()
+	if err != nil {
+		return "", err
+	}
+	cmd.Print("Repeat password: ")
+	again, err := term.ReadPassword(fd)
+	cmd.Println()
+	if err != nil {
+		return "", err
+	}
+	if string(password) != string(again) {
+		return "", errors.New("passwords don't match")
+	}
+	return string(password), nil
+}
+
+func init() {
+	rootCmd.AddCommand(adminCmd)
+	adminCmd.AddCommand(userCmd)
+	userCmd.AddCommand(userAddCmd)
+	userCmd.AddCommand(userListCmd)
+	userCmd.AddCommand(userDisableCmd)
+	userCmd.AddCommand(userEnableCmd)
+	userCmd.AddCommand(userDeleteCmd)
+	userCmd.AddCommand(userMergeCmd)
+	userDeleteCmd.Flags().BoolP("yes", "y", false, "Don't ask for confirmation")
+	userMergeCmd.Flags().BoolP("yes", "y", false, "Don't ask for confirmation")
+	adminCmd.AddCommand(backupCmd)
+	adminCmd.AddCommand(restoreCmd)
+	adminCmd.AddCommand(rotateSessionKeysCmd)
+	adminCmd.AddCommand(rotateEncryptionKeysCmd)
+	adminCmd.AddCommand(purgeUndecryptableTokensCmd)
+	backupCmd.Flags().StringP("output", "o", "", "File to write the backup to (default habits-<timestamp>.db)")
+}
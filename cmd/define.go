@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brk3/habits/internal/apiclient"
+	"github.com/brk3/habits/pkg/habit"
+	"github.com/spf13/cobra"
+)
+
+var defineCmd = &cobra.Command{
+	Use:   "define <habit>",
+	Short: "Create or update a habit's display name, description, color and icon",
+	Long: `The "define" command sets metadata for a habit. Only the flags given are
+changed; anything else keeps its current value.
+
+For example:
+  habits define guitar --display-name "Guitar practice" --color "#ff8800"
+  habits define gym --schedule 3/week
+  habits define piano --schedule mon,wed,fri
+  habits define guitar --target 30m/day
+  habits define guitar --archived
+
+Schedules are "daily", "N/week", "N/month" or a comma separated list of
+weekdays. Targets are a quantity per day or week, in the same form as
+"habits track" quantities.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		apiclient := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
+
+		existing, err := apiclient.GetHabitDefinition(cmd.Context(), args[0])
+		if err != nil {
+			cmd.Printf("Error fetching habit: %v\n", err)
+			os.Exit(1)
+		}
+		d := habit.HabitDefinition{Name: args[0]}
+		if existing != nil {
+			d = *existing
+		}
+
+		flags := cmd.Flags()
+		if flags.Changed("display-name") {
+			d.DisplayName, _ = flags.GetString("display-name")
+		}
+		if flags.Changed("description") {
+			d.Description, _ = flags.GetString("description")
+		}
+		if flags.Changed("color") {
+			d.Color, _ = flags.GetString("color")
+		}
+		if flags.Changed("icon") {
+			d.Icon, _ = flags.GetString("icon")
+		}
+		if flags.Changed("schedule") {
+			raw, _ := flags.GetString("schedule")
+			sched, err := parseSchedule(raw)
+			if err != nil {
+				cmd.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			d.Schedule = sched
+		}
+		if flags.Changed("target") {
+			raw, _ := flags.GetString("target")
+			target, err := parseTarget(raw)
+			if err != nil {
+				cmd.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			d.Target = target
+		}
+		if flags.Changed("archived") {
+			d.Archived, _ = flags.GetBool("archived")
+		}
+
+		out, err := apiclient.PutHabitDefinition(cmd.Context(), d)
+		if err != nil {
+			cmd.Printf("Error saving habit: %v\n", err)
+			os.Exit(1)
+		}
+		cmd.Printf("Saved %s\n", out.Name)
+	},
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parseSchedule(s string) (*habit.Schedule, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "daily" {
+		return &habit.Schedule{Frequency: habit.FrequencyDaily}, nil
+	}
+	if times, period, ok := strings.Cut(s, "/"); ok {
+		n, err := strconv.Atoi(times)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", s, err)
+		}
+		switch period {
+		case "week":
+			return &habit.Schedule{Frequency: habit.FrequencyWeekly, Times: n}, nil
+		case "month":
+			return &habit.Schedule{Frequency: habit.FrequencyMonthly, Times: n}, nil
+		}
+		return nil, fmt.Errorf("invalid schedule %q: period must be week or month", s)
+	}
+	sched := &habit.Schedule{Frequency: habit.FrequencyWeekdays}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		wd, ok := weekdayNames[name[:min(3, len(name))]]
+		if !ok {
+			return nil, fmt.Errorf("invalid schedule %q: unknown weekday %q", s, name)
+		}
+		sched.Weekdays = append(sched.Weekdays, wd)
+	}
+	return sched, nil
+}
+
+func parseTarget(s string) (*habit.Target, error) {
+	quantity, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid target %q: expected <quantity>/day or <quantity>/week", s)
+	}
+	value, unit, ok := parseQuantity(quantity)
+	if !ok {
+		return nil, fmt.Errorf("invalid target %q: bad quantity %q", s, quantity)
+	}
+	switch p := habit.TargetPeriod(period); p {
+	case habit.TargetPerDay, habit.TargetPerWeek:
+		return &habit.Target{Amount: value, Unit: unit, Period: p}, nil
+	}
+	return nil, fmt.Errorf("invalid target %q: period must be day or week", s)
+}
+
+func init() {
+	rootCmd.AddCommand(defineCmd)
+	defineCmd.Flags().String("display-name", "", "Human friendly name")
+	defineCmd.Flags().String("description", "", "Longer description")
+	defineCmd.Flags().String("color", "", "Color as #rrggbb")
+	defineCmd.Flags().String("icon", "", "Icon name or emoji")
+	defineCmd.Flags().String("schedule", "", "How often the habit is due, e.g. daily, 3/week, 2/month or mon,wed,fri")
+	defineCmd.Flags().String("target", "", "Quantity to do per day or week, e.g. 30m/day or 20km/week")
+	defineCmd.Flags().Bool("archived", false, "Hide the habit from listings")
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/brk3/habits/internal/apiclient"
+	"github.com/brk3/habits/internal/server"
+	"github.com/spf13/cobra"
+)
+
+var editCmd = &cobra.Command{
+	Use:   "edit <habit> <entry-id>",
+	Short: "Edit the note, quantity or timestamp of a habit entry",
+	Long: `The "edit" command corrects a single logged entry.
+
+For example:
+  habits edit guitar 01J9Z3M8Q4T7X2V5B6N8K0C1D3 --note "20 mins of minor scales"
+
+Entry IDs are printed by "habits track".`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		var update server.HabitEntryUpdateRequest
+		if cmd.Flags().Changed("note") {
+			note, _ := cmd.Flags().GetString("note")
+			update.Note = &note
+		}
+		if cmd.Flags().Changed("timestamp") {
+			ts, err := cmd.Flags().GetInt64("timestamp")
+			if err != nil {
+				cmd.Printf("Error: invalid timestamp: %v\n", err)
+				os.Exit(1)
+			}
+			update.TimeStamp = &ts
+		}
+		if cmd.Flags().Changed("quantity") {
+			raw, _ := cmd.Flags().GetString("quantity")
+			value, unit, ok := parseQuantity(raw)
+			if !ok {
+				cmd.Printf("Error: invalid quantity %q\n", raw)
+				os.Exit(1)
+			}
+			update.Value, update.Unit = &value, &unit
+		}
+		if update.Note == nil && update.TimeStamp == nil && update.Value == nil {
+			cmd.Println("Error: nothing to change, pass --note, --quantity and/or --timestamp")
+			os.Exit(1)
+		}
+
+		apiclient := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
+		h, err := apiclient.UpdateHabitEntry(cmd.Context(), args[0], args[1], update)
+		if err != nil {
+			cmd.Printf("Error editing entry: %v\n", err)
+			return
+		}
+		cmd.Printf("Updated entry %s: %s - %s\n", h.ID, h.Name, h.Note)
+	},
+}
+
+var rmEntryCmd = &cobra.Command{
+	Use:   "rm-entry <habit> <entry-id>",
+	Short: "Delete a single habit entry",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		apiclient := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
+		if err := apiclient.DeleteHabitEntry(cmd.Context(), args[0], args[1]); err != nil {
+			cmd.Printf("Error deleting entry: %v\n", err)
+			return
+		}
+		cmd.Printf("Deleted entry %s from %s\n", args[1], args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(editCmd)
+	rootCmd.AddCommand(rmEntryCmd)
+	editCmd.Flags().String("note", "", "New note for the entry")
+	editCmd.Flags().Int64("timestamp", 0, "New Unix timestamp for the entry")
+	editCmd.Flags().String("quantity", "", "New quantity for the entry, e.g. 30m or 5km")
+}
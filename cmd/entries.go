@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/brk3/habits/internal/apiclient"
+	"github.com/brk3/habits/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+var entriesCmd = &cobra.Command{
+	Use:   "entries <habit>",
+	Short: "List the entries of a habit",
+	Long: `The "entries" command prints every logged entry of a habit with its ID, oldest first.
+
+For example:
+  habits entries guitar --from 2025-01-01 --to 2025-02-01`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var q storage.EntryQuery
+		var err error
+		if q.From, err = dateFlag(cmd, "from"); err != nil {
+			cmd.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if q.To, err = dateFlag(cmd, "to"); err != nil {
+			cmd.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		q.Limit, _ = cmd.Flags().GetInt("page-size")
+
+		apiclient := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
+		for e, err := range apiclient.HabitEntries(cmd.Context(), args[0], q) {
+			if err != nil {
+				cmd.Printf("Error fetching entries: %v\n", err)
+				return
+			}
+			cmd.Printf("%s  %s  %s\n", e.ID, time.Unix(e.TimeStamp, 0).Format(time.DateTime), e.Note)
+		}
+	},
+}
+
+// dateFlag parses a YYYY-MM-DD flag as local midnight, returning 0 when unset.
+func dateFlag(cmd *cobra.Command, name string) (int64, error) {
+	v, _ := cmd.Flags().GetString(name)
+	if v == "" {
+		return 0, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, v, time.Local)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --%s date %q, expected YYYY-MM-DD", name, v)
+	}
+	return t.Unix(), nil
+}
+
+func init() {
+	rootCmd.AddCommand(entriesCmd)
+	entriesCmd.Flags().String("from", "", "Only show entries on or after this date (YYYY-MM-DD)")
+	entriesCmd.Flags().String("to", "", "Only show entries before this date (YYYY-MM-DD)")
+	entriesCmd.Flags().Int("page-size", 200, "Number of entries fetched per request")
+}
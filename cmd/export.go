@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/brk3/habits/internal/apiclient"
+	"github.com/brk3/habits/internal/server"
+	"github.com/brk3/habits/pkg/habit"
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export all of your habits, entries and settings as JSON",
+	Long: `The "export" command writes everything the server stores for you in a
+portable, versioned JSON format that "habits import" can load into any
+server or account.
+
+For example:
+  habits export -o habits.json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apiclient := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
+		export, err := apiclient.Export(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to export: %w", err)
+		}
+
+		out, _ := cmd.Flags().GetString("output")
+		w := cmd.OutOrStdout()
+		if out != "" && out != "-" {
+			f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(export)
+	},
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import habits, entries and settings from an export",
+	Long: `The "import" command loads a file written by "habits export" into your
+account. Existing habits are kept; habits in the file have their definitions
+replaced and their entries added. Importing the same file twice is harmless.
+
+Files from other trackers are read with --format:
+  habits import --format loop Checkmarks.csv
+  habits import --format csv --habit running --columns timestamp=Date,value=Km,note=Comment runs.csv
+
+The csv format expects a header row. --columns maps entry fields (name,
+timestamp, note, value, unit) to headers and defaults to headers with those
+names. Dates without a timezone are read in your timezone setting.
+
+Use "-" to read from stdin.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		r, err := openInput(cmd, args[0])
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		apiclient := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
+		var resp *server.ImportResponse
+		if format == "json" {
+			var export habit.Export
+			if err := json.NewDecoder(r).Decode(&export); err != nil {
+				return fmt.Errorf("failed to read %s: %w", args[0], err)
+			}
+			resp, err = apiclient.Import(cmd.Context(), &export)
+		} else {
+			params := url.Values{}
+			for _, flag := range []string{"habit", "columns", "time-layout"} {
+				if v, _ := cmd.Flags().GetString(flag); v != "" {
+					params.Set(strings.ReplaceAll(flag, "-", "_"), v)
+				}
+			}
+			resp, err = apiclient.ImportFile(cmd.Context(), format, params, r)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to import: %w", err)
+		}
+		cmd.Printf("Imported %d habit(s) with %d entries\n", resp.Habits, resp.Entries)
+		return nil
+	},
+}
+
+func openInput(cmd *cobra.Command, path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(cmd.InOrStdin()), nil
+	}
+	return os.Open(path)
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(importCmd)
+	exportCmd.Flags().StringP("output", "o", "", "File to write to (default stdout)")
+	importCmd.Flags().String("format", "json", "File format: json (a habits export), csv or loop")
+	importCmd.Flags().String("habit", "", "Habit name for csv files without a name column")
+	importCmd.Flags().String("columns", "", "Comma-separated field=Header mappings for csv files")
+	importCmd.Flags().String("time-layout", "", "Go time layout of the csv timestamp column")
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/brk3/habits/internal/apiclient"
+	"github.com/brk3/habits/internal/server"
+	"github.com/spf13/cobra"
+)
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "List and manage your API keys",
+	Long: `The "keys" command lists your API keys with their scopes and when each was
+last used, so stale keys are easy to spot and revoke.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		apiclient := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
+		keys, err := apiclient.ListAPIKeys(cmd.Context())
+		if err != nil {
+			cmd.Printf("Error listing API keys: %v\n", err)
+			os.Exit(1)
+		}
+		now := time.Now().Unix()
+		for _, k := range keys {
+			name := k.Name
+			if name == "" {
+				name = "(unnamed)"
+			}
+			expires := "never expires"
+			if k.ExpiresAt != 0 && k.ExpiresAt <= now {
+				expires = "EXPIRED " + formatKeyTime(k.ExpiresAt)
+			} else if k.ExpiresAt != 0 {
+				expires = "expires " + formatKeyTime(k.ExpiresAt)
+			}
+			cmd.Printf("%s  %-20s  %-30s  created %s  last used %s  %s\n",
+				k.KeyID[:min(len(k.KeyID), 16)], name, strings.Join(k.Scopes, ","),
+				formatKeyTime(k.CreatedAt), formatKeyTime(k.LastUsedAt), expires)
+		}
+	},
+}
+
+var keysCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create an API key",
+	Long: `The "create" command issues a new API key and prints it once; only its hash
+is kept by the server. Without --scope the key can do everything the key
+you are logged in with can.
+
+Scopes are habits:read, habits:write, admin and account:delete.
+
+For example:
+  habits keys create --name dashboard --scope habits:read --expires 2160h`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var req server.APIKeyCreateRequest
+		req.Name, _ = cmd.Flags().GetString("name")
+		req.Scopes, _ = cmd.Flags().GetStringSlice("scope")
+		expires, _ := cmd.Flags().GetDuration("expires")
+		req.ExpiresIn = int64(expires.Seconds())
+
+		apiclient := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
+		resp, err := apiclient.CreateAPIKey(cmd.Context(), req)
+		if err != nil {
+			cmd.Printf("Error creating API key: %v\n", err)
+			os.Exit(1)
+		}
+		cmd.Println(resp.APIKey)
+		cmd.PrintErrf("Scopes: %s. %s\n", strings.Join(resp.Key.Scopes, ","), resp.Message)
+	},
+}
+
+var keysRevokeCmd = &cobra.Command{
+	Use:   "revoke <key-id>",
+	Short: "Revoke an API key",
+	Long: `The "revoke" command deletes an API key. The key ID may be shortened to any
+prefix that matches only one of your keys, such as the one "habits keys"
+shows.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apiclient := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
+		keys, err := apiclient.ListAPIKeys(cmd.Context())
+		if err != nil {
+			return err
+		}
+		var match []server.APIKeyInfo
+		for _, k := range keys {
+			if strings.HasPrefix(k.KeyID, args[0]) {
+				match = append(match, k)
+			}
+		}
+		switch len(match) {
+		case 0:
+			return fmt.Errorf("no API key matches %s", args[0])
+		case 1:
+		default:
+			return fmt.Errorf("%s matches %d keys, give more of the ID", args[0], len(match))
+		}
+		if err := apiclient.DeleteAPIKey(cmd.Context(), match[0].KeyID); err != nil {
+			return err
+		}
+		cmd.Printf("Revoked %s\n", match[0].KeyID[:min(len(match[0].KeyID), 16)])
+		return nil
+	},
+}
+
+func formatKeyTime(ts int64) string {
+	if ts == 0 {
+		return "never"
+	}
+	return time.Unix(ts, 0).Format(time.DateOnly)
+}
+
+func init() {
+	rootCmd.AddCommand(keysCmd)
+	keysCmd.AddCommand(keysCreateCmd)
+	keysCmd.AddCommand(keysRevokeCmd)
+	keysCreateCmd.Flags().String("name", "", "Name to recognise the key by")
+	keysCreateCmd.Flags().StringSlice("scope", nil, "Scope to grant, repeatable (default: all of yours)")
+	keysCreateCmd.Flags().Duration("expires", 0, "Lifetime of the key, e.g. 720h (default: never expires)")
+}
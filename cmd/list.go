@@ -19,16 +19,28 @@ var listCmd = &cobra.Command{
 func list(cmd *cobra.Command) {
 	apiclient := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
 
-	habits, err := apiclient.ListHabits(context.Background())
+	archived, _ := cmd.Flags().GetBool("archived")
+	defs, err := apiclient.ListHabitDefinitions(context.Background(), archived)
 	if err != nil {
 		cmd.Printf("Error fetching habits: %v\n", err)
 		return
 	}
-	for _, h := range habits {
-		cmd.Println(h)
+	for _, d := range defs {
+		line := d.Name
+		if d.DisplayName != "" {
+			line += " (" + d.DisplayName + ")"
+		}
+		if d.Archived {
+			line += " [archived]"
+		}
+		if d.Description != "" {
+			line += " - " + d.Description
+		}
+		cmd.Println(line)
 	}
 }
 
 func init() {
 	rootCmd.AddCommand(listCmd)
+	listCmd.Flags().Bool("archived", false, "Include archived habits")
 }
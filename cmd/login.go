@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/brk3/habits/internal/apiclient"
+	"github.com/brk3/habits/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var loginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Log the CLI in through your browser",
+	Long: `The "login" command gets an API key for the CLI without copying one by hand.
+It shows a code to approve in a browser where you are logged in to habits,
+then saves the new key as auth_token in your config file.
+
+For example:
+  habits login
+  habits login --server https://habits.example.com`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		base, _ := cmd.Flags().GetString("server")
+		if base == "" {
+			if cfg == nil {
+				return errors.New("no config file found, pass --server")
+			}
+			base = cfg.APIBaseURL
+		}
+		client := apiclient.New(base, "")
+		start, err := client.StartDeviceLogin(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to start login: %w", err)
+		}
+
+		cmd.Printf("Open %s\nand confirm the code %s\n\n", start.VerificationURIComplete, start.UserCode)
+		cmd.Println("Waiting for approval...")
+
+		interval := time.Duration(start.Interval) * time.Second
+		deadline := time.Now().Add(time.Duration(start.ExpiresIn) * time.Second)
+		for {
+			select {
+			case <-cmd.Context().Done():
+				return cmd.Context().Err()
+			case <-time.After(interval):
+			}
+
+			apiKey, err := client.DeviceToken(cmd.Context(), start.DeviceCode)
+			var deviceErr *apiclient.DeviceError
+			switch {
+			case err == nil:
+				values := map[string]string{"auth_token": apiKey}
+				if cmd.Flags().Changed("server") {
+					values["api_base_url"] = base
+				}
+				if err := config.Set(config.Path(), values); err != nil {
+					return fmt.Errorf("logged in but failed to save the API key: %w", err)
+				}
+				cmd.Printf("Logged in, API key saved to %s\n", config.Path())
+				return nil
+			case errors.As(err, &deviceErr) && deviceErr.Code == "authorization_pending":
+			case errors.As(err, &deviceErr) && deviceErr.Code == "slow_down":
+				interval += 5 * time.Second
+			case errors.As(err, &deviceErr) && deviceErr.Code == "access_denied":
+				return errors.New("login was denied in the browser")
+			default:
+				return fmt.Errorf("login failed: %w", err)
+			}
+			if time.Now().After(deadline) {
+				return errors.New("login code expired, run habits login again")
+			}
+		}
+	},
+	Annotations: skipSync,
+}
+
+func init() {
+	rootCmd.AddCommand(loginCmd)
+	loginCmd.Flags().String("server", "", "Server URL (defaults to api_base_url from the config)")
+}
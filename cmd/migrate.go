@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/brk3/habits/internal/storage/bolt"
+	"github.com/spf13/cobra"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply pending database schema migrations",
+	Long: `The "migrate" command upgrades the database at db_path to the schema used by
+this build. The server also does this on startup; running it by hand lets you
+check what will change first with --dry-run.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return err
+		}
+		if cfg.Storage.Driver != "bolt" {
+			cmd.Printf("Migrations for the %s driver are applied automatically when the store is opened\n", cfg.Storage.Driver)
+			return nil
+		}
+		return migrate(cmd, dryRun)
+	},
+	Annotations: skipSync,
+}
+
+func migrate(cmd *cobra.Command, dryRun bool) error {
+	store, err := bolt.OpenWithOptions(cfg.DBPath, bolt.Options{SkipMigrations: true})
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", cfg.DBPath, err)
+	}
+	defer store.Close()
+
+	current, err := store.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	pending, err := store.PendingMigrations()
+	if err != nil {
+		return err
+	}
+
+	cmd.Printf("Schema version: %d (latest %d)\n", current, bolt.LatestSchemaVersion())
+	if len(pending) == 0 {
+		cmd.Println("Database is up to date")
+		return nil
+	}
+	for _, m := range pending {
+		cmd.Printf("  %d: %s\n", m.Version, m.Description)
+	}
+	if dryRun {
+		cmd.Printf("%d migration(s) pending, nothing applied (dry run)\n", len(pending))
+		return nil
+	}
+
+	if err := store.Migrate(); err != nil {
+		return err
+	}
+	cmd.Printf("Applied %d migration(s)\n", len(pending))
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	migrateCmd.Flags().Bool("dry-run", false, "List pending migrations without applying them")
+}
@@ -18,8 +18,25 @@ var rootCmd = &cobra.Command{
 	Habits is a CLI tool to track activities over time, as well as recording ad-hoc thoughts
 	or notes. It supports a growing set of commands for both structured and unstructured
 	journaling.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		for c := cmd; c != nil; c = c.Parent() {
+			// cobra adds help and completion itself, so they can't be annotated
+			if c.Annotations[skipSyncAnnotation] == "true" || c.Name() == "help" || c.Name() == "completion" {
+				return
+			}
+		}
+		backgroundSync(cmd)
+	},
 }
 
+// skipSyncAnnotation marks a command that, along with its subcommands,
+// doesn't send queued entries before running: commands that don't act as
+// the logged in user, or that manage the server.
+const skipSyncAnnotation = "skip_sync"
+
+// skipSync annotates a command with skipSyncAnnotation.
+var skipSync = map[string]string{skipSyncAnnotation: "true"}
+
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
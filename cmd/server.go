@@ -1,12 +1,13 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/brk3/habits/internal/logger"
 	"github.com/brk3/habits/internal/server"
-	"github.com/brk3/habits/internal/storage/bolt"
+	"github.com/brk3/habits/internal/storage"
 	"github.com/spf13/cobra"
 )
 
@@ -14,13 +15,29 @@ var serverCmd = &cobra.Command{
 	Use:   "server",
 	Short: "Start the HTTP server",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		logger.Info("Opening DB...")
-		store, err := bolt.Open(cfg.DBPath)
+		logger.Info("Opening DB...", "driver", cfg.Storage.Driver)
+		store, err := openStore()
 		if err != nil {
 			return err
 		}
 		defer store.Close()
 
+		// encrypt tokens stored before encryption was set up or under a key
+		// that has since been rotated out
+		if e, ok := store.(storage.Encrypter); ok {
+			n, err := e.ReencryptSecrets()
+			if errors.Is(err, storage.ErrUndecryptable) {
+				return fmt.Errorf(`%w; add the missing keys to the encryption keys, `+
+					`or run "habits admin purge-undecryptable-tokens" to delete the tokens and make their users log in again`, err)
+			}
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				logger.Info("Re-encrypted stored secrets", "count", n)
+			}
+		}
+
 		s, err := server.New(cfg, store)
 		if err != nil {
 			return err
@@ -33,6 +50,7 @@ var serverCmd = &cobra.Command{
 			return http.ListenAndServe(addr, s.Router())
 		}
 	},
+	Annotations: skipSync,
 }
 
 func init() {
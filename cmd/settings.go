@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/brk3/habits/internal/apiclient"
+	"github.com/spf13/cobra"
+)
+
+var settingsCmd = &cobra.Command{
+	Use:   "settings",
+	Short: "Show or change your server-side settings",
+	Long: `The "settings" command shows your settings, or changes them when flags
+are given.
+
+For example:
+  habits settings --timezone America/Los_Angeles
+
+The timezone decides where your days start for streaks, summaries and
+nudges. It defaults to UTC.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		apiclient := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
+		settings, err := apiclient.GetSettings(cmd.Context())
+		if err != nil {
+			cmd.Printf("Error fetching settings: %v\n", err)
+			os.Exit(1)
+		}
+
+		if cmd.Flags().Changed("timezone") {
+			settings.Timezone, _ = cmd.Flags().GetString("timezone")
+			if err := apiclient.PutSettings(cmd.Context(), *settings); err != nil {
+				cmd.Printf("Error saving settings: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		tz := settings.Timezone
+		if tz == "" {
+			tz = "UTC (default)"
+		}
+		cmd.Printf("timezone: %s\n", tz)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(settingsCmd)
+	settingsCmd.Flags().String("timezone", "", `IANA timezone such as Europe/Dublin, or "" to reset to UTC`)
+}
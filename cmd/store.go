@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/brk3/habits/internal/storage"
+	"github.com/brk3/habits/internal/storage/bolt"
+	"github.com/brk3/habits/internal/storage/postgres"
+	"github.com/brk3/habits/internal/storage/sqlite"
+)
+
+// openStore opens the storage backend selected by storage.driver, set up to
+// encrypt secrets with the configured encryption keys.
+func openStore() (storage.Store, error) {
+	cipher, err := openCipher()
+	if err != nil {
+		return nil, err
+	}
+	var store storage.Store
+	switch cfg.Storage.Driver {
+	case "bolt":
+		store, err = bolt.Open(cfg.DBPath)
+	case "sqlite":
+		store, err = sqlite.Open(cfg.DBPath)
+	case "postgres":
+		store, err = postgres.Open(cfg.Storage.DSN, postgres.Options{
+			MaxOpenConns:    cfg.Storage.MaxOpenConns,
+			MaxIdleConns:    cfg.Storage.MaxIdleConns,
+			ConnMaxLifetime: cfg.Storage.ConnMaxLifetime,
+		})
+	default:
+		return nil, fmt.Errorf("unsupported storage driver: %s", cfg.Storage.Driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := store.(storage.Encrypter); ok {
+		e.SetCipher(cipher)
+	} else if cipher != nil {
+		store.Close()
+		return nil, fmt.Errorf("storage driver %s doesn't support encryption", cfg.Storage.Driver)
+	}
+	return store, nil
+}
+
+// openCipher builds the cipher for encryption.keys or encryption.key_file,
+// or nil when neither is set.
+func openCipher() (*storage.Cipher, error) {
+	keys, err := cfg.EncryptionKeys()
+	if err != nil {
+		return nil, err
+	}
+	cipherKeys := make([]storage.CipherKey, len(keys))
+	for i, k := range keys {
+		key, err := k.Decode()
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s: %w", k.ID, err)
+		}
+		cipherKeys[i] = storage.CipherKey{ID: k.ID, Key: key}
+	}
+	return storage.NewCipher(cipherKeys...)
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/brk3/habits/internal/apiclient"
+	"github.com/brk3/habits/internal/journal"
+	"github.com/brk3/habits/internal/logger"
+	"github.com/brk3/habits/pkg/habit"
+	"github.com/spf13/cobra"
+)
+
+// syncBatchSize is how many queued entries are sent per request.
+const syncBatchSize = 500
+
+// backgroundSyncTimeout bounds the sync attempted before other commands, so
+// a dead network doesn't hold them up for long.
+const backgroundSyncTimeout = 5 * time.Second
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Send entries queued while the server was unreachable",
+	Long: `When "habits track" can't reach the server it queues the entry in a local
+journal (journal_path in the config). The "sync" command sends the queued
+entries. Other commands also try a quick sync first, so running it by hand
+is only needed to see what happened.
+
+Entries the server rejects are set aside in a .rejected file next to the
+journal.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		j := journal.New(cfg.JournalPath)
+		if !j.Pending() {
+			cmd.Println("Nothing to sync")
+			return nil
+		}
+		res, err := syncJournal(cmd.Context(), j)
+		printSyncResult(cmd, j, res)
+		if err != nil {
+			return fmt.Errorf("sync stopped, %d entries still queued: %w", res.Remaining, err)
+		}
+		return nil
+	},
+	Annotations: skipSync,
+}
+
+// syncJournal replays queued entries through the batch endpoint. Each batch
+// is sent with an idempotency key derived from its records, so resending a
+// batch after a lost response doesn't store it twice. An entry that "habits
+// track" already tried to send is resent the same way, with the same key, so
+// the server recognises it if that attempt was stored.
+func syncJournal(ctx context.Context, j *journal.Journal) (journal.SyncResult, error) {
+	client := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
+	return j.Sync(ctx, syncBatchSize, func(ctx context.Context, batch []journal.Record) (map[int]string, error) {
+		if len(batch) == 1 && batch[0].PutKey != "" {
+			entry := batch[0].Entry
+			err := client.PutHabit(apiclient.WithIdempotencyKey(ctx, batch[0].PutKey), &entry)
+			if errors.Is(err, apiclient.ErrRejected) {
+				logger.Warn("Queued entry rejected", "habit_name", entry.Name, "error", err)
+				return map[int]string{0: err.Error()}, nil
+			}
+			return nil, err
+		}
+		h := sha256.New()
+		entries := make([]habit.Habit, len(batch))
+		for i, r := range batch {
+			h.Write([]byte(r.Key))
+			entries[i] = r.Entry
+		}
+		ctx = apiclient.WithIdempotencyKey(ctx, "sync-"+hex.EncodeToString(h.Sum(nil)))
+		resp, err := client.PutHabits(ctx, entries)
+		if err != nil {
+			return nil, err
+		}
+		rejected := map[int]string{}
+		for _, r := range resp.Results {
+			if r.Error != "" {
+				logger.Warn("Queued entry rejected", "habit_name", batch[r.Index].Entry.Name, "error", r.Error)
+				rejected[r.Index] = r.Error
+			}
+		}
+		return rejected, nil
+	})
+}
+
+func printSyncResult(cmd *cobra.Command, j *journal.Journal, res journal.SyncResult) {
+	if res.Sent > 0 {
+		cmd.Printf("Synced %d queued entries\n", res.Sent)
+	}
+	if res.Rejected > 0 {
+		cmd.Printf("%d queued entries were rejected, see %s\n", res.Rejected, j.RejectedPath())
+	}
+}
+
+// backgroundSync opportunistically sends queued entries before a command
+// runs. Failures are only logged; the entries stay queued.
+func backgroundSync(cmd *cobra.Command) {
+	if cfg == nil {
+		return
+	}
+	j := journal.New(cfg.JournalPath)
+	if !j.Pending() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(cmd.Context(), backgroundSyncTimeout)
+	defer cancel()
+	res, err := syncJournal(ctx, j)
+	if err != nil {
+		if errors.Is(err, apiclient.ErrUnavailable) || errors.Is(err, context.DeadlineExceeded) {
+			logger.Debug("Server unreachable, leaving entries queued", "remaining", res.Remaining, "error", err)
+		} else {
+			logger.Warn("Failed to sync queued entries", "remaining", res.Remaining, "error", err)
+		}
+	}
+	printSyncResult(cmd, j, res)
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+}
@@ -1,11 +1,15 @@
 package cmd
 
 import (
+	"errors"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/brk3/habits/internal/apiclient"
+	"github.com/brk3/habits/internal/journal"
 	"github.com/brk3/habits/pkg/habit"
 	"github.com/spf13/cobra"
 )
@@ -17,12 +21,31 @@ var trackCmd = &cobra.Command{
 
 For example:
   habits track guitar "10 mins of major scales"
+  habits track guitar 30m "scales"
+  habits track running 5km
+
+An optional quantity such as 30m, 1.5h or 5km records how much was done.
+Minutes and hours are stored as minutes.
 
 This will store the habit along with the current timestamp, or a custom Unix timestamp if provided.`,
-	Args: cobra.ExactArgs(2),
+	Args: cobra.RangeArgs(2, 3),
 	Run: func(cmd *cobra.Command, args []string) {
 		name := strings.TrimSpace(args[0])
-		note := strings.TrimSpace(args[1])
+		h := &habit.Habit{Name: name}
+
+		if len(args) == 3 {
+			value, unit, ok := parseQuantity(args[1])
+			if !ok {
+				cmd.Printf("Error: invalid quantity %q\n", args[1])
+				os.Exit(1)
+			}
+			h.Value, h.Unit = value, unit
+			h.Note = strings.TrimSpace(args[2])
+		} else if value, unit, ok := parseQuantity(args[1]); ok {
+			h.Value, h.Unit = value, unit
+		} else {
+			h.Note = strings.TrimSpace(args[1])
+		}
 
 		if name == "" {
 			cmd.Println("Error: habit name cannot be empty")
@@ -39,28 +62,64 @@ This will store the habit along with the current timestamp, or a custom Unix tim
 			cmd.Printf("Error: invalid timestamp: %v\n", err)
 			os.Exit(1)
 		}
-		track(name, note, timestamp, cmd)
+		h.TimeStamp = timestamp
+		track(h, cmd)
 	},
 }
 
-func track(name string, note string, timestamp int64, cmd *cobra.Command) {
-	ts := timestamp
-	if ts == 0 {
-		ts = time.Now().Unix()
+func track(h *habit.Habit, cmd *cobra.Command) {
+	if h.TimeStamp == 0 {
+		h.TimeStamp = time.Now().Unix()
 	}
 
-	h := &habit.Habit{
-		Name:      name,
-		Note:      note,
-		TimeStamp: ts,
+	client := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
+	key := apiclient.NewIdempotencyKey()
+	err := client.PutHabit(apiclient.WithIdempotencyKey(cmd.Context(), key), h)
+	if errors.Is(err, apiclient.ErrUnavailable) {
+		// keep the entry for "habits sync" rather than dropping it, with the
+		// key in case the server did store it
+		if err := journal.New(cfg.JournalPath).Append(*h, key, time.Now().Unix()); err != nil {
+			cmd.Printf("Error recording habit: server unreachable and failed to queue entry: %v\n", err)
+			return
+		}
+		cmd.Printf("Server unreachable, queued %s for the next sync\n", h.Name)
+		return
 	}
-	apiclient := apiclient.New(cfg.APIBaseURL, cfg.AuthToken)
-	err := apiclient.PutHabit(cmd.Context(), h)
 	if err != nil {
 		cmd.Printf("Error recording habit: %v\n", err)
 		return
 	}
-	cmd.Printf("Recorded habit: %s - %s\n", name, note)
+	if h.Value > 0 {
+		cmd.Printf("Recorded habit: %s - %s %s (%s)\n", h.Name, formatQuantity(h.Value, h.Unit), h.Note, h.ID)
+		return
+	}
+	cmd.Printf("Recorded habit: %s - %s (%s)\n", h.Name, h.Note, h.ID)
+}
+
+var quantityPattern = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*([a-zA-Z]*)$`)
+
+// parseQuantity parses amounts like "30", "30m", "1.5h" or "5km". Minutes
+// and hours are normalised to minutes so they can be summed.
+func parseQuantity(s string) (value float64, unit string, ok bool) {
+	m := quantityPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, "", false
+	}
+	value, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, "", false
+	}
+	switch unit = strings.ToLower(m[2]); unit {
+	case "m", "min", "mins", "minute", "minutes":
+		return value, "min", true
+	case "h", "hr", "hrs", "hour", "hours":
+		return value * 60, "min", true
+	}
+	return value, unit, true
+}
+
+func formatQuantity(value float64, unit string) string {
+	return strings.TrimSpace(strconv.FormatFloat(value, 'f', -1, 64) + " " + unit)
 }
 
 func init() {
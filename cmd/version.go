@@ -16,6 +16,7 @@ and server if available.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		version(cmd)
 	},
+	Annotations: skipSync,
 }
 
 func version(cmd *cobra.Command) {
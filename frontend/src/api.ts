@@ -5,9 +5,30 @@ export type HeatmapDatum = {
 };
 
 export type HabitEntry = {
+  id: string;
   name: string;
   note: string;
   timestamp: number;
+  value?: number;
+  unit?: string;
+};
+
+export type HabitSchedule = {
+  frequency: 'daily' | 'weekly' | 'monthly' | 'weekdays';
+  times?: number;
+  weekdays?: number[]; // 0 = Sunday
+};
+
+export type HabitDefinition = {
+  name: string;
+  display_name?: string;
+  description?: string;
+  color?: string;
+  icon?: string;
+  created_at: number;
+  archived: boolean;
+  schedule?: HabitSchedule;
+  target?: { amount: number; unit: string; period: 'day' | 'week' };
 };
 
 async function fetchHabit(habit: string): Promise<HeatmapDatum[]> {
@@ -46,6 +67,17 @@ async function fetchHabits(): Promise<string[]> {
   return data.habits;
 }
 
+async function fetchHabitDefinition(habit: string): Promise<HabitDefinition | null> {
+  const res = await fetch(`/api/habits/${habit}/definition`, { credentials: 'include' });
+  if (res.status === 404) {
+    return null;
+  }
+  if (!res.ok) {
+    throw new Error(`Failed to fetch definition for habit ${habit}: ${res.statusText}`);
+  }
+  return res.json();
+}
+
 async function fetchVersionInfo(): Promise<{ Version: string; BuildDate: string }> {
   const res = await fetch('/version');
   if (!res.ok) {
@@ -63,4 +95,4 @@ async function fetchHabitEntries(habit: string): Promise<HabitEntry[]> {
   return json.entries;
 }
 
-export { fetchHabit, fetchHabitSummary, fetchHabits, fetchVersionInfo, fetchHabitEntries };
+export { fetchHabit, fetchHabitSummary, fetchHabits, fetchHabitDefinition, fetchVersionInfo, fetchHabitEntries };
@@ -0,0 +1,67 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/brk3/habits/internal/server"
+)
+
+// ExportAccount fetches everything the server stores about the
+// authenticated user.
+func (c *APIClient) ExportAccount(ctx context.Context) (*server.AccountExport, error) {
+	url := c.BaseURL + "/account/export"
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+	req.Header.Add("Authorization", `Bearer `+c.AuthToken)
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("export account: %s", res.Status)
+	}
+	var out server.AccountExport
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteAccount deletes the authenticated user and all of their data.
+func (c *APIClient) DeleteAccount(ctx context.Context) error {
+	return c.noContentRequest(ctx, "DELETE", "/account", "delete account")
+}
+
+// ListIdentities lists the OIDC logins linked to the authenticated user.
+func (c *APIClient) ListIdentities(ctx context.Context) ([]server.IdentityInfo, error) {
+	url := c.BaseURL + "/auth/identities"
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+	req.Header.Add("Authorization", `Bearer `+c.AuthToken)
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("list logins: %s", res.Status)
+	}
+	var out server.IdentityListResponse
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return out.Identities, nil
+}
+
+// UnlinkIdentity removes a linked login from the authenticated user.
+func (c *APIClient) UnlinkIdentity(ctx context.Context, id string) error {
+	return c.noContentRequest(ctx, "DELETE", "/auth/identities/"+id, "unlink login")
+}
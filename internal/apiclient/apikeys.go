@@ -0,0 +1,86 @@
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/brk3/habits/internal/server"
+)
+
+// CreateAPIKey issues a new API key. The plaintext key is only ever
+// returned here.
+func (c *APIClient) CreateAPIKey(ctx context.Context, r server.APIKeyCreateRequest) (*server.APIKeyCreateResponse, error) {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal API key request: %w", err)
+	}
+	url := c.BaseURL + "/auth/api_keys"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+	req.Header.Add("Authorization", `Bearer `+c.AuthToken)
+	req.Header.Add("Content-Type", "application/json")
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		var out struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&out); err == nil && out.Error != "" {
+			return nil, fmt.Errorf("create API key: %s: %s", res.Status, out.Error)
+		}
+		return nil, fmt.Errorf("create API key: %s", res.Status)
+	}
+	var out server.APIKeyCreateResponse
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *APIClient) ListAPIKeys(ctx context.Context) ([]server.APIKeyInfo, error) {
+	url := c.BaseURL + "/auth/api_keys"
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+	req.Header.Add("Authorization", `Bearer `+c.AuthToken)
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("list API keys: %s", res.Status)
+	}
+	var out server.APIKeyListResponse
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return out.Keys, nil
+}
+
+func (c *APIClient) DeleteAPIKey(ctx context.Context, keyID string) error {
+	url := c.BaseURL + "/auth/api_keys/" + keyID
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+	req.Header.Add("Authorization", `Bearer `+c.AuthToken)
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("delete API key: %s", res.Status)
+	}
+	return nil
+}
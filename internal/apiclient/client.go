@@ -6,10 +6,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"iter"
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/brk3/habits/internal/logger"
 	"github.com/brk3/habits/internal/server"
+	"github.com/brk3/habits/internal/storage"
 	"github.com/brk3/habits/pkg/habit"
 )
 
@@ -54,6 +58,254 @@ func (c *APIClient) ListHabits(ctx context.Context) ([]string, error) {
 	return response.Habits, nil
 }
 
+// ListHabitDefinitions returns the definitions of the user's habits,
+// including archived ones when archived is true.
+func (c *APIClient) ListHabitDefinitions(ctx context.Context, archived bool) ([]habit.HabitDefinition, error) {
+	logger.Debug("Listing habit definitions via API", "base_url", c.BaseURL, "archived", archived)
+	url := c.BaseURL + "/habits"
+	if archived {
+		url += "?archived=true"
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+	req.Header.Add("Authorization", `Bearer `+c.AuthToken)
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		logger.Error("Failed to list habit definitions", "error", err)
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		logger.Warn("List habit definitions request failed", "status", res.Status)
+		return nil, fmt.Errorf("list habits: %s", res.Status)
+	}
+	var response server.HabitListResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		logger.Error("Failed to decode habits response", "error", err)
+		return nil, err
+	}
+	return response.Definitions, nil
+}
+
+// GetHabitDefinition fetches a habit's definition. It returns nil without an
+// error if the habit has none.
+func (c *APIClient) GetHabitDefinition(ctx context.Context, name string) (*habit.HabitDefinition, error) {
+	url := c.BaseURL + "/habits/" + name + "/definition"
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+	req.Header.Add("Authorization", `Bearer `+c.AuthToken)
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		logger.Error("Failed to get habit definition", "habit_name", name, "error", err)
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if res.StatusCode != 200 {
+		logger.Warn("Get habit definition request failed", "habit_name", name, "status", res.Status)
+		return nil, fmt.Errorf("get definition %s: %s", name, res.Status)
+	}
+	var out habit.HabitDefinition
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PutHabitDefinition creates or replaces a habit's definition and returns
+// the stored result.
+func (c *APIClient) PutHabitDefinition(ctx context.Context, d habit.HabitDefinition) (*habit.HabitDefinition, error) {
+	logger.Debug("Putting habit definition via API", "habit_name", d.Name, "base_url", c.BaseURL)
+	body, err := json.Marshal(d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal definition %s: %w", d.Name, err)
+	}
+	url := c.BaseURL + "/habits/" + d.Name + "/definition"
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+	req.Header.Add("Authorization", `Bearer `+c.AuthToken)
+	req.Header.Add("Content-Type", "application/json")
+
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		logger.Error("Failed to put habit definition", "habit_name", d.Name, "error", err)
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
+		logger.Warn("Put habit definition request failed", "habit_name", d.Name, "status", res.Status)
+		return nil, fmt.Errorf("put definition %s: %s", d.Name, res.Status)
+	}
+	var out habit.HabitDefinition
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *APIClient) GetSettings(ctx context.Context) (*habit.UserSettings, error) {
+	url := c.BaseURL + "/settings"
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+	req.Header.Add("Authorization", `Bearer `+c.AuthToken)
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		logger.Error("Failed to get settings", "error", err)
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("get settings: %s", res.Status)
+	}
+	var out habit.UserSettings
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *APIClient) PutSettings(ctx context.Context, settings habit.UserSettings) error {
+	body, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal settings: %w", err)
+	}
+	url := c.BaseURL + "/settings"
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+	req.Header.Add("Authorization", `Bearer `+c.AuthToken)
+	req.Header.Add("Content-Type", "application/json")
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		logger.Error("Failed to put settings", "error", err)
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("put settings: %s", res.Status)
+	}
+	return nil
+}
+
+// Backup streams a snapshot of the server's database to w. It needs an
+// admin's credentials.
+func (c *APIClient) Backup(ctx context.Context, w io.Writer) (int64, error) {
+	url := c.BaseURL + "/admin/backup"
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+	req.Header.Add("Authorization", `Bearer `+c.AuthToken)
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		logger.Error("Failed to download backup", "error", err)
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return 0, fmt.Errorf("backup: %s", res.Status)
+	}
+	return io.Copy(w, res.Body)
+}
+
+// Export downloads everything stored for the authenticated user.
+func (c *APIClient) Export(ctx context.Context) (*habit.Export, error) {
+	url := c.BaseURL + "/export"
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+	req.Header.Add("Authorization", `Bearer `+c.AuthToken)
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		logger.Error("Failed to export", "error", err)
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("export: %s", res.Status)
+	}
+	var out habit.Export
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Import merges an export into the authenticated user's account.
+func (c *APIClient) Import(ctx context.Context, export *habit.Export) (*server.ImportResponse, error) {
+	body, err := json.Marshal(export)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal export: %w", err)
+	}
+	url := c.BaseURL + "/import"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+	req.Header.Add("Authorization", `Bearer `+c.AuthToken)
+	req.Header.Add("Content-Type", "application/json")
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		logger.Error("Failed to import", "error", err)
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("import: %s: %s", res.Status, bytes.TrimSpace(msg))
+	}
+	var out server.ImportResponse
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ImportFile uploads a file exported by another tracker, which the server
+// converts with the importer adapter named by format. params holds the
+// adapter options (habit, columns, time_layout).
+func (c *APIClient) ImportFile(ctx context.Context, format string, params url.Values, body io.Reader) (*server.ImportResponse, error) {
+	q := url.Values{}
+	for k, v := range params {
+		q[k] = v
+	}
+	q.Set("format", format)
+	u := c.BaseURL + "/import?" + q.Encode()
+	req, err := http.NewRequestWithContext(ctx, "POST", u, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", u, err)
+	}
+	req.Header.Add("Authorization", `Bearer `+c.AuthToken)
+	req.Header.Add("Content-Type", "text/csv")
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		logger.Error("Failed to import file", "format", format, "error", err)
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("import: %s: %s", res.Status, bytes.TrimSpace(msg))
+	}
+	var out server.ImportResponse
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
 func (c *APIClient) GetHabitSummary(ctx context.Context, name string) (*habit.HabitSummary, error) {
 	url := c.BaseURL + "/habits/" + name + "/summary"
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
@@ -75,6 +327,10 @@ func (c *APIClient) GetHabitSummary(ctx context.Context, name string) (*habit.Ha
 	return &out, nil
 }
 
+// PutHabit records an entry, filling in the ID the server assigned. It sends
+// an Idempotency-Key and retries transient failures with it, so an entry is
+// never recorded twice. To resend the entry later, set the key with
+// WithIdempotencyKey and send it again with the same one.
 func (c *APIClient) PutHabit(ctx context.Context, h *habit.Habit) error {
 	logger.Debug("Putting habit via API", "habit_name", h.Name, "base_url", c.BaseURL)
 	habitJson, err := json.Marshal(h)
@@ -82,25 +338,189 @@ func (c *APIClient) PutHabit(ctx context.Context, h *habit.Habit) error {
 		logger.Error("Failed to marshal habit", "habit_name", h.Name, "error", err)
 		return fmt.Errorf("failed to marshal habit %s: %w", h.Name, err)
 	}
-	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+"/habits", nil)
+	res, err := c.doIdempotent(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+"/habits", bytes.NewReader(habitJson))
+		if err != nil {
+			logger.Error("Failed to create put habit request", "base_url", c.BaseURL, "error", err)
+			return nil, fmt.Errorf("failed to create request for %s/habits: %w", c.BaseURL, err)
+		}
+		req.Header.Add("Authorization", `Bearer `+c.AuthToken)
+		req.Header.Add("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		logger.Error("Failed to put habit", "habit_name", h.Name, "error", err)
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusBadRequest || res.StatusCode == http.StatusUnprocessableEntity {
+		logger.Warn("Put habit request rejected", "habit_name", h.Name, "status", res.Status)
+		return fmt.Errorf("put habit failed: %w: %s", ErrRejected, res.Status)
+	}
+	if res.StatusCode >= 400 {
+		logger.Warn("Put habit request failed", "habit_name", h.Name, "status", res.Status)
+		return fmt.Errorf("put habit failed: %s", res.Status)
+	}
+	// the server assigns the entry ID
+	if err := json.NewDecoder(res.Body).Decode(h); err != nil {
+		logger.Error("Failed to decode put habit response", "habit_name", h.Name, "error", err)
+		return err
+	}
+	logger.Debug("Put habit successful", "habit_name", h.Name, "habit_entry_id", h.ID)
+	return nil
+}
+
+// PutHabits stores entries in one request. Items the server rejects are
+// reported in the response rather than as an error; err is only set when
+// the request as a whole failed.
+func (c *APIClient) PutHabits(ctx context.Context, entries []habit.Habit) (*server.HabitBatchResponse, error) {
+	logger.Debug("Putting habit batch via API", "count", len(entries), "base_url", c.BaseURL)
+	body, err := json.Marshal(entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal habit batch: %w", err)
+	}
+	url := c.BaseURL + "/habits:batch"
+	res, err := c.doIdempotent(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request for %s: %w", url, err)
+		}
+		req.Header.Add("Authorization", `Bearer `+c.AuthToken)
+		req.Header.Add("Content-Type", "application/json")
+		return req, nil
+	})
 	if err != nil {
-		logger.Error("Failed to create put habit request", "base_url", c.BaseURL, "error", err)
-		return fmt.Errorf("failed to create request for %s/habits: %w", c.BaseURL, err)
+		logger.Error("Failed to put habit batch", "error", err)
+		return nil, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusCreated, http.StatusMultiStatus, http.StatusBadRequest:
+	default:
+		return nil, fmt.Errorf("put habit batch failed: %s", res.Status)
+	}
+	var out server.HabitBatchResponse
+	// a 400 without results means the request itself was malformed
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil || len(out.Results) == 0 {
+		return nil, fmt.Errorf("put habit batch failed: %s", res.Status)
+	}
+	return &out, nil
+}
+
+func (c *APIClient) UpdateHabitEntry(ctx context.Context, name, id string, update server.HabitEntryUpdateRequest) (*habit.Habit, error) {
+	logger.Debug("Updating habit entry via API", "habit_name", name, "habit_entry_id", id, "base_url", c.BaseURL)
+	body, err := json.Marshal(update)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal update for entry %s: %w", id, err)
+	}
+	url := c.BaseURL + "/habits/" + name + "/entries/" + id
+	req, err := http.NewRequestWithContext(ctx, "PATCH", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", url, err)
 	}
 	req.Header.Add("Authorization", `Bearer `+c.AuthToken)
 	req.Header.Add("Content-Type", "application/json")
-	req.Body = io.NopCloser(bytes.NewReader(habitJson))
 
 	res, err := c.HTTP.Do(req)
 	if err != nil {
-		logger.Error("Failed to put habit", "habit_name", h.Name, "error", err)
+		logger.Error("Failed to update habit entry", "habit_name", name, "habit_entry_id", id, "error", err)
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		logger.Warn("Update habit entry request failed", "habit_name", name, "habit_entry_id", id, "status", res.Status)
+		return nil, fmt.Errorf("update entry %s: %s", id, res.Status)
+	}
+	var out habit.Habit
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *APIClient) DeleteHabitEntry(ctx context.Context, name, id string) error {
+	logger.Debug("Deleting habit entry via API", "habit_name", name, "habit_entry_id", id, "base_url", c.BaseURL)
+	url := c.BaseURL + "/habits/" + name + "/entries/" + id
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+	req.Header.Add("Authorization", `Bearer `+c.AuthToken)
+
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		logger.Error("Failed to delete habit entry", "habit_name", name, "habit_entry_id", id, "error", err)
 		return err
 	}
 	defer res.Body.Close()
-	if res.StatusCode >= 400 {
-		logger.Warn("Put habit request failed", "habit_name", h.Name, "status", res.Status)
-		return fmt.Errorf("put habit failed: %s", res.Status)
+	if res.StatusCode != http.StatusNoContent {
+		logger.Warn("Delete habit entry request failed", "habit_name", name, "habit_entry_id", id, "status", res.Status)
+		return fmt.Errorf("delete entry %s: %s", id, res.Status)
 	}
-	logger.Debug("Put habit successful", "habit_name", h.Name)
 	return nil
 }
+
+// GetHabitEntries fetches a single page of entries for a habit.
+func (c *APIClient) GetHabitEntries(ctx context.Context, name string, q storage.EntryQuery) (*server.HabitGetResponse, error) {
+	params := url.Values{}
+	if q.From != 0 {
+		params.Set("from", strconv.FormatInt(q.From, 10))
+	}
+	if q.To != 0 {
+		params.Set("to", strconv.FormatInt(q.To, 10))
+	}
+	if q.Limit != 0 {
+		params.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Cursor != "" {
+		params.Set("cursor", q.Cursor)
+	}
+	u := c.BaseURL + "/habits/" + name
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", u, err)
+	}
+	req.Header.Add("Authorization", `Bearer `+c.AuthToken)
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		logger.Error("Failed to get habit entries", "habit_name", name, "error", err)
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		logger.Warn("Get habit entries request failed", "habit_name", name, "status", res.Status)
+		return nil, fmt.Errorf("get habit %s: %s", name, res.Status)
+	}
+	var out server.HabitGetResponse
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// HabitEntries iterates over all entries matching q, following next_cursor
+// until the server reports no more pages. q.Limit sets the page size.
+func (c *APIClient) HabitEntries(ctx context.Context, name string, q storage.EntryQuery) iter.Seq2[habit.Habit, error] {
+	return func(yield func(habit.Habit, error) bool) {
+		for {
+			page, err := c.GetHabitEntries(ctx, name, q)
+			if err != nil {
+				yield(habit.Habit{}, err)
+				return
+			}
+			for _, e := range page.Entries {
+				if !yield(e, nil) {
+					return
+				}
+			}
+			if page.NextCursor == "" {
+				return
+			}
+			q.Cursor = page.NextCursor
+		}
+	}
+}
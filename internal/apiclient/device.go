@@ -0,0 +1,82 @@
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/brk3/habits/internal/server"
+)
+
+// DeviceError is an RFC 8628 error code returned while polling for a device
+// token, such as authorization_pending or slow_down.
+type DeviceError struct {
+	Code string
+}
+
+func (e *DeviceError) Error() string {
+	return "device login: " + e.Code
+}
+
+// StartDeviceLogin asks the server for a device code for the user to
+// approve in a browser.
+func (c *APIClient) StartDeviceLogin(ctx context.Context) (*server.DeviceAuthResponse, error) {
+	url := c.BaseURL + "/auth/device"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("start device login: %s", res.Status)
+	}
+	var out server.DeviceAuthResponse
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeviceToken redeems an approved device code for an API key. Until the
+// user has approved it a *DeviceError is returned.
+func (c *APIClient) DeviceToken(ctx context.Context, deviceCode string) (string, error) {
+	body, err := json.Marshal(server.DeviceTokenRequest{DeviceCode: deviceCode})
+	if err != nil {
+		return "", err
+	}
+	url := c.BaseURL + "/auth/device/token"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		var out server.DeviceTokenResponse
+		if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+			return "", err
+		}
+		return out.APIKey, nil
+	case http.StatusBadRequest:
+		var out struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&out); err != nil || out.Error == "" {
+			return "", fmt.Errorf("device token: %s", res.Status)
+		}
+		return "", &DeviceError{Code: out.Error}
+	default:
+		return "", fmt.Errorf("device token: %s", res.Status)
+	}
+}
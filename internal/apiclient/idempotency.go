@@ -0,0 +1,78 @@
+package apiclient
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/brk3/habits/internal/logger"
+)
+
+// maxAttempts is how many times a request with an Idempotency-Key is tried.
+// Retries reuse the key, so the server creates the entry at most once.
+const maxAttempts = 3
+
+// ErrUnavailable is returned by writes that failed because the server
+// couldn't be reached or kept failing, as opposed to rejecting the request.
+var ErrUnavailable = errors.New("server unavailable")
+
+// ErrRejected is returned by writes the server refused as invalid, which
+// fail the same way however often they are retried.
+var ErrRejected = errors.New("server rejected the request")
+
+type idempotencyKeyCtx struct{}
+
+// WithIdempotencyKey makes writes made with ctx use key instead of a fresh
+// random one, for callers that retry across processes, such as a journal of
+// unsent entries.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+// NewIdempotencyKey returns a fresh key for WithIdempotencyKey.
+func NewIdempotencyKey() string {
+	return rand.Text()
+}
+
+// doIdempotent sends the request built by newReq with an Idempotency-Key,
+// retrying on network errors, 5xx responses and 409 (the first attempt is
+// still being handled). Giving up on those is reported as ErrUnavailable.
+func (c *APIClient) doIdempotent(ctx context.Context, newReq func() (*http.Request, error)) (*http.Response, error) {
+	key, _ := ctx.Value(idempotencyKeyCtx{}).(string)
+	if key == "" {
+		key = NewIdempotencyKey()
+	}
+	backoff := 250 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		req, err := newReq()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Idempotency-Key", key)
+		res, err := c.HTTP.Do(req)
+		retry := err != nil || res.StatusCode >= 500 || res.StatusCode == http.StatusConflict
+		if !retry {
+			return res, nil
+		}
+		if attempt == maxAttempts {
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+			}
+			res.Body.Close()
+			return nil, fmt.Errorf("%w: %s", ErrUnavailable, res.Status)
+		}
+		if res != nil {
+			res.Body.Close()
+		}
+		logger.Debug("Retrying request", "url", req.URL.String(), "attempt", attempt, "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,89 @@
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/brk3/habits/internal/server"
+)
+
+// ListUsers lists every user for admins.
+func (c *APIClient) ListUsers(ctx context.Context) ([]server.AdminUserInfo, error) {
+	url := c.BaseURL + "/admin/users"
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+	req.Header.Add("Authorization", `Bearer `+c.AuthToken)
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("list users: %s", res.Status)
+	}
+	var out server.AdminUserListResponse
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return out.Users, nil
+}
+
+// SetUserDisabled disables or re-enables a user.
+func (c *APIClient) SetUserDisabled(ctx context.Context, userID string, disabled bool) error {
+	action := "enable"
+	if disabled {
+		action = "disable"
+	}
+	return c.noContentRequest(ctx, "POST", "/admin/users/"+userID+"/"+action, action+" user")
+}
+
+// DeleteUser deletes all of a user's data.
+func (c *APIClient) DeleteUser(ctx context.Context, userID string) error {
+	return c.noContentRequest(ctx, "DELETE", "/admin/users/"+userID, "delete user")
+}
+
+// MergeUser moves everything of a user into another.
+func (c *APIClient) MergeUser(ctx context.Context, userID, into string) error {
+	body, err := json.Marshal(server.AdminMergeRequest{Into: into})
+	if err != nil {
+		return fmt.Errorf("failed to marshal merge request: %w", err)
+	}
+	return c.noContentRequestBody(ctx, "POST", "/admin/users/"+userID+"/merge", "merge user", bytes.NewReader(body))
+}
+
+func (c *APIClient) noContentRequest(ctx context.Context, method, path, what string) error {
+	return c.noContentRequestBody(ctx, method, path, what, nil)
+}
+
+func (c *APIClient) noContentRequestBody(ctx context.Context, method, path, what string, body io.Reader) error {
+	url := c.BaseURL + path
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Add("Authorization", `Bearer `+c.AuthToken)
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		var out struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&out); err == nil && out.Error != "" {
+			return fmt.Errorf("%s: %s: %s", what, res.Status, out.Error)
+		}
+		return fmt.Errorf("%s: %s", what, res.Status)
+	}
+	return nil
+}
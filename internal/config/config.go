@@ -1,13 +1,17 @@
 package config
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"go.yaml.in/yaml/v4"
 
@@ -29,17 +33,35 @@ type OIDCProviderConfig struct {
 	logoutRedirectURL *url.URL `yaml:"-"`
 }
 
+// LocalProviderID is the provider ID of sessions from the local_auth
+// login, which no OIDC provider may use.
+const LocalProviderID = "local"
+
 type Config struct {
 	AuthEnabled bool   `yaml:"auth_enabled"`
 	AuthToken   string `yaml:"auth_token"`
 	DBPath      string `yaml:"db_path"`
 	APIBaseURL  string `yaml:"api_base_url"`
 	LogLevel    string `yaml:"log_level"`
+	// JournalPath is where the CLI queues entries it couldn't send.
+	JournalPath string `yaml:"journal_path"`
+
+	Storage struct {
+		Driver string `yaml:"driver"`
+		// DSN is the connection string for the postgres driver.
+		DSN             string        `yaml:"dsn"`
+		MaxOpenConns    int           `yaml:"max_open_conns"`
+		MaxIdleConns    int           `yaml:"max_idle_conns"`
+		ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	} `yaml:"storage"`
 
 	Server struct {
 		Host string `yaml:"host"`
 		Port int    `yaml:"port"`
-		TLS  struct {
+		// IdempotencyWindow is how long responses to requests with an
+		// Idempotency-Key are kept for replay. Negative disables it.
+		IdempotencyWindow time.Duration `yaml:"idempotency_window"`
+		TLS               struct {
 			Enabled  bool   `yaml:"enabled"`
 			CertFile string `yaml:"cert_file"`
 			KeyFile  string `yaml:"key_file"`
@@ -48,6 +70,41 @@ type Config struct {
 
 	OIDCProviders []OIDCProviderConfig `yaml:"oidc_providers"`
 
+	// LocalAuth enables the built-in username and password login, for
+	// installs without an OIDC provider. Accounts are created with
+	// "habits admin user add".
+	LocalAuth struct {
+		Enabled bool `yaml:"enabled"`
+	} `yaml:"local_auth"`
+
+	// Session holds the keys for the session cookie, so sessions survive
+	// restarts and are shared between replicas. Without any, keys are
+	// generated at startup.
+	Session struct {
+		// Keys are tried in order; the first signs new cookies.
+		Keys    []SessionKey `yaml:"keys"`
+		KeyFile string       `yaml:"key_file"`
+	} `yaml:"session"`
+
+	// Encryption holds the master keys that encrypt refresh tokens at
+	// rest. Without any, they are stored as given.
+	Encryption struct {
+		// Keys are tried in order; the first encrypts new secrets.
+		Keys    []EncryptionKey `yaml:"keys"`
+		KeyFile string          `yaml:"key_file"`
+	} `yaml:"encryption"`
+
+	Admin struct {
+		// Users lists the user IDs allowed to call the /admin endpoints
+		// when auth is enabled.
+		Users []string `yaml:"users"`
+		// Claim and ClaimValue also make admins of users whose ID token
+		// has the claim set to, or as a list containing, the value, such
+		// as groups: habits-admins.
+		Claim      string `yaml:"claim"`
+		ClaimValue string `yaml:"claim_value"`
+	} `yaml:"admin"`
+
 	Nudge struct {
 		NotifyEmail    string `yaml:"notify_email"`
 		ResendAPIKey   string `yaml:"resend_api_key"`
@@ -57,11 +114,16 @@ type Config struct {
 	SLogLevel slog.Level `yaml:"-"`
 }
 
-func Load() (*Config, error) {
-	path := os.Getenv("HABITS_CONFIG")
-	if path == "" {
-		path = "config.yaml"
+// Path is the config file in use: $HABITS_CONFIG, or config.yaml.
+func Path() string {
+	if path := os.Getenv("HABITS_CONFIG"); path != "" {
+		return path
 	}
+	return "config.yaml"
+}
+
+func Load() (*Config, error) {
+	path := Path()
 
 	b, err := os.ReadFile(path)
 	if err != nil {
@@ -89,18 +151,27 @@ func (c *Config) applyDefaults() {
 	if c.DBPath == "" {
 		c.DBPath = "habits.db"
 	}
+	if c.Storage.Driver == "" {
+		c.Storage.Driver = "bolt"
+	}
 	if c.Server.Host == "" {
 		c.Server.Host = "0.0.0.0"
 	}
 	if c.Server.Port == 0 {
 		c.Server.Port = 3000
 	}
+	if c.Server.IdempotencyWindow == 0 {
+		c.Server.IdempotencyWindow = 24 * time.Hour
+	}
 	if c.APIBaseURL == "" {
 		c.APIBaseURL = "http://localhost:3000"
 	}
 	if c.AuthToken == "" {
 		c.AuthToken = "XXX"
 	}
+	if c.JournalPath == "" {
+		c.JournalPath = defaultJournalPath()
+	}
 	if c.LogLevel == "" {
 		c.LogLevel = "debug"
 	}
@@ -133,6 +204,13 @@ func (c *Config) finalize() error {
 		return fmt.Errorf("invalid log_level: %s", c.LogLevel)
 	}
 
+	c.Storage.Driver = strings.ToLower(c.Storage.Driver)
+	switch c.Storage.Driver {
+	case "bolt", "sqlite", "postgres":
+	default:
+		return fmt.Errorf("invalid storage.driver: %s", c.Storage.Driver)
+	}
+
 	if c.DBPath != "" {
 		if c.DBPath, err = resolvePath(c.DBPath); err != nil {
 			return fmt.Errorf("file does not exist > db_path: %w", err)
@@ -150,6 +228,18 @@ func (c *Config) finalize() error {
 		}
 	}
 
+	if c.Session.KeyFile != "" {
+		if c.Session.KeyFile, err = resolvePath(c.Session.KeyFile); err != nil {
+			return fmt.Errorf("file does not exist > session.key_file: %w", err)
+		}
+	}
+
+	if c.Encryption.KeyFile != "" {
+		if c.Encryption.KeyFile, err = resolvePath(c.Encryption.KeyFile); err != nil {
+			return fmt.Errorf("file does not exist > encryption.key_file: %w", err)
+		}
+	}
+
 	for i := range c.OIDCProviders {
 		provider := &c.OIDCProviders[i]
 		name := provider.Name
@@ -160,6 +250,9 @@ func (c *Config) finalize() error {
 		if provider.Id == "" {
 			return fmt.Errorf("oidc_providers[%d] (%s): id is required", i, name)
 		}
+		if provider.Id == LocalProviderID {
+			return fmt.Errorf("oidc_providers[%d] (%s): id %q is reserved for local_auth", i, name, LocalProviderID)
+		}
 
 		provider.issuerURL, err = url.Parse(provider.IssuerURL)
 		if err != nil {
@@ -221,8 +314,32 @@ func (c *Config) validate() error {
 
 	}
 
-	if len(c.OIDCProviders) == 0 && c.AuthEnabled {
-		return errors.New("authentication was enabled, but no OIDC Providers were configured")
+	if c.Storage.Driver == "postgres" && c.Storage.DSN == "" {
+		return errors.New("storage.driver is postgres but storage.dsn is missing")
+	}
+
+	if (c.Admin.Claim == "") != (c.Admin.ClaimValue == "") {
+		return errors.New("admin.claim and admin.claim_value must be set together")
+	}
+
+	if len(c.Session.Keys) > 0 && c.Session.KeyFile != "" {
+		return errors.New("session.keys and session.key_file can't both be set")
+	}
+	for i, k := range c.Session.Keys {
+		if _, _, err := k.Decode(); err != nil {
+			return fmt.Errorf("session.keys[%d]: %w", i, err)
+		}
+	}
+
+	if len(c.Encryption.Keys) > 0 && c.Encryption.KeyFile != "" {
+		return errors.New("encryption.keys and encryption.key_file can't both be set")
+	}
+	if err := checkEncryptionKeys(c.Encryption.Keys); err != nil {
+		return fmt.Errorf("encryption.keys: %w", err)
+	}
+
+	if len(c.OIDCProviders) == 0 && !c.LocalAuth.Enabled && c.AuthEnabled {
+		return errors.New("authentication was enabled, but no OIDC Providers were configured and local_auth is disabled")
 	}
 
 	if len(c.OIDCProviders) > 0 && !c.AuthEnabled {
@@ -246,6 +363,9 @@ func (c *Config) validate() error {
 		if provider.Id == "" {
 			return fmt.Errorf("oidc_providers[%d] (%s): id is required", i, name)
 		}
+		if provider.Id == LocalProviderID {
+			return fmt.Errorf("oidc_providers[%d] (%s): id %q is reserved for local_auth", i, name, LocalProviderID)
+		}
 
 		if provider.IssuerURL == "" {
 			return fmt.Errorf("oidc_providers[%d] (%q): issuer_url is required", i, name)
@@ -266,6 +386,67 @@ func (c *Config) validate() error {
 	return nil
 }
 
+func defaultJournalPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "habits-journal.jsonl"
+	}
+	return filepath.Join(dir, "habits", "journal.jsonl")
+}
+
+// Set writes top-level keys into the config file at path, keeping the rest
+// of the file, comments included. The file is created if it doesn't exist.
+// It is written with 0600 permissions as it may now hold a credential.
+func Set(path string, values map[string]string) error {
+	var doc yaml.Node
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error reading config: %w", err)
+	}
+	if len(b) > 0 {
+		if err := yaml.Unmarshal(b, &doc); err != nil {
+			return fmt.Errorf("error parsing config: %w", err)
+		}
+	}
+	if doc.Kind == 0 || len(doc.Content) == 0 {
+		// a missing file, or one with only comments
+		doc = yaml.Node{Kind: yaml.DocumentNode, HeadComment: doc.HeadComment,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return errors.New("error updating config: top level is not a mapping")
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: values[key]}
+		found := false
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if root.Content[i].Value == key {
+				value.LineComment = root.Content[i+1].LineComment
+				root.Content[i+1] = value
+				found = true
+				break
+			}
+		}
+		if !found {
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+		}
+	}
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return fmt.Errorf("error encoding config: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, out.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("error writing config: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
 // you give path, i give _real_ path
 func resolvePath(p string) (string, error) {
 	if p == "" {
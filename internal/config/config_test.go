@@ -3,7 +3,9 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"go.yaml.in/yaml/v4"
 )
@@ -45,3 +47,209 @@ func TestLoad_CustomConfig(t *testing.T) {
 		t.Errorf("expected default server host 0.0.0.0, got %s", cfg.Server.Host)
 	}
 }
+
+func TestLoad_StorageDriver(t *testing.T) {
+	tmpDir := t.TempDir()
+	configFile := filepath.Join(tmpDir, "config.yaml")
+	t.Setenv("HABITS_CONFIG", configFile)
+
+	if err := os.WriteFile(configFile, []byte("storage:\n  driver: SQLite\n"), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal("error opening config:", err)
+	}
+	if cfg.Storage.Driver != "sqlite" {
+		t.Errorf("expected storage driver sqlite, got %s", cfg.Storage.Driver)
+	}
+
+	pg := "storage:\n  driver: postgres\n  dsn: postgres://localhost/habits\n  conn_max_lifetime: 5m\n"
+	if err := os.WriteFile(configFile, []byte(pg), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	cfg, err = Load()
+	if err != nil {
+		t.Fatal("error opening config:", err)
+	}
+	if cfg.Storage.ConnMaxLifetime != 5*time.Minute {
+		t.Errorf("expected conn_max_lifetime 5m, got %s", cfg.Storage.ConnMaxLifetime)
+	}
+
+	if err := os.WriteFile(configFile, []byte("storage:\n  driver: postgres\n"), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for postgres without dsn, got nil")
+	}
+
+	if err := os.WriteFile(configFile, []byte("storage:\n  driver: mysql\n"), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for unsupported storage driver, got nil")
+	}
+}
+
+func TestSet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	orig := "# my habits\nauth_token: \"XXX\" # old\nlog_level: info\n\nserver:\n  port: 1234\n"
+	if err := os.WriteFile(path, []byte(orig), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	err := Set(path, map[string]string{"auth_token": "hab_live_abc", "api_base_url": "https://habits.example.com"})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	t.Setenv("HABITS_CONFIG", path)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("error opening config: %v", err)
+	}
+	if cfg.AuthToken != "hab_live_abc" || cfg.APIBaseURL != "https://habits.example.com" || cfg.Server.Port != 1234 {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+
+	b, _ := os.ReadFile(path)
+	if !strings.Contains(string(b), "# my habits") {
+		t.Fatalf("comments were dropped:\n%s", b)
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0o600 {
+		t.Fatalf("got mode %v, want 0600", fi.Mode().Perm())
+	}
+
+	// a new file is created
+	fresh := filepath.Join(t.TempDir(), "new.yaml")
+	if err := Set(fresh, map[string]string{"auth_token": "hab_live_abc"}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if b, _ := os.ReadFile(fresh); string(b) != "auth_token: hab_live_abc\n" {
+		t.Fatalf("unexpected new config %q", b)
+	}
+}
+
+func TestSessionKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session-keys.yaml")
+	keys := []SessionKey{NewSessionKey(), NewSessionKey()}
+	if err := WriteSessionKeyFile(path, keys); err != nil {
+		t.Fatalf("WriteSessionKeyFile failed: %v", err)
+	}
+
+	c := Config{}
+	c.Session.KeyFile = path
+	got, err := c.SessionKeys()
+	if err != nil {
+		t.Fatalf("SessionKeys failed: %v", err)
+	}
+	if len(got) != 2 || got[0] != keys[0] || got[1] != keys[1] {
+		t.Fatalf("got keys %v, want %v", got, keys)
+	}
+
+	if err := os.Chmod(path, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SessionKeys(); err == nil || !strings.Contains(err.Error(), "permissive") {
+		t.Fatalf("expected a permissions error, got %v", err)
+	}
+}
+
+func TestLoad_SessionKeys(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	t.Setenv("HABITS_CONFIG", configFile)
+
+	for _, tc := range []struct {
+		name, yaml, wantErr string
+	}{
+		{"valid", "session:\n  keys:\n    - hash_key: " + NewSessionKey().HashKey + "\n      block_key: " + NewSessionKey().BlockKey + "\n", ""},
+		{"short block key", "session:\n  keys:\n    - hash_key: " + NewSessionKey().HashKey + "\n      block_key: c2hvcnQ=\n", "block_key"},
+		{"both", "session:\n  key_file: keys.yaml\n  keys:\n    - hash_key: " + NewSessionKey().HashKey + "\n      block_key: " + NewSessionKey().BlockKey + "\n", "both"},
+	} {
+		if err := os.WriteFile(configFile, []byte(tc.yaml), 0644); err != nil {
+			t.Fatalf("failed to write config file: %v", err)
+		}
+		_, err := Load()
+		if tc.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		}
+		if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+			t.Errorf("%s: got error %v, want one mentioning %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestLoad_EncryptionKeys(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	t.Setenv("HABITS_CONFIG", configFile)
+
+	key := NewEncryptionKey()
+	for _, tc := range []struct {
+		name, yaml, wantErr string
+	}{
+		{"valid", "encryption:\n  keys:\n    - id: " + key.ID + "\n      key: " + key.Key + "\n", ""},
+		{"short key", "encryption:\n  keys:\n    - id: old\n      key: c2hvcnQ=\n", "32 bytes"},
+		{"bad id", "encryption:\n  keys:\n    - id: a:b\n      key: " + key.Key + "\n", "must not contain"},
+		{"duplicate id", "encryption:\n  keys:\n    - id: a\n      key: " + key.Key + "\n    - id: a\n      key: " + key.Key + "\n", "duplicate"},
+		{"both", "encryption:\n  key_file: keys.yaml\n  keys:\n    - id: " + key.ID + "\n      key: " + key.Key + "\n", "both"},
+	} {
+		if err := os.WriteFile(configFile, []byte(tc.yaml), 0644); err != nil {
+			t.Fatalf("failed to write config file: %v", err)
+		}
+		_, err := Load()
+		if tc.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		}
+		if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+			t.Errorf("%s: got error %v, want one mentioning %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestEncryptionKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "encryption-keys.yaml")
+	keys := []EncryptionKey{NewEncryptionKey(), NewEncryptionKey()}
+	if err := WriteEncryptionKeyFile(path, keys); err != nil {
+		t.Fatalf("WriteEncryptionKeyFile failed: %v", err)
+	}
+
+	c := Config{}
+	c.Encryption.KeyFile = path
+	got, err := c.EncryptionKeys()
+	if err != nil {
+		t.Fatalf("EncryptionKeys failed: %v", err)
+	}
+	if len(got) != 2 || got[0] != keys[0] || got[1] != keys[1] {
+		t.Fatalf("got keys %v, want %v", got, keys)
+	}
+
+	if err := os.Chmod(path, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.EncryptionKeys(); err == nil || !strings.Contains(err.Error(), "permissive") {
+		t.Fatalf("expected a permissions error, got %v", err)
+	}
+}
+
+func TestLoad_LocalAuth(t *testing.T) {
+	tmpDir := t.TempDir()
+	configFile := filepath.Join(tmpDir, "config.yaml")
+	t.Setenv("HABITS_CONFIG", configFile)
+
+	if err := os.WriteFile(configFile, []byte("auth_enabled: true\n"), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for auth without any way to log in")
+	}
+
+	if err := os.WriteFile(configFile, []byte("auth_enabled: true\nlocal_auth:\n  enabled: true\n"), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal("error opening config:", err)
+	}
+	if !cfg.LocalAuth.Enabled {
+		t.Error("expected local_auth to be enabled")
+	}
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EncryptionKey is a base64 encoded master key for encrypting secrets such
+// as refresh tokens at rest. ID is stored with everything the key encrypts,
+// so it must stay the same for as long as the key is kept.
+type EncryptionKey struct {
+	ID  string `yaml:"id"`
+	Key string `yaml:"key"`
+	// Staged marks a key added by "habits admin rotate-encryption-keys
+	// --stage", which decrypts but doesn't encrypt until it's promoted.
+	Staged bool `yaml:"staged,omitempty"`
+}
+
+// NewEncryptionKey generates a random key, with an ID from the current date
+// and a random suffix.
+func NewEncryptionKey() EncryptionKey {
+	key := make([]byte, 32)
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(key)
+	_, _ = rand.Read(suffix)
+	return EncryptionKey{
+		ID:  time.Now().UTC().Format("20060102") + "-" + hex.EncodeToString(suffix),
+		Key: base64.StdEncoding.EncodeToString(key),
+	}
+}
+
+// Decode returns the raw key, checking it is a 32 byte AES-256 key and
+// that the ID can be stored with encrypted values.
+func (k EncryptionKey) Decode() ([]byte, error) {
+	if k.ID == "" {
+		return nil, errors.New("id is required")
+	}
+	if strings.Contains(k.ID, ":") {
+		return nil, fmt.Errorf("id %q must not contain ':'", k.ID)
+	}
+	key, err := base64.StdEncoding.DecodeString(k.Key)
+	if err != nil {
+		return nil, fmt.Errorf("key is not valid base64: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// EncryptionKeys returns the configured encryption keys, the one in use
+// first, from encryption.keys or encryption.key_file. It returns none when
+// neither is set.
+func (c *Config) EncryptionKeys() ([]EncryptionKey, error) {
+	keys, err := configuredKeys(c.Encryption.Keys, "encryption.key_file", c.Encryption.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkEncryptionKeys(keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func checkEncryptionKeys(keys []EncryptionKey) error {
+	seen := map[string]bool{}
+	for i, k := range keys {
+		if _, err := k.Decode(); err != nil {
+			return fmt.Errorf("encryption key %d: %w", i, err)
+		}
+		if seen[k.ID] {
+			return fmt.Errorf("encryption key %d: duplicate id %q", i, k.ID)
+		}
+		seen[k.ID] = true
+	}
+	return nil
+}
+
+// ReadEncryptionKeyFile reads the keys kept in an encryption key file, the
+// one in use first. The file must not be readable by other users.
+func ReadEncryptionKeyFile(path string) ([]EncryptionKey, error) {
+	return readKeyFile[EncryptionKey]("encryption.key_file", path)
+}
+
+// WriteEncryptionKeyFile replaces the keys in an encryption key file,
+// atomically and with 0600 permissions.
+func WriteEncryptionKeyFile(path string, keys []EncryptionKey) error {
+	return writeKeyFile(path, "encryption key", "# Encryption keys. The first encrypts new secrets; the rest are only used\n# to read them, whether encrypted before a rotation or with a staged key.\n", keys)
+}
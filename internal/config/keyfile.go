@@ -0,0 +1,69 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// keyFile is the layout of session.key_file and encryption.key_file, which
+// "habits admin" rotates keys in.
+type keyFile[K any] struct {
+	Keys []K `yaml:"keys"`
+}
+
+// configuredKeys returns keys, or those kept in the key file at path when
+// it is set. setting names the file in errors.
+func configuredKeys[K any](keys []K, setting, path string) ([]K, error) {
+	if path == "" {
+		return keys, nil
+	}
+	keys, err := readKeyFile[K](setting, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s %s holds no keys", setting, path)
+	}
+	return keys, nil
+}
+
+// readKeyFile reads the keys kept in a key file. The file must not be
+// readable by other users.
+func readKeyFile[K any](setting, path string) ([]K, error) {
+	fi, err := fileStat(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", setting, err)
+	}
+	if mode := fi.Mode().Perm(); mode&0o077 != 0 {
+		return nil, fmt.Errorf("%s: %s permissions too permissive (%#o); expected 0600", setting, path, mode)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", setting, err)
+	}
+	var f keyFile[K]
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", setting, err)
+	}
+	return f.Keys, nil
+}
+
+// writeKeyFile replaces the keys in a key file, atomically and with 0600
+// permissions, below header. what names the keys in errors.
+func writeKeyFile[K any](path, what, header string, keys []K) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("refusing to write a %s file without keys", what)
+	}
+	b, err := yaml.Marshal(keyFile[K]{Keys: keys})
+	if err != nil {
+		return fmt.Errorf("error encoding %ss: %w", what, err)
+	}
+	b = append([]byte(header), b...)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("error writing %ss: %w", what, err)
+	}
+	return os.Rename(tmp, path)
+}
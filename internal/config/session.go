@@ -0,0 +1,77 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+)
+
+// SessionKey is one pair of base64 encoded keys for the session cookie. The
+// hash key signs the cookie and the block key encrypts it with AES.
+type SessionKey struct {
+	HashKey  string `yaml:"hash_key"`
+	BlockKey string `yaml:"block_key"`
+	// Staged marks a key added by "habits admin rotate-session-keys
+	// --stage", which is accepted but doesn't sign until it's promoted.
+	Staged bool `yaml:"staged,omitempty"`
+}
+
+// NewSessionKey generates a random key pair.
+func NewSessionKey() SessionKey {
+	hashKey := make([]byte, 64)
+	blockKey := make([]byte, 32)
+	_, _ = rand.Read(hashKey)
+	_, _ = rand.Read(blockKey)
+	return SessionKey{
+		HashKey:  base64.StdEncoding.EncodeToString(hashKey),
+		BlockKey: base64.StdEncoding.EncodeToString(blockKey),
+	}
+}
+
+// Decode returns the raw keys, checking they are long enough to be safe
+// and that the block key is a valid AES key size.
+func (k SessionKey) Decode() (hashKey, blockKey []byte, err error) {
+	if hashKey, err = base64.StdEncoding.DecodeString(k.HashKey); err != nil {
+		return nil, nil, fmt.Errorf("hash_key is not valid base64: %w", err)
+	}
+	if len(hashKey) < 32 {
+		return nil, nil, fmt.Errorf("hash_key must be at least 32 bytes, got %d", len(hashKey))
+	}
+	if blockKey, err = base64.StdEncoding.DecodeString(k.BlockKey); err != nil {
+		return nil, nil, fmt.Errorf("block_key is not valid base64: %w", err)
+	}
+	switch len(blockKey) {
+	case 16, 24, 32:
+	default:
+		return nil, nil, fmt.Errorf("block_key must be 16, 24 or 32 bytes, got %d", len(blockKey))
+	}
+	return hashKey, blockKey, nil
+}
+
+// SessionKeys returns the configured session keys, the one in use first,
+// from session.keys or session.key_file. It returns none when neither is
+// set.
+func (c *Config) SessionKeys() ([]SessionKey, error) {
+	keys, err := configuredKeys(c.Session.Keys, "session.key_file", c.Session.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	for i, k := range keys {
+		if _, _, err := k.Decode(); err != nil {
+			return nil, fmt.Errorf("session key %d: %w", i, err)
+		}
+	}
+	return keys, nil
+}
+
+// ReadSessionKeyFile reads the keys kept in a session key file, the one in
+// use first. The file must not be readable by other users.
+func ReadSessionKeyFile(path string) ([]SessionKey, error) {
+	return readKeyFile[SessionKey]("session.key_file", path)
+}
+
+// WriteSessionKeyFile replaces the keys in a session key file, atomically
+// and with 0600 permissions.
+func WriteSessionKeyFile(path string, keys []SessionKey) error {
+	return writeKeyFile(path, "session key", "# Session cookie keys. The first signs new cookies; the rest are only\n# used to read them, whether signed before a rotation or with a staged key.\n", keys)
+}
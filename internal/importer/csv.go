@@ -0,0 +1,161 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brk3/habits/pkg/habit"
+)
+
+// columnFields are the entry fields a CSV column can be mapped to.
+var columnFields = []string{"name", "timestamp", "note", "value", "unit"}
+
+// defaultColumns is used when Options.Columns is empty, matching a file with
+// a header like "name,timestamp,note,value,unit".
+var defaultColumns = map[string]string{
+	"name":      "name",
+	"timestamp": "timestamp",
+	"note":      "note",
+	"value":     "value",
+	"unit":      "unit",
+}
+
+// timeLayouts are tried in order when Options.TimeLayout is empty.
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// CSV reads a file with a header row, one entry per row. Options.Columns
+// says which header holds each field; only timestamp is required, and the
+// name column may be replaced by Options.Habit. Rows are skipped when their
+// value column is present but zero.
+func CSV(r io.Reader, opts Options) ([]habit.Habit, error) {
+	columns := opts.Columns
+	if len(columns) == 0 {
+		columns = defaultColumns
+	}
+	for field := range columns {
+		if !slices.Contains(columnFields, field) {
+			return nil, fmt.Errorf("unknown column field %q, want one of %s", field, strings.Join(columnFields, ", "))
+		}
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("empty file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	index := map[string]int{}
+	for field, name := range columns {
+		i := indexOf(header, name)
+		if i < 0 {
+			if len(opts.Columns) == 0 {
+				continue // default columns are optional
+			}
+			return nil, fmt.Errorf("column %q not found in header", name)
+		}
+		index[field] = i
+	}
+	if _, ok := index["timestamp"]; !ok {
+		return nil, errors.New("no timestamp column")
+	}
+	if _, ok := index["name"]; !ok && opts.Habit == "" {
+		return nil, errors.New("no name column and no habit given")
+	}
+
+	var out []habit.Habit
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		get := func(field string) string {
+			if i, ok := index[field]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		h := habit.Habit{Name: get("name"), Note: get("note"), Unit: get("unit")}
+		if h.Name == "" {
+			h.Name = opts.Habit
+		}
+		if h.TimeStamp, err = parseTime(get("timestamp"), opts); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if v := get("value"); v != "" {
+			if h.Value, err = strconv.ParseFloat(v, 64); err != nil {
+				return nil, fmt.Errorf("line %d: invalid value %q", line, v)
+			}
+			if h.Value == 0 {
+				continue
+			}
+		}
+		if h.ID, err = stableID(h); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		out = append(out, h)
+	}
+	return out, nil
+}
+
+func parseTime(s string, opts Options) (int64, error) {
+	ts, err := parseUnix(s, opts)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkTime(ts); err != nil {
+		return 0, fmt.Errorf("invalid timestamp %q: %w", s, err)
+	}
+	return ts, nil
+}
+
+func parseUnix(s string, opts Options) (int64, error) {
+	if s == "" {
+		return 0, errors.New("missing timestamp")
+	}
+	if opts.TimeLayout != "" {
+		t, err := time.ParseInLocation(opts.TimeLayout, s, opts.location())
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q: %w", s, err)
+		}
+		return t.Unix(), nil
+	}
+	if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return ts, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, opts.location()); err == nil {
+			return t.Unix(), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid timestamp %q", s)
+}
+
+func indexOf(header []string, name string) int {
+	for i, h := range header {
+		if strings.EqualFold(strings.TrimSpace(h), name) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,85 @@
+// Package importer converts files exported by other habit trackers into
+// habit entries. Each format is handled by an Adapter registered under a
+// name, which is what `habits import --format` selects.
+package importer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+
+	"github.com/brk3/habits/pkg/habit"
+)
+
+// Options tune how an adapter reads a file. Adapters ignore the fields that
+// don't apply to their format.
+type Options struct {
+	// Habit names the entries when the file has no habit column.
+	Habit string
+	// Columns maps entry fields (name, timestamp, note, value, unit) to the
+	// header of the CSV column holding them.
+	Columns map[string]string
+	// TimeLayout is the time.Parse layout of the timestamp column. When
+	// empty, Unix seconds, RFC 3339 and common date formats are accepted.
+	TimeLayout string
+	// Location is used for timestamps that carry no zone. Defaults to UTC.
+	Location *time.Location
+}
+
+// Adapter parses r into entries. Entries get stable IDs derived from their
+// content, so importing the same file twice doesn't duplicate them.
+type Adapter func(r io.Reader, opts Options) ([]habit.Habit, error)
+
+var adapters = map[string]Adapter{
+	"csv":  CSV,
+	"loop": Loop,
+}
+
+// Register makes an adapter available under name, replacing any existing
+// one.
+func Register(name string, a Adapter) {
+	adapters[name] = a
+}
+
+// Get returns the adapter registered under name.
+func Get(name string) (Adapter, bool) {
+	a, ok := adapters[name]
+	return a, ok
+}
+
+// Formats lists the registered adapter names.
+func Formats() []string {
+	return slices.Sorted(maps.Keys(adapters))
+}
+
+func (o Options) location() *time.Location {
+	if o.Location == nil {
+		return time.UTC
+	}
+	return o.Location
+}
+
+// checkTime rejects timestamps that can't be carried in an entry ID.
+func checkTime(ts int64) error {
+	if ts < 0 || uint64(ts) > ulid.MaxTime()/1000 {
+		return fmt.Errorf("timestamp %d out of range", ts)
+	}
+	return nil
+}
+
+// stableID derives an entry ID from its content so re-imports upsert rather
+// than duplicate.
+func stableID(h habit.Habit) (string, error) {
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s\x00%d\x00%s\x00%g\x00%s", h.Name, h.TimeStamp, h.Note, h.Value, h.Unit))
+	id, err := ulid.New(ulid.Timestamp(time.Unix(h.TimeStamp, 0)), bytes.NewReader(sum[:]))
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
@@ -0,0 +1,88 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSV_ColumnMapping(t *testing.T) {
+	in := `Date,Km,Comment
+2024-03-01,5.2,easy
+2024-03-02,0,rest day
+2024-03-03,10,"long, slow"
+`
+	dublin, _ := time.LoadLocation("Europe/Dublin")
+	opts := Options{
+		Habit:    "running",
+		Columns:  map[string]string{"timestamp": "Date", "value": "Km", "note": "Comment"},
+		Location: dublin,
+	}
+	entries, err := CSV(strings.NewReader(in), opts)
+	if err != nil {
+		t.Fatalf("CSV failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries (zero values skipped), got %+v", entries)
+	}
+	want := time.Date(2024, 3, 3, 0, 0, 0, 0, dublin).Unix()
+	if e := entries[1]; e.Name != "running" || e.Value != 10 || e.Note != "long, slow" || e.TimeStamp != want {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+
+	again, err := CSV(strings.NewReader(in), opts)
+	if err != nil {
+		t.Fatalf("CSV failed: %v", err)
+	}
+	if again[0].ID != entries[0].ID {
+		t.Fatalf("expected stable IDs, got %s and %s", entries[0].ID, again[0].ID)
+	}
+}
+
+func TestCSV_Errors(t *testing.T) {
+	tests := map[string]struct {
+		in   string
+		opts Options
+	}{
+		"no name":       {in: "timestamp\n1700000000\n"},
+		"unknown field": {in: "a\n1\n", opts: Options{Columns: map[string]string{"when": "a"}}},
+		"missing col":   {in: "a\n1\n", opts: Options{Habit: "x", Columns: map[string]string{"timestamp": "b"}}},
+		"bad time":      {in: "name,timestamp\nguitar,yesterday\n"},
+		"bad value":     {in: "name,timestamp,value\nguitar,1700000000,lots\n"},
+		"negative time": {in: "name,timestamp\nguitar,-1\n"},
+	}
+	for name, tt := range tests {
+		if _, err := CSV(strings.NewReader(tt.in), tt.opts); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestLoop(t *testing.T) {
+	in := `Date,Meditate,Guitar
+2024-03-02,2,-1
+2024-03-01,YES_MANUAL,1
+2024-02-29,0,2
+`
+	entries, err := Loop(strings.NewReader(in), Options{})
+	if err != nil {
+		t.Fatalf("Loop failed: %v", err)
+	}
+	got := map[string]int{}
+	for _, e := range entries {
+		got[e.Name]++
+	}
+	if len(entries) != 3 || got["Meditate"] != 2 || got["Guitar"] != 1 {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	if want := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC).Unix(); entries[0].TimeStamp != want {
+		t.Fatalf("got timestamp %d, want %d", entries[0].TimeStamp, want)
+	}
+
+	if _, err := Loop(strings.NewReader("name,timestamp\n"), Options{}); err == nil {
+		t.Fatal("expected an error for a non-Loop file")
+	}
+	if _, err := Loop(strings.NewReader("Date,Meditate\n0001-01-01,2\n"), Options{}); err == nil {
+		t.Fatal("expected an error for a date before 1970")
+	}
+}
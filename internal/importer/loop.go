@@ -0,0 +1,81 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/brk3/habits/pkg/habit"
+)
+
+// loopNote marks entries that came from Loop, which records no notes.
+const loopNote = "Imported from Loop"
+
+// Loop reads the Checkmarks.csv at the top of a Loop Habit Tracker export:
+// a Date column followed by one column per habit, e.g.
+//
+//	Date,Meditate,Guitar
+//	2024-03-02,2,-1
+//	2024-03-01,2,0
+//
+// Only manual check-ins (2, or YES_MANUAL in newer exports) become entries.
+// Loop's 1 is a day it filled in automatically for a non-daily habit, and
+// the rest are misses, skips or unknowns, so those are left out. Entries are
+// placed at noon of their day in Options.Location.
+func Loop(r io.Reader, opts Options) ([]habit.Habit, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("empty file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if len(header) < 2 || !strings.EqualFold(strings.TrimSpace(header[0]), "date") {
+		return nil, errors.New("not a Loop checkmarks file: want a header of Date followed by habit names")
+	}
+	names := make([]string, len(header))
+	for i, h := range header[1:] {
+		names[i+1] = strings.TrimSpace(h)
+	}
+
+	var out []habit.Habit
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+
+		day, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(record[0]), opts.location())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid date %q", line, record[0])
+		}
+		ts := time.Date(day.Year(), day.Month(), day.Day(), 12, 0, 0, 0, day.Location()).Unix()
+		if err := checkTime(ts); err != nil {
+			return nil, fmt.Errorf("line %d: invalid date %q: %w", line, record[0], err)
+		}
+
+		for i := 1; i < len(record) && i < len(names); i++ {
+			switch strings.TrimSpace(record[i]) {
+			case "2", "YES_MANUAL":
+			default:
+				continue
+			}
+			h := habit.Habit{Name: names[i], Note: loopNote, TimeStamp: ts}
+			if h.ID, err = stableID(h); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			out = append(out, h)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,158 @@
+// Package journal keeps entries the CLI couldn't send, so they can be
+// replayed once the server is reachable again.
+//
+// New entries are appended to a JSON lines file. A sync first moves that
+// file aside to <path>.sending, so entries tracked while it runs land in a
+// fresh journal, and rewrites it as batches are accepted. A sync that is
+// interrupted leaves <path>.sending behind and the next one resumes from it
+// with the same records, whose idempotency keys stop the server from
+// storing them twice. Entries the server rejects are moved to
+// <path>.rejected for the user to look at.
+package journal
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/brk3/habits/pkg/habit"
+)
+
+// Record is a queued entry and the idempotency key used to send it.
+type Record struct {
+	Key string `json:"key"`
+	// PutKey is the Idempotency-Key the entry was already sent on its own
+	// with, which the server may have stored it under. Such records are
+	// sent alone so they can be resent with it.
+	PutKey   string      `json:"put_key,omitempty"`
+	QueuedAt int64       `json:"queued_at"`
+	Entry    habit.Habit `json:"entry"`
+}
+
+type Journal struct {
+	path string
+}
+
+func New(path string) *Journal {
+	return &Journal{path: path}
+}
+
+func (j *Journal) sendingPath() string  { return j.path + ".sending" }
+func (j *Journal) rejectedPath() string { return j.path + ".rejected" }
+
+// Append queues e for the next sync. putKey is the idempotency key a failed
+// attempt to send it used, or empty if it wasn't sent.
+func (j *Journal) Append(e habit.Habit, putKey string, queuedAt int64) error {
+	return appendRecords(j.path, []Record{{Key: rand.Text(), PutKey: putKey, QueuedAt: queuedAt, Entry: e}})
+}
+
+// Pending reports whether there is anything to sync. It only stats files,
+// so it is cheap enough to call on every command.
+func (j *Journal) Pending() bool {
+	for _, p := range []string{j.path, j.sendingPath()} {
+		if fi, err := os.Stat(p); err == nil && fi.Size() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Take returns the records to send. Records left by an interrupted sync
+// come back unchanged; otherwise the journal is moved aside and its records
+// returned. Call Keep as records are sent.
+func (j *Journal) Take() ([]Record, error) {
+	if _, err := os.Stat(j.sendingPath()); errors.Is(err, fs.ErrNotExist) {
+		if err := os.Rename(j.path, j.sendingPath()); errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to move journal aside: %w", err)
+		}
+	}
+	return readRecords(j.sendingPath())
+}
+
+// Keep replaces the records being sent with remaining, the ones not yet
+// accepted by the server. Keeping none finishes the sync.
+func (j *Journal) Keep(remaining []Record) error {
+	if len(remaining) == 0 {
+		if err := os.Remove(j.sendingPath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	tmp := j.sendingPath() + ".tmp"
+	if err := os.Remove(tmp); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := appendRecords(tmp, remaining); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.sendingPath())
+}
+
+// Reject moves records the server refused out of the way.
+func (j *Journal) Reject(records []Record) error {
+	return appendRecords(j.rejectedPath(), records)
+}
+
+// RejectedPath is where rejected records are kept.
+func (j *Journal) RejectedPath() string {
+	return j.rejectedPath()
+}
+
+func appendRecords(path string, records []Record) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create journal directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write journal: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+	return f.Close()
+}
+
+func readRecords(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer f.Close()
+
+	var out []Record
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var r Record
+		if err := dec.Decode(&r); err != nil {
+			// a torn final line from a crash mid-append is dropped, anything
+			// before it is still sent
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
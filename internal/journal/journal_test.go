@@ -0,0 +1,118 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/brk3/habits/pkg/habit"
+)
+
+func TestSync(t *testing.T) {
+	j := New(filepath.Join(t.TempDir(), "journal.jsonl"))
+	if j.Pending() {
+		t.Fatal("expected an empty journal")
+	}
+	for _, note := range []string{"a", "b", "c", "bad"} {
+		if err := j.Append(habit.Habit{Name: "guitar", Note: note, TimeStamp: 1700000000}, "", 1700000000); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	if !j.Pending() {
+		t.Fatal("expected pending entries")
+	}
+
+	// the first batch goes through, the second hits a dead network
+	var sent []string
+	var keys []string
+	calls := 0
+	flaky := func(ctx context.Context, batch []Record) (map[int]string, error) {
+		calls++
+		if calls == 2 {
+			return nil, errors.New("connection refused")
+		}
+		rejected := map[int]string{}
+		for i, r := range batch {
+			if r.Entry.Note == "bad" {
+				rejected[i] = "invalid"
+				continue
+			}
+			sent = append(sent, r.Entry.Note)
+		}
+		keys = append(keys, batch[0].Key)
+		return rejected, nil
+	}
+	res, err := j.Sync(context.Background(), 2, flaky)
+	if err == nil || res.Sent != 2 || res.Remaining != 2 {
+		t.Fatalf("got %+v, %v; want 2 sent, 2 remaining and an error", res, err)
+	}
+
+	// entries tracked meanwhile wait for the interrupted batch to finish
+	if err := j.Append(habit.Habit{Name: "guitar", Note: "d", TimeStamp: 1700000000}, "", 1700000000); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	res, err = j.Sync(context.Background(), 2, flaky)
+	if err != nil || res.Sent != 1 || res.Rejected != 1 || res.Remaining != 0 {
+		t.Fatalf("got %+v, %v; want 1 sent and 1 rejected", res, err)
+	}
+	res, err = j.Sync(context.Background(), 2, flaky)
+	if err != nil || res.Sent != 1 {
+		t.Fatalf("got %+v, %v; want the new entry sent", res, err)
+	}
+	if len(sent) != 4 || sent[3] != "d" {
+		t.Fatalf("unexpected sends %v", sent)
+	}
+	if j.Pending() {
+		t.Fatal("expected the journal to be drained")
+	}
+
+	rejected, err := readRecords(j.RejectedPath())
+	if err != nil || len(rejected) != 1 || rejected[0].Entry.Note != "bad" {
+		t.Fatalf("unexpected rejected records %+v, %v", rejected, err)
+	}
+}
+
+func TestSync_PutKeySentAlone(t *testing.T) {
+	j := New(filepath.Join(t.TempDir(), "journal.jsonl"))
+	for _, key := range []string{"", "", "put-1", ""} {
+		if err := j.Append(habit.Habit{Name: "guitar", TimeStamp: 1700000000}, key, 1700000000); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	var batches [][]string
+	res, err := j.Sync(context.Background(), 10, func(ctx context.Context, batch []Record) (map[int]string, error) {
+		var keys []string
+		for _, r := range batch {
+			keys = append(keys, r.PutKey)
+		}
+		batches = append(batches, keys)
+		return nil, nil
+	})
+	if err != nil || res.Sent != 4 {
+		t.Fatalf("got %+v, %v; want 4 sent", res, err)
+	}
+	want := [][]string{{"", ""}, {"put-1"}, {""}}
+	if !reflect.DeepEqual(batches, want) {
+		t.Fatalf("got batches %q, want %q", batches, want)
+	}
+}
+
+func TestTake_TornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j := New(path)
+	if err := j.Append(habit.Habit{Name: "guitar", TimeStamp: 1700000000}, "", 1700000000); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	f.WriteString(`{"key":"x","entry":{"na`)
+	f.Close()
+
+	records, err := j.Take()
+	if err != nil || len(records) != 1 {
+		t.Fatalf("got %d records, %v; want the complete one", len(records), err)
+	}
+}
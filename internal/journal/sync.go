@@ -0,0 +1,66 @@
+package journal
+
+import (
+	"context"
+	"fmt"
+)
+
+// Sender delivers a batch of records to the server. It returns the reasons
+// for any records the server refused, keyed by their index in batch. An
+// error means the batch may not have been stored and should be sent again
+// later.
+type Sender func(ctx context.Context, batch []Record) (rejected map[int]string, err error)
+
+type SyncResult struct {
+	Sent      int
+	Rejected  int
+	Remaining int
+}
+
+// Sync sends the pending records in batches of up to batchSize, dropping
+// each batch from the journal once the server has it. Records with a PutKey
+// are sent in a batch of their own. It stops at the first batch that fails,
+// leaving it and the rest for the next sync.
+func (j *Journal) Sync(ctx context.Context, batchSize int, send Sender) (SyncResult, error) {
+	var res SyncResult
+	records, err := j.Take()
+	if err != nil {
+		return res, err
+	}
+	for len(records) > 0 {
+		n := 1
+		if records[0].PutKey == "" {
+			for n < min(batchSize, len(records)) && records[n].PutKey == "" {
+				n++
+			}
+		}
+		batch := records[:n]
+		rejected, err := send(ctx, batch)
+		if err != nil {
+			res.Remaining = len(records)
+			return res, err
+		}
+
+		var refused []Record
+		for i, r := range batch {
+			if _, ok := rejected[i]; ok {
+				refused = append(refused, r)
+			}
+		}
+		if len(refused) > 0 {
+			if err := j.Reject(refused); err != nil {
+				res.Remaining = len(records)
+				return res, fmt.Errorf("failed to record rejected entries: %w", err)
+			}
+		}
+		res.Sent += len(batch) - len(refused)
+		res.Rejected += len(refused)
+
+		records = records[len(batch):]
+		if err := j.Keep(records); err != nil {
+			res.Remaining = len(records)
+			return res, fmt.Errorf("failed to update journal: %w", err)
+		}
+	}
+	return res, nil
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/brk3/habits/internal/apiclient"
 	"github.com/brk3/habits/internal/config"
 	"github.com/brk3/habits/internal/logger"
+	"github.com/brk3/habits/pkg/habit"
 )
 
 func Nudge(cfg *config.Config, n Notifier, nudgeThreshold int) {
@@ -37,7 +38,7 @@ func GetHabitsExpiringIn(ctx context.Context, q Querier, now time.Time, in time.
 		if err != nil {
 			return nil, err
 		}
-		cutoff := time.Unix(h.LastWrite, 0).Add(24 * time.Hour)
+		cutoff := streakCutoff(h, now)
 		if h.CurrentStreak > 0 && now.Before(cutoff) && cutoff.Sub(now) <= in {
 			expiring = append(expiring, h.Name)
 		}
@@ -45,3 +46,25 @@ func GetHabitsExpiringIn(ctx context.Context, q Querier, now time.Time, in time.
 
 	return expiring, nil
 }
+
+// streakCutoff is when a streak last extended at h.LastWrite breaks: the
+// end of the period after the last one done, in the summary's timezone.
+// For a daily habit that's midnight at the end of the following day.
+func streakCutoff(h *habit.HabitSummary, now time.Time) time.Time {
+	loc := time.UTC
+	if h.Timezone != "" {
+		if l, err := time.LoadLocation(h.Timezone); err == nil {
+			loc = l
+		} else {
+			logger.Warn("unknown timezone in summary, using UTC", "timezone", h.Timezone, "err", err)
+		}
+	}
+	periods := habit.NewSchedulePeriods(h.Schedule)
+	last := habit.Day(h.LastWrite, loc)
+	done := periods.Current(last)
+	// a current period short of its target isn't done yet
+	if done == periods.Current(habit.Day(now.Unix(), loc)) && h.ThisPeriod < h.PeriodTarget {
+		done--
+	}
+	return time.Unix(habit.DayStart(periods.End(done+1, last), loc), 0)
+}
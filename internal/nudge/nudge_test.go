@@ -14,8 +14,8 @@ func TestGetHabitsExpiringIn(t *testing.T) {
 	// last write was 20:00 on Jan 1, 2024 UTC
 	lastWrite := time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC)
 
-	// now is 18:00 on Jan 1, 2024 UTC - 2 hours to go until threshold
-	now := time.Date(2024, 1, 2, 18, 0, 0, 0, time.UTC)
+	// now is 22:00 on Jan 2, 2024 UTC - 2 hours to go until the streak breaks
+	now := time.Date(2024, 1, 2, 22, 0, 0, 0, time.UTC)
 
 	f := &mockClient{
 		habits: []string{"guitar", "coding"},
@@ -59,3 +59,77 @@ func TestGetHabitsExpiringIn_NoneExpiring(t *testing.T) {
 		t.Fatalf("got %v, want []", got)
 	}
 }
+
+func TestGetHabitsExpiringIn_Timezone(t *testing.T) {
+	within := 2 * time.Hour
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+
+	// last write was 20:00 on Jan 1 in LA, which is already Jan 2 in UTC
+	lastWrite := time.Date(2024, 1, 1, 20, 0, 0, 0, la)
+
+	// now is 22:00 on Jan 2 in LA - 2 hours until midnight there
+	now := time.Date(2024, 1, 2, 22, 0, 0, 0, la).UTC()
+
+	f := &mockClient{
+		habits: []string{"guitar"},
+		summary: map[string]*habit.HabitSummary{
+			"guitar": {Name: "guitar", CurrentStreak: 3, LastWrite: lastWrite.Unix(), Timezone: "America/Los_Angeles"},
+		},
+	}
+
+	got, err := GetHabitsExpiringIn(context.Background(), f, now, within)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != "guitar" {
+		t.Fatalf("got %v, want [guitar]", got)
+	}
+
+	// bucketed in UTC the streak wouldn't break for another day
+	f.summary["guitar"].Timezone = ""
+	got, err = GetHabitsExpiringIn(context.Background(), f, now, within)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("got %v, want []", got)
+	}
+}
+
+func TestGetHabitsExpiringIn_Weekly(t *testing.T) {
+	within := 2 * time.Hour
+	weekly := habit.Schedule{Frequency: habit.FrequencyWeekly, Times: 3}
+
+	// 2024-01-01 was a Monday. This week is one day short of its target,
+	// and the streak from last week breaks at midnight on Sunday.
+	f := &mockClient{
+		habits: []string{"gym"},
+		summary: map[string]*habit.HabitSummary{
+			"gym": {Name: "gym", CurrentStreak: 4, LastWrite: time.Date(2024, 1, 6, 9, 0, 0, 0, time.UTC).Unix(),
+				ThisPeriod: 2, PeriodTarget: 3, Schedule: weekly},
+		},
+	}
+	now := time.Date(2024, 1, 7, 22, 0, 0, 0, time.UTC)
+	got, err := GetHabitsExpiringIn(context.Background(), f, now, within)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != "gym" {
+		t.Fatalf("got %v, want [gym]", got)
+	}
+
+	// with the week done, missing a day isn't a reason to nudge
+	f.summary["gym"].ThisPeriod = 3
+	now = time.Date(2024, 1, 6, 22, 0, 0, 0, time.UTC)
+	f.summary["gym"].LastWrite = time.Date(2024, 1, 5, 9, 0, 0, 0, time.UTC).Unix()
+	got, err = GetHabitsExpiringIn(context.Background(), f, now, within)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("got %v, want []", got)
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/brk3/habits/internal/logger"
+)
+
+// exportAccount returns everything stored about the caller: their habits as
+// in GET /export, plus their account, logins, API keys and sessions.
+// Secrets such as password hashes, tokens and key hashes are left out.
+func (s *Server) exportAccount(w http.ResponseWriter, r *http.Request) {
+	userID := userIDFromContext(s.cfg.AuthEnabled, r)
+	if userID == "" {
+		http.Error(w, `{"error":"user id is required"}`, http.StatusBadRequest)
+		return
+	}
+	logger.Info("Exporting account", "user_id", userID)
+
+	export, err := s.buildAccountExport(userID)
+	if err != nil {
+		logger.Error("Failed to export account", "user_id", userID, "error", err)
+		http.Error(w, `{"error":"storage error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="habits-account-%s.json"`,
+		time.Now().UTC().Format("20060102")))
+	if err := writeJSON(w, http.StatusOK, export); err != nil {
+		logger.Error("Failed to serialize account export", "user_id", userID, "error", err)
+	}
+}
+
+func (s *Server) buildAccountExport(userID string) (*AccountExport, error) {
+	data, err := s.buildExport(userID)
+	if err != nil {
+		return nil, err
+	}
+	export := &AccountExport{
+		UserID:     userID,
+		Data:       data,
+		APIKeys:    []APIKeyInfo{},
+		Sessions:   []SessionInfo{},
+		Identities: []IdentityInfo{},
+	}
+
+	if account, found, err := s.store.GetAccount(userID); err != nil {
+		return nil, err
+	} else if found {
+		export.Account = &account
+	}
+
+	localUsers, err := s.store.ListLocalUsers()
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range localUsers {
+		if u.UserID == userID {
+			export.Username = u.Username
+		}
+	}
+
+	keys, err := s.store.ListAPIKeys(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		export.APIKeys = append(export.APIKeys, apiKeyInfo(k))
+	}
+
+	sessions, err := s.store.ListSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, sess := range sessions {
+		export.Sessions = append(export.Sessions, SessionInfo{
+			ID:         sess.ID,
+			CreatedAt:  sess.CreatedAt,
+			LastSeenAt: sess.LastSeenAt,
+			ExpiresAt:  sess.ExpiresAt,
+			UserAgent:  sess.UserAgent,
+			IPAddress:  sess.IPAddress,
+		})
+	}
+
+	identities, err := s.store.ListIdentities(userID)
+	if err != nil {
+		return nil, err
+	}
+	tokenIDs := []string{userID}
+	for _, ident := range identities {
+		export.Identities = append(export.Identities, identityInfo(ident))
+		tokenIDs = append(tokenIDs, ident.ID)
+	}
+	for _, id := range tokenIDs {
+		_, found, err := s.store.GetRefreshToken(id)
+		if err != nil {
+			return nil, err
+		}
+		export.HasRefreshToken = export.HasRefreshToken || found
+	}
+	return export, nil
+}
+
+// deleteAccount deletes the caller and everything stored about them in one
+// transaction. The API key or session used for the request stops working
+// with it.
+func (s *Server) deleteAccount(w http.ResponseWriter, r *http.Request) {
+	userID := userIDFromContext(s.cfg.AuthEnabled, r)
+	if userID == "" {
+		http.Error(w, `{"error":"user id is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := s.store.DeleteUser(userID); err != nil {
+		logger.Error("Failed to delete account", "user_id", userID, "error", err)
+		http.Error(w, `{"error":"failed to delete account"}`, http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Deleted account", "user_id", userID)
+	clearSessionCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brk3/habits/internal/config"
+	"github.com/brk3/habits/internal/storage"
+	"github.com/brk3/habits/pkg/habit"
+	"golang.org/x/oauth2"
+)
+
+func TestAccountExportAndDelete(t *testing.T) {
+	store := newMemStore()
+	srv, err := New(&config.Config{AuthEnabled: true}, store)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	h := srv.Router()
+
+	key := "hab_live_user12345678901234567890123"
+	otherKey := "hab_live_other1234567890123456789012"
+	for k, userID := range map[string]string{key: "user-1", otherKey: "user-2"} {
+		if err := store.PutAPIKey(storage.APIKey{Hash: hashAPIKey(k), UserID: userID, Name: "laptop", Scopes: storage.Scopes}); err != nil {
+			t.Fatalf("PutAPIKey failed: %v", err)
+		}
+	}
+	if err := store.PutHabit("user-1", habit.Habit{Name: "guitar", TimeStamp: 100}); err != nil {
+		t.Fatalf("PutHabit failed: %v", err)
+	}
+	now := time.Now().Unix()
+	if err := store.PutSession(storage.Session{ID: "sess-1", UserID: "user-1", ProviderID: "google", IDToken: "secret-id-token", CreatedAt: now, LastSeenAt: now, ExpiresAt: now + 3600}); err != nil {
+		t.Fatalf("PutSession failed: %v", err)
+	}
+	if err := store.PutRefreshToken("user-1", &oauth2.Token{RefreshToken: "secret-refresh"}); err != nil {
+		t.Fatalf("PutRefreshToken failed: %v", err)
+	}
+	if _, err := srv.recordOIDCLogin("user-1", map[string]any{"email": "user@example.com"}); err != nil {
+		t.Fatalf("recordOIDCLogin failed: %v", err)
+	}
+
+	request := func(method, path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		req.Header.Set("Accept", "application/json")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := request(http.MethodGet, "/account/export", key)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d want 200", rr.Code)
+	}
+	for _, secret := range []string{"secret-id-token", "secret-refresh", key} {
+		if strings.Contains(rr.Body.String(), secret) {
+			t.Fatalf("export contains %q: %s", secret, rr.Body.String())
+		}
+	}
+	var export AccountExport
+	if err := json.Unmarshal(rr.Body.Bytes(), &export); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if export.UserID != "user-1" || export.Account == nil || export.Account.Email != "user@example.com" || !export.HasRefreshToken {
+		t.Fatalf("unexpected export %+v", export)
+	}
+	if len(export.APIKeys) != 1 || export.APIKeys[0].Name != "laptop" || len(export.Sessions) != 1 || export.Sessions[0].ID != "sess-1" {
+		t.Fatalf("unexpected keys or sessions %+v %+v", export.APIKeys, export.Sessions)
+	}
+	if len(export.Data.Habits) != 1 || len(export.Data.Habits[0].Entries) != 1 {
+		t.Fatalf("unexpected habits %+v", export.Data.Habits)
+	}
+
+	if rr := request(http.MethodDelete, "/account", key); rr.Code != http.StatusNoContent {
+		t.Fatalf("got %d want 204", rr.Code)
+	}
+	if rr := request(http.MethodGet, "/habits", key); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("got %d want 401 once deleted", rr.Code)
+	}
+	if _, found, _ := store.GetSession("sess-1"); found {
+		t.Fatal("expected the session to be gone")
+	}
+	if _, found, _ := store.GetRefreshToken("user-1"); found {
+		t.Fatal("expected the refresh token to be gone")
+	}
+	if names, _ := store.ListHabitNames("user-1"); len(names) != 0 {
+		t.Fatalf("expected the habits to be gone, got %v", names)
+	}
+	if rr := request(http.MethodGet, "/habits", otherKey); rr.Code != http.StatusOK {
+		t.Fatalf("got %d want 200 for another user", rr.Code)
+	}
+}
+
+func TestAccountDelete_RequiresScope(t *testing.T) {
+	store := newMemStore()
+	srv, err := New(&config.Config{AuthEnabled: true}, store)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	h := srv.Router()
+
+	key := "hab_live_write12345678901234567890123"
+	scopes := []string{storage.ScopeHabitsRead, storage.ScopeHabitsWrite}
+	if err := store.PutAPIKey(storage.APIKey{Hash: hashAPIKey(key), UserID: "user-1", Name: "sync", Scopes: scopes}); err != nil {
+		t.Fatalf("PutAPIKey failed: %v", err)
+	}
+	if err := store.PutHabit("user-1", habit.Habit{Name: "guitar", TimeStamp: 100}); err != nil {
+		t.Fatalf("PutHabit failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/account", nil)
+	req.Header.Set("Authorization", "Bearer "+key)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("got %d want 403 for a habits:write key", rr.Code)
+	}
+	if names, _ := store.ListHabitNames("user-1"); len(names) != 1 {
+		t.Fatalf("expected the habits to be kept, got %v", names)
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/brk3/habits/internal/logger"
+	"github.com/brk3/habits/internal/storage"
+)
+
+// claimAdmin reports whether ID token claims carry the admin claim set in
+// admin.claim and admin.claim_value.
+func (s *Server) claimAdmin(claims map[string]any) bool {
+	if s.cfg.Admin.Claim == "" {
+		return false
+	}
+	switch v := claims[s.cfg.Admin.Claim].(type) {
+	case string:
+		return v == s.cfg.Admin.ClaimValue
+	case []any:
+		return slices.Contains(v, any(s.cfg.Admin.ClaimValue))
+	}
+	return false
+}
+
+// recordLogin creates or updates the account of a user logging in. The
+// account is returned so disabled users can be turned away.
+func (s *Server) recordLogin(userID string, update func(a *storage.Account)) (storage.Account, error) {
+	a, found, err := s.store.GetAccount(userID)
+	if err != nil {
+		return storage.Account{}, err
+	}
+	now := time.Now().Unix()
+	if !found {
+		a = storage.Account{UserID: userID, CreatedAt: now}
+	}
+	a.LastLoginAt = now
+	update(&a)
+	return a, s.store.PutAccount(a)
+}
+
+// recordOIDCLogin records a login with an OIDC provider, taking the
+// user's details and admin role from the ID token.
+func (s *Server) recordOIDCLogin(userID string, claims map[string]any) (storage.Account, error) {
+	return s.recordLogin(userID, func(a *storage.Account) {
+		a.Email = cmp.Or(strClaim(claims, "email"), a.Email)
+		a.Name = cmp.Or(strClaim(claims, "name"), strClaim(claims, "preferred_username"), a.Name)
+		a.Admin = s.claimAdmin(claims)
+	})
+}
+
+// serveUser passes an authenticated request on, unless the user's account
+// is disabled. It also settles whether the user is an admin.
+func (s *Server) serveUser(w http.ResponseWriter, r *http.Request, next http.Handler, u *User) {
+	account, _, err := s.store.GetAccount(u.UserID)
+	if err != nil {
+		logger.Error("Failed to look up account", "userID", u.UserID, "error", err)
+		http.Error(w, `{"error":"failed to look up account"}`, http.StatusInternalServerError)
+		return
+	}
+	if account.Disabled {
+		logger.Warn("Disabled user denied", "userID", u.UserID, "path", r.URL.Path)
+		http.Error(w, `{"error":"account disabled"}`, http.StatusForbidden)
+		return
+	}
+	// the recorded role only counts while roles come from a claim
+	u.Admin = u.Admin || slices.Contains(s.cfg.Admin.Users, u.UserID) ||
+		(s.cfg.Admin.Claim != "" && account.Admin)
+	next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userCtxKey{}, u)))
+}
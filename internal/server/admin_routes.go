@@ -0,0 +1,220 @@
+package server
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/brk3/habits/internal/logger"
+	"github.com/brk3/habits/internal/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+// adminOnly lets through admins: users listed in admin.users or given the
+// role by the admin claim. With auth disabled there is a single anonymous
+// user, who owns everything anyway.
+func (s *Server) adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.AuthEnabled {
+			user, _ := r.Context().Value(userCtxKey{}).(*User)
+			if user == nil || !(user.Admin || slices.Contains(s.cfg.Admin.Users, user.UserID)) {
+				logger.Warn("Non-admin user denied admin endpoint", "user_id", userIDFromContext(s.cfg.AuthEnabled, r), "path", r.URL.Path)
+				http.Error(w, `{"error":"forbidden"}`, http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) getBackup(w http.ResponseWriter, r *http.Request) {
+	b, ok := s.store.(storage.Backupper)
+	if !ok {
+		http.Error(w, `{"error":"backups are not supported by this storage driver"}`, http.StatusNotImplemented)
+		return
+	}
+
+	filename := fmt.Sprintf("habits-%s.db", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	// once bytes are on the wire the status can't change, so a failure
+	// part way through shows up as a truncated, invalid file
+	n, err := b.Backup(w)
+	if err != nil {
+		logger.Error("Backup failed", "bytes", n, "error", err)
+		return
+	}
+	logger.Info("Backup streamed", "bytes", n, "user_id", userIDFromContext(s.cfg.AuthEnabled, r))
+}
+
+func (s *Server) listUsers(w http.ResponseWriter, r *http.Request) {
+	stats, err := s.store.ListUserStats()
+	if err != nil {
+		logger.Error("Failed to list user stats", "error", err)
+		http.Error(w, `{"error":"failed to list users"}`, http.StatusInternalServerError)
+		return
+	}
+	accounts, err := s.store.ListAccounts()
+	if err != nil {
+		logger.Error("Failed to list accounts", "error", err)
+		http.Error(w, `{"error":"failed to list users"}`, http.StatusInternalServerError)
+		return
+	}
+	localUsers, err := s.store.ListLocalUsers()
+	if err != nil {
+		logger.Error("Failed to list local users", "error", err)
+		http.Error(w, `{"error":"failed to list users"}`, http.StatusInternalServerError)
+		return
+	}
+
+	users := map[string]*AdminUserInfo{}
+	user := func(userID string) *AdminUserInfo {
+		if users[userID] == nil {
+			users[userID] = &AdminUserInfo{UserID: userID}
+		}
+		return users[userID]
+	}
+	for _, st := range stats {
+		u := user(st.UserID)
+		u.HabitCount, u.EntryCount, u.LastActiveAt = st.HabitCount, st.EntryCount, st.LastEntryAt
+	}
+	for _, a := range accounts {
+		u := user(a.UserID)
+		u.Email, u.Name, u.Disabled, u.CreatedAt = a.Email, a.Name, a.Disabled, a.CreatedAt
+		u.Admin = s.cfg.Admin.Claim != "" && a.Admin
+		u.LastActiveAt = max(u.LastActiveAt, a.LastLoginAt)
+	}
+	for _, lu := range localUsers {
+		u := user(lu.UserID)
+		u.Username = lu.Username
+		u.CreatedAt = cmp.Or(u.CreatedAt, lu.CreatedAt)
+	}
+
+	out := []AdminUserInfo{}
+	for _, u := range users {
+		u.Admin = u.Admin || slices.Contains(s.cfg.Admin.Users, u.UserID)
+		u.LastActiveAt = max(u.LastActiveAt, s.lastSeen(u.UserID))
+		out = append(out, *u)
+	}
+	slices.SortFunc(out, func(a, b AdminUserInfo) int { return strings.Compare(a.UserID, b.UserID) })
+
+	if err := writeJSON(w, http.StatusOK, AdminUserListResponse{Users: out}); err != nil {
+		logger.Error("Failed to serialize users", "error", err)
+	}
+}
+
+// lastSeen is when the user's sessions or API keys were last used.
+func (s *Server) lastSeen(userID string) int64 {
+	var last int64
+	sessions, err := s.store.ListSessions(userID)
+	if err != nil {
+		logger.Warn("Failed to list sessions", "user_id", userID, "error", err)
+	}
+	for _, sess := range sessions {
+		last = max(last, sess.LastSeenAt)
+	}
+	keys, err := s.store.ListAPIKeys(userID)
+	if err != nil {
+		logger.Warn("Failed to list API keys", "user_id", userID, "error", err)
+	}
+	for _, key := range keys {
+		last = max(last, key.LastUsedAt)
+	}
+	return last
+}
+
+// setUserDisabled disables or re-enables a user. Disabling logs the user
+// out everywhere; their API keys are kept but refused until re-enabled.
+func (s *Server) setUserDisabled(disabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := chi.URLParam(r, "user_id")
+		if disabled && userID == userIDFromContext(s.cfg.AuthEnabled, r) {
+			http.Error(w, `{"error":"admins can't disable themselves"}`, http.StatusBadRequest)
+			return
+		}
+
+		a, found, err := s.store.GetAccount(userID)
+		if err != nil {
+			logger.Error("Failed to look up account", "user_id", userID, "error", err)
+			http.Error(w, `{"error":"failed to look up account"}`, http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			a = storage.Account{UserID: userID, CreatedAt: time.Now().Unix()}
+		}
+		a.Disabled = disabled
+		if err := s.store.PutAccount(a); err != nil {
+			logger.Error("Failed to update account", "user_id", userID, "error", err)
+			http.Error(w, `{"error":"failed to update account"}`, http.StatusInternalServerError)
+			return
+		}
+
+		if disabled {
+			if err := s.store.DeleteUserSessions(userID); err != nil {
+				logger.Error("Failed to delete sessions of disabled user", "user_id", userID, "error", err)
+			}
+			if err := s.deleteRefreshTokens(userID); err != nil {
+				logger.Error("Failed to delete refresh tokens of disabled user", "user_id", userID, "error", err)
+			}
+		}
+		logger.Info("Changed user status", "user_id", userID, "disabled", disabled, "by", userIDFromContext(s.cfg.AuthEnabled, r))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) deleteUser(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "user_id")
+	if userID == userIDFromContext(s.cfg.AuthEnabled, r) {
+		http.Error(w, `{"error":"admins can't delete themselves"}`, http.StatusBadRequest)
+		return
+	}
+	if err := s.store.DeleteUser(userID); err != nil {
+		logger.Error("Failed to delete user", "user_id", userID, "error", err)
+		http.Error(w, `{"error":"failed to delete user"}`, http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Deleted user", "user_id", userID, "by", userIDFromContext(s.cfg.AuthEnabled, r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// mergeUser moves everything of a user into another account, for
+// duplicates made before their logins were linked. Their logins are linked
+// to the account they are merged into.
+func (s *Server) mergeUser(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "user_id")
+	var req AdminMergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Into == "" {
+		http.Error(w, `{"error":"body must name the user to merge into"}`, http.StatusBadRequest)
+		return
+	}
+	if req.Into == userID {
+		http.Error(w, `{"error":"can't merge a user into itself"}`, http.StatusBadRequest)
+		return
+	}
+	if userID == userIDFromContext(s.cfg.AuthEnabled, r) {
+		http.Error(w, `{"error":"admins can't merge themselves away"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := s.store.MergeUser(userID, req.Into); err != nil {
+		logger.Error("Failed to merge user", "user_id", userID, "into", req.Into, "error", err)
+		http.Error(w, `{"error":"failed to merge user"}`, http.StatusInternalServerError)
+		return
+	}
+	// logins that never got an identity record would otherwise keep
+	// logging in as the merged user
+	if _, found, err := s.store.GetIdentity(userID); err != nil {
+		logger.Error("Failed to look up identity", "identityID", userID, "error", err)
+	} else if !found {
+		if err := s.store.PutIdentity(storage.Identity{ID: userID, UserID: req.Into, CreatedAt: time.Now().Unix()}); err != nil {
+			logger.Error("Failed to link merged login", "identityID", userID, "error", err)
+		}
+	}
+	logger.Info("Merged user", "user_id", userID, "into", req.Into, "by", userIDFromContext(s.cfg.AuthEnabled, r))
+	w.WriteHeader(http.StatusNoContent)
+}
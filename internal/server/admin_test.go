@@ -0,0 +1,178 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/brk3/habits/internal/config"
+	"github.com/brk3/habits/internal/storage"
+	"github.com/brk3/habits/pkg/habit"
+)
+
+// backupMemStore is a memStore that can also take backups.
+type backupMemStore struct {
+	*memStore
+}
+
+func (b backupMemStore) Backup(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, "snapshot")
+	return int64(n), err
+}
+
+func TestGetBackup(t *testing.T) {
+	h := newTestServer(backupMemStore{newMemStore()})
+
+	rr := mockRequest(h, http.MethodGet, "/admin/backup", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d want 200", rr.Code)
+	}
+	if rr.Body.String() != "snapshot" {
+		t.Fatalf("got body %q, want snapshot", rr.Body.String())
+	}
+	if rr.Header().Get("Content-Disposition") == "" {
+		t.Fatal("expected a Content-Disposition header")
+	}
+}
+
+func TestGetBackup_Unsupported(t *testing.T) {
+	h := newTestServer(newMemStore())
+
+	rr := mockRequest(h, http.MethodGet, "/admin/backup", nil)
+	if rr.Code != http.StatusNotImplemented {
+		t.Fatalf("got %d want 501", rr.Code)
+	}
+}
+
+func TestAdminOnly(t *testing.T) {
+	cfg := &config.Config{AuthEnabled: true}
+	cfg.Admin.Users = []string{"user-admin"}
+	srv, err := New(cfg, backupMemStore{newMemStore()})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	h := srv.adminOnly(http.HandlerFunc(srv.getBackup))
+
+	for userID, want := range map[string]int{
+		"user-admin": http.StatusOK,
+		"user-other": http.StatusForbidden,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/backup", nil)
+		req = withAuthenticatedUser(req, userID, "test@example.com")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Fatalf("%s: got %d want %d", userID, rr.Code, want)
+		}
+	}
+}
+
+func TestAdminUsers(t *testing.T) {
+	store := newMemStore()
+	cfg := &config.Config{AuthEnabled: true}
+	cfg.Admin.Claim, cfg.Admin.ClaimValue = "groups", "habits-admins"
+	srv, err := New(cfg, store)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	h := srv.Router()
+
+	adminKey := "hab_live_admin1234567890123456789012"
+	userKey := "hab_live_user12345678901234567890123"
+	for key, userID := range map[string]string{adminKey: "user-admin", userKey: "user-other"} {
+		if err := store.PutAPIKey(storage.APIKey{Hash: hashAPIKey(key), UserID: userID, Scopes: storage.Scopes}); err != nil {
+			t.Fatalf("PutAPIKey failed: %v", err)
+		}
+	}
+	// the admin got the role from the claim at their last login
+	if _, err := srv.recordOIDCLogin("user-admin", map[string]any{"groups": []any{"users", "habits-admins"}}); err != nil {
+		t.Fatalf("recordOIDCLogin failed: %v", err)
+	}
+	if _, err := srv.recordOIDCLogin("user-other", map[string]any{"email": "other@example.com", "groups": []any{"users"}}); err != nil {
+		t.Fatalf("recordOIDCLogin failed: %v", err)
+	}
+	if err := store.PutHabit("user-other", habit.Habit{Name: "guitar", TimeStamp: 100}); err != nil {
+		t.Fatalf("PutHabit failed: %v", err)
+	}
+
+	request := func(method, path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		req.Header.Set("Accept", "application/json")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := request(http.MethodGet, "/admin/users", userKey); rr.Code != http.StatusForbidden {
+		t.Fatalf("got %d want 403 for a non-admin", rr.Code)
+	}
+	rr := request(http.MethodGet, "/admin/users", adminKey)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d want 200", rr.Code)
+	}
+	var list AdminUserListResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if len(list.Users) != 2 {
+		t.Fatalf("expected 2 users, got %+v", list.Users)
+	}
+	admin, other := list.Users[0], list.Users[1]
+	if !admin.Admin || other.Admin || other.Email != "other@example.com" || other.HabitCount != 1 || other.EntryCount != 1 || other.LastActiveAt == 0 {
+		t.Fatalf("unexpected users %+v", list.Users)
+	}
+
+	if rr := request(http.MethodPost, "/admin/users/user-admin/disable", adminKey); rr.Code != http.StatusBadRequest {
+		t.Fatalf("got %d want 400 disabling yourself", rr.Code)
+	}
+	if rr := request(http.MethodPost, "/admin/users/user-other/disable", adminKey); rr.Code != http.StatusNoContent {
+		t.Fatalf("got %d want 204", rr.Code)
+	}
+	if rr := request(http.MethodGet, "/habits", userKey); rr.Code != http.StatusForbidden {
+		t.Fatalf("got %d want 403 for a disabled user", rr.Code)
+	}
+	if rr := request(http.MethodPost, "/admin/users/user-other/enable", adminKey); rr.Code != http.StatusNoContent {
+		t.Fatalf("got %d want 204", rr.Code)
+	}
+	if rr := request(http.MethodGet, "/habits", userKey); rr.Code != http.StatusOK {
+		t.Fatalf("got %d want 200 once re-enabled", rr.Code)
+	}
+
+	if rr := request(http.MethodDelete, "/admin/users/user-other", adminKey); rr.Code != http.StatusNoContent {
+		t.Fatalf("got %d want 204", rr.Code)
+	}
+	if _, found, _ := store.GetAPIKey(hashAPIKey(userKey)); found {
+		t.Fatal("expected the deleted user's API key to be gone")
+	}
+	if rr := request(http.MethodGet, "/habits", userKey); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("got %d want 401 once deleted", rr.Code)
+	}
+}
+
+func TestClaimAdmin(t *testing.T) {
+	cfg := &config.Config{}
+	srv := &Server{cfg: cfg}
+	if srv.claimAdmin(map[string]any{"groups": "habits-admins"}) {
+		t.Fatal("expected no admin claim without admin.claim")
+	}
+
+	cfg.Admin.Claim, cfg.Admin.ClaimValue = "groups", "habits-admins"
+	for claims, want := range map[string]bool{
+		`{"groups": "habits-admins"}`:            true,
+		`{"groups": ["users", "habits-admins"]}`: true,
+		`{"groups": ["users"]}`:                  false,
+		`{"groups": "users"}`:                    false,
+		`{}`:                                     false,
+	} {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(claims), &m); err != nil {
+			t.Fatalf("unmarshal error: %v", err)
+		}
+		if got := srv.claimAdmin(m); got != want {
+			t.Errorf("%s: got %v want %v", claims, got, want)
+		}
+	}
+}
@@ -7,10 +7,13 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/brk3/habits/internal/config"
+	"github.com/brk3/habits/internal/storage"
 )
 
 func TestAPIKeyGeneration(t *testing.T) {
@@ -38,13 +41,13 @@ func TestAPIKeyGeneration(t *testing.T) {
 		t.Fatalf("got status %d, want 200, body: %s", rr.Code, rr.Body.String())
 	}
 
-	var response map[string]string
+	var response APIKeyCreateResponse
 	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
 		t.Fatalf("failed to decode response: %v", err)
 	}
 
-	apiKey, ok := response["api_key"]
-	if !ok || apiKey == "" {
+	apiKey := response.APIKey
+	if apiKey == "" {
 		t.Fatal("response missing api_key field")
 	}
 
@@ -54,15 +57,18 @@ func TestAPIKeyGeneration(t *testing.T) {
 
 	hash := sha256.Sum256([]byte(apiKey))
 	keyHash := fmt.Sprintf("%x", hash)
-	storedUserID, found, err := store.GetAPIKey(keyHash)
+	stored, found, err := store.GetAPIKey(keyHash)
 	if err != nil {
 		t.Fatalf("failed to get API key from store: %v", err)
 	}
 	if !found {
 		t.Fatal("API key not found in store")
 	}
-	if storedUserID != userID {
-		t.Fatalf("stored userID %s doesn't match expected %s", storedUserID, userID)
+	if stored.UserID != userID {
+		t.Fatalf("stored userID %s doesn't match expected %s", stored.UserID, userID)
+	}
+	if !slices.Equal(stored.Scopes, storage.Scopes) || stored.CreatedAt == 0 || stored.ExpiresAt != 0 {
+		t.Fatalf("key created without a body should have every scope and no expiry, got %+v", stored)
 	}
 }
 
@@ -81,7 +87,7 @@ func TestAPIKeyAuthentication(t *testing.T) {
 	}
 	userID := userIDFromClaims(claims)
 
-	if err := store.PutAPIKey(keyHash, userID); err != nil {
+	if err := store.PutAPIKey(storage.APIKey{Hash: keyHash, UserID: userID, Scopes: storage.Scopes}); err != nil {
 		t.Fatalf("failed to store API key: %v", err)
 	}
 
@@ -149,13 +155,13 @@ func TestListAPIKeys(t *testing.T) {
 	// Store some API keys for this user
 	key1Hash := fmt.Sprintf("%x", sha256.Sum256([]byte("key1")))
 	key2Hash := fmt.Sprintf("%x", sha256.Sum256([]byte("key2")))
-	store.PutAPIKey(key1Hash, userID)
-	store.PutAPIKey(key2Hash, userID)
+	store.PutAPIKey(storage.APIKey{Hash: key1Hash, UserID: userID, Name: "laptop", Scopes: storage.Scopes})
+	store.PutAPIKey(storage.APIKey{Hash: key2Hash, UserID: userID, Name: "dashboard", Scopes: []string{storage.ScopeHabitsRead}})
 
 	// Store a key for a different user
 	otherUserID := "user-other"
 	key3Hash := fmt.Sprintf("%x", sha256.Sum256([]byte("key3")))
-	store.PutAPIKey(key3Hash, otherUserID)
+	store.PutAPIKey(storage.APIKey{Hash: key3Hash, UserID: otherUserID})
 
 	// Make authenticated request
 	req := httptest.NewRequest(http.MethodGet, "/auth/api_keys", nil)
@@ -168,20 +174,21 @@ func TestListAPIKeys(t *testing.T) {
 		t.Fatalf("got status %d, want 200, body: %s", rr.Code, rr.Body.String())
 	}
 
-	var response map[string][]map[string]string
+	var response APIKeyListResponse
 	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
 		t.Fatalf("failed to decode response: %v", err)
 	}
 
-	keys, ok := response["keys"]
-	if !ok {
-		t.Fatal("response missing keys field")
-	}
-
 	// Should have 2 keys (not the other user's key)
+	keys := response.Keys
 	if len(keys) != 2 {
 		t.Fatalf("got %d keys, want 2", len(keys))
 	}
+	for _, k := range keys {
+		if k.KeyID == key3Hash || k.Name == "" || len(k.Scopes) == 0 {
+			t.Fatalf("unexpected key in listing: %+v", k)
+		}
+	}
 }
 
 // TestAuthenticateAPIKey_ValidKey tests the authenticateAPIKey function directly
@@ -200,7 +207,7 @@ func TestAuthenticateAPIKey_ValidKey(t *testing.T) {
 	keyHash := fmt.Sprintf("%x", hash)
 	userID := "user-test123"
 
-	if err := store.PutAPIKey(keyHash, userID); err != nil {
+	if err := store.PutAPIKey(storage.APIKey{Hash: keyHash, UserID: userID, Scopes: storage.Scopes}); err != nil {
 		t.Fatalf("failed to store API key: %v", err)
 	}
 
@@ -262,6 +269,137 @@ func TestAPIKeyGeneration_Unauthenticated(t *testing.T) {
 	}
 }
 
+func TestAPIKeyGeneration_NameScopesExpiry(t *testing.T) {
+	store := newMemStore()
+	srv, err := New(&config.Config{AuthEnabled: true}, store)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	create := func(user *User, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/api_keys", strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), userCtxKey{}, user))
+		rr := httptest.NewRecorder()
+		srv.generateAPIKey(rr, req)
+		return rr
+	}
+
+	session := &User{UserID: "user-1"}
+	rr := create(session, `{"name":"dashboard","scopes":["habits:read"],"expires_in":3600}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200, body: %s", rr.Code, rr.Body.String())
+	}
+	var resp APIKeyCreateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Key.Name != "dashboard" || !slices.Equal(resp.Key.Scopes, []string{storage.ScopeHabitsRead}) {
+		t.Fatalf("unexpected key %+v", resp.Key)
+	}
+	if want := time.Now().Unix() + 3600; resp.Key.ExpiresAt < want-5 || resp.Key.ExpiresAt > want {
+		t.Fatalf("got expiry %d, want about %d", resp.Key.ExpiresAt, want)
+	}
+	if resp.Key.KeyID != hashAPIKey(resp.APIKey) {
+		t.Fatal("key_id should be the hash DELETE takes")
+	}
+
+	if rr := create(session, `{"scopes":["habits:everything"]}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d for an unknown scope, want 400", rr.Code)
+	}
+	if rr := create(session, `{"expires_in":-1}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d for a negative expiry, want 400", rr.Code)
+	}
+
+	// a scoped key can't mint a key with more than it holds
+	scoped := &User{UserID: "user-1", Scopes: []string{storage.ScopeHabitsRead, storage.ScopeHabitsWrite}}
+	if rr := create(scoped, `{"scopes":["admin"]}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d escalating to admin, want 400", rr.Code)
+	}
+	rr = create(scoped, ``)
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !slices.Equal(resp.Key.Scopes, scoped.Scopes) {
+		t.Fatalf("got scopes %v, want the caller's %v", resp.Key.Scopes, scoped.Scopes)
+	}
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	store := newMemStore()
+	h := newTestServerWithAuth(t, store)
+
+	readKey := "hab_live_readonly12345678901234567890"
+	if err := store.PutAPIKey(storage.APIKey{Hash: hashAPIKey(readKey), UserID: "user-1", Scopes: []string{storage.ScopeHabitsRead}}); err != nil {
+		t.Fatalf("failed to store API key: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+readKey)
+		req.Header.Set("Accept", "application/json")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do(http.MethodGet, "/habits/", ""); rr.Code != http.StatusOK {
+		t.Fatalf("got status %d reading with a read-only key, want 200", rr.Code)
+	}
+	if rr := do(http.MethodGet, "/export", ""); rr.Code != http.StatusOK {
+		t.Fatalf("got status %d exporting with a read-only key, want 200", rr.Code)
+	}
+	for _, tc := range []struct{ method, path, body string }{
+		{http.MethodPost, "/habits/", `{"name":"guitar","timestamp":1700000000}`},
+		{http.MethodPost, "/habits:batch", `[]`},
+		{http.MethodPut, "/settings", `{}`},
+		{http.MethodPost, "/auth/api_keys", ``},
+		{http.MethodGet, "/admin/backup", ``},
+	} {
+		rr := do(tc.method, tc.path, tc.body)
+		if rr.Code != http.StatusForbidden {
+			t.Fatalf("%s %s: got status %d with a read-only key, want 403", tc.method, tc.path, rr.Code)
+		}
+		if !strings.Contains(rr.Header().Get("WWW-Authenticate"), "insufficient_scope") {
+			t.Fatalf("%s %s: missing insufficient_scope challenge", tc.method, tc.path)
+		}
+	}
+}
+
+func TestAPIKeyExpiryAndLastUsed(t *testing.T) {
+	store := newMemStore()
+	h := newTestServerWithAuth(t, store)
+
+	now := time.Now().Unix()
+	liveKey := "hab_live_live123456789012345678901234"
+	expiredKey := "hab_live_expired12345678901234567890"
+	store.PutAPIKey(storage.APIKey{Hash: hashAPIKey(liveKey), UserID: "user-1", ExpiresAt: now + 3600, Scopes: storage.Scopes})
+	store.PutAPIKey(storage.APIKey{Hash: hashAPIKey(expiredKey), UserID: "user-1", ExpiresAt: now - 1, Scopes: storage.Scopes})
+
+	get := func(apiKey string) int {
+		req := httptest.NewRequest(http.MethodGet, "/habits/", nil)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		req.Header.Set("Accept", "application/json")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := get(expiredKey); code != http.StatusUnauthorized {
+		t.Fatalf("got status %d for an expired key, want 401", code)
+	}
+	if code := get(liveKey); code != http.StatusOK {
+		t.Fatalf("got status %d for a live key, want 200", code)
+	}
+	key, _, _ := store.GetAPIKey(hashAPIKey(liveKey))
+	if key.LastUsedAt < now {
+		t.Fatalf("last used not recorded, got %d", key.LastUsedAt)
+	}
+	key, _, _ = store.GetAPIKey(hashAPIKey(expiredKey))
+	if key.LastUsedAt != 0 {
+		t.Fatalf("expired key should not be marked used, got %d", key.LastUsedAt)
+	}
+}
+
 // Helper function to add authenticated user to request context
 func withAuthenticatedUser(req *http.Request, userID, email string) *http.Request {
 	user := &User{
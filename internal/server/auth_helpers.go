@@ -1,10 +1,72 @@
 package server
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
+	"slices"
+	"time"
+
+	"github.com/brk3/habits/internal/logger"
+	"github.com/brk3/habits/internal/storage"
 )
 
+// issueAPIKey creates and stores a new API key described by key, filling in
+// its hash and creation time, and returns the plaintext key. Only the hash
+// is kept, so this is the one chance to show it.
+func (s *Server) issueAPIKey(key storage.APIKey) (string, storage.APIKey, error) {
+	keyBytes := make([]byte, 24) // 24 bytes = 32 chars in base64
+	if _, err := rand.Read(keyBytes); err != nil {
+		return "", storage.APIKey{}, fmt.Errorf("failed to generate API key: %w", err)
+	}
+	plainKey := "hab_live_" + base64.RawURLEncoding.EncodeToString(keyBytes)
+
+	key.Hash = hashAPIKey(plainKey)
+	key.CreatedAt = time.Now().Unix()
+	if err := s.store.PutAPIKey(key); err != nil {
+		return "", storage.APIKey{}, fmt.Errorf("failed to store API key: %w", err)
+	}
+	logger.Info("Generated new API key", "userID", key.UserID, "keyHash", truncateHash(key.Hash), "name", key.Name, "scopes", key.Scopes)
+	return plainKey, key, nil
+}
+
+// grantableScopes checks the scopes requested for a new key against those
+// user holds, so a key can never be used to mint a more powerful one. An
+// empty request asks for everything the user has.
+func grantableScopes(user *User, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		if user.Scopes != nil {
+			return slices.Clone(user.Scopes), nil
+		}
+		return slices.Clone(storage.Scopes), nil
+	}
+	var scopes []string
+	for _, scope := range requested {
+		if !storage.ValidScope(scope) {
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+		if !user.HasScope(scope) {
+			return nil, fmt.Errorf("cannot grant scope %q without holding it", scope)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+func apiKeyInfo(key storage.APIKey) APIKeyInfo {
+	return APIKeyInfo{
+		KeyID:      key.Hash,
+		Name:       key.Name,
+		CreatedAt:  key.CreatedAt,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		Scopes:     key.Scopes,
+	}
+}
+
 // hashAPIKey creates a SHA256 hash of an API key for storage
 func hashAPIKey(apiKey string) string {
 	hash := sha256.Sum256([]byte(apiKey))
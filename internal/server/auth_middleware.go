@@ -3,14 +3,18 @@ package server
 import (
 	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/brk3/habits/internal/config"
 	"github.com/brk3/habits/internal/logger"
+	"github.com/brk3/habits/internal/storage"
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/gorilla/securecookie"
 	"golang.org/x/oauth2"
@@ -19,6 +23,9 @@ import (
 const (
 	sessionMaxAge = 24 * time.Hour // 24 hours - aligns with typical OIDC refresh token lifetimes
 	apiKeyPrefix  = "hab_"         // Prefix for API keys (currently only hab_live_ generated, hab_test_ reserved for future)
+	// apiKeyTouchInterval limits how often a key's last used time is
+	// written, so busy clients don't cost a write per request.
+	apiKeyTouchInterval = time.Minute
 )
 
 type userCtxKey struct{}
@@ -28,6 +35,18 @@ type User struct {
 	Email   string
 	UserID  string
 	Claims  map[string]any
+	// Scopes limits what an API key may do. It is nil for browser sessions
+	// and ID tokens, which may do everything.
+	Scopes []string
+	// SessionID is set when the request was made with a session cookie.
+	SessionID string
+	// Admin is whether the user may use the /admin endpoints.
+	Admin bool
+}
+
+// HasScope reports whether the user may make requests needing scope.
+func (u *User) HasScope(scope string) bool {
+	return u.Scopes == nil || slices.Contains(u.Scopes, scope)
 }
 
 type StateStore struct {
@@ -40,6 +59,9 @@ type authState struct {
 	Verifier string
 	Return   string
 	ExpireAt time.Time
+	// LinkUserID is set when a logged in user is linking the login to
+	// their account.
+	LinkUserID string
 }
 
 func NewStateStore(ttl time.Duration) *StateStore {
@@ -61,17 +83,48 @@ func NewStateStore(ttl time.Duration) *StateStore {
 	return s
 }
 
-func ConfigureOIDCProviders(cfg *config.Config) (map[string]*AuthProvider, *securecookie.SecureCookie, error) {
+// sessionCodecs builds the session cookie codecs from the configured keys,
+// the one in use first, so cookies signed with a key that has since been
+// rotated out of first place, or with a staged key, can still be read.
+func sessionCodecs(cfg *config.Config) ([]securecookie.Codec, error) {
+	keys, err := cfg.SessionKeys()
+	if err != nil {
+		return nil, err
+	}
+	var pairs [][]byte
+	for _, k := range keys {
+		hashKey, blockKey, err := k.Decode()
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, hashKey, blockKey)
+	}
+	if len(pairs) == 0 {
+		logger.Warn("No session keys configured, generating them; sessions won't survive a restart or be shared between replicas")
+		hashKey := securecookie.GenerateRandomKey(64)
+		blockKey := securecookie.GenerateRandomKey(32)
+		if hashKey == nil || blockKey == nil {
+			return nil, fmt.Errorf("failed to generate secure cookie keys")
+		}
+		pairs = append(pairs, hashKey, blockKey)
+	}
+
+	codecs := securecookie.CodecsFromPairs(pairs...)
+	for _, c := range codecs {
+		c.(*securecookie.SecureCookie).MaxAge(int(sessionMaxAge.Seconds()))
+	}
+	logger.Info("Session keys loaded", "count", len(codecs))
+	return codecs, nil
+}
+
+func ConfigureOIDCProviders(cfg *config.Config) (map[string]*AuthProvider, []securecookie.Codec, error) {
 	logger.Info("Configuring OIDC providers", "count", len(cfg.OIDCProviders))
 	providers := make(map[string]*AuthProvider)
 
-	hashKey := securecookie.GenerateRandomKey(64)
-	blockKey := securecookie.GenerateRandomKey(32)
-	if hashKey == nil || blockKey == nil {
-		return nil, nil, fmt.Errorf("failed to generate secure cookie keys")
+	sessionCookie, err := sessionCodecs(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load session keys: %w", err)
 	}
-	sessionCookie := securecookie.New(hashKey, blockKey)
-	sessionCookie.MaxAge(int(sessionMaxAge.Seconds()))
 
 	for i := range cfg.OIDCProviders {
 		cfgprov := cfg.OIDCProviders[i]
@@ -118,23 +171,28 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 		var rawIDToken string
 		var providerID string
 
+		var sess *storage.Session
+		var sessToken string
+
 		// 1) Try session cookie first
-		if c, err := r.Cookie("session"); err == nil {
-			logger.Debug("Found session cookie")
-			var prefixedToken string
-			if err := s.sessionCookie.Decode("session", c.Value, &prefixedToken); err == nil {
-				// Parse provider-prefixed token
-				if pID, token, err := parseProviderToken(prefixedToken); err == nil {
-					providerID, rawIDToken = pID, token
-					logger.Debug("Extracted token from session cookie", "provider", providerID)
-				} else {
-					logger.Debug("Failed to parse session token", "error", err)
+		if found, token, ok := s.sessionFromCookie(r); ok {
+			sess, sessToken = found, token
+			providerID, rawIDToken = sess.ProviderID, sess.IDToken
+			logger.Debug("Found session", "provider", providerID, "session", truncateHash(sess.ID))
+
+			// local logins have no ID token to verify
+			if sess.ProviderID == config.LocalProviderID {
+				u, ok := s.localSessionUser(sess)
+				if !ok {
+					RecordAuthEvent("verification", "failed", config.LocalProviderID)
+					s.handleAuthFailure(w, r, true)
+					return
 				}
-			} else {
-				logger.Debug("Failed to decode session cookie", "error", err)
+				RecordAuthEvent("verification", "success", config.LocalProviderID)
+				s.touchSession(sess)
+				s.serveUser(w, r, next, u)
+				return
 			}
-		} else {
-			logger.Debug("No session cookie found", "error", err)
 		}
 
 		// 2) Try API key or Bearer token if no valid session cookie
@@ -146,7 +204,7 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 					if user, authenticated := s.authenticateAPIKey(token); authenticated {
 						logger.Debug("API key authentication successful", "userID", user.UserID)
 						RecordAuthEvent("verification", "success", "apikey")
-						next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userCtxKey{}, user)))
+						s.serveUser(w, r, next, user)
 						return
 					}
 					logger.Debug("API key authentication failed")
@@ -186,24 +244,22 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 			if newIDToken, refreshed := s.tryRefreshToken(r.Context(), providerID, rawIDToken); refreshed {
 				if newIdTok, verifyErr := s.authProviders[providerID].idVerifier.Verify(r.Context(), newIDToken); verifyErr == nil {
 					RecordAuthEvent("refresh", "success", providerID)
-					prefixedToken := providerID + ":" + newIDToken
 
-					// Update cookie with refreshed token
-					val, err := s.sessionCookie.Encode("session", prefixedToken)
-					if err != nil {
-						logger.Error("Failed to encode refreshed session cookie", "error", err)
-						s.handleAuthFailure(w, r, true)
-						return
+					// Keep the session's token current and extend it
+					if sess != nil {
+						sess.IDToken = newIDToken
+						sess.ExpiresAt = time.Now().Add(sessionMaxAge).Unix()
+						if err := s.store.UpdateSession(*sess); err != nil {
+							logger.Error("Failed to update refreshed session", "error", err)
+							s.handleAuthFailure(w, r, true)
+							return
+						}
+						if err := s.setSessionCookie(w, sessToken); err != nil {
+							logger.Error("Failed to encode refreshed session cookie", "error", err)
+							s.handleAuthFailure(w, r, true)
+							return
+						}
 					}
-					http.SetCookie(w, &http.Cookie{
-						Name:     "session",
-						Value:    val,
-						Path:     "/",
-						HttpOnly: true,
-						Secure:   true,
-						SameSite: http.SameSiteLaxMode,
-						MaxAge:   int(sessionMaxAge.Seconds()),
-					})
 					idTok = newIdTok
 				} else {
 					logger.Debug("New ID token verification failed", "error", verifyErr)
@@ -229,15 +285,26 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 			s.handleAuthFailure(w, r, true)
 			return
 		}
+		userID, err := s.identityUserID(userIDFromClaims(claims))
+		if err != nil {
+			logger.Error("Failed to look up identity", "error", err)
+			http.Error(w, `{"error":"failed to look up identity"}`, http.StatusInternalServerError)
+			return
+		}
 		u := &User{
 			Subject: idTok.Subject,
 			Email:   strClaim(claims, "email"),
-			UserID:  userIDFromClaims(claims),
+			UserID:  userID,
 			Claims:  claims,
+			Admin:   s.claimAdmin(claims),
+		}
+		if sess != nil {
+			u.SessionID = sess.ID
+			s.touchSession(sess)
 		}
 
 		// Inject user into context
-		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userCtxKey{}, u)))
+		s.serveUser(w, r, next, u)
 	})
 }
 
@@ -271,7 +338,8 @@ func strClaim(m map[string]any, k string) string {
 	return ""
 }
 
-// userIDFromClaims generates a consistent user ID from OIDC token claims
+// userIDFromClaims generates a consistent user ID from OIDC token claims.
+// It identifies the login; see identityUserID for the user it logs in as.
 func userIDFromClaims(claims map[string]any) string {
 	iss, ok := claims["iss"].(string)
 	if !ok {
@@ -352,7 +420,7 @@ func (s *Server) handleAuthFailure(w http.ResponseWriter, r *http.Request, clear
 	accept := r.Header.Get("Accept")
 	if r.Method == http.MethodGet && (strings.Contains(accept, "text/html") || accept == "") {
 		logger.Debug("Redirecting to login page")
-		http.Redirect(w, r, "/auth/login", http.StatusFound)
+		http.Redirect(w, r, "/auth/login?return="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
 	} else {
 		logger.Debug("Returning 401 unauthorized")
 		if clearCookie {
@@ -373,6 +441,7 @@ func (s *Server) tryRefreshToken(ctx context.Context, providerID, expiredIDToken
 		return "", false
 	}
 
+	// refresh tokens are stored by identity, not by the user it logs in as
 	userID := userIDFromClaims(claims)
 	if userID == "" {
 		logger.Debug("Failed to calculate user ID from claims")
@@ -428,7 +497,7 @@ func (s *Server) authenticateAPIKey(apiKey string) (*User, bool) {
 	keyHash := hashAPIKey(apiKey)
 
 	logger.Debug("Looking up API key", "keyHash", truncateHash(keyHash))
-	userID, found, err := s.store.GetAPIKey(keyHash)
+	key, found, err := s.store.GetAPIKey(keyHash)
 	if err != nil {
 		logger.Error("Failed to lookup API key", "error", err)
 		return nil, false
@@ -439,14 +508,73 @@ func (s *Server) authenticateAPIKey(apiKey string) (*User, bool) {
 		return nil, false
 	}
 
+	now := time.Now()
+	if key.Expired(now) {
+		logger.Debug("API key has expired", "keyHash", truncateHash(keyHash), "expiresAt", key.ExpiresAt)
+		return nil, false
+	}
+
+	if now.Unix()-key.LastUsedAt >= int64(apiKeyTouchInterval.Seconds()) {
+		// a failure here shouldn't lock the user out
+		if err := s.store.TouchAPIKey(keyHash, now.Unix()); err != nil {
+			logger.Warn("Failed to record API key use", "keyHash", truncateHash(keyHash), "error", err)
+		}
+	}
+
 	// Create a minimal User with just the userID
 	// API keys don't have email or subject from OIDC
 	user := &User{
-		UserID:  userID,
+		UserID:  key.UserID,
 		Subject: "apikey:" + truncateHash(keyHash), // Include partial hash for logging
 		Email:   "",
 		Claims:  map[string]any{"auth_method": "api_key"},
+		// never nil, so a key without scopes can do nothing
+		Scopes: append([]string{}, key.Scopes...),
 	}
 
 	return user, true
 }
+
+// touchSession records that a session was used, at most once per
+// sessionTouchInterval.
+func (s *Server) touchSession(sess *storage.Session) {
+	now := time.Now().Unix()
+	if now-sess.LastSeenAt < int64(sessionTouchInterval.Seconds()) {
+		return
+	}
+	sess.LastSeenAt = now
+	// a failure here shouldn't lock the user out
+	if err := s.store.UpdateSession(*sess); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		logger.Warn("Failed to record session use", "session", truncateHash(sess.ID), "error", err)
+	}
+}
+
+// requireScope rejects requests made with an API key that lacks the scope
+// they need: read for GET and HEAD, write for everything else. Requests
+// without a user, as when auth is disabled, are let through.
+func requireScope(read, write string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scope := write
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				scope = read
+			}
+			if user, ok := r.Context().Value(userCtxKey{}).(*User); ok && !user.HasScope(scope) {
+				logger.Warn("API key denied for missing scope", "user_id", user.UserID, "subject", user.Subject, "scope", scope, "path", r.URL.Path)
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+				writeError(w, http.StatusForbidden, "API key lacks the "+scope+" scope")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Shorthands for the scopes the routes need.
+var (
+	habitsScope = requireScope(storage.ScopeHabitsRead, storage.ScopeHabitsWrite)
+	adminScope  = requireScope(storage.ScopeAdmin, storage.ScopeAdmin)
+	// deleting an account can't be undone, so a key that may only write
+	// habits can't do it
+	accountDeleteScope = requireScope(storage.ScopeAccountDelete, storage.ScopeAccountDelete)
+)
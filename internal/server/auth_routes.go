@@ -1,24 +1,40 @@
 package server
 
 import (
+	"cmp"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/brk3/habits/internal/config"
 	"github.com/brk3/habits/internal/logger"
+	"github.com/brk3/habits/internal/storage"
 	"github.com/go-chi/chi/v5"
 	"golang.org/x/oauth2"
 )
 
 func (s *Server) login(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if _, ok := s.authProviders[id]; !ok {
+		http.Error(w, "unknown provider", http.StatusNotFound)
+		return
+	}
+	s.redirectToProvider(w, r, id, authState{Return: safeReturn(r.URL.Query().Get("return"))})
+}
 
+// redirectToProvider sends the browser to provider id to log in, saving
+// saved for the callback along with the PKCE verifier.
+func (s *Server) redirectToProvider(w http.ResponseWriter, r *http.Request, id string, saved authState) {
 	// Generate PKCE challenge
 	verifier := make([]byte, 48)
 	if _, err := rand.Read(verifier); err != nil {
@@ -37,19 +53,9 @@ func (s *Server) login(w http.ResponseWriter, r *http.Request) {
 	}
 	st := hex.EncodeToString(stateBytes)
 
-	// Capture return path (sanitize to keep it relative)
-	ret := r.URL.Query().Get("return")
-	if ret == "" {
-		ret = "/"
-	} else if u, err := url.Parse(ret); err != nil || u.IsAbs() || u.Host != "" {
-		ret = "/"
-	}
-
-	s.authProviders[id].state.Put(st, authState{
-		Verifier: verifierStr,
-		Return:   ret,
-		ExpireAt: time.Now().Add(5 * time.Minute),
-	})
+	saved.Verifier = verifierStr
+	saved.ExpireAt = time.Now().Add(5 * time.Minute)
+	s.authProviders[id].state.Put(st, saved)
 
 	authURL := s.authProviders[id].oauth2.AuthCodeURL(
 		st,
@@ -61,6 +67,10 @@ func (s *Server) login(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) callback(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if _, ok := s.authProviders[id]; !ok {
+		http.Error(w, "unknown provider", http.StatusNotFound)
+		return
+	}
 	st := r.URL.Query().Get("state")
 	if st == "" {
 		http.Error(w, "missing state", http.StatusBadRequest)
@@ -102,90 +112,114 @@ func (s *Server) callback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Store complete token for future refresh
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		logger.Error("Failed to extract claims from ID token", "error", err)
+		http.Error(w, "token claims invalid", http.StatusUnauthorized)
+		return
+	}
+	identityID := userIDFromClaims(claims)
+	if identityID == "" {
+		logger.Error("Failed to calculate userID from claims")
+		http.Error(w, "token claims invalid", http.StatusUnauthorized)
+		return
+	}
+	if saved.LinkUserID != "" {
+		s.finishLink(w, r, id, identityID, claims, tok, saved)
+		return
+	}
+	userID, err := s.identityUserID(identityID)
+	if err != nil {
+		logger.Error("Failed to look up identity", "identityID", identityID, "error", err)
+		http.Error(w, "failed to look up identity", http.StatusInternalServerError)
+		return
+	}
+
+	account, err := s.recordOIDCLogin(userID, claims)
+	if err != nil {
+		logger.Error("Failed to record login", "userID", userID, "error", err)
+		http.Error(w, "failed to record login", http.StatusInternalServerError)
+		return
+	}
+	if account.Disabled {
+		logger.Warn("Disabled user denied login", "userID", userID)
+		http.Error(w, "account disabled", http.StatusForbidden)
+		return
+	}
+	if err := s.recordIdentity(identityID, userID, id, claims); err != nil {
+		logger.Error("Failed to record identity", "identityID", identityID, "error", err)
+		http.Error(w, "failed to record login", http.StatusInternalServerError)
+		return
+	}
+
+	// Store complete token for future refresh, by identity since linked
+	// logins each have their own
 	logger.Debug("Processing token storage", "hasRefreshToken", tok.RefreshToken != "", "expiry", tok.Expiry)
 	if tok.RefreshToken != "" {
-		var claims map[string]any
-		if err := idToken.Claims(&claims); err != nil {
-			logger.Error("Failed to extract claims from ID token", "error", err)
-			http.Error(w, "token claims invalid", http.StatusUnauthorized)
-			return
-		}
-
-		userID := userIDFromClaims(claims)
-		if userID != "" {
-			if err := s.store.PutRefreshToken(userID, tok); err != nil {
-				logger.Error("Failed to persist refresh token", "userID", userID, "error", err)
-			}
-			logger.Debug("Stored oauth2 token for user", "userID", userID, "hasRefresh", tok.RefreshToken != "", "expiry", tok.Expiry)
-		} else {
-			logger.Debug("Failed to calculate userID from claims")
+		if err := s.store.PutRefreshToken(identityID, tok); err != nil {
+			logger.Error("Failed to persist refresh token", "userID", userID, "error", err)
 		}
+		logger.Debug("Stored oauth2 token for user", "userID", userID, "hasRefresh", tok.RefreshToken != "", "expiry", tok.Expiry)
 	} else {
 		logger.Debug("No refresh token in oauth2 token - refresh will not be possible")
 	}
 
-	// Set session cookie
-	prefixedToken := id + ":" + rawIDToken
-	val, err := s.sessionCookie.Encode("session", prefixedToken)
-	if err != nil {
-		logger.Error("Failed to encode session cookie", "error", err)
-		http.Error(w, "session encoding failed", http.StatusInternalServerError)
-		return
-	}
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    val,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteLaxMode,
-		MaxAge:   int(sessionMaxAge.Seconds()),
-	})
+	if err := s.startSession(w, r, userID, id, rawIDToken); err != nil {
+		logger.Error("Failed to start session", "userID", userID, "error", err)
+		http.Error(w, "session creation failed", http.StatusInternalServerError)
+		return
+	}
 
 	http.Redirect(w, r, saved.Return, http.StatusFound)
 }
 
 func (s *Server) logout(w http.ResponseWriter, r *http.Request) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    "",
-		Path:     "/",
-		MaxAge:   -1,
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteLaxMode,
-	})
+	if token, ok := s.sessionToken(r); ok {
+		if err := s.store.DeleteSession(sessionID(token)); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			logger.Error("Failed to delete session", "error", err)
+		}
+	}
+	clearSessionCookie(w)
 	logger.Info("User logout completed")
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (s *Server) simpleLogin(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	fmt.Fprint(w, `<h1>Login</h1><style>button{display:block;margin:10px 0;padding:10px 20px;}</style>`)
-	for id := range s.authProviders {
-		fmt.Fprintf(w, `<form action="/auth/login/%s"><button>%s</button></form>`, id, s.authProviders[id].name)
+	s.renderLogin(w, http.StatusOK, r.URL.Query().Get("return"), "")
+}
+
+// safeReturn keeps a post-login return path relative, so the login can't be
+// used to redirect elsewhere.
+func safeReturn(ret string) string {
+	if ret == "" {
+		return "/"
 	}
+	if u, err := url.Parse(ret); err != nil || u.IsAbs() || u.Host != "" {
+		return "/"
+	}
+	return ret
 }
 
 // TODO(pbourke): this is no longer applicable with pat style api keys - review
 func (s *Server) getAPIToken(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("session")
-	if err != nil {
+	sess, _, ok := s.sessionFromCookie(r)
+	if !ok {
 		http.Error(w, "not logged in", http.StatusUnauthorized)
 		return
 	}
 
-	var prefixedToken string
-	if err := s.sessionCookie.Decode("session", cookie.Value, &prefixedToken); err != nil {
-		http.Error(w, "invalid session cookie", http.StatusUnauthorized)
+	if sess.ProviderID == config.LocalProviderID {
+		http.Error(w, "local logins have no ID token, create an API key instead", http.StatusBadRequest)
 		return
 	}
 
 	w.Header().Set("Content-Type", "text/plain")
-	w.Write([]byte(prefixedToken))
+	w.Write([]byte(sess.ProviderID + ":" + sess.IDToken))
 }
 
+// maxAPIKeyNameLength keeps key names to something that fits a listing.
+const maxAPIKeyNameLength = 100
+
 // generateAPIKey creates a new API key for the authenticated user
 func (s *Server) generateAPIKey(w http.ResponseWriter, r *http.Request) {
 	user, ok := r.Context().Value(userCtxKey{}).(*User)
@@ -194,35 +228,46 @@ func (s *Server) generateAPIKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate random 32-character key
-	keyBytes := make([]byte, 24) // 24 bytes = 32 chars in base64
-	if _, err := rand.Read(keyBytes); err != nil {
-		logger.Error("Failed to generate random bytes for API key", "error", err)
-		http.Error(w, "key generation failed", http.StatusInternalServerError)
+	// the body is optional; without one the key is unnamed and unrestricted
+	var req APIKeyCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, `{"error":"invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if len(req.Name) > maxAPIKeyNameLength {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("name must be at most %d characters", maxAPIKeyNameLength))
+		return
+	}
+	if req.ExpiresIn < 0 {
+		http.Error(w, `{"error":"expires_in must not be negative"}`, http.StatusBadRequest)
+		return
+	}
+	scopes, err := grantableScopes(user, req.Scopes)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// Create the API key with hab_live_ prefix
-	plainKey := "hab_live_" + base64.RawURLEncoding.EncodeToString(keyBytes)
-
-	// Hash the key for storage
-	keyHash := hashAPIKey(plainKey)
-
-	// Store the hashed key with the user's ID
-	if err := s.store.PutAPIKey(keyHash, user.UserID); err != nil {
-		logger.Error("Failed to store API key", "error", err, "userID", user.UserID)
+	key := storage.APIKey{UserID: user.UserID, Name: req.Name, Scopes: scopes}
+	if req.ExpiresIn > 0 {
+		key.ExpiresAt = time.Now().Unix() + req.ExpiresIn
+	}
+	plainKey, key, err := s.issueAPIKey(key)
+	if err != nil {
+		logger.Error("Failed to issue API key", "error", err, "userID", user.UserID)
 		http.Error(w, "failed to store key", http.StatusInternalServerError)
 		return
 	}
 
-	logger.Info("Generated new API key", "userID", user.UserID, "keyHash", truncateHash(keyHash))
-
 	// Return the plaintext key - this is the only time it will be shown
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"api_key": plainKey,
-		"message": "Save this key securely - it cannot be retrieved later",
-	})
+	resp := APIKeyCreateResponse{
+		APIKey:  plainKey,
+		Message: "Save this key securely - it cannot be retrieved later",
+		Key:     apiKeyInfo(key),
+	}
+	if err := writeJSON(w, http.StatusOK, resp); err != nil {
+		logger.Error("Failed to serialize API key", "userID", user.UserID, "error", err)
+	}
 }
 
 func (s *Server) listAPIKeys(w http.ResponseWriter, r *http.Request) {
@@ -232,28 +277,24 @@ func (s *Server) listAPIKeys(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	keyHashes, err := s.store.ListAPIKeyHashes(user.UserID)
+	stored, err := s.store.ListAPIKeys(user.UserID)
 	if err != nil {
 		logger.Error("Failed to list API keys", "error", err, "userID", user.UserID)
 		http.Error(w, "failed to list keys", http.StatusInternalServerError)
 		return
 	}
+	slices.SortFunc(stored, func(a, b storage.APIKey) int {
+		return cmp.Or(cmp.Compare(a.CreatedAt, b.CreatedAt), strings.Compare(a.Hash, b.Hash))
+	})
 
-	type KeyInfo struct {
-		KeyID string `json:"key_id"`
+	keys := make([]APIKeyInfo, len(stored))
+	for i, key := range stored {
+		keys[i] = apiKeyInfo(key)
 	}
 
-	keys := make([]KeyInfo, len(keyHashes))
-	for i, hash := range keyHashes {
-		keys[i] = KeyInfo{
-			KeyID: truncateHash(hash),
-		}
+	if err := writeJSON(w, http.StatusOK, APIKeyListResponse{Keys: keys}); err != nil {
+		logger.Error("Failed to serialize API keys", "userID", user.UserID, "error", err)
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{
-		"keys": keys,
-	})
 }
 
 // deleteAPIKey revokes a specific API key
@@ -270,7 +311,7 @@ func (s *Server) deleteAPIKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, found, err := s.store.GetAPIKey(keyHash)
+	key, found, err := s.store.GetAPIKey(keyHash)
 	if err != nil {
 		logger.Error("Failed to lookup API key for deletion", "error", err)
 		http.Error(w, "failed to lookup key", http.StatusInternalServerError)
@@ -282,8 +323,8 @@ func (s *Server) deleteAPIKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if userID != user.UserID {
-		logger.Warn("User attempted to delete another user's API key", "userID", user.UserID, "targetUserID", userID)
+	if key.UserID != user.UserID {
+		logger.Warn("User attempted to delete another user's API key", "userID", user.UserID, "targetUserID", key.UserID)
 		http.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
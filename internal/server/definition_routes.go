@@ -0,0 +1,202 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/brk3/habits/internal/logger"
+	"github.com/brk3/habits/internal/storage"
+	"github.com/brk3/habits/pkg/habit"
+	"github.com/go-chi/chi/v5"
+)
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+func (s *Server) getHabitDefinition(w http.ResponseWriter, r *http.Request) {
+	habitID := chi.URLParam(r, "habit_id")
+	userID := userIDFromContext(s.cfg.AuthEnabled, r)
+	if userID == "" || habitID == "" {
+		http.Error(w, `{"error":"user id and habit id are required"}`, http.StatusBadRequest)
+		return
+	}
+
+	d, found, err := s.store.GetHabitDefinition(userID, habitID)
+	if err != nil {
+		logger.Error("Failed to get habit definition", "user_id", userID, "habit_id", habitID, "error", err)
+		http.Error(w, `{"error":"storage error"}`, http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, `{"error":"habit not found"}`, http.StatusNotFound)
+		return
+	}
+
+	if err := writeJSON(w, http.StatusOK, d); err != nil {
+		logger.Error("Failed to serialize habit definition response", "user_id", userID, "habit_id", habitID, "error", err)
+		http.Error(w, `{"error":"failed to serialize response"}`, http.StatusInternalServerError)
+		return
+	}
+}
+
+// putHabitDefinition creates or replaces a habit's metadata. The name comes
+// from the URL and created_at is kept from any existing definition.
+func (s *Server) putHabitDefinition(w http.ResponseWriter, r *http.Request) {
+	habitID := chi.URLParam(r, "habit_id")
+	userID := userIDFromContext(s.cfg.AuthEnabled, r)
+	logger.Debug("Putting habit definition", "user_id", userID, "habit_id", habitID)
+	if userID == "" || habitID == "" {
+		http.Error(w, `{"error":"user id and habit id are required"}`, http.StatusBadRequest)
+		return
+	}
+
+	var d habit.HabitDefinition
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+		logger.Warn("Invalid JSON in put habit definition request", "error", err)
+		http.Error(w, `{"error":"invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+	d.Name = habitID
+	if err := validateHabitDefinition(d); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	existing, found, err := s.store.GetHabitDefinition(userID, habitID)
+	if err != nil {
+		logger.Error("Failed to get habit definition", "user_id", userID, "habit_id", habitID, "error", err)
+		http.Error(w, `{"error":"storage error"}`, http.StatusInternalServerError)
+		return
+	}
+	status := http.StatusCreated
+	d.CreatedAt = time.Now().Unix()
+	if found {
+		status = http.StatusOK
+		d.CreatedAt = existing.CreatedAt
+	}
+
+	if err := s.store.PutHabitDefinition(userID, d); err != nil {
+		logger.Error("Failed to store habit definition", "user_id", userID, "habit_id", habitID, "error", err)
+		http.Error(w, `{"error":"database write failed"}`, http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Habit definition stored", "user_id", userID, "habit_id", habitID, "created", !found)
+
+	if err := writeJSON(w, status, d); err != nil {
+		logger.Error("Failed to serialize habit definition response", "user_id", userID, "habit_id", habitID, "error", err)
+		http.Error(w, `{"error":"failed to serialize response"}`, http.StatusInternalServerError)
+		return
+	}
+}
+
+// deleteHabitDefinition removes a habit that has no entries. Habits with
+// history are removed with DELETE /habits/{habit_id} or archived instead.
+func (s *Server) deleteHabitDefinition(w http.ResponseWriter, r *http.Request) {
+	habitID := chi.URLParam(r, "habit_id")
+	userID := userIDFromContext(s.cfg.AuthEnabled, r)
+	logger.Info("Deleting habit definition", "user_id", userID, "habit_id", habitID)
+	if userID == "" || habitID == "" {
+		http.Error(w, `{"error":"user id and habit id are required"}`, http.StatusBadRequest)
+		return
+	}
+
+	entries, _, err := s.store.GetHabitRange(userID, habitID, storage.EntryQuery{Limit: 1})
+	if err != nil {
+		logger.Error("Failed to get habit entries", "user_id", userID, "habit_id", habitID, "error", err)
+		http.Error(w, `{"error":"storage error"}`, http.StatusInternalServerError)
+		return
+	}
+	if len(entries) > 0 {
+		http.Error(w, `{"error":"habit has entries; delete the habit or archive it instead"}`, http.StatusConflict)
+		return
+	}
+
+	err = s.store.DeleteHabitDefinition(userID, habitID)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, `{"error":"habit not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to delete habit definition", "user_id", userID, "habit_id", habitID, "error", err)
+		http.Error(w, `{"error":"storage error"}`, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func validateHabitDefinition(d habit.HabitDefinition) error {
+	const maxNameLength = 20
+	const maxDisplayNameLength = 64
+	const maxDescriptionLength = 1024
+	const maxIconLength = 32
+
+	if len(d.Name) == 0 || len(d.Name) > maxNameLength {
+		return fmt.Errorf("bad habit name: must be 1-%d characters", maxNameLength)
+	}
+	if len(d.DisplayName) > maxDisplayNameLength {
+		return fmt.Errorf("bad display name: must be 0-%d characters", maxDisplayNameLength)
+	}
+	if len(d.Description) > maxDescriptionLength {
+		return fmt.Errorf("bad description: must be 0-%d characters", maxDescriptionLength)
+	}
+	if d.Color != "" && !colorPattern.MatchString(d.Color) {
+		return fmt.Errorf("bad color: must be of the form #rrggbb")
+	}
+	if len(d.Icon) > maxIconLength {
+		return fmt.Errorf("bad icon: must be 0-%d characters", maxIconLength)
+	}
+	if d.Schedule != nil {
+		if err := validateSchedule(*d.Schedule); err != nil {
+			return err
+		}
+	}
+	if d.Target != nil {
+		return validateTarget(*d.Target)
+	}
+	return nil
+}
+
+func validateTarget(t habit.Target) error {
+	const maxUnitLength = 16
+
+	if !(t.Amount > 0) || math.IsInf(t.Amount, 0) {
+		return fmt.Errorf("bad target: amount must be positive")
+	}
+	if len(t.Unit) > maxUnitLength {
+		return fmt.Errorf("bad target: unit must be 0-%d characters", maxUnitLength)
+	}
+	if t.Period != habit.TargetPerDay && t.Period != habit.TargetPerWeek {
+		return fmt.Errorf("bad target: period must be day or week")
+	}
+	return nil
+}
+
+func validateSchedule(sched habit.Schedule) error {
+	switch sched.Frequency {
+	case habit.FrequencyDaily:
+	case habit.FrequencyWeekly:
+		if sched.Times < 1 || sched.Times > 7 {
+			return fmt.Errorf("bad schedule: weekly times must be 1-7")
+		}
+	case habit.FrequencyMonthly:
+		if sched.Times < 1 || sched.Times > 31 {
+			return fmt.Errorf("bad schedule: monthly times must be 1-31")
+		}
+	case habit.FrequencyWeekdays:
+		if len(sched.Weekdays) == 0 {
+			return fmt.Errorf("bad schedule: weekdays must not be empty")
+		}
+		for _, wd := range sched.Weekdays {
+			if wd < time.Sunday || wd > time.Saturday {
+				return fmt.Errorf("bad schedule: weekdays must be 0-6")
+			}
+		}
+	default:
+		return fmt.Errorf("bad schedule: frequency must be one of daily, weekly, monthly, weekdays")
+	}
+	return nil
+}
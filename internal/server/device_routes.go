@@ -0,0 +1,228 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/brk3/habits/internal/logger"
+	"github.com/brk3/habits/internal/storage"
+)
+
+// The device flow follows RFC 8628: the CLI asks for a code, the user
+// approves it in a browser where they are logged in through OIDC, and the
+// CLI polls until it is handed an API key.
+const (
+	deviceCodeTTL      = 10 * time.Minute
+	devicePollInterval = 5 * time.Second
+	// userCodeAlphabet has no vowels, so codes can't spell words, and no
+	// characters that are easily confused (RFC 8628 §6.1).
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+// startDevice stores a new device authorization, picking a user code that
+// isn't in use.
+func (s *Server) startDevice() (storage.DeviceAuthorization, error) {
+	for {
+		a := storage.DeviceAuthorization{
+			DeviceCode: rand.Text(),
+			UserCode:   newUserCode(),
+			ExpiresAt:  time.Now().Add(deviceCodeTTL).Unix(),
+		}
+		created, err := s.store.CreateDeviceAuthorization(a)
+		if err != nil || created {
+			return a, err
+		}
+	}
+}
+
+// pollDevice returns the RFC 8628 error for a device code that can't be
+// redeemed yet, or the approving user's ID and scopes. The store forgets a
+// decided authorization as it's polled, so it can only be redeemed once.
+func (s *Server) pollDevice(deviceCode string) (userID string, scopes []string, errCode string, err error) {
+	now := time.Now().Unix()
+	a, found, err := s.store.PollDeviceAuthorization(deviceCode, now)
+	switch {
+	case err != nil:
+		return "", nil, "", err
+	case !found:
+		return "", nil, "invalid_grant", nil
+	case a.ExpiresAt <= now:
+		return "", nil, "expired_token", nil
+	case a.Denied:
+		return "", nil, "access_denied", nil
+	case a.UserID != "":
+		return a.UserID, a.Scopes, "", nil
+	case now-a.LastPollAt < int64(devicePollInterval.Seconds()):
+		return "", nil, "slow_down", nil
+	}
+	return "", nil, "authorization_pending", nil
+}
+
+// purgeDevices deletes expired device authorizations in the background.
+func (s *Server) purgeDevices() {
+	ticker := time.NewTicker(deviceCodeTTL)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := s.store.DeleteExpiredDeviceAuthorizations(time.Now().Unix()); err != nil {
+			logger.Warn("Failed to purge expired device authorizations", "error", err)
+		}
+	}
+}
+
+func newUserCode() string {
+	b := make([]byte, userCodeLength)
+	_, _ = rand.Read(b)
+	for i := range b {
+		// the modulo bias is negligible for a code that lives 10 minutes
+		b[i] = userCodeAlphabet[int(b[i])%len(userCodeAlphabet)]
+	}
+	return string(b)
+}
+
+// normalizeUserCode accepts codes as typed, in any case and with or
+// without the dash.
+func normalizeUserCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(userCodeAlphabet, r) {
+			return r
+		}
+		return -1
+	}, code)
+}
+
+func formatUserCode(code string) string {
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
+
+// requestBaseURL is the scheme and host the client used to reach us,
+// allowing for a TLS terminating proxy in front.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func (s *Server) startDeviceAuth(w http.ResponseWriter, r *http.Request) {
+	a, err := s.startDevice()
+	if err != nil {
+		logger.Error("Failed to start device authorization", "error", err)
+		http.Error(w, `{"error":"storage error"}`, http.StatusInternalServerError)
+		return
+	}
+	deviceCode, userCode := a.DeviceCode, a.UserCode
+	verify := requestBaseURL(r) + "/auth/device/verify"
+	logger.Info("Started device authorization", "user_code", userCode)
+
+	resp := DeviceAuthResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                formatUserCode(userCode),
+		VerificationURI:         verify,
+		VerificationURIComplete: verify + "?code=" + url.QueryEscape(formatUserCode(userCode)),
+		ExpiresIn:               int(deviceCodeTTL.Seconds()),
+		Interval:                int(devicePollInterval.Seconds()),
+	}
+	if err := writeJSON(w, http.StatusOK, resp); err != nil {
+		logger.Error("Failed to serialize device authorization", "error", err)
+		http.Error(w, `{"error":"failed to serialize response"}`, http.StatusInternalServerError)
+		return
+	}
+}
+
+const devicePage = `<!doctype html><title>Habits device login</title>
+<style>body{font-family:sans-serif;margin:40px}input,button{font-size:1.2em;padding:8px;margin:4px}</style>
+<h1>Log in a device</h1>%s`
+
+func (s *Server) verifyDevicePage(w http.ResponseWriter, r *http.Request) {
+	code := html.EscapeString(r.URL.Query().Get("code"))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, devicePage, `<p>Check that this code matches the one shown in your terminal.
+Approving gives the device an API key for your account.</p>
+<form method="post">
+<input name="user_code" value="`+code+`" placeholder="XXXX-XXXX" autocomplete="off" required>
+<button name="action" value="approve">Approve</button>
+<button name="action" value="deny">Deny</button>
+</form>`)
+}
+
+func (s *Server) approveDevice(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(userCtxKey{}).(*User)
+	if !ok || user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := user.UserID
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	approve := r.PostForm.Get("action") == "approve"
+	userCode := normalizeUserCode(r.PostForm.Get("user_code"))
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// the device can't be given more than the approver holds
+	scopes, _ := grantableScopes(user, nil)
+	decided, err := s.store.DecideDeviceAuthorization(userCode, userID, scopes, approve, time.Now().Unix())
+	if err != nil {
+		logger.Error("Failed to decide device authorization", "user_id", userID, "error", err)
+		http.Error(w, "storage error", http.StatusInternalServerError)
+		return
+	}
+	if !decided {
+		logger.Warn("Device approval for unknown or expired code", "user_id", userID)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, devicePage, `<p>That code is invalid or has expired. Run <code>habits login</code> again.</p>`)
+		return
+	}
+	logger.Info("Device authorization decided", "user_id", userID, "approved", approve)
+	if approve {
+		fmt.Fprintf(w, devicePage, `<p>Device approved. You can return to your terminal.</p>`)
+	} else {
+		fmt.Fprintf(w, devicePage, `<p>Device denied.</p>`)
+	}
+}
+
+func (s *Server) deviceToken(w http.ResponseWriter, r *http.Request) {
+	var req DeviceTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.DeviceCode == "" {
+		http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+		return
+	}
+
+	userID, scopes, errCode, err := s.pollDevice(req.DeviceCode)
+	if err != nil {
+		logger.Error("Failed to poll device authorization", "error", err)
+		http.Error(w, `{"error":"server_error"}`, http.StatusInternalServerError)
+		return
+	}
+	if errCode != "" {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, errCode), http.StatusBadRequest)
+		return
+	}
+	apiKey, _, err := s.issueAPIKey(storage.APIKey{
+		UserID: userID,
+		Name:   "habits login " + time.Now().UTC().Format("2006-01-02"),
+		Scopes: scopes,
+	})
+	if err != nil {
+		logger.Error("Failed to issue API key for device", "user_id", userID, "error", err)
+		http.Error(w, `{"error":"server_error"}`, http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Device authorization redeemed", "user_id", userID)
+
+	if err := writeJSON(w, http.StatusOK, DeviceTokenResponse{APIKey: apiKey}); err != nil {
+		logger.Error("Failed to serialize device token", "user_id", userID, "error", err)
+		http.Error(w, `{"error":"failed to serialize response"}`, http.StatusInternalServerError)
+		return
+	}
+}
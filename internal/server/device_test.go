@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/brk3/habits/internal/storage"
+)
+
+func TestDeviceLogin(t *testing.T) {
+	store := newMemStore()
+	h := newTestServerWithAuth(t, store)
+
+	approverKey := "hab_live_approver123456789012345678"
+	if err := store.PutAPIKey(storage.APIKey{Hash: hashAPIKey(approverKey), UserID: "user-approver", Scopes: storage.Scopes}); err != nil {
+		t.Fatalf("PutAPIKey failed: %v", err)
+	}
+
+	rr := mockRequest(h, http.MethodPost, "/auth/device", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d want 200", rr.Code)
+	}
+	var start DeviceAuthResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &start); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if start.DeviceCode == "" || len(start.UserCode) != 9 || !strings.HasSuffix(start.VerificationURI, "/auth/device/verify") {
+		t.Fatalf("unexpected device authorization %+v", start)
+	}
+
+	poll := func() (int, string) {
+		rr := mockRequest(h, http.MethodPost, "/auth/device/token", DeviceTokenRequest{DeviceCode: start.DeviceCode})
+		var body map[string]string
+		_ = json.Unmarshal(rr.Body.Bytes(), &body)
+		if rr.Code == http.StatusOK {
+			return rr.Code, body["api_key"]
+		}
+		return rr.Code, body["error"]
+	}
+	if code, e := poll(); code != http.StatusBadRequest || e != "authorization_pending" {
+		t.Fatalf("got %d %q, want authorization_pending", code, e)
+	}
+	if _, e := poll(); e != "slow_down" {
+		t.Fatalf("got %q, want slow_down", e)
+	}
+
+	// without a login the approval page sends the browser to log in first
+	req := httptest.NewRequest(http.MethodGet, "/auth/device/verify?code="+start.UserCode, nil)
+	req.Header.Set("Accept", "text/html")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if loc := rr.Header().Get("Location"); rr.Code != http.StatusFound || !strings.Contains(loc, "return=") {
+		t.Fatalf("got %d to %q, want a login redirect that returns here", rr.Code, loc)
+	}
+
+	approve := func(userCode string) int {
+		form := url.Values{"user_code": {userCode}, "action": {"approve"}}
+		req := httptest.NewRequest(http.MethodPost, "/auth/device/verify", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer "+approverKey)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if code := approve("nope-nope"); code != http.StatusBadRequest {
+		t.Fatalf("got %d want 400 for an unknown code", code)
+	}
+	// codes are accepted as typed
+	if code := approve(strings.ToLower(strings.ReplaceAll(start.UserCode, "-", " "))); code != http.StatusOK {
+		t.Fatalf("got %d want 200", code)
+	}
+
+	code, apiKey := poll()
+	if code != http.StatusOK || !strings.HasPrefix(apiKey, "hab_live_") {
+		t.Fatalf("got %d %q, want an API key", code, apiKey)
+	}
+	if key, found, _ := store.GetAPIKey(hashAPIKey(apiKey)); !found || key.UserID != "user-approver" {
+		t.Fatalf("issued key belongs to %q (found=%v), want user-approver", key.UserID, found)
+	}
+	if _, e := poll(); e != "invalid_grant" {
+		t.Fatalf("got %q, want invalid_grant once redeemed", e)
+	}
+}
+
+func TestDeviceLogin_SharedStore(t *testing.T) {
+	store := newMemStore()
+	first := newTestServerWithAuth(t, store)
+	second := newTestServerWithAuth(t, store)
+
+	approverKey := "hab_live_approver123456789012345678"
+	if err := store.PutAPIKey(storage.APIKey{Hash: hashAPIKey(approverKey), UserID: "user-approver", Scopes: storage.Scopes}); err != nil {
+		t.Fatalf("PutAPIKey failed: %v", err)
+	}
+
+	rr := mockRequest(first, http.MethodPost, "/auth/device", nil)
+	var start DeviceAuthResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &start); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+
+	// the approval and the poll each reach a different replica
+	form := url.Values{"user_code": {start.UserCode}, "action": {"approve"}}
+	req := httptest.NewRequest(http.MethodPost, "/auth/device/verify", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+approverKey)
+	rr = httptest.NewRecorder()
+	second.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d want 200", rr.Code)
+	}
+
+	rr = mockRequest(first, http.MethodPost, "/auth/device/token", DeviceTokenRequest{DeviceCode: start.DeviceCode})
+	var token DeviceTokenResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &token); err != nil || rr.Code != http.StatusOK || token.APIKey == "" {
+		t.Fatalf("got %d %s, want an API key", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/brk3/habits/internal/importer"
+	"github.com/brk3/habits/internal/logger"
+	"github.com/brk3/habits/pkg/habit"
+)
+
+// maxImportBytes bounds the body of POST /import.
+const maxImportBytes = 64 << 20
+
+func (s *Server) exportData(w http.ResponseWriter, r *http.Request) {
+	userID := userIDFromContext(s.cfg.AuthEnabled, r)
+	logger.Info("Exporting user data", "user_id", userID)
+	if userID == "" {
+		http.Error(w, `{"error":"user id is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	export, err := s.buildExport(userID)
+	if err != nil {
+		logger.Error("Failed to export user data", "user_id", userID, "error", err)
+		http.Error(w, `{"error":"storage error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="habits-export-%s.json"`,
+		time.Now().UTC().Format("20060102")))
+	if err := writeJSON(w, http.StatusOK, export); err != nil {
+		logger.Error("Failed to serialize export", "user_id", userID, "error", err)
+		http.Error(w, `{"error":"failed to serialize response"}`, http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) buildExport(userID string) (*habit.Export, error) {
+	settings, err := s.store.GetUserSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+	defs, err := s.store.ListHabitDefinitions(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &habit.Export{
+		Version:    habit.ExportVersion,
+		ExportedAt: time.Now().Unix(),
+		Settings:   settings,
+		Habits:     make([]habit.ExportedHabit, 0, len(defs)),
+	}
+	for _, d := range defs {
+		entries, err := s.store.GetHabit(userID, d.Name)
+		if err != nil {
+			return nil, err
+		}
+		if entries == nil {
+			entries = []habit.Habit{}
+		}
+		export.Habits = append(export.Habits, habit.ExportedHabit{Definition: d, Entries: entries})
+	}
+	return export, nil
+}
+
+// importData merges an export into the caller's account. Everything is
+// validated before anything is written; definitions and settings in the
+// file replace existing ones and entries are upserted by ID.
+//
+// With ?format= naming an importer adapter, the body is instead a file from
+// another tracker; see importFile.
+func (s *Server) importData(w http.ResponseWriter, r *http.Request) {
+	userID := userIDFromContext(s.cfg.AuthEnabled, r)
+	logger.Info("Importing user data", "user_id", userID)
+	if userID == "" {
+		http.Error(w, `{"error":"user id is required"}`, http.StatusBadRequest)
+		return
+	}
+	if format := r.URL.Query().Get("format"); format != "" && format != "json" {
+		s.importFile(w, r, userID, format)
+		return
+	}
+
+	var export habit.Export
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportBytes)).Decode(&export); err != nil {
+		logger.Warn("Invalid JSON in import request", "user_id", userID, "error", err)
+		http.Error(w, `{"error":"invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+	if err := validateExport(&export); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := s.applyImport(userID, &export)
+	if err != nil {
+		logger.Error("Failed to import user data", "user_id", userID, "error", err)
+		http.Error(w, `{"error":"database write failed"}`, http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Imported user data", "user_id", userID, "habits", resp.Habits, "entries", resp.Entries)
+
+	if err := writeJSON(w, http.StatusOK, resp); err != nil {
+		logger.Error("Failed to serialize import response", "user_id", userID, "error", err)
+		http.Error(w, `{"error":"failed to serialize response"}`, http.StatusInternalServerError)
+		return
+	}
+}
+
+func validateExport(export *habit.Export) error {
+	if export.Version < 1 || export.Version > habit.ExportVersion {
+		return fmt.Errorf("unsupported export version %d, this server reads up to %d", export.Version, habit.ExportVersion)
+	}
+	if tz := export.Settings.Timezone; tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			return fmt.Errorf("invalid timezone %q", tz)
+		}
+	}
+
+	seen := make(map[string]bool, len(export.Habits))
+	for i := range export.Habits {
+		h := &export.Habits[i]
+		if err := validateHabitDefinition(h.Definition); err != nil {
+			return fmt.Errorf("habits[%d]: %w", i, err)
+		}
+		if seen[h.Definition.Name] {
+			return fmt.Errorf("habits[%d]: duplicate habit %s", i, h.Definition.Name)
+		}
+		seen[h.Definition.Name] = true
+
+		for j := range h.Entries {
+			e := &h.Entries[j]
+			if e.Name == "" {
+				e.Name = h.Definition.Name
+			}
+			if e.Name != h.Definition.Name {
+				return fmt.Errorf("habits[%d].entries[%d]: entry for %s under habit %s", i, j, e.Name, h.Definition.Name)
+			}
+			if err := validateHabit(*e); err != nil {
+				return fmt.Errorf("habits[%d].entries[%d]: %w", i, j, err)
+			}
+			// IDs end up in bolt keys, so only accept the ULIDs we hand out
+			if e.ID != "" && !habit.ValidID(e.ID) {
+				return fmt.Errorf("habits[%d].entries[%d]: invalid entry ID %q", i, j, e.ID)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Server) applyImport(userID string, export *habit.Export) (ImportResponse, error) {
+	var resp ImportResponse
+	if export.Settings.Timezone != "" {
+		if err := s.store.PutUserSettings(userID, export.Settings); err != nil {
+			return resp, err
+		}
+	}
+	for _, h := range export.Habits {
+		if err := s.store.ImportHabits(userID, h.Entries); err != nil {
+			return resp, err
+		}
+		resp.Entries += len(h.Entries)
+		d := h.Definition
+		if d.CreatedAt == 0 {
+			d.CreatedAt = time.Now().Unix()
+		}
+		// written after the entries so it replaces the default definition
+		// PutHabit creates
+		if err := s.store.PutHabitDefinition(userID, d); err != nil {
+			return resp, err
+		}
+		resp.Habits++
+	}
+	return resp, nil
+}
+
+// importFile converts a file from another tracker with the importer adapter
+// named by format and writes the entries in one batch. Adapter options come
+// from the query: habit, columns (field=Header pairs separated by commas)
+// and time_layout. Times without a zone are read in the caller's timezone.
+func (s *Server) importFile(w http.ResponseWriter, r *http.Request, userID, format string) {
+	adapter, ok := importer.Get(format)
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown import format %q, want one of %s",
+			format, strings.Join(importer.Formats(), ", ")))
+		return
+	}
+	loc, err := s.userLocation(r, userID)
+	if err != nil {
+		http.Error(w, `{"error":"invalid timezone"}`, http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	opts := importer.Options{
+		Habit:      q.Get("habit"),
+		TimeLayout: q.Get("time_layout"),
+		Location:   loc,
+	}
+	if columns := q.Get("columns"); columns != "" {
+		opts.Columns = map[string]string{}
+		for pair := range strings.SplitSeq(columns, ",") {
+			field, header, ok := strings.Cut(pair, "=")
+			if !ok {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid column mapping %q, want field=Header", pair))
+				return
+			}
+			opts.Columns[strings.TrimSpace(field)] = strings.TrimSpace(header)
+		}
+	}
+
+	entries, err := adapter(http.MaxBytesReader(w, r.Body, maxImportBytes), opts)
+	if err != nil {
+		logger.Warn("Failed to parse import file", "user_id", userID, "format", format, "error", err)
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	names := map[string]bool{}
+	for i, e := range entries {
+		if err := validateHabit(e); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("entry %d (%s): %s", i+1, e.Name, err))
+			return
+		}
+		names[e.Name] = true
+	}
+
+	if err := s.store.PutHabits(userID, entries); err != nil {
+		logger.Error("Failed to import entries", "user_id", userID, "format", format, "error", err)
+		http.Error(w, `{"error":"database write failed"}`, http.StatusInternalServerError)
+		return
+	}
+	resp := ImportResponse{Habits: len(names), Entries: len(entries)}
+	logger.Info("Imported file", "user_id", userID, "format", format, "habits", resp.Habits, "entries", resp.Entries)
+
+	if err := writeJSON(w, http.StatusOK, resp); err != nil {
+		logger.Error("Failed to serialize import response", "user_id", userID, "error", err)
+		http.Error(w, `{"error":"failed to serialize response"}`, http.StatusInternalServerError)
+		return
+	}
+}
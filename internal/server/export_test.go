@@ -0,0 +1,165 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brk3/habits/pkg/habit"
+)
+
+func TestExportImport_RoundTrip(t *testing.T) {
+	src := newTestServer(newMemStore())
+
+	now := time.Now().Unix()
+	for _, e := range []habit.Habit{
+		{Name: "guitar", Note: "scales", TimeStamp: now - 86400, Value: 30, Unit: "min"},
+		{Name: "guitar", Note: "chords", TimeStamp: now},
+		{Name: "reading", Note: "ch. 3", TimeStamp: now},
+	} {
+		if rr := mockRequest(src, http.MethodPost, "/habits/", e); rr.Code != http.StatusCreated {
+			t.Fatalf("got %d want 201", rr.Code)
+		}
+	}
+	rr := mockRequest(src, http.MethodPut, "/habits/guitar/definition",
+		habit.HabitDefinition{DisplayName: "Guitar", Color: "#ff8800"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d want 200", rr.Code)
+	}
+	if rr := mockRequest(src, http.MethodPut, "/settings", habit.UserSettings{Timezone: "Europe/Dublin"}); rr.Code != http.StatusOK {
+		t.Fatalf("got %d want 200", rr.Code)
+	}
+
+	rr = mockRequest(src, http.MethodGet, "/export", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d want 200", rr.Code)
+	}
+	var export habit.Export
+	if err := json.Unmarshal(rr.Body.Bytes(), &export); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if export.Version != habit.ExportVersion || len(export.Habits) != 2 {
+		t.Fatalf("unexpected export: %+v", export)
+	}
+
+	dstStore := newMemStore()
+	dst := newTestServer(dstStore)
+	// importing twice must not duplicate entries
+	for range 2 {
+		rr = mockRequest(dst, http.MethodPost, "/import", export)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("got %d want 200: %s", rr.Code, rr.Body.String())
+		}
+	}
+	var resp ImportResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if resp.Habits != 2 || resp.Entries != 3 {
+		t.Fatalf("unexpected import counts: %+v", resp)
+	}
+
+	rr = mockRequest(dst, http.MethodGet, "/export", nil)
+	var again habit.Export
+	if err := json.Unmarshal(rr.Body.Bytes(), &again); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if again.Settings.Timezone != "Europe/Dublin" {
+		t.Fatalf("settings not imported: %+v", again.Settings)
+	}
+	for i, h := range again.Habits {
+		want := export.Habits[i]
+		if h.Definition != want.Definition {
+			t.Fatalf("got definition %+v, want %+v", h.Definition, want.Definition)
+		}
+		if len(h.Entries) != len(want.Entries) {
+			t.Fatalf("%s: got %d entries, want %d", h.Definition.Name, len(h.Entries), len(want.Entries))
+		}
+		for j := range h.Entries {
+			if h.Entries[j] != want.Entries[j] {
+				t.Fatalf("got entry %+v, want %+v", h.Entries[j], want.Entries[j])
+			}
+		}
+	}
+}
+
+func TestImport_Invalid(t *testing.T) {
+	h := newTestServer(newMemStore())
+	now := time.Now().Unix()
+
+	for name, export := range map[string]habit.Export{
+		"future version": {Version: habit.ExportVersion + 1},
+		"bad timezone":   {Version: 1, Settings: habit.UserSettings{Timezone: "Not/AZone"}},
+		"mismatched entry": {Version: 1, Habits: []habit.ExportedHabit{{
+			Definition: habit.HabitDefinition{Name: "guitar"},
+			Entries:    []habit.Habit{{Name: "reading", TimeStamp: now}},
+		}}},
+		"bad entry": {Version: 1, Habits: []habit.ExportedHabit{{
+			Definition: habit.HabitDefinition{Name: "guitar"},
+			Entries:    []habit.Habit{{TimeStamp: -1}},
+		}}},
+		"bad entry ID": {Version: 1, Habits: []habit.ExportedHabit{{
+			Definition: habit.HabitDefinition{Name: "guitar"},
+			Entries:    []habit.Habit{{ID: "../x", TimeStamp: now}},
+		}}},
+	} {
+		rr := mockRequest(h, http.MethodPost, "/import", export)
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: got %d want 400", name, rr.Code)
+		}
+	}
+
+	// nothing was written by the rejected imports
+	rr := mockRequest(h, http.MethodGet, "/habits/", nil)
+	var list HabitListResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if len(list.Habits) != 0 {
+		t.Fatalf("expected no habits, got %v", list.Habits)
+	}
+}
+
+func TestImport_LoopFormat(t *testing.T) {
+	store := newMemStore()
+	h := newTestServer(store)
+	csv := "Date,Meditate,Guitar\n2024-03-02,2,0\n2024-03-01,2,2\n"
+
+	for range 2 {
+		req := httptest.NewRequest(http.MethodPost, "/import?format=loop&tz=Europe/Dublin", strings.NewReader(csv))
+		req.Header.Set("Authorization", "Bearer XXX")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("got %d want 200: %s", rr.Code, rr.Body.String())
+		}
+		var resp ImportResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal error: %v", err)
+		}
+		if resp.Habits != 2 || resp.Entries != 3 {
+			t.Fatalf("unexpected import counts: %+v", resp)
+		}
+	}
+	// re-importing the same file upserts the same entries
+	if n := len(store.habits["Meditate"]); n != 2 {
+		t.Fatalf("got %d Meditate entries, want 2", n)
+	}
+
+	rr := mockRequest(h, http.MethodPost, "/import?format=numbers", nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("got %d want 400 for unknown format", rr.Code)
+	}
+
+	// a timestamp that can't make an entry ID is a bad file, not a crash
+	req := httptest.NewRequest(http.MethodPost, "/import?format=csv", strings.NewReader("name,timestamp\nguitar,-1\n"))
+	req.Header.Set("Authorization", "Bearer XXX")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("got %d want 400 for an out of range timestamp", rr.Code)
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/brk3/habits/internal/logger"
+	"github.com/brk3/habits/internal/storage"
+)
+
+const (
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentRequestBytes bounds the body read to fingerprint a
+	// request. A full batch of entries with long notes fits well within it.
+	maxIdempotentRequestBytes = 16 << 20
+	// maxIdempotentResponseBytes bounds a stored response. Larger ones
+	// aren't kept, so a retry repeats the request.
+	maxIdempotentResponseBytes = 1 << 20
+	// maxIdempotencyKeysPerUser bounds the responses kept for one user.
+	// Past it, requests are handled without being remembered.
+	maxIdempotencyKeysPerUser = 1000
+	// idempotencyClaimTimeout is how long a key stays claimed by a request
+	// that never finishes, such as one on a replica that died.
+	idempotencyClaimTimeout  = time.Minute
+	idempotencyPurgeInterval = time.Hour
+)
+
+// Responses to requests carrying an Idempotency-Key header are kept in the
+// store for cfg.Server.IdempotencyWindow, so a client retrying after a
+// dropped connection gets the original response instead of creating a
+// second entry, whichever replica the retry reaches. Keys are scoped per
+// user and path.
+
+// idempotencyKey derives the stored key, which is a hash so it can't carry
+// arbitrary bytes into the store.
+func idempotencyKey(userID, path, key string) string {
+	sum := sha256.Sum256([]byte(userID + "\x00" + path + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// purgeIdempotencyRecords deletes expired records in the background.
+func (s *Server) purgeIdempotencyRecords() {
+	ticker := time.NewTicker(idempotencyPurgeInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := s.store.DeleteExpiredIdempotencyRecords(time.Now().Unix()); err != nil {
+			logger.Warn("Failed to purge expired idempotency records", "error", err)
+		}
+	}
+}
+
+// idempotent replays the stored response when a request repeats an
+// Idempotency-Key. Requests without the header are passed through, and a
+// key reused with a different body is rejected with 422. Server errors are
+// not remembered, so those requests can be retried with the same key.
+func (s *Server) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || s.cfg.Server.IdempotencyWindow <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			http.Error(w, `{"error":"Idempotency-Key too long"}`, http.StatusBadRequest)
+			return
+		}
+		userID := userIDFromContext(s.cfg.AuthEnabled, r)
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentRequestBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, `{"error":"request body too large"}`, http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, `{"error":"failed to read request body"}`, http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := time.Now()
+		count, err := s.store.CountIdempotencyRecords(userID, now.Unix())
+		if err != nil {
+			logger.Error("Failed to count idempotency records", "user_id", userID, "error", err)
+			http.Error(w, `{"error":"storage error"}`, http.StatusInternalServerError)
+			return
+		}
+		if count >= maxIdempotencyKeysPerUser {
+			logger.Warn("Too many idempotency keys, not remembering response", "user_id", userID, "path", r.URL.Path)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		fingerprint := sha256.Sum256(body)
+		rec := storage.IdempotencyRecord{
+			Key:         idempotencyKey(userID, r.URL.Path, key),
+			UserID:      userID,
+			Fingerprint: hex.EncodeToString(fingerprint[:]),
+			ExpiresAt:   now.Add(idempotencyClaimTimeout).Unix(),
+		}
+		prev, claimed, err := s.store.ClaimIdempotencyKey(rec, now.Unix())
+		if err != nil {
+			logger.Error("Failed to claim idempotency key", "user_id", userID, "error", err)
+			http.Error(w, `{"error":"storage error"}`, http.StatusInternalServerError)
+			return
+		}
+		if !claimed {
+			switch {
+			case prev.Fingerprint != "" && prev.Fingerprint != rec.Fingerprint:
+				logger.Warn("Idempotency key reused with a different request", "user_id", userID, "path", r.URL.Path)
+				http.Error(w, `{"error":"Idempotency-Key was already used for a different request"}`, http.StatusUnprocessableEntity)
+			case !prev.Done:
+				http.Error(w, `{"error":"a request with this Idempotency-Key is still in progress"}`, http.StatusConflict)
+			default:
+				logger.Debug("Replaying idempotent response", "user_id", userID, "path", r.URL.Path, "status", prev.Status)
+				w.Header().Set("Content-Type", prev.ContentType)
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(prev.Status)
+				_, _ = w.Write(prev.Body)
+			}
+			return
+		}
+
+		var buf bytes.Buffer
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ww.Tee(&buf)
+		defer func() {
+			if p := recover(); p != nil {
+				s.releaseIdempotencyKey(rec.Key)
+				panic(p)
+			}
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if status >= 500 || buf.Len() > maxIdempotentResponseBytes {
+				s.releaseIdempotencyKey(rec.Key)
+				return
+			}
+			rec.Done = true
+			rec.Status = status
+			rec.ContentType = ww.Header().Get("Content-Type")
+			rec.Body = buf.Bytes()
+			rec.ExpiresAt = time.Now().Add(s.cfg.Server.IdempotencyWindow).Unix()
+			if err := s.store.PutIdempotencyRecord(rec); err != nil {
+				logger.Error("Failed to store idempotent response", "user_id", userID, "error", err)
+				s.releaseIdempotencyKey(rec.Key)
+			}
+		}()
+		next.ServeHTTP(ww, r)
+	})
+}
+
+// releaseIdempotencyKey forgets a claim so the request can be retried.
+func (s *Server) releaseIdempotencyKey(key string) {
+	if err := s.store.DeleteIdempotencyRecord(key); err != nil {
+		logger.Warn("Failed to release idempotency key", "error", err)
+	}
+}
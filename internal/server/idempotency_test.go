@@ -0,0 +1,107 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/brk3/habits/internal/config"
+	"github.com/brk3/habits/pkg/habit"
+)
+
+func TestTrackHabit_IdempotencyKey(t *testing.T) {
+	store := newMemStore()
+	cfg := &config.Config{}
+	cfg.Server.IdempotencyWindow = time.Hour
+	s, _ := New(cfg, store)
+	h := s.Router()
+
+	post := func(key string, e habit.Habit) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(e)
+		req := httptest.NewRequest(http.MethodPost, "/habits/", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", key)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	e := habit.Habit{Name: "guitar", Note: "scales", TimeStamp: time.Now().Unix()}
+	first := post("key-1", e)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("got %d want 201", first.Code)
+	}
+	retry := post("key-1", e)
+	if retry.Code != http.StatusCreated || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("expected a replayed 201, got %d %v", retry.Code, retry.Header())
+	}
+	if retry.Body.String() != first.Body.String() {
+		t.Fatalf("replayed body %s differs from %s", retry.Body.String(), first.Body.String())
+	}
+	if n := len(store.habits["guitar"]); n != 1 {
+		t.Fatalf("got %d entries, want 1", n)
+	}
+
+	e.Note = "chords"
+	if rr := post("key-1", e); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("got %d want 422 for a reused key", rr.Code)
+	}
+	if rr := post("key-2", e); rr.Code != http.StatusCreated || rr.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("expected a fresh 201 for a new key, got %d", rr.Code)
+	}
+	if n := len(store.habits["guitar"]); n != 2 {
+		t.Fatalf("got %d entries, want 2", n)
+	}
+}
+
+func TestTrackHabit_IdempotencyKeySharedStore(t *testing.T) {
+	store := newMemStore()
+	cfg := &config.Config{}
+	cfg.Server.IdempotencyWindow = time.Hour
+	first, _ := New(cfg, store)
+	second, _ := New(cfg, store)
+
+	post := func(s *Server) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(habit.Habit{Name: "guitar", TimeStamp: time.Now().Unix()})
+		req := httptest.NewRequest(http.MethodPost, "/habits/", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "key-1")
+		rr := httptest.NewRecorder()
+		s.Router().ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := post(first); rr.Code != http.StatusCreated {
+		t.Fatalf("got %d want 201", rr.Code)
+	}
+	// A retry reaching another replica is replayed from the store.
+	if rr := post(second); rr.Code != http.StatusCreated || rr.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("expected a replayed 201, got %d %v", rr.Code, rr.Header())
+	}
+	if n := len(store.habits["guitar"]); n != 1 {
+		t.Fatalf("got %d entries, want 1", n)
+	}
+}
+
+func TestIdempotencyKey_BodyTooLarge(t *testing.T) {
+	store := newMemStore()
+	cfg := &config.Config{}
+	cfg.Server.IdempotencyWindow = time.Hour
+	s, _ := New(cfg, store)
+
+	body := bytes.Repeat([]byte("x"), maxIdempotentRequestBytes+1)
+	req := httptest.NewRequest(http.MethodPost, "/habits/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", "key-1")
+	rr := httptest.NewRecorder()
+	s.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("got %d want 413", rr.Code)
+	}
+	if n := len(store.idempotency); n != 0 {
+		t.Fatalf("got %d idempotency records, want 0", n)
+	}
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"cmp"
+	"net/http"
+	"time"
+
+	"github.com/brk3/habits/internal/logger"
+	"github.com/brk3/habits/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/oauth2"
+)
+
+// identityUserID returns the user an OIDC login logs in as: the user its
+// identity is linked to, or for a login that was never linked, the user
+// its identity ID names.
+func (s *Server) identityUserID(identityID string) (string, error) {
+	ident, found, err := s.store.GetIdentity(identityID)
+	if err != nil {
+		return "", err
+	}
+	if found {
+		return ident.UserID, nil
+	}
+	return identityID, nil
+}
+
+// recordIdentity creates or updates the identity of an OIDC login, linking
+// it to userID.
+func (s *Server) recordIdentity(identityID, userID, providerID string, claims map[string]any) error {
+	ident, found, err := s.store.GetIdentity(identityID)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	if !found {
+		ident = storage.Identity{ID: identityID, CreatedAt: now}
+	}
+	// identities linked by an admin merge start out without these
+	ident.UserID = userID
+	ident.ProviderID = providerID
+	ident.Issuer = strClaim(claims, "iss")
+	ident.Subject = strClaim(claims, "sub")
+	ident.Email = cmp.Or(strClaim(claims, "email"), ident.Email)
+	ident.LastLoginAt = now
+	return s.store.PutIdentity(ident)
+}
+
+// deleteRefreshTokens forgets the refresh tokens of all of a user's logins.
+func (s *Server) deleteRefreshTokens(userID string) error {
+	identities, err := s.store.ListIdentities(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.store.DeleteRefreshToken(userID); err != nil {
+		return err
+	}
+	for _, ident := range identities {
+		if err := s.store.DeleteRefreshToken(ident.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkLogin starts a login with another provider that links it to the
+// logged in user's account instead of logging in as it.
+func (s *Server) linkLogin(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(userCtxKey{}).(*User)
+	if !ok || user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	// the callback checks the browser is still logged in as the same
+	// user, which only a session can show
+	if user.SessionID == "" {
+		http.Error(w, `{"error":"linking a login needs a browser session"}`, http.StatusBadRequest)
+		return
+	}
+	id := chi.URLParam(r, "id")
+	if _, ok := s.authProviders[id]; !ok {
+		http.Error(w, "unknown provider", http.StatusNotFound)
+		return
+	}
+	s.redirectToProvider(w, r, id, authState{
+		Return:     safeReturn(r.URL.Query().Get("return")),
+		LinkUserID: user.UserID,
+	})
+}
+
+// finishLink links the identity that just logged in to the account that
+// asked for it. If the identity already logged in as another user, that
+// user, likely a duplicate made by logging in with the wrong provider, is
+// merged into the account.
+func (s *Server) finishLink(w http.ResponseWriter, r *http.Request, providerID, identityID string, claims map[string]any, tok *oauth2.Token, saved authState) {
+	sess, _, ok := s.sessionFromCookie(r)
+	if !ok || sess.UserID != saved.LinkUserID {
+		logger.Warn("Link callback without the linking user's session", "provider", providerID, "userID", saved.LinkUserID)
+		http.Error(w, "not logged in as the linking user", http.StatusForbidden)
+		return
+	}
+
+	owner, err := s.identityUserID(identityID)
+	if err != nil {
+		logger.Error("Failed to look up identity", "identityID", identityID, "error", err)
+		http.Error(w, "failed to look up identity", http.StatusInternalServerError)
+		return
+	}
+	if owner != saved.LinkUserID {
+		account, _, err := s.store.GetAccount(owner)
+		if err != nil {
+			logger.Error("Failed to look up account", "userID", owner, "error", err)
+			http.Error(w, "failed to look up account", http.StatusInternalServerError)
+			return
+		}
+		if account.Disabled {
+			logger.Warn("Refused to merge a disabled user", "userID", owner, "into", saved.LinkUserID)
+			http.Error(w, "account disabled", http.StatusForbidden)
+			return
+		}
+		if err := s.store.MergeUser(owner, saved.LinkUserID); err != nil {
+			logger.Error("Failed to merge user", "userID", owner, "into", saved.LinkUserID, "error", err)
+			http.Error(w, "failed to merge accounts", http.StatusInternalServerError)
+			return
+		}
+		logger.Info("Merged user into linked account", "userID", owner, "into", saved.LinkUserID)
+	}
+
+	if err := s.recordIdentity(identityID, saved.LinkUserID, providerID, claims); err != nil {
+		logger.Error("Failed to link identity", "identityID", identityID, "userID", saved.LinkUserID, "error", err)
+		http.Error(w, "failed to link login", http.StatusInternalServerError)
+		return
+	}
+	if tok.RefreshToken != "" {
+		if err := s.store.PutRefreshToken(identityID, tok); err != nil {
+			logger.Error("Failed to persist refresh token", "identityID", identityID, "error", err)
+		}
+	}
+	RecordAuthEvent("link", "success", providerID)
+	logger.Info("Linked login", "provider", providerID, "identityID", identityID, "userID", saved.LinkUserID)
+	http.Redirect(w, r, saved.Return, http.StatusFound)
+}
+
+func (s *Server) listIdentities(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(userCtxKey{}).(*User)
+	if !ok || user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	stored, err := s.store.ListIdentities(user.UserID)
+	if err != nil {
+		logger.Error("Failed to list identities", "user_id", user.UserID, "error", err)
+		http.Error(w, `{"error":"failed to list logins"}`, http.StatusInternalServerError)
+		return
+	}
+	identities := make([]IdentityInfo, len(stored))
+	for i, ident := range stored {
+		identities[i] = identityInfo(ident)
+	}
+	if err := writeJSON(w, http.StatusOK, IdentityListResponse{Identities: identities}); err != nil {
+		logger.Error("Failed to serialize identities", "user_id", user.UserID, "error", err)
+	}
+}
+
+func identityInfo(ident storage.Identity) IdentityInfo {
+	return IdentityInfo{
+		ID:          ident.ID,
+		ProviderID:  ident.ProviderID,
+		Issuer:      ident.Issuer,
+		Subject:     ident.Subject,
+		Email:       ident.Email,
+		CreatedAt:   ident.CreatedAt,
+		LastLoginAt: ident.LastLoginAt,
+	}
+}
+
+// unlinkIdentity removes a linked login from the user's account and logs
+// out its sessions. Logging in with it again starts a new, empty account.
+func (s *Server) unlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(userCtxKey{}).(*User)
+	if !ok || user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	ident, found, err := s.store.GetIdentity(id)
+	if err != nil {
+		logger.Error("Failed to look up identity", "identityID", id, "error", err)
+		http.Error(w, `{"error":"failed to look up login"}`, http.StatusInternalServerError)
+		return
+	}
+	// other users' logins are reported as missing rather than forbidden,
+	// so their IDs can't be probed
+	if !found || ident.UserID != user.UserID {
+		http.Error(w, `{"error":"login not found"}`, http.StatusNotFound)
+		return
+	}
+	// a login always logs in as the user its ID names, linked or not
+	if ident.ID == user.UserID {
+		http.Error(w, `{"error":"the login that created the account can't be unlinked"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := s.store.DeleteIdentity(id); err != nil {
+		logger.Error("Failed to delete identity", "identityID", id, "error", err)
+		http.Error(w, `{"error":"failed to unlink login"}`, http.StatusInternalServerError)
+		return
+	}
+	if err := s.store.DeleteRefreshToken(id); err != nil {
+		logger.Error("Failed to delete refresh token", "identityID", id, "error", err)
+	}
+	// sessions don't record which login started them, so log out all of
+	// the provider's
+	sessions, err := s.store.ListSessions(user.UserID)
+	if err != nil {
+		logger.Error("Failed to list sessions", "user_id", user.UserID, "error", err)
+	}
+	for _, sess := range sessions {
+		if sess.ProviderID != ident.ProviderID {
+			continue
+		}
+		if err := s.store.DeleteSession(sess.ID); err != nil {
+			logger.Error("Failed to delete session", "session", truncateHash(sess.ID), "error", err)
+		}
+	}
+	logger.Info("Unlinked login", "identityID", id, "provider", ident.ProviderID, "user_id", user.UserID)
+	w.WriteHeader(http.StatusNoContent)
+}
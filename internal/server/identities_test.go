@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brk3/habits/internal/storage"
+	"github.com/brk3/habits/pkg/habit"
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/oauth2"
+)
+
+func TestIdentityUserID(t *testing.T) {
+	srv, store := newSessionTestServer(t)
+	if err := store.PutIdentity(storage.Identity{ID: "user-b", UserID: "user-a"}); err != nil {
+		t.Fatalf("PutIdentity failed: %v", err)
+	}
+	for identityID, want := range map[string]string{"user-b": "user-a", "user-c": "user-c"} {
+		if got, err := srv.identityUserID(identityID); err != nil || got != want {
+			t.Errorf("%s: got %q (err %v) want %q", identityID, got, err, want)
+		}
+	}
+}
+
+func TestFinishLink(t *testing.T) {
+	srv, store := newSessionTestServer(t)
+	if err := store.PutSession(storage.Session{ID: sessionID("tok"), UserID: "user-a", ProviderID: "test", ExpiresAt: time.Now().Unix() + 60}); err != nil {
+		t.Fatalf("PutSession failed: %v", err)
+	}
+	// the duplicate made by logging in with the second provider first
+	if err := store.PutHabit("user-b", habit.Habit{Name: "guitar", TimeStamp: 100}); err != nil {
+		t.Fatalf("PutHabit failed: %v", err)
+	}
+	if err := store.PutAPIKey(storage.APIKey{Hash: "key-b", UserID: "user-b"}); err != nil {
+		t.Fatalf("PutAPIKey failed: %v", err)
+	}
+	if err := store.PutAccount(storage.Account{UserID: "user-b"}); err != nil {
+		t.Fatalf("PutAccount failed: %v", err)
+	}
+
+	claims := map[string]any{"iss": "https://other.example.com", "sub": "42", "email": "b@example.com"}
+	saved := authState{Return: "/habits", LinkUserID: "user-a"}
+	link := func(req *http.Request) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		srv.finishLink(rr, req, "test", "user-b", claims, &oauth2.Token{RefreshToken: "refresh"}, saved)
+		return rr
+	}
+
+	// the state alone mustn't link a login to whoever started the flow
+	if rr := link(httptest.NewRequest(http.MethodGet, "/auth/callback/test", nil)); rr.Code != http.StatusForbidden {
+		t.Fatalf("got %d want 403 without the linking user's session", rr.Code)
+	}
+	if got, _ := srv.identityUserID("user-b"); got != "user-b" {
+		t.Fatalf("expected no link yet, got %q", got)
+	}
+
+	rr := link(sessionCookieRequest(t, srv, http.MethodGet, "/auth/callback/test", "tok"))
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "/habits" {
+		t.Fatalf("got %d to %q, want 302 to /habits", rr.Code, rr.Header().Get("Location"))
+	}
+	ident, found, _ := store.GetIdentity("user-b")
+	if !found || ident.UserID != "user-a" || ident.ProviderID != "test" || ident.Issuer != "https://other.example.com" || ident.Email != "b@example.com" {
+		t.Fatalf("unexpected identity %+v (found=%v)", ident, found)
+	}
+	if key, _, _ := store.GetAPIKey("key-b"); key.UserID != "user-a" {
+		t.Fatalf("expected the duplicate's key to move, got %+v", key)
+	}
+	if _, found, _ := store.GetAccount("user-b"); found {
+		t.Fatal("expected the duplicate's account to be gone")
+	}
+	if _, found, _ := store.GetRefreshToken("user-b"); !found {
+		t.Fatal("expected the refresh token to be stored by identity")
+	}
+}
+
+func TestIdentityEndpoints(t *testing.T) {
+	srv, store := newSessionTestServer(t)
+	now := time.Now().Unix()
+	for _, ident := range []storage.Identity{
+		{ID: "user-a", UserID: "user-a", ProviderID: "test", CreatedAt: now - 60},
+		{ID: "user-b", UserID: "user-a", ProviderID: "other", CreatedAt: now},
+		{ID: "user-c", UserID: "user-c", ProviderID: "test", CreatedAt: now},
+	} {
+		if err := store.PutIdentity(ident); err != nil {
+			t.Fatalf("PutIdentity failed: %v", err)
+		}
+	}
+	for _, sess := range []storage.Session{
+		{ID: "sess-test", UserID: "user-a", ProviderID: "test", ExpiresAt: now + 60},
+		{ID: "sess-other", UserID: "user-a", ProviderID: "other", ExpiresAt: now + 60},
+	} {
+		if err := store.PutSession(sess); err != nil {
+			t.Fatalf("PutSession failed: %v", err)
+		}
+	}
+	if err := store.PutRefreshToken("user-b", &oauth2.Token{RefreshToken: "refresh"}); err != nil {
+		t.Fatalf("PutRefreshToken failed: %v", err)
+	}
+
+	request := func(method, id string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+		req := withAuthenticatedUser(httptest.NewRequest(method, "/auth/identities", nil), "user-a", "a@example.com")
+		if id != "" {
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", id)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	rr := request(http.MethodGet, "", srv.listIdentities)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d want 200", rr.Code)
+	}
+	var list IdentityListResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if len(list.Identities) != 2 || list.Identities[0].ID != "user-a" || list.Identities[1].ID != "user-b" {
+		t.Fatalf("unexpected identities %+v", list.Identities)
+	}
+
+	if rr := request(http.MethodDelete, "user-c", srv.unlinkIdentity); rr.Code != http.StatusNotFound {
+		t.Fatalf("got %d want 404 unlinking another user's login", rr.Code)
+	}
+	if rr := request(http.MethodDelete, "user-a", srv.unlinkIdentity); rr.Code != http.StatusBadRequest {
+		t.Fatalf("got %d want 400 unlinking the account's own login", rr.Code)
+	}
+	if rr := request(http.MethodDelete, "user-b", srv.unlinkIdentity); rr.Code != http.StatusNoContent {
+		t.Fatalf("got %d want 204", rr.Code)
+	}
+	if got, _ := srv.identityUserID("user-b"); got != "user-b" {
+		t.Fatalf("expected the unlinked login to log in as itself, got %q", got)
+	}
+	if _, found, _ := store.GetRefreshToken("user-b"); found {
+		t.Fatal("expected the unlinked login's refresh token to be deleted")
+	}
+	if _, found, _ := store.GetSession("sess-other"); found {
+		t.Fatal("expected the unlinked provider's sessions to be revoked")
+	}
+	if _, found, _ := store.GetSession("sess-test"); !found {
+		t.Fatal("expected other sessions to be kept")
+	}
+}
+
+func TestAdminMergeUser(t *testing.T) {
+	srv, store := newSessionTestServer(t)
+	srv.cfg.Admin.Users = []string{"user-admin"}
+	h := srv.Router()
+
+	adminKey := "hab_live_admin1234567890123456789012"
+	if err := store.PutAPIKey(storage.APIKey{Hash: hashAPIKey(adminKey), UserID: "user-admin", Scopes: storage.Scopes}); err != nil {
+		t.Fatalf("PutAPIKey failed: %v", err)
+	}
+	if err := store.PutAPIKey(storage.APIKey{Hash: "key-b", UserID: "user-b"}); err != nil {
+		t.Fatalf("PutAPIKey failed: %v", err)
+	}
+
+	request := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+adminKey)
+		req.Header.Set("Accept", "application/json")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := request("/admin/users/user-b/merge", `{}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("got %d want 400 without a target", rr.Code)
+	}
+	if rr := request("/admin/users/user-admin/merge", `{"into":"user-a"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("got %d want 400 merging yourself", rr.Code)
+	}
+	if rr := request("/admin/users/user-b/merge", `{"into":"user-a"}`); rr.Code != http.StatusNoContent {
+		t.Fatalf("got %d want 204", rr.Code)
+	}
+	if key, _, _ := store.GetAPIKey("key-b"); key.UserID != "user-a" {
+		t.Fatalf("expected the key to move, got %+v", key)
+	}
+	if got, _ := srv.identityUserID("user-b"); got != "user-a" {
+		t.Fatalf("expected the merged user's login to log in as user-a, got %q", got)
+	}
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/brk3/habits/internal/config"
+	"github.com/brk3/habits/internal/logger"
+	"github.com/brk3/habits/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	maxUsernameLength = 64
+	minPasswordLength = 8
+	// bcrypt ignores anything past 72 bytes, so longer passwords are
+	// refused rather than silently truncated.
+	maxPasswordLength = 72
+)
+
+// dummyPasswordHash is compared against when a login names an unknown user,
+// so the response takes as long as for a wrong password.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("habits-dummy-password"), bcrypt.DefaultCost)
+
+// NewLocalUser creates the record for a local account, hashing its password.
+func NewLocalUser(username, password string) (storage.LocalUser, error) {
+	if err := validateUsername(username); err != nil {
+		return storage.LocalUser{}, err
+	}
+	if len(password) < minPasswordLength {
+		return storage.LocalUser{}, fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	if len(password) > maxPasswordLength {
+		return storage.LocalUser{}, fmt.Errorf("password must be at most %d bytes", maxPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return storage.LocalUser{}, fmt.Errorf("failed to hash password: %w", err)
+	}
+	return storage.LocalUser{
+		Username:     username,
+		UserID:       localUserID(username),
+		PasswordHash: string(hash),
+		CreatedAt:    time.Now().Unix(),
+	}, nil
+}
+
+func validateUsername(username string) error {
+	if username == "" {
+		return errors.New("username is required")
+	}
+	if len(username) > maxUsernameLength {
+		return fmt.Errorf("username must be at most %d characters", maxUsernameLength)
+	}
+	if strings.IndexFunc(username, func(r rune) bool { return unicode.IsSpace(r) || !unicode.IsPrint(r) }) >= 0 {
+		return errors.New("username must not contain spaces or control characters")
+	}
+	return nil
+}
+
+// localUserID derives a local account's user ID the way OIDC users' IDs are
+// derived, with the local provider standing in for the issuer.
+func localUserID(username string) string {
+	return userIDFromClaims(map[string]any{"iss": config.LocalProviderID, "sub": username})
+}
+
+// checkLocalPassword returns the local user if the password is theirs.
+func (s *Server) checkLocalPassword(username, password string) (storage.LocalUser, bool) {
+	u, found, err := s.store.GetLocalUser(username)
+	if err != nil {
+		logger.Error("Failed to look up local user", "username", username, "error", err)
+		return storage.LocalUser{}, false
+	}
+	if !found {
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return storage.LocalUser{}, false
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)); err != nil {
+		return storage.LocalUser{}, false
+	}
+	return u, true
+}
+
+func (s *Server) localLogin(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	username := r.PostForm.Get("username")
+	ret := safeReturn(r.PostForm.Get("return"))
+
+	u, ok := s.checkLocalPassword(username, r.PostForm.Get("password"))
+	if !ok {
+		logger.Warn("Local login failed", "username", username, "ip", clientIP(r))
+		RecordAuthEvent("login", "failed", config.LocalProviderID)
+		s.renderLogin(w, http.StatusUnauthorized, ret, "Invalid username or password.")
+		return
+	}
+
+	account, err := s.recordLogin(u.UserID, func(a *storage.Account) {
+		a.Name = cmp.Or(a.Name, u.Username)
+	})
+	if err != nil {
+		logger.Error("Failed to record login", "userID", u.UserID, "error", err)
+		http.Error(w, "failed to record login", http.StatusInternalServerError)
+		return
+	}
+	if account.Disabled {
+		logger.Warn("Disabled user denied login", "userID", u.UserID)
+		s.renderLogin(w, http.StatusForbidden, ret, "This account is disabled.")
+		return
+	}
+
+	if err := s.startSession(w, r, u.UserID, config.LocalProviderID, u.Username); err != nil {
+		logger.Error("Failed to start session", "userID", u.UserID, "error", err)
+		http.Error(w, "session creation failed", http.StatusInternalServerError)
+		return
+	}
+	RecordAuthEvent("login", "success", config.LocalProviderID)
+	http.Redirect(w, r, ret, http.StatusSeeOther)
+}
+
+// localSessionUser builds the user for a session from the local login. The
+// account is looked up on every request so deleting it logs the user out.
+func (s *Server) localSessionUser(sess *storage.Session) (*User, bool) {
+	u, found, err := s.store.GetLocalUser(sess.IDToken)
+	if err != nil {
+		logger.Error("Failed to look up local user", "username", sess.IDToken, "error", err)
+		return nil, false
+	}
+	if !found || u.UserID != sess.UserID {
+		logger.Debug("Local user for session no longer exists", "username", sess.IDToken)
+		return nil, false
+	}
+	return &User{
+		Subject: u.Username,
+		UserID:  u.UserID,
+		Claims: map[string]any{
+			"iss":                config.LocalProviderID,
+			"sub":                u.Username,
+			"preferred_username": u.Username,
+		},
+		SessionID: sess.ID,
+	}, true
+}
+
+// renderLogin writes the login page, with a button per OIDC provider and a
+// password form when local_auth is enabled.
+func (s *Server) renderLogin(w http.ResponseWriter, code int, ret, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	fmt.Fprint(w, `<h1>Login</h1><style>button,input{display:block;margin:10px 0;padding:10px 20px;}</style>`)
+	if message != "" {
+		fmt.Fprintf(w, `<p>%s</p>`, html.EscapeString(message))
+	}
+	ret = html.EscapeString(ret)
+	for id := range s.authProviders {
+		fmt.Fprintf(w, `<form action="/auth/login/%s"><input type="hidden" name="return" value="%s"><button>%s</button></form>`,
+			id, ret, s.authProviders[id].name)
+	}
+	if s.cfg.LocalAuth.Enabled {
+		fmt.Fprintf(w, `<form method="post" action="/auth/login/local"><input type="hidden" name="return" value="%s">`+
+			`<input name="username" placeholder="Username" autocomplete="username" required>`+
+			`<input type="password" name="password" placeholder="Password" autocomplete="current-password" required>`+
+			`<button>Log in</button></form>`, ret)
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/brk3/habits/internal/config"
+)
+
+func TestNewLocalUser(t *testing.T) {
+	for _, tc := range []struct{ username, password string }{
+		{"", "password123"},
+		{"has space", "password123"},
+		{"alice", "short"},
+		{"alice", strings.Repeat("x", 73)},
+	} {
+		if _, err := NewLocalUser(tc.username, tc.password); err == nil {
+			t.Errorf("expected NewLocalUser(%q, %q) to fail", tc.username, tc.password)
+		}
+	}
+
+	u, err := NewLocalUser("alice", "password123")
+	if err != nil {
+		t.Fatalf("NewLocalUser failed: %v", err)
+	}
+	if u.PasswordHash == "password123" || u.UserID != localUserID("alice") || !strings.HasPrefix(u.UserID, "user-") {
+		t.Fatalf("unexpected user %+v", u)
+	}
+}
+
+func TestLocalLogin(t *testing.T) {
+	store := newMemStore()
+	cfg := &config.Config{AuthEnabled: true}
+	cfg.LocalAuth.Enabled = true
+	srv, err := New(cfg, store)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	h := srv.Router()
+
+	u, err := NewLocalUser("alice", "password123")
+	if err != nil {
+		t.Fatalf("NewLocalUser failed: %v", err)
+	}
+	if err := store.PutLocalUser(u); err != nil {
+		t.Fatalf("PutLocalUser failed: %v", err)
+	}
+
+	login := func(username, password string) *httptest.ResponseRecorder {
+		form := url.Values{"username": {username}, "password": {password}, "return": {"/habits"}}
+		req := httptest.NewRequest(http.MethodPost, "/auth/login/local", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	for _, creds := range [][2]string{{"alice", "wrong-password"}, {"bob", "password123"}} {
+		if rr := login(creds[0], creds[1]); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("got %d want 401 logging in as %s", rr.Code, creds[0])
+		}
+	}
+
+	rr := login("alice", "password123")
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/habits" {
+		t.Fatalf("got %d to %q, want a redirect to /habits", rr.Code, rr.Header().Get("Location"))
+	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "session" {
+		t.Fatalf("expected a session cookie, got %v", cookies)
+	}
+
+	get := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/habits", nil)
+		req.Header.Set("Accept", "application/json")
+		req.AddCookie(cookies[0])
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := get(); rr.Code != http.StatusOK {
+		t.Fatalf("got %d want 200 with the session", rr.Code)
+	}
+	sessions, _ := store.ListSessions(u.UserID)
+	if len(sessions) != 1 {
+		t.Fatalf("expected a session for %s, got %v", u.UserID, sessions)
+	}
+
+	// deleting the account ends its sessions
+	if err := store.DeleteLocalUser("alice"); err != nil {
+		t.Fatalf("DeleteLocalUser failed: %v", err)
+	}
+	if rr := get(); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("got %d want 401 once the account is gone", rr.Code)
+	}
+}
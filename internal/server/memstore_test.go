@@ -1,6 +1,9 @@
 package server
 
 import (
+	"cmp"
+	"maps"
+	"slices"
 	"sync"
 
 	"github.com/brk3/habits/internal/storage"
@@ -11,33 +14,76 @@ import (
 type memStore struct {
 	mu            sync.RWMutex
 	habits        map[string][]habit.Habit
-	apiKeys       map[string]string
+	definitions   map[string]habit.HabitDefinition
+	settings      map[string]habit.UserSettings
+	apiKeys       map[string]storage.APIKey
+	sessions      map[string]storage.Session
+	localUsers    map[string]storage.LocalUser
+	accounts      map[string]storage.Account
+	identities    map[string]storage.Identity
 	refreshTokens map[string]*oauth2.Token
+	idempotency   map[string]storage.IdempotencyRecord
+	devices       map[string]storage.DeviceAuthorization
+	// owners are the users that stored habits. Habits aren't kept per user,
+	// so they all share them.
+	owners map[string]bool
 }
 
 func newMemStore() *memStore {
 	return &memStore{
 		habits:        map[string][]habit.Habit{},
-		apiKeys:       map[string]string{},
+		definitions:   map[string]habit.HabitDefinition{},
+		settings:      map[string]habit.UserSettings{},
+		apiKeys:       map[string]storage.APIKey{},
+		sessions:      map[string]storage.Session{},
+		localUsers:    map[string]storage.LocalUser{},
+		accounts:      map[string]storage.Account{},
+		identities:    map[string]storage.Identity{},
 		refreshTokens: map[string]*oauth2.Token{},
+		idempotency:   map[string]storage.IdempotencyRecord{},
+		devices:       map[string]storage.DeviceAuthorization{},
+		owners:        map[string]bool{},
 	}
 }
 
 func (m *memStore) PutHabit(userID string, h habit.Habit) error {
+	return m.PutHabits(userID, []habit.Habit{h})
+}
+
+func (m *memStore) PutHabits(userID string, entries []habit.Habit) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.habits[h.Name] = append(m.habits[h.Name], h)
-
+	m.owners[userID] = true
+	for i := range entries {
+		h := &entries[i]
+		if h.ID == "" {
+			h.ID = habit.NewID(h.TimeStamp)
+		}
+		// like the real stores, putting an existing ID replaces that entry
+		existing := m.habits[h.Name]
+		if j := slices.IndexFunc(existing, func(e habit.Habit) bool { return e.ID == h.ID }); j >= 0 {
+			existing[j] = *h
+		} else {
+			m.habits[h.Name] = append(existing, *h)
+		}
+		if _, ok := m.definitions[h.Name]; !ok {
+			m.definitions[h.Name] = habit.HabitDefinition{Name: h.Name, CreatedAt: h.TimeStamp}
+		}
+	}
 	return nil
 }
 
+func (m *memStore) ImportHabits(userID string, entries []habit.Habit) error {
+	return m.PutHabits(userID, entries)
+}
+
 func (m *memStore) ListHabitNames(userID string) ([]string, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	out := []string{}
-	for habitKey := range m.habits {
+	for habitKey := range m.definitions {
 		out = append(out, habitKey)
 	}
 
@@ -51,6 +97,44 @@ func (m *memStore) GetHabit(userID, name string) ([]habit.Habit, error) {
 	return append([]habit.Habit(nil), m.habits[name]...), nil
 }
 
+func (m *memStore) GetHabitRange(userID, name string, q storage.EntryQuery) ([]habit.Habit, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := append([]habit.Habit(nil), m.habits[name]...)
+	slices.SortFunc(entries, func(a, b habit.Habit) int {
+		return cmp.Or(cmp.Compare(a.TimeStamp, b.TimeStamp), cmp.Compare(a.ID, b.ID))
+	})
+
+	var afterTS int64
+	var afterID string
+	if q.Cursor != "" {
+		var err error
+		if afterTS, afterID, err = storage.DecodeCursor(q.Cursor); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var out []habit.Habit
+	for _, e := range entries {
+		if q.From != 0 && e.TimeStamp < q.From {
+			continue
+		}
+		if q.To != 0 && e.TimeStamp >= q.To {
+			continue
+		}
+		if q.Cursor != "" && (e.TimeStamp < afterTS || (e.TimeStamp == afterTS && e.ID <= afterID)) {
+			continue
+		}
+		if q.Limit > 0 && len(out) == q.Limit {
+			last := out[len(out)-1]
+			return out, storage.EncodeCursor(last.TimeStamp, last.ID), nil
+		}
+		out = append(out, e)
+	}
+	return out, "", nil
+}
+
 func (m *memStore) GetHabitSummary(name string) (habit.HabitSummary, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -66,36 +150,143 @@ func (m *memStore) DeleteHabit(userID, name string) error {
 	defer m.mu.Unlock()
 
 	delete(m.habits, name)
+	if _, ok := m.definitions[name]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(m.definitions, name)
 	return nil
 }
 
-func (m *memStore) PutAPIKey(keyHash, userID string) error {
+func (m *memStore) GetHabitEntry(userID, name, id string) (habit.Habit, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, e := range m.habits[name] {
+		if e.ID == id {
+			return e, true, nil
+		}
+	}
+	return habit.Habit{}, false, nil
+}
+
+func (m *memStore) UpdateHabitEntry(userID, name string, e habit.Habit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.habits[name] {
+		if m.habits[name][i].ID == e.ID {
+			m.habits[name][i] = e
+			return nil
+		}
+	}
+	return storage.ErrNotFound
+}
+
+func (m *memStore) DeleteHabitEntry(userID, name, id string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.apiKeys[keyHash] = userID
+	for i, e := range m.habits[name] {
+		if e.ID == id {
+			m.habits[name] = append(m.habits[name][:i], m.habits[name][i+1:]...)
+			return nil
+		}
+	}
+	return storage.ErrNotFound
+}
+
+func (m *memStore) PutHabitDefinition(userID string, d habit.HabitDefinition) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.definitions[d.Name] = d
 	return nil
 }
 
-func (m *memStore) GetAPIKey(keyHash string) (string, bool, error) {
+func (m *memStore) GetHabitDefinition(userID, name string) (habit.HabitDefinition, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	d, found := m.definitions[name]
+	return d, found, nil
+}
+
+func (m *memStore) ListHabitDefinitions(userID string) ([]habit.HabitDefinition, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	userID, found := m.apiKeys[keyHash]
-	return userID, found, nil
+	out := []habit.HabitDefinition{}
+	for _, d := range m.definitions {
+		out = append(out, d)
+	}
+	slices.SortFunc(out, func(a, b habit.HabitDefinition) int { return cmp.Compare(a.Name, b.Name) })
+	return out, nil
+}
+
+func (m *memStore) DeleteHabitDefinition(userID, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.definitions[name]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(m.definitions, name)
+	return nil
 }
 
-func (m *memStore) ListAPIKeyHashes(userID string) ([]string, error) {
+func (m *memStore) GetUserSettings(userID string) (habit.UserSettings, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	var hashes []string
-	for hash, storedUserID := range m.apiKeys {
-		if storedUserID == userID {
-			hashes = append(hashes, hash)
+	return m.settings[userID], nil
+}
+
+func (m *memStore) PutUserSettings(userID string, settings habit.UserSettings) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.settings[userID] = settings
+	return nil
+}
+
+func (m *memStore) PutAPIKey(key storage.APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.apiKeys[key.Hash] = key
+	return nil
+}
+
+func (m *memStore) GetAPIKey(keyHash string) (storage.APIKey, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key, found := m.apiKeys[keyHash]
+	return key, found, nil
+}
+
+func (m *memStore) ListAPIKeys(userID string) ([]storage.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var keys []storage.APIKey
+	for _, key := range m.apiKeys {
+		if key.UserID == userID {
+			keys = append(keys, key)
 		}
 	}
-	return hashes, nil
+	return keys, nil
+}
+
+func (m *memStore) TouchAPIKey(keyHash string, lastUsedAt int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if key, found := m.apiKeys[keyHash]; found {
+		key.LastUsedAt = lastUsedAt
+		m.apiKeys[keyHash] = key
+	}
+	return nil
 }
 
 func (m *memStore) DeleteAPIKey(keyHash string) error {
@@ -106,6 +297,206 @@ func (m *memStore) DeleteAPIKey(keyHash string) error {
 	return nil
 }
 
+func (m *memStore) PutSession(sess storage.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[sess.ID] = sess
+	return nil
+}
+
+func (m *memStore) UpdateSession(sess storage.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, found := m.sessions[sess.ID]; !found {
+		return storage.ErrNotFound
+	}
+	m.sessions[sess.ID] = sess
+	return nil
+}
+
+func (m *memStore) GetSession(id string) (storage.Session, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sess, found := m.sessions[id]
+	return sess, found, nil
+}
+
+func (m *memStore) ListSessions(userID string) ([]storage.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var sessions []storage.Session
+	for _, sess := range m.sessions {
+		if sess.UserID == userID {
+			sessions = append(sessions, sess)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *memStore) DeleteSession(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *memStore) DeleteUserSessions(userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	maps.DeleteFunc(m.sessions, func(_ string, sess storage.Session) bool { return sess.UserID == userID })
+	return nil
+}
+
+func (m *memStore) DeleteExpiredSessions(now int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	maps.DeleteFunc(m.sessions, func(_ string, sess storage.Session) bool { return sess.ExpiresAt <= now })
+	return nil
+}
+
+func (m *memStore) ClaimIdempotencyKey(rec storage.IdempotencyRecord, now int64) (storage.IdempotencyRecord, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if prev, found := m.idempotency[rec.Key]; found && prev.ExpiresAt > now {
+		return prev, false, nil
+	}
+	m.idempotency[rec.Key] = rec
+	return storage.IdempotencyRecord{}, true, nil
+}
+
+func (m *memStore) PutIdempotencyRecord(rec storage.IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.idempotency[rec.Key] = rec
+	return nil
+}
+
+func (m *memStore) DeleteIdempotencyRecord(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.idempotency, key)
+	return nil
+}
+
+func (m *memStore) CountIdempotencyRecords(userID string, now int64) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var n int
+	for _, rec := range m.idempotency {
+		if rec.UserID == userID && rec.ExpiresAt > now {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *memStore) DeleteExpiredIdempotencyRecords(now int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	maps.DeleteFunc(m.idempotency, func(_ string, rec storage.IdempotencyRecord) bool { return rec.ExpiresAt <= now })
+	return nil
+}
+
+func (m *memStore) CreateDeviceAuthorization(a storage.DeviceAuthorization) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, b := range m.devices {
+		if b.UserCode == a.UserCode || b.DeviceCode == a.DeviceCode {
+			return false, nil
+		}
+	}
+	m.devices[a.DeviceCode] = a
+	return true, nil
+}
+
+func (m *memStore) DecideDeviceAuthorization(userCode, userID string, scopes []string, approve bool, now int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for k, a := range m.devices {
+		if a.UserCode != userCode || a.ExpiresAt <= now || a.UserID != "" || a.Denied {
+			continue
+		}
+		if approve {
+			a.UserID, a.Scopes = userID, scopes
+		} else {
+			a.Denied = true
+		}
+		m.devices[k] = a
+		return true, nil
+	}
+	return false, nil
+}
+
+func (m *memStore) PollDeviceAuthorization(deviceCode string, now int64) (storage.DeviceAuthorization, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, found := m.devices[deviceCode]
+	switch {
+	case !found, a.ExpiresAt <= now:
+	case a.UserID != "" || a.Denied:
+		delete(m.devices, deviceCode)
+	default:
+		polled := a
+		polled.LastPollAt = now
+		m.devices[deviceCode] = polled
+	}
+	return a, found, nil
+}
+
+func (m *memStore) DeleteExpiredDeviceAuthorizations(now int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	maps.DeleteFunc(m.devices, func(_ string, a storage.DeviceAuthorization) bool { return a.ExpiresAt <= now })
+	return nil
+}
+
+func (m *memStore) PutLocalUser(u storage.LocalUser) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.localUsers[u.Username] = u
+	return nil
+}
+
+func (m *memStore) GetLocalUser(username string) (storage.LocalUser, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	u, found := m.localUsers[username]
+	return u, found, nil
+}
+
+func (m *memStore) ListLocalUsers() ([]storage.LocalUser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.Collect(maps.Values(m.localUsers)), nil
+}
+
+func (m *memStore) DeleteLocalUser(username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.localUsers, username)
+	return nil
+}
+
 func (m *memStore) PutRefreshToken(userID string, token *oauth2.Token) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -130,6 +521,161 @@ func (m *memStore) DeleteRefreshToken(userID string) error {
 	return nil
 }
 
+func (m *memStore) PutIdentity(id storage.Identity) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.identities[id.ID] = id
+	return nil
+}
+
+func (m *memStore) GetIdentity(id string) (storage.Identity, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ident, found := m.identities[id]
+	return ident, found, nil
+}
+
+func (m *memStore) ListIdentities(userID string) ([]storage.Identity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var out []storage.Identity
+	for _, id := range m.identities {
+		if id.UserID == userID {
+			out = append(out, id)
+		}
+	}
+	slices.SortFunc(out, func(a, b storage.Identity) int { return cmp.Compare(a.CreatedAt, b.CreatedAt) })
+	return out, nil
+}
+
+func (m *memStore) DeleteIdentity(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.identities, id)
+	return nil
+}
+
+func (m *memStore) PutAccount(a storage.Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.accounts[a.UserID] = a
+	return nil
+}
+
+func (m *memStore) GetAccount(userID string) (storage.Account, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	a, found := m.accounts[userID]
+	return a, found, nil
+}
+
+func (m *memStore) ListAccounts() ([]storage.Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.Collect(maps.Values(m.accounts)), nil
+}
+
+func (m *memStore) ListUserStats() ([]storage.UserStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var stats []storage.UserStats
+	for userID := range m.owners {
+		st := storage.UserStats{UserID: userID, HabitCount: len(m.definitions)}
+		for _, entries := range m.habits {
+			for _, e := range entries {
+				st.EntryCount++
+				st.LastEntryAt = max(st.LastEntryAt, e.TimeStamp)
+			}
+		}
+		stats = append(stats, st)
+	}
+	return stats, nil
+}
+
+func (m *memStore) DeleteUser(userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.owners, userID)
+	if len(m.owners) == 0 {
+		clear(m.habits)
+		clear(m.definitions)
+	}
+	delete(m.settings, userID)
+	maps.DeleteFunc(m.apiKeys, func(_ string, k storage.APIKey) bool { return k.UserID == userID })
+	maps.DeleteFunc(m.sessions, func(_ string, sess storage.Session) bool { return sess.UserID == userID })
+	maps.DeleteFunc(m.localUsers, func(_ string, u storage.LocalUser) bool { return u.UserID == userID })
+	maps.DeleteFunc(m.identities, func(_ string, id storage.Identity) bool {
+		if id.UserID != userID {
+			return false
+		}
+		delete(m.refreshTokens, id.ID)
+		return true
+	})
+	delete(m.refreshTokens, userID)
+	maps.DeleteFunc(m.idempotency, func(_ string, rec storage.IdempotencyRecord) bool { return rec.UserID == userID })
+	maps.DeleteFunc(m.devices, func(_ string, a storage.DeviceAuthorization) bool { return a.UserID == userID })
+	delete(m.accounts, userID)
+	return nil
+}
+
+func (m *memStore) MergeUser(fromUserID, toUserID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.owners[fromUserID] {
+		delete(m.owners, fromUserID)
+		m.owners[toUserID] = true
+	}
+	if settings, ok := m.settings[fromUserID]; ok {
+		if _, ok := m.settings[toUserID]; !ok {
+			m.settings[toUserID] = settings
+		}
+		delete(m.settings, fromUserID)
+	}
+	for k, key := range m.apiKeys {
+		if key.UserID == fromUserID {
+			key.UserID = toUserID
+			m.apiKeys[k] = key
+		}
+	}
+	for k, sess := range m.sessions {
+		if sess.UserID == fromUserID {
+			sess.UserID = toUserID
+			m.sessions[k] = sess
+		}
+	}
+	for k, u := range m.localUsers {
+		if u.UserID == fromUserID {
+			u.UserID = toUserID
+			m.localUsers[k] = u
+		}
+	}
+	for k, id := range m.identities {
+		if id.UserID == fromUserID {
+			id.UserID = toUserID
+			m.identities[k] = id
+		}
+	}
+	maps.DeleteFunc(m.idempotency, func(_ string, rec storage.IdempotencyRecord) bool { return rec.UserID == fromUserID })
+	for k, a := range m.devices {
+		if a.UserID == fromUserID {
+			a.UserID = toUserID
+			m.devices[k] = a
+		}
+	}
+	delete(m.accounts, fromUserID)
+	return nil
+}
+
 func (m *memStore) Close() error {
 	return nil
 }
@@ -20,7 +20,7 @@ type Server struct {
 	store         storage.Store
 	authProviders map[string]*AuthProvider
 	cfg           *config.Config
-	sessionCookie *securecookie.SecureCookie
+	sessionCookie []securecookie.Codec
 }
 
 type AuthProvider struct {
@@ -38,12 +38,18 @@ func New(cfg *config.Config, store storage.Store) (*Server, error) {
 		cfg:   cfg,
 	}
 
+	if cfg.Server.IdempotencyWindow > 0 {
+		go srv.purgeIdempotencyRecords()
+	}
+
 	if cfg.AuthEnabled {
 		var err error
 		srv.authProviders, srv.sessionCookie, err = ConfigureOIDCProviders(cfg)
 		if err != nil {
 			return nil, err
 		}
+		go srv.purgeDevices()
+		go srv.purgeSessions()
 	}
 
 	logger.Info("Server initialization complete")
@@ -65,16 +71,32 @@ func (s *Server) Router() http.Handler {
 		r.Route("/auth", func(r chi.Router) {
 			r.Get("/login", s.simpleLogin)
 			r.Get("/login/{id}", s.login)
+			if s.cfg.LocalAuth.Enabled {
+				r.Post("/login/local", s.localLogin)
+			}
 			r.Get("/callback/{id}", s.callback)
 			r.Get("/logout", s.logout)
 			r.Get("/get_api_token", s.getAPIToken)
 
+			// device login for the CLI, approved in a logged in browser
+			r.Post("/device", s.startDeviceAuth)
+			r.Post("/device/token", s.deviceToken)
+
 			// API key management (requires auth)
 			r.Group(func(r chi.Router) {
 				r.Use(s.authMiddleware)
+				r.Use(habitsScope)
 				r.Post("/api_keys", s.generateAPIKey)
 				r.Get("/api_keys", s.listAPIKeys)
 				r.Delete("/api_keys/{keyHash}", s.deleteAPIKey)
+				r.Get("/device/verify", s.verifyDevicePage)
+				r.Post("/device/verify", s.approveDevice)
+				r.Get("/sessions", s.listSessions)
+				r.Delete("/sessions", s.logoutEverywhere)
+				r.Delete("/sessions/{id}", s.deleteSession)
+				r.Get("/link/{id}", s.linkLogin)
+				r.Get("/identities", s.listIdentities)
+				r.Delete("/identities/{id}", s.unlinkIdentity)
 			})
 		})
 	}
@@ -82,13 +104,71 @@ func (s *Server) Router() http.Handler {
 	r.Route("/habits", func(r chi.Router) {
 		if s.cfg.AuthEnabled {
 			r.Use(s.authMiddleware)
+			r.Use(habitsScope)
 			r.Use(s.userAwareMetricsMiddleware)
 		}
-		r.Post("/", s.trackHabit)
+		r.With(s.idempotent).Post("/", s.trackHabit)
 		r.Get("/", s.listHabits)
 		r.Get("/{habit_id}", s.getHabit)
 		r.Get("/{habit_id}/summary", s.getHabitSummary)
 		r.Delete("/{habit_id}", s.deleteHabit)
+		r.Get("/{habit_id}/definition", s.getHabitDefinition)
+		r.Put("/{habit_id}/definition", s.putHabitDefinition)
+		r.Delete("/{habit_id}/definition", s.deleteHabitDefinition)
+		r.Patch("/{habit_id}/entries/{entry_id}", s.updateHabitEntry)
+		r.Delete("/{habit_id}/entries/{entry_id}", s.deleteHabitEntry)
+	})
+
+	// a sibling of /habits rather than a child, so it can't collide with a
+	// habit named "batch"
+	r.Group(func(r chi.Router) {
+		if s.cfg.AuthEnabled {
+			r.Use(s.authMiddleware)
+			r.Use(habitsScope)
+			r.Use(s.userAwareMetricsMiddleware)
+		}
+		r.With(s.idempotent).Post("/habits:batch", s.trackHabits)
+	})
+
+	r.Route("/admin", func(r chi.Router) {
+		if s.cfg.AuthEnabled {
+			r.Use(s.authMiddleware)
+			r.Use(adminScope)
+		}
+		r.Use(s.adminOnly)
+		r.Get("/backup", s.getBackup)
+		r.Get("/users", s.listUsers)
+		r.Post("/users/{user_id}/disable", s.setUserDisabled(true))
+		r.Post("/users/{user_id}/enable", s.setUserDisabled(false))
+		r.Delete("/users/{user_id}", s.deleteUser)
+		r.Post("/users/{user_id}/merge", s.mergeUser)
+	})
+
+	r.Group(func(r chi.Router) {
+		if s.cfg.AuthEnabled {
+			r.Use(s.authMiddleware)
+			r.Use(habitsScope)
+		}
+		r.Get("/export", s.exportData)
+		r.Post("/import", s.importData)
+	})
+
+	r.Route("/account", func(r chi.Router) {
+		if s.cfg.AuthEnabled {
+			r.Use(s.authMiddleware)
+			r.Use(habitsScope)
+		}
+		r.Get("/export", s.exportAccount)
+		r.With(accountDeleteScope).Delete("/", s.deleteAccount)
+	})
+
+	r.Route("/settings", func(r chi.Router) {
+		if s.cfg.AuthEnabled {
+			r.Use(s.authMiddleware)
+			r.Use(habitsScope)
+		}
+		r.Get("/", s.getSettings)
+		r.Put("/", s.putSettings)
 	})
 
 	return r
@@ -9,6 +9,7 @@ import (
 
 	"github.com/brk3/habits/internal/config"
 	"github.com/brk3/habits/internal/storage"
+	"github.com/gorilla/securecookie"
 )
 
 func TestLogin_RedirectsToIDP(t *testing.T) {
@@ -98,6 +99,44 @@ func TestGetUserID_NoUserInContext(t *testing.T) {
 	}
 }
 
+func TestSessionCodecs_Rotation(t *testing.T) {
+	oldKey, newKey := config.NewSessionKey(), config.NewSessionKey()
+
+	before := &config.Config{}
+	before.Session.Keys = []config.SessionKey{oldKey}
+	oldCodecs, err := sessionCodecs(before)
+	if err != nil {
+		t.Fatalf("sessionCodecs failed: %v", err)
+	}
+	cookie, err := securecookie.EncodeMulti("session", "test:token", oldCodecs...)
+	if err != nil {
+		t.Fatalf("EncodeMulti failed: %v", err)
+	}
+
+	// after a rotation the old key still reads existing sessions
+	after := &config.Config{}
+	after.Session.Keys = []config.SessionKey{newKey, oldKey}
+	codecs, err := sessionCodecs(after)
+	if err != nil {
+		t.Fatalf("sessionCodecs failed: %v", err)
+	}
+	var got string
+	if err := securecookie.DecodeMulti("session", cookie, &got, codecs...); err != nil || got != "test:token" {
+		t.Fatalf("got %q, %v decoding a cookie signed before rotation", got, err)
+	}
+
+	// and once it is dropped they are logged out
+	dropped := &config.Config{}
+	dropped.Session.Keys = []config.SessionKey{newKey}
+	codecs, err = sessionCodecs(dropped)
+	if err != nil {
+		t.Fatalf("sessionCodecs failed: %v", err)
+	}
+	if err := securecookie.DecodeMulti("session", cookie, &got, codecs...); err == nil {
+		t.Fatal("expected a cookie signed with a dropped key to be rejected")
+	}
+}
+
 func newTestServerWithAuth(t *testing.T, st storage.Store) http.Handler {
 	mockOIDC := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/.well-known/openid-configuration" {
@@ -1,19 +1,181 @@
 package server
 
 import (
+	"github.com/brk3/habits/internal/storage"
 	"github.com/brk3/habits/pkg/habit"
 )
 
 type HabitListResponse struct {
-	Habits []string `json:"habits"`
+	Habits      []string                `json:"habits"`
+	Definitions []habit.HabitDefinition `json:"definitions"`
 }
 
 type HabitGetResponse struct {
-	HabitID string        `json:"habit_id"`
-	Entries []habit.Habit `json:"entries"`
+	HabitID    string        `json:"habit_id"`
+	Entries    []habit.Habit `json:"entries"`
+	NextCursor string        `json:"next_cursor,omitempty"`
 }
 
 type HabitSummaryResponse struct {
 	HabitID      string             `json:"habit_id"`
 	HabitSummary habit.HabitSummary `json:"habit_summary"`
 }
+
+// HabitEntryUpdateRequest is the body of PATCH /habits/{habit_id}/entries/{entry_id}.
+// Fields left nil keep their current value.
+type HabitEntryUpdateRequest struct {
+	Note      *string  `json:"note,omitempty"`
+	TimeStamp *int64   `json:"timestamp,omitempty"`
+	Value     *float64 `json:"value,omitempty"`
+	Unit      *string  `json:"unit,omitempty"`
+}
+
+// HabitBatchResult is the outcome of one item of POST /habits:batch. Entry
+// is set when the item was stored and Error when it was rejected.
+type HabitBatchResult struct {
+	Index int          `json:"index"`
+	Entry *habit.Habit `json:"entry,omitempty"`
+	Error string       `json:"error,omitempty"`
+}
+
+// HabitBatchResponse lists a result for every submitted item, in order.
+type HabitBatchResponse struct {
+	Created int                `json:"created"`
+	Failed  int                `json:"failed"`
+	Results []HabitBatchResult `json:"results"`
+}
+
+// ImportResponse counts what POST /import wrote.
+type ImportResponse struct {
+	Habits  int `json:"habits"`
+	Entries int `json:"entries"`
+}
+
+// DeviceAuthResponse starts a device login; see RFC 8628 §3.2.
+type DeviceAuthResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+type DeviceTokenRequest struct {
+	DeviceCode string `json:"device_code"`
+}
+
+type DeviceTokenResponse struct {
+	APIKey string `json:"api_key"`
+}
+
+// APIKeyCreateRequest is the optional body of POST /auth/api_keys. Keys get
+// every scope the caller has unless Scopes narrows them down.
+type APIKeyCreateRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes,omitempty"`
+	// ExpiresIn is the key's lifetime in seconds; zero keeps it until it
+	// is deleted.
+	ExpiresIn int64 `json:"expires_in,omitempty"`
+}
+
+// APIKeyInfo describes a key without revealing it. KeyID is what
+// DELETE /auth/api_keys/{key_id} takes.
+type APIKeyInfo struct {
+	KeyID      string   `json:"key_id"`
+	Name       string   `json:"name"`
+	CreatedAt  int64    `json:"created_at,omitempty"`
+	ExpiresAt  int64    `json:"expires_at,omitempty"`
+	LastUsedAt int64    `json:"last_used_at,omitempty"`
+	Scopes     []string `json:"scopes"`
+}
+
+type APIKeyCreateResponse struct {
+	APIKey  string     `json:"api_key"`
+	Message string     `json:"message"`
+	Key     APIKeyInfo `json:"key"`
+}
+
+type APIKeyListResponse struct {
+	Keys []APIKeyInfo `json:"keys"`
+}
+
+// SessionInfo describes a browser session. ID is what
+// DELETE /auth/sessions/{id} takes.
+type SessionInfo struct {
+	ID         string `json:"id"`
+	CreatedAt  int64  `json:"created_at"`
+	LastSeenAt int64  `json:"last_seen_at"`
+	ExpiresAt  int64  `json:"expires_at"`
+	UserAgent  string `json:"user_agent"`
+	IPAddress  string `json:"ip_address"`
+	// Current marks the session the request was made with.
+	Current bool `json:"current"`
+}
+
+type SessionListResponse struct {
+	Sessions []SessionInfo `json:"sessions"`
+}
+
+// AdminUserInfo describes a user to admins. Users from before accounts were
+// recorded only have their habit counts until they next log in.
+type AdminUserInfo struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email,omitempty"`
+	Name   string `json:"name,omitempty"`
+	// Username is set for users with a local_auth login.
+	Username   string `json:"username,omitempty"`
+	Admin      bool   `json:"admin"`
+	Disabled   bool   `json:"disabled"`
+	HabitCount int    `json:"habit_count"`
+	EntryCount int    `json:"entry_count"`
+	CreatedAt  int64  `json:"created_at,omitempty"`
+	// LastActiveAt is the latest of their last entry, login, session use
+	// and API key use.
+	LastActiveAt int64 `json:"last_active_at,omitempty"`
+}
+
+type AdminUserListResponse struct {
+	Users []AdminUserInfo `json:"users"`
+}
+
+// AdminMergeRequest names the user POST /admin/users/{user_id}/merge
+// moves everything into.
+type AdminMergeRequest struct {
+	Into string `json:"into"`
+}
+
+// IdentityInfo describes an OIDC login of the user. ID is what
+// DELETE /auth/identities/{id} takes.
+type IdentityInfo struct {
+	ID          string `json:"id"`
+	ProviderID  string `json:"provider_id"`
+	Issuer      string `json:"issuer"`
+	Subject     string `json:"subject"`
+	Email       string `json:"email,omitempty"`
+	CreatedAt   int64  `json:"created_at"`
+	LastLoginAt int64  `json:"last_login_at,omitempty"`
+}
+
+type IdentityListResponse struct {
+	Identities []IdentityInfo `json:"identities"`
+}
+
+// AccountExport is everything stored about a user, returned by
+// GET /account/export. Password hashes, tokens and key secrets are left out.
+type AccountExport struct {
+	UserID string `json:"user_id"`
+	// Account is missing for users who haven't logged in since accounts
+	// were recorded.
+	Account *storage.Account `json:"account,omitempty"`
+	// Username is set for users with a local_auth login.
+	Username string        `json:"username,omitempty"`
+	Data     *habit.Export `json:"data"`
+	APIKeys  []APIKeyInfo  `json:"api_keys"`
+	Sessions []SessionInfo `json:"sessions"`
+	// Identities are the user's OIDC logins.
+	Identities []IdentityInfo `json:"identities"`
+	// HasRefreshToken reports whether an OIDC refresh token is stored for
+	// any of their logins.
+	HasRefreshToken bool `json:"has_refresh_token"`
+}
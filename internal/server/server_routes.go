@@ -2,11 +2,14 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
-	"time"
+	"strconv"
 
 	"github.com/brk3/habits/internal/logger"
+	"github.com/brk3/habits/internal/storage"
 	"github.com/brk3/habits/pkg/habit"
 	"github.com/brk3/habits/pkg/versioninfo"
 	"github.com/go-chi/chi/v5"
@@ -18,6 +21,12 @@ func writeJSON(w http.ResponseWriter, code int, v any) error {
 	return json.NewEncoder(w).Encode(v)
 }
 
+// writeError is for error messages that may contain quotes, such as parse
+// errors, which can't be pasted into a JSON literal.
+func writeError(w http.ResponseWriter, code int, msg string) {
+	_ = writeJSON(w, code, map[string]string{"error": msg})
+}
+
 func (s *Server) getHabitSummary(w http.ResponseWriter, r *http.Request) {
 	habitID := chi.URLParam(r, "habit_id")
 	userID := userIDFromContext(s.cfg.AuthEnabled, r)
@@ -28,50 +37,62 @@ func (s *Server) getHabitSummary(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	currentStreak, longestSreak, err := s.computeStreaks(userID, habitID)
+	loc, err := s.userLocation(r, userID)
 	if err != nil {
-		logger.Error("Failed to compute streaks", "user_id", userID, "habit_id", habitID, "error", err)
-		http.Error(w, `{"error":"error computing streaks"}`, http.StatusInternalServerError)
+		http.Error(w, `{"error":"invalid timezone"}`, http.StatusBadRequest)
 		return
 	}
 
-	firstLogged, err := s.getFirstLogged(userID, habitID)
+	entries, err := s.store.GetHabit(userID, habitID)
 	if err != nil {
-		logger.Error("Failed to get first logged date", "user_id", userID, "habit_id", habitID, "error", err)
-		http.Error(w, `{"error":"error retrieving first logged date"}`, http.StatusInternalServerError)
+		logger.Error("Failed to get habit entries", "user_id", userID, "habit_id", habitID, "error", err)
+		http.Error(w, `{"error":"error retrieving habit entries"}`, http.StatusInternalServerError)
 		return
 	}
-
-	totalDaysDone, err := s.computeTotalDaysDone(userID, habitID)
+	def, _, err := s.store.GetHabitDefinition(userID, habitID)
 	if err != nil {
-		logger.Error("Failed to compute total days done", "user_id", userID, "habit_id", habitID, "error", err)
-		http.Error(w, `{"error":"error computing total days done"}`, http.StatusInternalServerError)
+		logger.Error("Failed to get habit definition", "user_id", userID, "habit_id", habitID, "error", err)
+		http.Error(w, `{"error":"error retrieving habit definition"}`, http.StatusInternalServerError)
 		return
 	}
+	sched := habitSchedule(def)
 
-	daysThisMonth, err := s.computeDaysThisMonth(userID, habitID)
-	if err != nil {
-		logger.Error("Failed to compute days this month", "user_id", userID, "habit_id", habitID, "error", err)
-		http.Error(w, `{"error":"error computing days this month"}`, http.StatusInternalServerError)
-		return
-	}
+	currentStreak, longestSreak := computeStreaks(entries, sched, loc)
+	thisPeriod, periodTarget, streakUnit := computePeriodProgress(entries, sched, loc)
 
-	bestMonth, err := s.computeBestMonth(userID, habitID)
+	firstLogged, err := getFirstLogged(habitID, entries)
 	if err != nil {
-		logger.Error("Failed to compute best month", "user_id", userID, "habit_id", habitID, "error", err)
-		http.Error(w, `{"error":"error computing best month"}`, http.StatusInternalServerError)
+		logger.Error("Failed to get first logged date", "user_id", userID, "habit_id", habitID, "error", err)
+		http.Error(w, `{"error":"error retrieving first logged date"}`, http.StatusInternalServerError)
 		return
 	}
 
+	lastLogged := getLastLogged(entries)
+	totalDaysDone := computeTotalDaysDone(entries, loc)
+	daysThisMonth := computeDaysThisMonth(entries, loc)
+	bestMonth := computeBestMonth(entries, loc)
+	quantities := computeQuantities(entries, def, loc)
+
 	summary := habit.HabitSummary{
 		Name:          habitID,
 		CurrentStreak: currentStreak,
 		LongestStreak: longestSreak,
+		StreakUnit:    streakUnit,
+		ThisPeriod:    thisPeriod,
+		PeriodTarget:  periodTarget,
 		FirstLogged:   firstLogged,
 		TotalDaysDone: totalDaysDone,
 		BestMonth:     bestMonth,
 		ThisMonth:     daysThisMonth,
-		LastWrite:     time.Now().Unix(),
+		LastWrite:     lastLogged,
+		Timezone:      loc.String(),
+		Schedule:      sched,
+		Unit:          quantities.Unit,
+		Total:         quantities.Total,
+		AveragePerDay: quantities.AveragePerDay,
+		BestDay:       quantities.BestDay,
+		BestDayTotal:  quantities.BestDayTotal,
+		TargetDone:    quantities.TargetDone,
 	}
 
 	summaryResponse := HabitSummaryResponse{
@@ -105,14 +126,25 @@ func (s *Server) listHabits(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, `{"error":"user id is required"}`, http.StatusBadRequest)
 		return
 	}
-	names, err := s.store.ListHabitNames(userID)
+	defs, err := s.store.ListHabitDefinitions(userID)
 	if err != nil {
 		logger.Error("Failed to list habits", "user_id", userID, "error", err)
 		http.Error(w, `{"error":"storage error"}`, http.StatusInternalServerError)
 		return
 	}
-	logger.Debug("Listed habits successfully", "user_id", userID, "count", len(names))
-	if err := writeJSON(w, http.StatusOK, HabitListResponse{Habits: names}); err != nil {
+
+	// archived habits are hidden unless asked for
+	includeArchived := r.URL.Query().Get("archived") == "true"
+	resp := HabitListResponse{Habits: []string{}, Definitions: []habit.HabitDefinition{}}
+	for _, d := range defs {
+		if d.Archived && !includeArchived {
+			continue
+		}
+		resp.Habits = append(resp.Habits, d.Name)
+		resp.Definitions = append(resp.Definitions, d)
+	}
+	logger.Debug("Listed habits successfully", "user_id", userID, "count", len(resp.Habits))
+	if err := writeJSON(w, http.StatusOK, resp); err != nil {
 		logger.Error("Failed to serialize habit list response", "user_id", userID, "error", err)
 		http.Error(w, `{"error":"failed to serialize response"}`, http.StatusInternalServerError)
 		return
@@ -137,7 +169,8 @@ func (s *Server) trackHabit(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
 		return
 	}
-	logger.Info("Storing habit", "user_id", userID, "habit_name", h.Name, "timestamp", h.TimeStamp)
+	h.ID = habit.NewID(h.TimeStamp)
+	logger.Info("Storing habit", "user_id", userID, "habit_name", h.Name, "habit_entry_id", h.ID, "timestamp", h.TimeStamp)
 	if err := s.store.PutHabit(userID, h); err != nil {
 		logger.Error("Failed to store habit", "user_id", userID, "habit_name", h.Name, "error", err)
 		http.Error(w, `{"error":"database write failed"}`, http.StatusInternalServerError)
@@ -160,6 +193,82 @@ func (s *Server) trackHabit(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// maxBatchSize bounds the number of entries in one POST /habits:batch.
+const maxBatchSize = 10000
+
+// trackHabits stores an array of entries. Every item is validated on its
+// own and the valid ones are written in a single transaction. The response
+// is 201 if all items were stored, 207 if only some were and 400 if none
+// were, with a result per item either way.
+func (s *Server) trackHabits(w http.ResponseWriter, r *http.Request) {
+	userID := userIDFromContext(s.cfg.AuthEnabled, r)
+	logger.Debug("Tracking habits in batch", "user_id", userID)
+	if userID == "" {
+		logger.Warn("Missing user ID for batch track")
+		http.Error(w, `{"error":"user id is required"}`, http.StatusBadRequest)
+		return
+	}
+	var batch []habit.Habit
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		logger.Warn("Invalid JSON in batch track request", "error", err)
+		http.Error(w, `{"error":"invalid JSON, expected an array of entries"}`, http.StatusBadRequest)
+		return
+	}
+	if len(batch) == 0 || len(batch) > maxBatchSize {
+		http.Error(w, fmt.Sprintf(`{"error":"batch must hold 1-%d entries"}`, maxBatchSize), http.StatusBadRequest)
+		return
+	}
+
+	resp := HabitBatchResponse{Results: make([]HabitBatchResult, len(batch))}
+	valid := make([]habit.Habit, 0, len(batch))
+	index := make([]int, 0, len(batch))
+	for i, h := range batch {
+		resp.Results[i].Index = i
+		if err := validateHabit(h); err != nil {
+			resp.Results[i].Error = err.Error()
+			resp.Failed++
+			continue
+		}
+		h.ID = habit.NewID(h.TimeStamp)
+		valid = append(valid, h)
+		index = append(index, i)
+	}
+
+	if len(valid) > 0 {
+		if err := s.store.PutHabits(userID, valid); err != nil {
+			logger.Error("Failed to store habit batch", "user_id", userID, "count", len(valid), "error", err)
+			http.Error(w, `{"error":"database write failed"}`, http.StatusInternalServerError)
+			return
+		}
+		for j, i := range index {
+			resp.Results[i].Entry = &valid[j]
+		}
+		resp.Created = len(valid)
+		logger.Info("Habit batch tracked", "user_id", userID, "created", resp.Created, "failed", resp.Failed)
+
+		habits, err := s.store.ListHabitNames(userID)
+		if err != nil {
+			logger.Warn("Failed to update active habits metric after tracking", "user_id", userID, "error", err)
+		} else {
+			UpdateActiveHabitsForUser(userID, len(habits))
+			UpdateTotalActiveHabits(len(habits))
+		}
+	}
+
+	code := http.StatusCreated
+	switch {
+	case resp.Created == 0:
+		code = http.StatusBadRequest
+	case resp.Failed > 0:
+		code = http.StatusMultiStatus
+	}
+	if err := writeJSON(w, code, resp); err != nil {
+		logger.Error("Failed to serialize batch track response", "user_id", userID, "error", err)
+		http.Error(w, `{"error":"failed to serialize response"}`, http.StatusInternalServerError)
+		return
+	}
+}
+
 func (s *Server) getHabit(w http.ResponseWriter, r *http.Request) {
 	habitID := chi.URLParam(r, "habit_id")
 	userID := userIDFromContext(s.cfg.AuthEnabled, r)
@@ -168,20 +277,43 @@ func (s *Server) getHabit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	entries, err := s.store.GetHabit(userID, habitID)
+	q, err := parseEntryQuery(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	entries, next, err := s.store.GetHabitRange(userID, habitID, q)
+	if errors.Is(err, storage.ErrInvalidCursor) {
+		http.Error(w, `{"error":"invalid cursor"}`, http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		logger.Error("Failed to get habit entries", "user_id", userID, "habit_id", habitID, "error", err)
 		http.Error(w, `{"error":"storage error"}`, http.StatusInternalServerError)
 		return
 	}
-	if len(entries) == 0 {
-		http.Error(w, `{"error":"habit not found"}`, http.StatusNotFound)
-		return
+	if len(entries) == 0 && q.Cursor == "" {
+		// an empty range of an existing habit is not an error
+		existing, _, err := s.store.GetHabitRange(userID, habitID, storage.EntryQuery{Limit: 1})
+		if err != nil {
+			logger.Error("Failed to get habit entries", "user_id", userID, "habit_id", habitID, "error", err)
+			http.Error(w, `{"error":"storage error"}`, http.StatusInternalServerError)
+			return
+		}
+		if len(existing) == 0 {
+			http.Error(w, `{"error":"habit not found"}`, http.StatusNotFound)
+			return
+		}
+	}
+	if entries == nil {
+		entries = []habit.Habit{}
 	}
 
 	h := HabitGetResponse{
-		HabitID: habitID,
-		Entries: entries,
+		HabitID:    habitID,
+		Entries:    entries,
+		NextCursor: next,
 	}
 	if err := writeJSON(w, http.StatusOK, h); err != nil {
 		logger.Error("Failed to serialize get habit response", "user_id", userID, "habit_id", habitID, "error", err)
@@ -190,6 +322,36 @@ func (s *Server) getHabit(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// parseEntryQuery reads the from, to, limit and cursor query parameters.
+// from and to are Unix timestamps; without a limit every matching entry is returned.
+func parseEntryQuery(r *http.Request) (storage.EntryQuery, error) {
+	const maxLimit = 1000
+
+	var q storage.EntryQuery
+	var err error
+	params := r.URL.Query()
+	if v := params.Get("from"); v != "" {
+		if q.From, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return q, fmt.Errorf("invalid from")
+		}
+	}
+	if v := params.Get("to"); v != "" {
+		if q.To, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return q, fmt.Errorf("invalid to")
+		}
+	}
+	if q.From != 0 && q.To != 0 && q.To <= q.From {
+		return q, fmt.Errorf("to must be after from")
+	}
+	if v := params.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 1 || q.Limit > maxLimit {
+			return q, fmt.Errorf("limit must be 1-%d", maxLimit)
+		}
+	}
+	q.Cursor = params.Get("cursor")
+	return q, nil
+}
+
 func (s *Server) deleteHabit(w http.ResponseWriter, r *http.Request) {
 	habitID := chi.URLParam(r, "habit_id")
 	userID := userIDFromContext(s.cfg.AuthEnabled, r)
@@ -219,9 +381,107 @@ func (s *Server) deleteHabit(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (s *Server) updateHabitEntry(w http.ResponseWriter, r *http.Request) {
+	habitID := chi.URLParam(r, "habit_id")
+	entryID := chi.URLParam(r, "entry_id")
+	userID := userIDFromContext(s.cfg.AuthEnabled, r)
+	logger.Debug("Updating habit entry", "user_id", userID, "habit_id", habitID, "entry_id", entryID)
+	if userID == "" || habitID == "" || entryID == "" {
+		http.Error(w, `{"error":"user id, habit id and entry id are required"}`, http.StatusBadRequest)
+		return
+	}
+
+	var req HabitEntryUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Warn("Invalid JSON in update habit entry request", "error", err)
+		http.Error(w, `{"error":"invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+
+	e, found, err := s.store.GetHabitEntry(userID, habitID, entryID)
+	if err != nil {
+		logger.Error("Failed to get habit entry", "user_id", userID, "habit_id", habitID, "entry_id", entryID, "error", err)
+		http.Error(w, `{"error":"storage error"}`, http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, `{"error":"entry not found"}`, http.StatusNotFound)
+		return
+	}
+
+	if req.Note != nil {
+		e.Note = *req.Note
+	}
+	if req.Value != nil {
+		e.Value = *req.Value
+	}
+	if req.Unit != nil {
+		e.Unit = *req.Unit
+	}
+	if req.TimeStamp != nil {
+		e.TimeStamp = *req.TimeStamp
+	}
+	if err := validateHabit(e); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.UpdateHabitEntry(userID, habitID, e)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, `{"error":"entry not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to update habit entry", "user_id", userID, "habit_id", habitID, "entry_id", entryID, "error", err)
+		http.Error(w, `{"error":"database write failed"}`, http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Habit entry updated successfully", "user_id", userID, "habit_id", habitID, "entry_id", entryID)
+
+	if err := writeJSON(w, http.StatusOK, e); err != nil {
+		logger.Error("Failed to serialize update habit entry response", "user_id", userID, "habit_id", habitID, "error", err)
+		http.Error(w, `{"error":"failed to serialize response"}`, http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) deleteHabitEntry(w http.ResponseWriter, r *http.Request) {
+	habitID := chi.URLParam(r, "habit_id")
+	entryID := chi.URLParam(r, "entry_id")
+	userID := userIDFromContext(s.cfg.AuthEnabled, r)
+	logger.Info("Deleting habit entry", "user_id", userID, "habit_id", habitID, "entry_id", entryID)
+	if userID == "" || habitID == "" || entryID == "" {
+		http.Error(w, `{"error":"user id, habit id and entry id are required"}`, http.StatusBadRequest)
+		return
+	}
+
+	err := s.store.DeleteHabitEntry(userID, habitID, entryID)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, `{"error":"entry not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to delete habit entry", "user_id", userID, "habit_id", habitID, "entry_id", entryID, "error", err)
+		http.Error(w, `{"error":"storage error"}`, http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Habit entry deleted successfully", "user_id", userID, "habit_id", habitID, "entry_id", entryID)
+
+	habits, err := s.store.ListHabitNames(userID)
+	if err != nil {
+		logger.Warn("Failed to update active habits metric after entry deletion", "user_id", userID, "error", err)
+	} else {
+		UpdateActiveHabitsForUser(userID, len(habits))
+		UpdateTotalActiveHabits(len(habits))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func validateHabit(h habit.Habit) error {
 	const maxNameLength = 20
 	const maxNoteLength = 1024
+	const maxUnitLength = 16
 	const minTS = 946684800
 	const maxTS = 4102444800
 
@@ -234,6 +494,12 @@ func validateHabit(h habit.Habit) error {
 	if h.TimeStamp < minTS || h.TimeStamp > maxTS {
 		return fmt.Errorf("invalid timestamp")
 	}
+	if h.Value < 0 || math.IsNaN(h.Value) || math.IsInf(h.Value, 0) {
+		return fmt.Errorf("bad habit value: must be a non-negative number")
+	}
+	if len(h.Unit) > maxUnitLength {
+		return fmt.Errorf("bad habit unit: must be 0-%d characters", maxUnitLength)
+	}
 
 	return nil
 }
@@ -3,9 +3,11 @@ package server
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -51,6 +53,13 @@ func TestTrackHabit_Valid(t *testing.T) {
 	if rr.Code != http.StatusCreated {
 		t.Fatalf("got %d want 201", rr.Code)
 	}
+	var created habit.Habit
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if created.ID == "" {
+		t.Fatal("expected entry ID in create response")
+	}
 
 	rr = mockRequest(h, http.MethodGet, "/habits/guitar", nil)
 	if rr.Code != http.StatusOK {
@@ -72,6 +81,54 @@ func TestTrackHabit_Valid(t *testing.T) {
 	if resp.Entries[0].TimeStamp == 0 {
 		t.Fatal("got 0 timestamp, want non-zero")
 	}
+	if resp.Entries[0].ID != created.ID {
+		t.Fatalf("got entry ID '%s' want '%s'", resp.Entries[0].ID, created.ID)
+	}
+}
+
+func TestTrackHabits_Batch(t *testing.T) {
+	store := newMemStore()
+	h := newTestServer(store)
+	now := time.Now().Unix()
+
+	batch := []habit.Habit{
+		{Name: "guitar", Note: "scales", TimeStamp: now - 60},
+		{Name: "guitar", TimeStamp: -1},
+		{Name: "reading", TimeStamp: now, Value: 20, Unit: "pages"},
+	}
+	rr := mockRequest(h, http.MethodPost, "/habits:batch", batch)
+	if rr.Code != http.StatusMultiStatus {
+		t.Fatalf("got %d want 207: %s", rr.Code, rr.Body.String())
+	}
+	var resp HabitBatchResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if resp.Created != 2 || resp.Failed != 1 || len(resp.Results) != 3 {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	if r := resp.Results[1]; r.Index != 1 || r.Error == "" || r.Entry != nil {
+		t.Fatalf("expected item 1 to fail, got %+v", r)
+	}
+	if r := resp.Results[2]; r.Entry == nil || r.Entry.ID == "" || r.Entry.Name != "reading" {
+		t.Fatalf("expected item 2 to be stored, got %+v", r)
+	}
+	if len(store.habits["guitar"]) != 1 || len(store.habits["reading"]) != 1 {
+		t.Fatalf("unexpected stored entries %+v", store.habits)
+	}
+
+	rr = mockRequest(h, http.MethodPost, "/habits:batch", batch[:1])
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got %d want 201", rr.Code)
+	}
+	rr = mockRequest(h, http.MethodPost, "/habits:batch", batch[1:2])
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("got %d want 400", rr.Code)
+	}
+	rr = mockRequest(h, http.MethodPost, "/habits:batch", batch[0])
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("got %d want 400 for a non-array body", rr.Code)
+	}
 }
 
 func TestListHabits_Empty(t *testing.T) {
@@ -183,6 +240,119 @@ func TestGetHabitSummary_MultipleStreaks(t *testing.T) {
 	}
 }
 
+func TestGetHabitSummary_WeeklyStreak(t *testing.T) {
+	h := newTestServer(newMemStore())
+
+	rr := mockRequest(h, http.MethodPut, "/habits/gym/definition", habit.HabitDefinition{
+		Schedule: &habit.Schedule{Frequency: habit.FrequencyWeekly, Times: 2},
+	})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got %d want 201", rr.Code)
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	monday := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	// twice in each of the last three weeks, once five weeks ago
+	var days []time.Time
+	for k := 1; k <= 3; k++ {
+		days = append(days, monday.AddDate(0, 0, -7*k), monday.AddDate(0, 0, -7*k+1))
+	}
+	days = append(days, monday.AddDate(0, 0, -35))
+	for _, d := range days {
+		rr := mockRequest(h, http.MethodPost, "/habits/",
+			habit.Habit{Name: "gym", TimeStamp: d.Add(12 * time.Hour).Unix()})
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("got %d want 201", rr.Code)
+		}
+	}
+
+	rr = mockRequest(h, http.MethodGet, "/habits/gym/summary", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d want 200", rr.Code)
+	}
+	var resp HabitSummaryResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	sum := resp.HabitSummary
+	if sum.CurrentStreak != 3 || sum.LongestStreak != 3 {
+		t.Fatalf("got streaks %d/%d, want 3/3", sum.CurrentStreak, sum.LongestStreak)
+	}
+	if sum.StreakUnit != "week" || sum.ThisPeriod != 0 || sum.PeriodTarget != 2 {
+		t.Fatalf("unexpected period fields: %+v", sum)
+	}
+}
+
+func TestGetHabitSummary_Quantities(t *testing.T) {
+	h := newTestServer(newMemStore())
+
+	rr := mockRequest(h, http.MethodPut, "/habits/guitar/definition", habit.HabitDefinition{
+		Target: &habit.Target{Amount: 30, Unit: "min", Period: habit.TargetPerDay},
+	})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got %d want 201", rr.Code)
+	}
+
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1)
+	for _, e := range []habit.Habit{
+		{Name: "guitar", TimeStamp: yesterday.Unix(), Value: 40, Unit: "min"},
+		{Name: "guitar", TimeStamp: yesterday.Unix(), Value: 20, Unit: "min"},
+		{Name: "guitar", TimeStamp: now.Unix(), Value: 15, Unit: "min"},
+		// other units and plain entries don't count
+		{Name: "guitar", TimeStamp: now.Unix(), Value: 3, Unit: "songs"},
+		{Name: "guitar", TimeStamp: now.Unix(), Note: "jam"},
+	} {
+		rr := mockRequest(h, http.MethodPost, "/habits/", e)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("got %d want 201", rr.Code)
+		}
+	}
+
+	rr = mockRequest(h, http.MethodGet, "/habits/guitar/summary", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d want 200", rr.Code)
+	}
+	var resp HabitSummaryResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	sum := resp.HabitSummary
+	if sum.Unit != "min" || sum.Total != 75 || sum.AveragePerDay != 37.5 {
+		t.Fatalf("unexpected totals: %+v", sum)
+	}
+	if sum.BestDayTotal != 60 || sum.BestDay != yesterday.Truncate(24*time.Hour).Unix() {
+		t.Fatalf("unexpected best day: %+v", sum)
+	}
+	if sum.TargetDone != 15 {
+		t.Fatalf("got target done %v, want 15", sum.TargetDone)
+	}
+}
+
+func TestTrackHabit_InvalidValue(t *testing.T) {
+	h := newTestServer(newMemStore())
+	rr := mockRequest(h, http.MethodPost, "/habits/",
+		habit.Habit{Name: "guitar", TimeStamp: time.Now().Unix(), Value: -5, Unit: "min"})
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("got %d want 400", rr.Code)
+	}
+}
+
+func TestPutHabitDefinition_InvalidSchedule(t *testing.T) {
+	h := newTestServer(newMemStore())
+	for _, sched := range []habit.Schedule{
+		{Frequency: "hourly"},
+		{Frequency: habit.FrequencyWeekly, Times: 8},
+		{Frequency: habit.FrequencyMonthly},
+		{Frequency: habit.FrequencyWeekdays},
+	} {
+		rr := mockRequest(h, http.MethodPut, "/habits/gym/definition", habit.HabitDefinition{Schedule: &sched})
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("%+v: got %d want 400", sched, rr.Code)
+		}
+	}
+}
+
 func TestTrackHabit_WithInvalidTimeStamp(t *testing.T) {
 	st := newMemStore()
 	h := newTestServer(st)
@@ -342,6 +512,317 @@ func TestDeleteHabit(t *testing.T) {
 	}
 }
 
+func TestUpdateHabitEntry(t *testing.T) {
+	h := newTestServer(newMemStore())
+
+	rr := mockRequest(h, http.MethodPost, "/habits/",
+		habit.Habit{Name: "guitar", Note: "scales", TimeStamp: time.Now().Unix()})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got %d want 201", rr.Code)
+	}
+	var created habit.Habit
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+
+	note := "chords"
+	rr = mockRequest(h, http.MethodPatch, "/habits/guitar/entries/"+created.ID,
+		HabitEntryUpdateRequest{Note: &note})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d want 200, body: %s", rr.Code, rr.Body.String())
+	}
+	var updated habit.Habit
+	if err := json.Unmarshal(rr.Body.Bytes(), &updated); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if updated.Note != "chords" || updated.TimeStamp != created.TimeStamp || updated.ID != created.ID {
+		t.Fatalf("unexpected updated entry: %+v", updated)
+	}
+
+	badTS := int64(1)
+	rr = mockRequest(h, http.MethodPatch, "/habits/guitar/entries/"+created.ID,
+		HabitEntryUpdateRequest{TimeStamp: &badTS})
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("got %d want 400", rr.Code)
+	}
+
+	rr = mockRequest(h, http.MethodPatch, "/habits/guitar/entries/missing",
+		HabitEntryUpdateRequest{Note: &note})
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("got %d want 404", rr.Code)
+	}
+}
+
+func TestDeleteHabitEntry(t *testing.T) {
+	h := newTestServer(newMemStore())
+
+	var ids []string
+	for _, note := range []string{"scales", "chords"} {
+		rr := mockRequest(h, http.MethodPost, "/habits/",
+			habit.Habit{Name: "guitar", Note: note, TimeStamp: time.Now().Unix()})
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("got %d want 201", rr.Code)
+		}
+		var created habit.Habit
+		if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+			t.Fatalf("unmarshal error: %v", err)
+		}
+		ids = append(ids, created.ID)
+	}
+
+	rr := mockRequest(h, http.MethodDelete, "/habits/guitar/entries/"+ids[0], nil)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("got %d want 204 No Content", rr.Code)
+	}
+
+	rr = mockRequest(h, http.MethodGet, "/habits/guitar", nil)
+	var resp HabitGetResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if len(resp.Entries) != 1 || resp.Entries[0].ID != ids[1] {
+		t.Fatalf("expected only entry %s to remain, got %+v", ids[1], resp.Entries)
+	}
+
+	rr = mockRequest(h, http.MethodDelete, "/habits/guitar/entries/"+ids[0], nil)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("got %d want 404", rr.Code)
+	}
+}
+
+func TestGetHabit_RangeAndPagination(t *testing.T) {
+	h := newTestServer(newMemStore())
+
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()
+	for i := range 5 {
+		rr := mockRequest(h, http.MethodPost, "/habits/",
+			habit.Habit{Name: "guitar", Note: "practice", TimeStamp: base + int64(i)*86400})
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("got %d want 201", rr.Code)
+		}
+	}
+
+	rr := mockRequest(h, http.MethodGet, fmt.Sprintf("/habits/guitar?from=%d&to=%d", base+86400, base+3*86400), nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d want 200", rr.Code)
+	}
+	var resp HabitGetResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if len(resp.Entries) != 2 || resp.NextCursor != "" {
+		t.Fatalf("expected 2 entries and no cursor, got %d entries, cursor %q", len(resp.Entries), resp.NextCursor)
+	}
+
+	// an empty range of an existing habit is not a 404
+	rr = mockRequest(h, http.MethodGet, fmt.Sprintf("/habits/guitar?from=%d", base+30*86400), nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d want 200", rr.Code)
+	}
+
+	path := "/habits/guitar?limit=2"
+	total := 0
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("pagination did not terminate")
+		}
+		rr = mockRequest(h, http.MethodGet, path, nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("got %d want 200", rr.Code)
+		}
+		resp = HabitGetResponse{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal error: %v", err)
+		}
+		total += len(resp.Entries)
+		if resp.NextCursor == "" {
+			break
+		}
+		path = "/habits/guitar?limit=2&cursor=" + resp.NextCursor
+	}
+	if total != 5 {
+		t.Fatalf("got %d entries across pages, want 5", total)
+	}
+
+	for _, q := range []string{"limit=0", "limit=abc", "from=x", "cursor=!!", fmt.Sprintf("from=%d&to=%d", base, base)} {
+		rr = mockRequest(h, http.MethodGet, "/habits/guitar?"+q, nil)
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: got %d want 400", q, rr.Code)
+		}
+	}
+}
+
+func TestHabitDefinition_CRUD(t *testing.T) {
+	h := newTestServer(newMemStore())
+
+	rr := mockRequest(h, http.MethodGet, "/habits/guitar/definition", nil)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("got %d want 404", rr.Code)
+	}
+
+	rr = mockRequest(h, http.MethodPut, "/habits/guitar/definition",
+		habit.HabitDefinition{DisplayName: "Guitar practice", Color: "#ff8800"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got %d want 201", rr.Code)
+	}
+	var created habit.HabitDefinition
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if created.Name != "guitar" || created.CreatedAt == 0 {
+		t.Fatalf("unexpected definition: %+v", created)
+	}
+
+	// replacing keeps the original creation time
+	rr = mockRequest(h, http.MethodPut, "/habits/guitar/definition",
+		habit.HabitDefinition{DisplayName: "Guitar", CreatedAt: 1})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d want 200", rr.Code)
+	}
+	rr = mockRequest(h, http.MethodGet, "/habits/guitar/definition", nil)
+	var got habit.HabitDefinition
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if got.DisplayName != "Guitar" || got.CreatedAt != created.CreatedAt {
+		t.Fatalf("unexpected definition after replace: %+v", got)
+	}
+
+	for _, bad := range []habit.HabitDefinition{
+		{Color: "orange"},
+		{DisplayName: strings.Repeat("x", 65)},
+		{Icon: strings.Repeat("x", 33)},
+	} {
+		rr = mockRequest(h, http.MethodPut, "/habits/guitar/definition", bad)
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("%+v: got %d want 400", bad, rr.Code)
+		}
+	}
+
+	rr = mockRequest(h, http.MethodPost, "/habits/",
+		habit.Habit{Name: "guitar", TimeStamp: time.Now().Unix()})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got %d want 201", rr.Code)
+	}
+	rr = mockRequest(h, http.MethodDelete, "/habits/guitar/definition", nil)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("got %d want 409", rr.Code)
+	}
+
+	rr = mockRequest(h, http.MethodPut, "/habits/reading/definition", habit.HabitDefinition{})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got %d want 201", rr.Code)
+	}
+	rr = mockRequest(h, http.MethodDelete, "/habits/reading/definition", nil)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("got %d want 204", rr.Code)
+	}
+	rr = mockRequest(h, http.MethodDelete, "/habits/reading/definition", nil)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("got %d want 404", rr.Code)
+	}
+}
+
+func TestListHabits_HidesArchived(t *testing.T) {
+	h := newTestServer(newMemStore())
+
+	for _, name := range []string{"guitar", "reading"} {
+		rr := mockRequest(h, http.MethodPost, "/habits/",
+			habit.Habit{Name: name, TimeStamp: time.Now().Unix()})
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("got %d want 201", rr.Code)
+		}
+	}
+	rr := mockRequest(h, http.MethodPut, "/habits/reading/definition", habit.HabitDefinition{Archived: true})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d want 200", rr.Code)
+	}
+
+	rr = mockRequest(h, http.MethodGet, "/habits/", nil)
+	var resp HabitListResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if len(resp.Habits) != 1 || resp.Habits[0] != "guitar" || len(resp.Definitions) != 1 {
+		t.Fatalf("expected only guitar, got %+v", resp)
+	}
+
+	rr = mockRequest(h, http.MethodGet, "/habits/?archived=true", nil)
+	resp = HabitListResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if len(resp.Habits) != 2 {
+		t.Fatalf("expected 2 habits with archived=true, got %+v", resp.Habits)
+	}
+}
+
+func TestGetHabitSummary_Timezone(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	h := newTestServer(newMemStore())
+
+	// morning and evening of the same day in LA, but two days in UTC
+	for _, hour := range []int{8, 20} {
+		rr := mockRequest(h, http.MethodPost, "/habits/",
+			habit.Habit{Name: "guitar", TimeStamp: time.Date(2024, 3, 1, hour, 0, 0, 0, la).Unix()})
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("got %d want 201", rr.Code)
+		}
+	}
+
+	totalDays := func(path string, header string) int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if header != "" {
+			req.Header.Set("X-Timezone", header)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: got %d want 200", path, rr.Code)
+		}
+		var resp HabitSummaryResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal error: %v", err)
+		}
+		return resp.HabitSummary.TotalDaysDone
+	}
+
+	if got := totalDays("/habits/guitar/summary", ""); got != 2 {
+		t.Fatalf("UTC: got %d days, want 2", got)
+	}
+	if got := totalDays("/habits/guitar/summary", "America/Los_Angeles"); got != 1 {
+		t.Fatalf("header: got %d days, want 1", got)
+	}
+	if got := totalDays("/habits/guitar/summary?tz=America/Los_Angeles", ""); got != 1 {
+		t.Fatalf("query: got %d days, want 1", got)
+	}
+
+	rr := mockRequest(h, http.MethodPut, "/settings", habit.UserSettings{Timezone: "Not/AZone"})
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("got %d want 400", rr.Code)
+	}
+	rr = mockRequest(h, http.MethodPut, "/settings", habit.UserSettings{Timezone: "America/Los_Angeles"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d want 200", rr.Code)
+	}
+	if got := totalDays("/habits/guitar/summary", ""); got != 1 {
+		t.Fatalf("saved setting: got %d days, want 1", got)
+	}
+	// a per-request override still wins
+	if got := totalDays("/habits/guitar/summary", "UTC"); got != 2 {
+		t.Fatalf("override: got %d days, want 2", got)
+	}
+
+	rr = mockRequest(h, http.MethodGet, "/habits/guitar/summary?tz=Not/AZone", nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("got %d want 400", rr.Code)
+	}
+}
+
 func TestUserIdIsAnonymousWhenAuthDisabled(t *testing.T) {
 	if userIDFromContext(false, nil) != "anonymous" {
 		t.Fatal("expected anonymous user ID when auth is disabled")
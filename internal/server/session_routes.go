@@ -0,0 +1,248 @@
+package server
+
+import (
+	"cmp"
+	"crypto/rand"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/brk3/habits/internal/config"
+	"github.com/brk3/habits/internal/logger"
+	"github.com/brk3/habits/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/securecookie"
+)
+
+const (
+	// sessionTouchInterval limits how often a session's last seen time is
+	// written.
+	sessionTouchInterval = time.Minute
+	sessionPurgeInterval = time.Hour
+)
+
+// sessionID is the stored ID of the session a cookie token belongs to.
+func sessionID(token string) string {
+	return hashAPIKey(token)
+}
+
+// clientIP is the address the request came from, as seen by the proxy in
+// front when there is one. It is only shown to users, never trusted.
+func clientIP(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		ip, _, _ := strings.Cut(fwd, ",")
+		return strings.TrimSpace(ip)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// startSession stores a new session for a login and sets its cookie.
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, userID, providerID, rawIDToken string) error {
+	token := rand.Text()
+	now := time.Now()
+	sess := storage.Session{
+		ID:         sessionID(token),
+		UserID:     userID,
+		ProviderID: providerID,
+		IDToken:    rawIDToken,
+		CreatedAt:  now.Unix(),
+		LastSeenAt: now.Unix(),
+		ExpiresAt:  now.Add(sessionMaxAge).Unix(),
+		UserAgent:  r.UserAgent(),
+		IPAddress:  clientIP(r),
+	}
+	if err := s.store.PutSession(sess); err != nil {
+		return err
+	}
+	logger.Info("Started session", "user_id", userID, "session", truncateHash(sess.ID))
+	return s.setSessionCookie(w, token)
+}
+
+func (s *Server) setSessionCookie(w http.ResponseWriter, token string) error {
+	val, err := securecookie.EncodeMulti("session", token, s.sessionCookie...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session",
+		Value:    val,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(sessionMaxAge.Seconds()),
+	})
+	return nil
+}
+
+// sessionFromCookie returns the live session the request's cookie points
+// to, along with the cookie's token.
+func (s *Server) sessionFromCookie(r *http.Request) (*storage.Session, string, bool) {
+	token, ok := s.sessionToken(r)
+	if !ok {
+		return nil, "", false
+	}
+	sess, found, err := s.store.GetSession(sessionID(token))
+	if err != nil {
+		logger.Error("Failed to look up session", "error", err)
+		return nil, "", false
+	}
+	if !found {
+		logger.Debug("Session not found, it was revoked or has expired")
+		return nil, "", false
+	}
+	if sess.Expired(time.Now()) {
+		logger.Debug("Session has expired", "session", truncateHash(sess.ID))
+		if err := s.store.DeleteSession(sess.ID); err != nil {
+			logger.Warn("Failed to delete expired session", "error", err)
+		}
+		return nil, "", false
+	}
+	if sess.ProviderID == config.LocalProviderID {
+		if !s.cfg.LocalAuth.Enabled {
+			logger.Debug("Session is from local_auth, which is disabled")
+			return nil, "", false
+		}
+	} else if _, ok := s.authProviders[sess.ProviderID]; !ok {
+		logger.Debug("Session is for a provider that is no longer configured", "provider", sess.ProviderID)
+		return nil, "", false
+	}
+	return &sess, token, true
+}
+
+// sessionToken returns the token in the request's session cookie.
+func (s *Server) sessionToken(r *http.Request) (string, bool) {
+	c, err := r.Cookie("session")
+	if err != nil {
+		logger.Debug("No session cookie found", "error", err)
+		return "", false
+	}
+	var token string
+	if err := securecookie.DecodeMulti("session", c.Value, &token, s.sessionCookie...); err != nil {
+		logger.Debug("Failed to decode session cookie", "error", err)
+		return "", false
+	}
+	return token, true
+}
+
+// purgeSessions deletes expired sessions in the background, as sessions
+// that are never used again are otherwise only removed when listed.
+func (s *Server) purgeSessions() {
+	ticker := time.NewTicker(sessionPurgeInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := s.store.DeleteExpiredSessions(time.Now().Unix()); err != nil {
+			logger.Warn("Failed to purge expired sessions", "error", err)
+		}
+	}
+}
+
+func (s *Server) listSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(userCtxKey{}).(*User)
+	if !ok || user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	stored, err := s.store.ListSessions(user.UserID)
+	if err != nil {
+		logger.Error("Failed to list sessions", "user_id", user.UserID, "error", err)
+		http.Error(w, `{"error":"failed to list sessions"}`, http.StatusInternalServerError)
+		return
+	}
+	slices.SortFunc(stored, func(a, b storage.Session) int {
+		return cmp.Or(cmp.Compare(b.LastSeenAt, a.LastSeenAt), strings.Compare(a.ID, b.ID))
+	})
+
+	now := time.Now()
+	sessions := []SessionInfo{}
+	for _, sess := range stored {
+		if sess.Expired(now) {
+			continue
+		}
+		sessions = append(sessions, SessionInfo{
+			ID:         sess.ID,
+			CreatedAt:  sess.CreatedAt,
+			LastSeenAt: sess.LastSeenAt,
+			ExpiresAt:  sess.ExpiresAt,
+			UserAgent:  sess.UserAgent,
+			IPAddress:  sess.IPAddress,
+			Current:    sess.ID == user.SessionID,
+		})
+	}
+	if err := writeJSON(w, http.StatusOK, SessionListResponse{Sessions: sessions}); err != nil {
+		logger.Error("Failed to serialize sessions", "user_id", user.UserID, "error", err)
+	}
+}
+
+func (s *Server) deleteSession(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(userCtxKey{}).(*User)
+	if !ok || user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	sess, found, err := s.store.GetSession(id)
+	if err != nil {
+		logger.Error("Failed to look up session for deletion", "error", err)
+		http.Error(w, `{"error":"failed to look up session"}`, http.StatusInternalServerError)
+		return
+	}
+	// someone else's session is reported as missing, so IDs can't be probed
+	if !found || sess.UserID != user.UserID {
+		http.Error(w, `{"error":"session not found"}`, http.StatusNotFound)
+		return
+	}
+	if err := s.store.DeleteSession(id); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		logger.Error("Failed to delete session", "user_id", user.UserID, "error", err)
+		http.Error(w, `{"error":"failed to delete session"}`, http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Revoked session", "user_id", user.UserID, "session", truncateHash(id))
+	if id == user.SessionID {
+		clearSessionCookie(w)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logoutEverywhere revokes all of the user's sessions, including the
+// current one, and forgets their refresh tokens. API keys are left alone.
+func (s *Server) logoutEverywhere(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(userCtxKey{}).(*User)
+	if !ok || user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := s.store.DeleteUserSessions(user.UserID); err != nil {
+		logger.Error("Failed to delete sessions", "user_id", user.UserID, "error", err)
+		http.Error(w, `{"error":"failed to delete sessions"}`, http.StatusInternalServerError)
+		return
+	}
+	if err := s.deleteRefreshTokens(user.UserID); err != nil {
+		logger.Error("Failed to delete refresh tokens", "user_id", user.UserID, "error", err)
+	}
+	logger.Info("Logged out everywhere", "user_id", user.UserID)
+	clearSessionCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session",
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
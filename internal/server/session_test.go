@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/brk3/habits/internal/config"
+	"github.com/brk3/habits/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/securecookie"
+	"golang.org/x/oauth2"
+)
+
+func newSessionTestServer(t *testing.T) (*Server, *memStore) {
+	store := newMemStore()
+	srv, err := New(&config.Config{AuthEnabled: true}, store)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	srv.authProviders["test"] = &AuthProvider{name: "Test"}
+	return srv, store
+}
+
+func sessionCookieRequest(t *testing.T, srv *Server, method, path, token string) *http.Request {
+	val, err := securecookie.EncodeMulti("session", token, srv.sessionCookie...)
+	if err != nil {
+		t.Fatalf("failed to encode cookie: %v", err)
+	}
+	req := httptest.NewRequest(method, path, nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: val})
+	return req
+}
+
+func TestSessionFromCookie(t *testing.T) {
+	srv, store := newSessionTestServer(t)
+	now := time.Now().Unix()
+
+	live := storage.Session{ID: sessionID("live"), UserID: "user1", ProviderID: "test", IDToken: "jwt", ExpiresAt: now + 60}
+	expired := storage.Session{ID: sessionID("expired"), UserID: "user1", ProviderID: "test", IDToken: "jwt", ExpiresAt: now - 1}
+	unknown := storage.Session{ID: sessionID("unknown"), UserID: "user1", ProviderID: "gone", IDToken: "jwt", ExpiresAt: now + 60}
+	for _, sess := range []storage.Session{live, expired, unknown} {
+		if err := store.PutSession(sess); err != nil {
+			t.Fatalf("PutSession failed: %v", err)
+		}
+	}
+
+	if sess, _, ok := srv.sessionFromCookie(sessionCookieRequest(t, srv, http.MethodGet, "/", "live")); !ok || sess.ID != live.ID {
+		t.Fatalf("expected the live session, got %+v (ok=%v)", sess, ok)
+	}
+	for _, token := range []string{"expired", "unknown", "revoked"} {
+		if _, _, ok := srv.sessionFromCookie(sessionCookieRequest(t, srv, http.MethodGet, "/", token)); ok {
+			t.Fatalf("expected %s session to be rejected", token)
+		}
+	}
+	if _, found, _ := store.GetSession(expired.ID); found {
+		t.Fatal("expected expired session to be deleted on use")
+	}
+
+	// a cookie in the old format, holding the ID token itself, is not a session
+	if _, _, ok := srv.sessionFromCookie(sessionCookieRequest(t, srv, http.MethodGet, "/", "test:jwt")); ok {
+		t.Fatal("expected a legacy cookie to be rejected")
+	}
+}
+
+func TestSessionEndpoints(t *testing.T) {
+	srv, store := newSessionTestServer(t)
+	now := time.Now().Unix()
+
+	for _, sess := range []storage.Session{
+		{ID: "current", UserID: "user1", ProviderID: "test", CreatedAt: now - 60, LastSeenAt: now, ExpiresAt: now + 60, UserAgent: "firefox"},
+		{ID: "other", UserID: "user1", ProviderID: "test", CreatedAt: now - 120, LastSeenAt: now - 60, ExpiresAt: now + 60},
+		{ID: "stale", UserID: "user1", ProviderID: "test", ExpiresAt: now - 1},
+		{ID: "theirs", UserID: "user2", ProviderID: "test", ExpiresAt: now + 60},
+	} {
+		if err := store.PutSession(sess); err != nil {
+			t.Fatalf("PutSession failed: %v", err)
+		}
+	}
+	if err := store.PutRefreshToken("user1", &oauth2.Token{RefreshToken: "refresh"}); err != nil {
+		t.Fatalf("PutRefreshToken failed: %v", err)
+	}
+
+	request := func(method, id string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+		req := withAuthenticatedUser(httptest.NewRequest(method, "/auth/sessions", nil), "user1", "user1@example.com")
+		req.Context().Value(userCtxKey{}).(*User).SessionID = "current"
+		if id != "" {
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", id)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	rr := request(http.MethodGet, "", srv.listSessions)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d want 200", rr.Code)
+	}
+	var list SessionListResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if len(list.Sessions) != 2 || list.Sessions[0].ID != "current" || !list.Sessions[0].Current || list.Sessions[1].Current {
+		t.Fatalf("unexpected sessions %+v", list.Sessions)
+	}
+
+	if rr := request(http.MethodDelete, "theirs", srv.deleteSession); rr.Code != http.StatusNotFound {
+		t.Fatalf("got %d want 404 revoking another user's session", rr.Code)
+	}
+	if rr := request(http.MethodDelete, "other", srv.deleteSession); rr.Code != http.StatusNoContent {
+		t.Fatalf("got %d want 204", rr.Code)
+	}
+	if _, found, _ := store.GetSession("other"); found {
+		t.Fatal("expected session to be revoked")
+	}
+
+	if rr := request(http.MethodDelete, "", srv.logoutEverywhere); rr.Code != http.StatusNoContent {
+		t.Fatalf("got %d want 204", rr.Code)
+	}
+	if sessions, _ := store.ListSessions("user1"); len(sessions) != 0 {
+		t.Fatalf("expected all sessions revoked, got %v", sessions)
+	}
+	if _, found, _ := store.GetSession("theirs"); !found {
+		t.Fatal("expected other users' sessions to be kept")
+	}
+	if _, found, _ := store.GetRefreshToken("user1"); found {
+		t.Fatal("expected refresh token to be deleted")
+	}
+}
+
+func TestLogout_DeletesSession(t *testing.T) {
+	srv, store := newSessionTestServer(t)
+	if err := store.PutSession(storage.Session{ID: sessionID("tok"), UserID: "user1", ProviderID: "test", ExpiresAt: time.Now().Unix() + 60}); err != nil {
+		t.Fatalf("PutSession failed: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	srv.logout(rr, sessionCookieRequest(t, srv, http.MethodGet, "/auth/logout", "tok"))
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("got %d want 204", rr.Code)
+	}
+	if _, found, _ := store.GetSession(sessionID("tok")); found {
+		t.Fatal("expected session to be deleted on logout")
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/brk3/habits/internal/logger"
+	"github.com/brk3/habits/pkg/habit"
+)
+
+func (s *Server) getSettings(w http.ResponseWriter, r *http.Request) {
+	userID := userIDFromContext(s.cfg.AuthEnabled, r)
+	if userID == "" {
+		http.Error(w, `{"error":"user id is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	settings, err := s.store.GetUserSettings(userID)
+	if err != nil {
+		logger.Error("Failed to get settings", "user_id", userID, "error", err)
+		http.Error(w, `{"error":"storage error"}`, http.StatusInternalServerError)
+		return
+	}
+	if err := writeJSON(w, http.StatusOK, settings); err != nil {
+		logger.Error("Failed to serialize settings response", "user_id", userID, "error", err)
+		http.Error(w, `{"error":"failed to serialize response"}`, http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) putSettings(w http.ResponseWriter, r *http.Request) {
+	userID := userIDFromContext(s.cfg.AuthEnabled, r)
+	logger.Debug("Putting settings", "user_id", userID)
+	if userID == "" {
+		http.Error(w, `{"error":"user id is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	var settings habit.UserSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		logger.Warn("Invalid JSON in put settings request", "error", err)
+		http.Error(w, `{"error":"invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+	if settings.Timezone != "" {
+		if _, err := time.LoadLocation(settings.Timezone); err != nil {
+			http.Error(w, `{"error":"invalid timezone"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := s.store.PutUserSettings(userID, settings); err != nil {
+		logger.Error("Failed to store settings", "user_id", userID, "error", err)
+		http.Error(w, `{"error":"database write failed"}`, http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Settings stored", "user_id", userID, "timezone", settings.Timezone)
+
+	if err := writeJSON(w, http.StatusOK, settings); err != nil {
+		logger.Error("Failed to serialize settings response", "user_id", userID, "error", err)
+		http.Error(w, `{"error":"failed to serialize response"}`, http.StatusInternalServerError)
+		return
+	}
+}
+
+// userLocation resolves the timezone that decides where a user's days
+// start: the X-Timezone header, then the tz query parameter, then the
+// user's saved setting, falling back to UTC. An invalid override is an
+// error; an invalid saved setting is logged and ignored.
+func (s *Server) userLocation(r *http.Request, userID string) (*time.Location, error) {
+	if tz := r.Header.Get("X-Timezone"); tz != "" {
+		return time.LoadLocation(tz)
+	}
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		return time.LoadLocation(tz)
+	}
+
+	settings, err := s.store.GetUserSettings(userID)
+	if err != nil {
+		logger.Warn("Failed to get settings, using UTC", "user_id", userID, "error", err)
+		return time.UTC, nil
+	}
+	if settings.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		logger.Warn("Invalid saved timezone, using UTC", "user_id", userID, "timezone", settings.Timezone, "error", err)
+		return time.UTC, nil
+	}
+	return loc, nil
+}
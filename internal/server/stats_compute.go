@@ -2,49 +2,46 @@ package server
 
 import (
 	"fmt"
+	"maps"
 	"slices"
 	"time"
-)
-
-func (s *Server) computeStreaks(userID, habit string) (current, longest int, err error) {
-	entries, err := s.store.GetHabit(userID, habit)
-	if err != nil {
-		return 0, 0, err
-	}
 
-	// collect unique days from entries
-	uniq := make(map[int64]struct{}, len(entries))
-	for i := range entries {
-		day := toDay(entries[i].TimeStamp)
-		uniq[day] = struct{}{}
-	}
+	"github.com/brk3/habits/pkg/habit"
+)
 
-	if len(uniq) == 0 {
-		return 0, 0, nil
-	}
+// The compute helpers below work on a habit's entries and definition, which
+// getHabitSummary loads once for all of them.
 
-	// convert to slice, sort and reverse
-	days := make([]int64, 0, len(uniq))
-	for d := range uniq {
-		days = append(days, d)
+// habitSchedule returns the schedule of a habit, defaulting to daily for
+// habits without one.
+func habitSchedule(d habit.HabitDefinition) habit.Schedule {
+	if d.Schedule == nil {
+		return habit.Schedule{Frequency: habit.FrequencyDaily}
 	}
-	slices.Sort(days)
-	slices.Reverse(days)
-
-	today := toDay(time.Now().Unix())
+	return *d.Schedule
+}
 
-	// single unique day
-	if len(days) == 1 {
-		longest = 1
-		if days[0] == today || days[0] == today-1 {
-			current = 1
-		} else {
-			current = 0
+// computeStreaks counts runs of consecutive satisfied periods. The current
+// period doesn't break a streak until it's over, so a daily habit last done
+// yesterday still has a current streak today.
+func computeStreaks(entries []habit.Habit, sched habit.Schedule, loc *time.Location) (current, longest int) {
+	periods := habit.NewSchedulePeriods(sched)
+	counts := periods.Count(entries, loc)
+
+	sats := make([]int64, 0, len(counts))
+	for p, n := range counts {
+		if n >= periods.Target {
+			sats = append(sats, p)
 		}
-		return current, longest, nil
 	}
+	if len(sats) == 0 {
+		return 0, 0
+	}
+	slices.Sort(sats)
+	slices.Reverse(sats)
 
-	streakOngoing := days[0] == today || days[0] == today-1
+	now := periods.Current(habit.Day(time.Now().Unix(), loc))
+	streakOngoing := sats[0] == now || sats[0] == now-1
 	longest = 1
 	run := 1
 	current = 0
@@ -52,8 +49,8 @@ func (s *Server) computeStreaks(userID, habit string) (current, longest int, err
 		current = 1
 	}
 
-	for i := 0; i < len(days)-1; i++ {
-		if days[i]-days[i+1] == 1 {
+	for i := 0; i < len(sats)-1; i++ {
+		if sats[i]-sats[i+1] == 1 {
 			run++
 			longest = max(longest, run)
 			if streakOngoing {
@@ -65,16 +62,86 @@ func (s *Server) computeStreaks(userID, habit string) (current, longest int, err
 		}
 	}
 
-	return current, longest, nil
+	return current, longest
+}
+
+// computePeriodProgress returns how many days the habit has been done in the
+// current period, the number needed to satisfy it, and the period's unit.
+func computePeriodProgress(entries []habit.Habit, sched habit.Schedule, loc *time.Location) (done, target int, unit string) {
+	periods := habit.NewSchedulePeriods(sched)
+	counts := periods.Count(entries, loc)
+	return counts[periods.Current(habit.Day(time.Now().Unix(), loc))], periods.Target, periods.Unit
 }
 
-func (s *Server) getFirstLogged(userID, habit string) (int64, error) {
-	entries, err := s.store.GetHabit(userID, habit)
-	if err != nil {
-		return 0, err
+type quantities struct {
+	Unit          string
+	Total         float64
+	AveragePerDay float64
+	BestDay       int64
+	BestDayTotal  float64
+	TargetDone    float64
+}
+
+// computeQuantities totals the values of a habit's entries. Only entries in
+// one unit are counted: the target's unit if the habit has a target,
+// otherwise the unit of the latest entry with a value.
+func computeQuantities(entries []habit.Habit, d habit.HabitDefinition, loc *time.Location) quantities {
+	var q quantities
+	if d.Target != nil {
+		q.Unit = d.Target.Unit
+	} else {
+		for i := len(entries) - 1; i >= 0; i-- {
+			if entries[i].Value > 0 {
+				q.Unit = entries[i].Unit
+				break
+			}
+		}
+	}
+
+	perDay := make(map[int64]float64)
+	for _, e := range entries {
+		if e.Value > 0 && e.Unit == q.Unit {
+			q.Total += e.Value
+			perDay[habit.Day(e.TimeStamp, loc)] += e.Value
+		}
+	}
+	if len(perDay) == 0 {
+		return q
+	}
+	q.AveragePerDay = q.Total / float64(len(perDay))
+
+	days := slices.Sorted(maps.Keys(perDay))
+	for _, day := range days {
+		if perDay[day] > q.BestDayTotal {
+			q.BestDay = habit.DayStart(day, loc)
+			q.BestDayTotal = perDay[day]
+		}
 	}
+
+	if d.Target != nil {
+		today := habit.Day(time.Now().Unix(), loc)
+		thisWeek := habit.WeekOf(today)
+		for day, total := range perDay {
+			week := habit.WeekOf(day)
+			if day == today || (d.Target.Period == habit.TargetPerWeek && week == thisWeek) {
+				q.TargetDone += total
+			}
+		}
+	}
+	return q
+}
+
+func getLastLogged(entries []habit.Habit) int64 {
+	var last int64
+	for _, e := range entries {
+		last = max(last, e.TimeStamp)
+	}
+	return last
+}
+
+func getFirstLogged(name string, entries []habit.Habit) (int64, error) {
 	if len(entries) == 0 {
-		return 0, fmt.Errorf("habit %s not found", habit)
+		return 0, fmt.Errorf("habit %s not found", name)
 	}
 
 	days := make([]int64, len(entries))
@@ -86,57 +153,34 @@ func (s *Server) getFirstLogged(userID, habit string) (int64, error) {
 	return days[0], nil
 }
 
-func (s *Server) computeTotalDaysDone(userID, habit string) (int, error) {
-	entries, err := s.store.GetHabit(userID, habit)
-	if err != nil {
-		return 0, err
-	}
-	if len(entries) == 0 {
-		return 0, fmt.Errorf("habit %s not found", habit)
-	}
-
+func computeTotalDaysDone(entries []habit.Habit, loc *time.Location) int {
 	days := make(map[int64]struct{}, len(entries))
 	for _, e := range entries {
-		days[toDay(e.TimeStamp)] = struct{}{}
+		days[habit.Day(e.TimeStamp, loc)] = struct{}{}
 	}
 
-	return len(days), nil
+	return len(days)
 }
 
-func (s *Server) computeDaysThisMonth(userID, habit string) (int, error) {
-	entries, err := s.store.GetHabit(userID, habit)
-	if err != nil {
-		return 0, err
-	}
-	if len(entries) == 0 {
-		return 0, fmt.Errorf("habit %s not found", habit)
-	}
-
-	thisMonth := time.Now().UTC().Truncate(24 * time.Hour).Month()
+func computeDaysThisMonth(entries []habit.Habit, loc *time.Location) int {
+	year, month, _ := time.Now().In(loc).Date()
 	daysThisMonth := make(map[int64]struct{})
 
 	for _, e := range entries {
-		if time.Unix(e.TimeStamp, 0).UTC().Month() == thisMonth {
-			daysThisMonth[toDay(e.TimeStamp)] = struct{}{}
+		y, m, _ := time.Unix(e.TimeStamp, 0).In(loc).Date()
+		if y == year && m == month {
+			daysThisMonth[habit.Day(e.TimeStamp, loc)] = struct{}{}
 		}
 	}
 
-	return len(daysThisMonth), nil
+	return len(daysThisMonth)
 }
 
-func (s *Server) computeBestMonth(userID, habit string) (int, error) {
-	entries, err := s.store.GetHabit(userID, habit)
-	if err != nil {
-		return 0, err
-	}
-	if len(entries) == 0 {
-		return 0, fmt.Errorf("habit %s not found", habit)
-	}
-
+func computeBestMonth(entries []habit.Habit, loc *time.Location) int {
 	monthDays := map[int]int{}
 	for _, e := range entries {
-		date := time.Unix(e.TimeStamp, 0).UTC()
-		if date.Year() == time.Now().Year() {
+		date := time.Unix(e.TimeStamp, 0).In(loc)
+		if date.Year() == time.Now().In(loc).Year() {
 			monthDays[int(date.Month())]++
 		}
 	}
@@ -150,13 +194,5 @@ func (s *Server) computeBestMonth(userID, habit string) (int, error) {
 		}
 	}
 
-	return bestMonth, nil
-}
-
-// toDay converts a Unix timestamp (seconds since 1970) into a "day index".
-// A day index is the number of days since 1970-01-01 UTC.
-// making it easy to compare days and detect consecutive streaks.
-func toDay(ts int64) int64 {
-	const daySec = 24 * 60 * 60
-	return time.Unix(ts, 0).UTC().Truncate(24*time.Hour).Unix() / daySec
+	return bestMonth
 }
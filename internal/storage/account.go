@@ -0,0 +1,25 @@
+package storage
+
+// Account is what is kept about a user beyond their habits. Users from
+// before accounts were recorded have none until they next log in.
+type Account struct {
+	UserID string `json:"user_id"`
+	// Email and Name are from the last login, where the provider gave them.
+	Email string `json:"email,omitempty"`
+	Name  string `json:"name,omitempty"`
+	// Admin is whether the admin claim was present at the last login.
+	Admin bool `json:"admin,omitempty"`
+	// Disabled accounts can't log in or use their API keys.
+	Disabled    bool  `json:"disabled,omitempty"`
+	CreatedAt   int64 `json:"created_at"`
+	LastLoginAt int64 `json:"last_login_at,omitempty"`
+}
+
+// UserStats summarises the habits of a user with any stored data.
+type UserStats struct {
+	UserID     string
+	HabitCount int
+	EntryCount int
+	// LastEntryAt is the timestamp of the latest entry, zero without any.
+	LastEntryAt int64
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"slices"
+	"time"
+)
+
+// API key scopes. A request made with an API key may only do what the
+// key's scopes allow.
+const (
+	ScopeHabitsRead  = "habits:read"
+	ScopeHabitsWrite = "habits:write"
+	ScopeAdmin       = "admin"
+	// ScopeAccountDelete allows deleting the key's account, which
+	// habits:write alone doesn't.
+	ScopeAccountDelete = "account:delete"
+)
+
+// Scopes lists every scope. Keys created without asking for particular
+// scopes get all of them.
+var Scopes = []string{ScopeHabitsRead, ScopeHabitsWrite, ScopeAdmin, ScopeAccountDelete}
+
+// APIKey is what is kept about an API key. The key itself is never stored,
+// only its hash.
+type APIKey struct {
+	Hash   string `json:"hash"`
+	UserID string `json:"user_id"`
+	Name   string `json:"name"`
+	// CreatedAt is zero for keys from before it was recorded.
+	CreatedAt int64 `json:"created_at,omitempty"`
+	// ExpiresAt is zero for keys that never expire.
+	ExpiresAt  int64    `json:"expires_at,omitempty"`
+	LastUsedAt int64    `json:"last_used_at,omitempty"`
+	Scopes     []string `json:"scopes"`
+}
+
+func (k APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != 0 && now.Unix() >= k.ExpiresAt
+}
+
+func (k APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// ValidScope reports whether scope is one of Scopes.
+func ValidScope(scope string) bool {
+	return slices.Contains(Scopes, scope)
+}
@@ -0,0 +1,306 @@
+package bolt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/brk3/habits/internal/storage"
+	"github.com/brk3/habits/pkg/habit"
+	"go.etcd.io/bbolt"
+)
+
+// accountsBucket sits in the root bucket next to api_keys, holding accounts
+// as JSON by user ID.
+const accountsBucket = "accounts"
+
+func getAccountsBucket(tx *bbolt.Tx) (*bbolt.Bucket, error) {
+	bucket := tx.Bucket([]byte(rootBucket)).Bucket([]byte(accountsBucket))
+	if bucket == nil {
+		return nil, fmt.Errorf("accounts bucket not found")
+	}
+	return bucket, nil
+}
+
+func (s *Store) PutAccount(a storage.Account) error {
+	val, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("failed to marshal account: %w", err)
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := getAccountsBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(a.UserID), val)
+	})
+}
+
+func (s *Store) GetAccount(userID string) (storage.Account, bool, error) {
+	var a storage.Account
+	var found bool
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		bucket, err := getAccountsBucket(tx)
+		if err != nil {
+			return err
+		}
+		val := bucket.Get([]byte(userID))
+		if val == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(val, &a)
+	})
+	if err != nil {
+		return storage.Account{}, false, fmt.Errorf("failed to get account for user %s: %w", userID, err)
+	}
+	return a, found, nil
+}
+
+func (s *Store) ListAccounts() ([]storage.Account, error) {
+	var accounts []storage.Account
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		bucket, err := getAccountsBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var a storage.Account
+			if err := json.Unmarshal(v, &a); err != nil {
+				return fmt.Errorf("failed to unmarshal account %s: %w", k, err)
+			}
+			accounts = append(accounts, a)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list accounts: %w", err)
+	}
+	return accounts, nil
+}
+
+func (s *Store) ListUserStats() ([]storage.UserStats, error) {
+	var stats []storage.UserStats
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return forEachUserBucket(tx, func(userID string, user *bbolt.Bucket) error {
+			st := storage.UserStats{UserID: userID}
+			if defs := user.Bucket([]byte("definitions")); defs != nil {
+				st.HabitCount = defs.Stats().KeyN
+			}
+			err := user.Bucket([]byte("habits")).ForEach(func(k, v []byte) error {
+				var h habit.Habit
+				if err := json.Unmarshal(v, &h); err != nil {
+					return fmt.Errorf("failed to unmarshal entry %s for %s: %w", k, userID, err)
+				}
+				st.EntryCount++
+				st.LastEntryAt = max(st.LastEntryAt, h.TimeStamp)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			// reads create empty buckets, so only count users with habits
+			if st.HabitCount > 0 || st.EntryCount > 0 {
+				stats = append(stats, st)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user stats: %w", err)
+	}
+	return stats, nil
+}
+
+func (s *Store) DeleteUser(userID string) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		root := tx.Bucket([]byte(rootBucket))
+		if root == nil {
+			return fmt.Errorf("root bucket does not exist")
+		}
+		// only a bucket with habits is a user's; the shared buckets sit
+		// beside them
+		if user := root.Bucket([]byte(userID)); user != nil && user.Bucket([]byte("habits")) != nil {
+			if err := root.DeleteBucket([]byte(userID)); err != nil {
+				return err
+			}
+		}
+		for _, name := range []string{"api_keys", sessionsBucket, localUsersBucket, idempotencyBucket, devicesBucket} {
+			if _, err := deleteUserRecords(root.Bucket([]byte(name)), userID); err != nil {
+				return fmt.Errorf("failed to delete from %s: %w", name, err)
+			}
+		}
+		identityIDs, err := deleteUserRecords(root.Bucket([]byte(identitiesBucket)), userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete from %s: %w", identitiesBucket, err)
+		}
+		// refresh tokens are stored by identity
+		if bucket := root.Bucket([]byte("refresh_tokens")); bucket != nil {
+			for _, id := range append(identityIDs, []byte(userID)) {
+				if err := bucket.Delete(id); err != nil {
+					return err
+				}
+			}
+		}
+		if bucket := root.Bucket([]byte(accountsBucket)); bucket != nil {
+			return bucket.Delete([]byte(userID))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete user %s: %w", userID, err)
+	}
+	return nil
+}
+
+// deleteUserRecords deletes the JSON records in bucket that belong to
+// userID, going by their user_id field, and returns their keys.
+func deleteUserRecords(bucket *bbolt.Bucket, userID string) ([][]byte, error) {
+	if bucket == nil {
+		return nil, nil
+	}
+	// deleting while iterating skips keys, so collect them first
+	var keys [][]byte
+	err := bucket.ForEach(func(k, v []byte) error {
+		var rec struct {
+			UserID string `json:"user_id"`
+		}
+		if err := json.Unmarshal(v, &rec); err != nil {
+			return fmt.Errorf("failed to unmarshal %s: %w", k, err)
+		}
+		if rec.UserID == userID {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		if err := bucket.Delete(k); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+func (s *Store) MergeUser(fromUserID, toUserID string) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		root := tx.Bucket([]byte(rootBucket))
+		if root == nil {
+			return fmt.Errorf("root bucket does not exist")
+		}
+		if from := root.Bucket([]byte(fromUserID)); from != nil && from.Bucket([]byte("habits")) != nil {
+			if err := createUserBuckets(tx, toUserID); err != nil {
+				return err
+			}
+			to := root.Bucket([]byte(toUserID))
+			if err := copyMissingEntries(from.Bucket([]byte("habits")), to.Bucket([]byte("habits"))); err != nil {
+				return fmt.Errorf("failed to merge habits: %w", err)
+			}
+			if err := copyMissing(from.Bucket([]byte("definitions")), to.Bucket([]byte("definitions"))); err != nil {
+				return fmt.Errorf("failed to merge definitions: %w", err)
+			}
+			if settings := from.Get([]byte(settingsKey)); settings != nil && to.Get([]byte(settingsKey)) == nil {
+				if err := to.Put([]byte(settingsKey), append([]byte(nil), settings...)); err != nil {
+					return err
+				}
+			}
+			if err := root.DeleteBucket([]byte(fromUserID)); err != nil {
+				return err
+			}
+		}
+		for _, name := range []string{"api_keys", sessionsBucket, localUsersBucket, identitiesBucket, devicesBucket} {
+			if err := reassignUserRecords(root.Bucket([]byte(name)), fromUserID, toUserID); err != nil {
+				return fmt.Errorf("failed to merge %s: %w", name, err)
+			}
+		}
+		// keys are derived from the user, so the records can't be moved
+		if _, err := deleteUserRecords(root.Bucket([]byte(idempotencyBucket)), fromUserID); err != nil {
+			return fmt.Errorf("failed to delete from %s: %w", idempotencyBucket, err)
+		}
+		if bucket := root.Bucket([]byte(accountsBucket)); bucket != nil {
+			return bucket.Delete([]byte(fromUserID))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to merge user %s into %s: %w", fromUserID, toUserID, err)
+	}
+	return nil
+}
+
+// copyMissing copies the keys of src that dst doesn't have.
+func copyMissing(src, dst *bbolt.Bucket) error {
+	if src == nil {
+		return nil
+	}
+	return src.ForEach(func(k, v []byte) error {
+		if dst.Get(k) != nil {
+			return nil
+		}
+		return dst.Put(append([]byte(nil), k...), append([]byte(nil), v...))
+	})
+}
+
+// copyMissingEntries copies the entries of src whose IDs dst doesn't have.
+// An import can give both users an entry with the same ID, and the target's
+// entry is kept, as for definitions.
+func copyMissingEntries(src, dst *bbolt.Bucket) error {
+	if src == nil {
+		return nil
+	}
+	ids := map[string]bool{}
+	err := dst.ForEach(func(k, v []byte) error {
+		if i := bytes.LastIndexByte(k, '/'); i >= 0 {
+			ids[string(k[i+1:])] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return src.ForEach(func(k, v []byte) error {
+		if i := bytes.LastIndexByte(k, '/'); i >= 0 && ids[string(k[i+1:])] {
+			return nil
+		}
+		return dst.Put(append([]byte(nil), k...), append([]byte(nil), v...))
+	})
+}
+
+// reassignUserRecords moves the JSON records in bucket that belong to
+// fromUserID, going by their user_id field, to toUserID.
+func reassignUserRecords(bucket *bbolt.Bucket, fromUserID, toUserID string) error {
+	if bucket == nil {
+		return nil
+	}
+	type kv struct{ k, v []byte }
+	var moved []kv
+	err := bucket.ForEach(func(k, v []byte) error {
+		var rec map[string]json.RawMessage
+		if err := json.Unmarshal(v, &rec); err != nil {
+			return fmt.Errorf("failed to unmarshal %s: %w", k, err)
+		}
+		var userID string
+		if err := json.Unmarshal(rec["user_id"], &userID); err != nil || userID != fromUserID {
+			return nil
+		}
+		rec["user_id"], _ = json.Marshal(toUserID)
+		val, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		moved = append(moved, kv{append([]byte(nil), k...), val})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// like deleting, writing while iterating isn't allowed
+	for _, m := range moved {
+		if err := bucket.Put(m.k, m.v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
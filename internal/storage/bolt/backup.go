@@ -0,0 +1,125 @@
+package bolt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/brk3/habits/internal/logger"
+	"go.etcd.io/bbolt"
+)
+
+// Backup streams a consistent snapshot of the database to w. It runs in a
+// read transaction, so writers carry on while it is taken.
+func (s *Store) Backup(w io.Writer) (int64, error) {
+	var n int64
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	if err != nil {
+		return n, fmt.Errorf("failed to write backup: %w", err)
+	}
+	return n, nil
+}
+
+// ValidateFile checks that path is a healthy habits database: it opens,
+// passes bolt's consistency check, has the root bucket and a schema this
+// build understands.
+func ValidateFile(path string) error {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bbolt.Tx) error {
+		var errs []error
+		for err := range tx.Check() {
+			errs = append(errs, err)
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("%s failed consistency check: %w", path, errors.Join(errs...))
+		}
+		if tx.Bucket([]byte(rootBucket)) == nil {
+			return fmt.Errorf("%s has no %s bucket", path, rootBucket)
+		}
+		if v := readSchemaVersion(tx); v > LatestSchemaVersion() {
+			return fmt.Errorf("%s has schema version %d, newer than supported version %d", path, v, LatestSchemaVersion())
+		}
+		return nil
+	})
+}
+
+// Restore replaces the database at dst with the backup at src after
+// validating it. The previous database is kept at dst+".bak". It fails if
+// another process, such as a running server, has dst open.
+func Restore(src, dst string) error {
+	if err := ValidateFile(src); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(dst); err == nil {
+		// bolt holds an exclusive lock while a server has the file open
+		db, err := bbolt.Open(dst, 0600, &bbolt.Options{Timeout: time.Second})
+		if err != nil {
+			return fmt.Errorf("failed to lock %s, is the server still running? %w", dst, err)
+		}
+		if err := db.Close(); err != nil {
+			return err
+		}
+		if err := copyFile(dst, dst+".bak"); err != nil {
+			return fmt.Errorf("failed to keep a copy of %s: %w", dst, err)
+		}
+		logger.Info("Kept previous database", "path", dst+".bak")
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	tmp := dst + ".restore"
+	if err := copyFile(src, tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to swap in %s: %w", src, err)
+	}
+	logger.Info("Restored database", "from", src, "to", dst)
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	// make the new directory entry durable too
+	dir, err := os.Open(filepath.Dir(dst))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -0,0 +1,101 @@
+package bolt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/brk3/habits/pkg/habit"
+	"go.etcd.io/bbolt"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "source.db")
+	store, err := Open(srcPath)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	now := time.Now().Unix()
+	if err := store.PutHabit("testuser", habit.Habit{ID: habit.NewID(now), Name: "guitar", TimeStamp: now}); err != nil {
+		t.Fatalf("PutHabit failed: %v", err)
+	}
+
+	backupPath := filepath.Join(dir, "backup.db")
+	f, err := os.Create(backupPath)
+	if err != nil {
+		t.Fatalf("failed to create backup file: %v", err)
+	}
+	if _, err := store.Backup(f); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	f.Close()
+	store.Close()
+
+	if err := ValidateFile(backupPath); err != nil {
+		t.Fatalf("ValidateFile failed on backup: %v", err)
+	}
+
+	// restore over a database with different contents
+	dstPath := filepath.Join(dir, "habits.db")
+	dst, err := Open(dstPath)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	if err := dst.PutHabit("testuser", habit.Habit{ID: habit.NewID(now), Name: "reading", TimeStamp: now}); err != nil {
+		t.Fatalf("PutHabit failed: %v", err)
+	}
+
+	// refused while the database is open
+	if err := Restore(backupPath, dstPath); err == nil {
+		t.Fatal("expected Restore to fail while the database is in use")
+	}
+	dst.Close()
+
+	if err := Restore(backupPath, dstPath); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if _, err := os.Stat(dstPath + ".bak"); err != nil {
+		t.Fatalf("expected previous database to be kept: %v", err)
+	}
+
+	restored, err := Open(dstPath)
+	if err != nil {
+		t.Fatalf("failed to open restored store: %v", err)
+	}
+	defer restored.Close()
+	names, err := restored.ListHabitNames("testuser")
+	if err != nil {
+		t.Fatalf("ListHabitNames failed: %v", err)
+	}
+	if len(names) != 1 || names[0] != "guitar" {
+		t.Fatalf("got habits %v after restore, want [guitar]", names)
+	}
+}
+
+func TestValidateFile_Rejects(t *testing.T) {
+	dir := t.TempDir()
+
+	garbage := filepath.Join(dir, "garbage.db")
+	if err := os.WriteFile(garbage, []byte("not a database"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateFile(garbage); err == nil {
+		t.Fatal("expected error validating garbage file")
+	}
+
+	// a valid bolt file that isn't a habits database
+	empty := filepath.Join(dir, "empty.db")
+	db, err := bbolt.Open(empty, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if err := ValidateFile(empty); err == nil {
+		t.Fatal("expected error validating database without root bucket")
+	}
+	if err := Restore(empty, filepath.Join(dir, "habits.db")); err == nil {
+		t.Fatal("expected Restore to reject an invalid backup")
+	}
+}
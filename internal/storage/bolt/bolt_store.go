@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/brk3/habits/internal/logger"
@@ -17,10 +16,22 @@ import (
 const rootBucket = "users"
 
 type Store struct {
-	db *bbolt.DB
+	db     *bbolt.DB
+	cipher *storage.Cipher
+}
+
+// Options tweak how the database is opened.
+type Options struct {
+	// SkipMigrations opens the database without applying pending schema
+	// migrations, e.g. to inspect them with PendingMigrations.
+	SkipMigrations bool
 }
 
 func Open(path string) (*Store, error) {
+	return OpenWithOptions(path, Options{})
+}
+
+func OpenWithOptions(path string, opts Options) (*Store, error) {
 	logger.Debug("Opening BoltDB", "path", path)
 	db, err := bbolt.Open(path, 0600, nil)
 	if err != nil {
@@ -30,15 +41,14 @@ func Open(path string) (*Store, error) {
 
 	s := &Store{db: db}
 
-	if err := db.Update(func(tx *bbolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(rootBucket))
-		return err
-	}); err != nil {
-		logger.Error("Failed to create root bucket", "bucket", rootBucket, "error", err)
-		if closeErr := db.Close(); closeErr != nil {
-			logger.Error("Failed to close database after bucket creation error", "error", closeErr)
+	if !opts.SkipMigrations {
+		if err := s.Migrate(); err != nil {
+			logger.Error("Failed to migrate BoltDB", "path", path, "error", err)
+			if closeErr := db.Close(); closeErr != nil {
+				logger.Error("Failed to close database after migration error", "error", closeErr)
+			}
+			return nil, err
 		}
-		return nil, err
 	}
 
 	logger.Info("BoltDB opened successfully", "path", path)
@@ -47,19 +57,27 @@ func Open(path string) (*Store, error) {
 
 func (s *Store) ensureUserHabitsBucketExists(userID string) error {
 	return s.db.Update(func(tx *bbolt.Tx) error {
-		usersBucket := tx.Bucket([]byte(rootBucket))
-		if usersBucket == nil {
-			return fmt.Errorf("root bucket does not exist")
-		}
+		return createUserBuckets(tx, userID)
+	})
+}
 
-		userBucket, err := usersBucket.CreateBucketIfNotExists([]byte(userID))
-		if err != nil {
-			return err
-		}
+// createUserBuckets creates a user's buckets within tx if they are missing.
+func createUserBuckets(tx *bbolt.Tx, userID string) error {
+	usersBucket := tx.Bucket([]byte(rootBucket))
+	if usersBucket == nil {
+		return fmt.Errorf("root bucket does not exist")
+	}
 
-		_, err = userBucket.CreateBucketIfNotExists([]byte("habits"))
+	userBucket, err := usersBucket.CreateBucketIfNotExists([]byte(userID))
+	if err != nil {
 		return err
-	})
+	}
+
+	if _, err = userBucket.CreateBucketIfNotExists([]byte("habits")); err != nil {
+		return err
+	}
+	_, err = userBucket.CreateBucketIfNotExists([]byte("definitions"))
+	return err
 }
 
 func (s *Store) ensureAPIKeyBucketExists() error {
@@ -103,27 +121,73 @@ func (s *Store) Close() error {
 	return nil
 }
 
+// entryKey builds the key for an entry: name/<RFC3339 UTC>/<id>. Keys sort by
+// entry time under the habit name prefix, and the ID keeps entries logged in
+// the same second apart.
+func entryKey(h habit.Habit) []byte {
+	return fmt.Appendf(nil, "%s/%s/%s", h.Name, time.Unix(h.TimeStamp, 0).UTC().Format(time.RFC3339), h.ID)
+}
+
 func (s *Store) PutHabit(userID string, h habit.Habit) error {
-	logger.Debug("Storing habit", "user_id", userID, "habit_name", h.Name)
-	if err := s.ensureUserHabitsBucketExists(userID); err != nil {
-		logger.Error("Failed to ensure bucket exists", "user_id", userID, "error", err)
-		return err
+	return s.PutHabits(userID, []habit.Habit{h})
+}
+
+func (s *Store) PutHabits(userID string, entries []habit.Habit) error {
+	return s.putHabits(userID, entries, false)
+}
+
+func (s *Store) ImportHabits(userID string, entries []habit.Habit) error {
+	return s.putHabits(userID, entries, true)
+}
+
+// putHabits stores entries. With replace, an entry already stored with
+// another timestamp has its old key removed, which costs a scan of the
+// habit's keys.
+func (s *Store) putHabits(userID string, entries []habit.Habit, replace bool) error {
+	logger.Debug("Storing habits", "user_id", userID, "count", len(entries))
+	for i := range entries {
+		if entries[i].ID == "" {
+			entries[i].ID = habit.NewID(entries[i].TimeStamp)
+		}
 	}
+	// one transaction for the whole batch, bucket creation included, as
+	// each bolt write transaction costs an fsync
 	return s.db.Update(func(tx *bbolt.Tx) error {
+		if err := createUserBuckets(tx, userID); err != nil {
+			return fmt.Errorf("failed to create buckets for user %s: %w", userID, err)
+		}
 		bucket, err := s.getUserHabitsBucket(tx, userID)
 		if err != nil {
 			return fmt.Errorf("failed to get user habits bucket: %w", err)
 		}
-		val, err := json.Marshal(h)
-		if err != nil {
-			return fmt.Errorf("failed to marshal habit %s: %w", h.Name, err)
-		}
-		key := fmt.Appendf(nil, "%s/%s", h.Name, time.Unix(h.TimeStamp, 0).Format(time.RFC3339))
-		err = bucket.Put(key, val)
-		if err != nil {
-			return fmt.Errorf("failed to store habit %s: %w", h.Name, err)
+		// keys embed the timestamp, so an entry stored again with another
+		// time must replace its old key rather than sit beside it
+		existing := map[string]map[string][]byte{}
+		for _, h := range entries {
+			val, err := json.Marshal(h)
+			if err != nil {
+				return fmt.Errorf("failed to marshal habit %s: %w", h.Name, err)
+			}
+			key := entryKey(h)
+			if replace {
+				if existing[h.Name] == nil {
+					existing[h.Name] = entryKeysByID(bucket, h.Name)
+				}
+				if old, ok := existing[h.Name][h.ID]; ok && !bytes.Equal(old, key) {
+					if err := bucket.Delete(old); err != nil {
+						return fmt.Errorf("failed to remove old habit entry %s: %w", h.ID, err)
+					}
+				}
+				existing[h.Name][h.ID] = key
+			}
+			if err := bucket.Put(key, val); err != nil {
+				return fmt.Errorf("failed to store habit %s: %w", h.Name, err)
+			}
+			if err := s.ensureHabitDefinition(tx, userID, h.Name, h.TimeStamp); err != nil {
+				return fmt.Errorf("failed to create definition for habit %s: %w", h.Name, err)
+			}
+			logger.Debug("Habit stored successfully", "key", string(key))
 		}
-		logger.Debug("Habit stored successfully", "key", string(key))
 		return nil
 	})
 }
@@ -132,25 +196,20 @@ func (s *Store) ListHabitNames(userID string) ([]string, error) {
 	if err := s.ensureUserHabitsBucketExists(userID); err != nil {
 		return nil, fmt.Errorf("failed to ensure bucket exists for user %s: %w", userID, err)
 	}
-	uniq := map[string]struct{}{}
+	out := []string{}
 	err := s.db.View(func(tx *bbolt.Tx) error {
-		bucket, err := s.getUserHabitsBucket(tx, userID)
+		bucket, err := s.getUserDefinitionsBucket(tx, userID)
 		if err != nil {
-			return fmt.Errorf("failed to get user habits bucket for listing: %w", err)
+			return fmt.Errorf("failed to get user definitions bucket for listing: %w", err)
 		}
 		return bucket.ForEach(func(k, _ []byte) error {
-			name := strings.SplitN(string(k), "/", 2)[0]
-			uniq[name] = struct{}{}
+			out = append(out, string(k))
 			return nil
 		})
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list habit names for user %s: %w", userID, err)
 	}
-	out := make([]string, 0, len(uniq))
-	for n := range uniq {
-		out = append(out, n)
-	}
 	return out, nil
 }
 
@@ -181,6 +240,67 @@ func (s *Store) GetHabit(userID, name string) ([]habit.Habit, error) {
 	return out, nil
 }
 
+func (s *Store) GetHabitRange(userID, name string, q storage.EntryQuery) ([]habit.Habit, string, error) {
+	if err := s.ensureUserHabitsBucketExists(userID); err != nil {
+		return nil, "", fmt.Errorf("failed to ensure bucket exists for user %s: %w", userID, err)
+	}
+
+	prefix := []byte(name + "/")
+	start := prefix
+	if q.From != 0 {
+		start = entryKey(habit.Habit{Name: name, TimeStamp: q.From})
+	}
+	var after []byte
+	if q.Cursor != "" {
+		ts, id, err := storage.DecodeCursor(q.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		after = entryKey(habit.Habit{ID: id, Name: name, TimeStamp: ts})
+		if bytes.Compare(after, start) > 0 {
+			start = after
+		}
+	}
+	var end []byte
+	if q.To != 0 {
+		// keys for the To second all start with this, and "/" sorts before any ID
+		end = entryKey(habit.Habit{Name: name, TimeStamp: q.To})
+	}
+
+	var out []habit.Habit
+	var next string
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		bucket, err := s.getUserHabitsBucket(tx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to get user habits bucket for retrieval: %w", err)
+		}
+		c := bucket.Cursor()
+		for k, v := c.Seek(start); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			if after != nil && bytes.Compare(k, after) <= 0 {
+				continue
+			}
+			if end != nil && bytes.Compare(k, end) >= 0 {
+				break
+			}
+			if q.Limit > 0 && len(out) == q.Limit {
+				last := out[len(out)-1]
+				next = storage.EncodeCursor(last.TimeStamp, last.ID)
+				break
+			}
+			var e habit.Habit
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("failed to unmarshal habit entry for %s: %w", name, err)
+			}
+			out = append(out, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get habit range %s for user %s: %w", name, userID, err)
+	}
+	return out, next, nil
+}
+
 func (s *Store) DeleteHabit(userID, name string) error {
 	if err := s.ensureUserHabitsBucketExists(userID); err != nil {
 		return fmt.Errorf("failed to ensure bucket exists for user %s: %w", userID, err)
@@ -197,41 +317,150 @@ func (s *Store) DeleteHabit(userID, name string) error {
 				return fmt.Errorf("failed to delete habit entry %s: %w", string(k), err)
 			}
 		}
+		defs, err := s.getUserDefinitionsBucket(tx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to get user definitions bucket for deletion: %w", err)
+		}
+		return defs.Delete([]byte(name))
+	})
+}
+
+// findEntryKey returns the key of the entry with the given ID under the
+// habit's prefix, or nil if there is none.
+func findEntryKey(bucket *bbolt.Bucket, name, id string) []byte {
+	c := bucket.Cursor()
+	prefix := []byte(name + "/")
+	suffix := []byte("/" + id)
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		if bytes.HasSuffix(k, suffix) {
+			return append([]byte(nil), k...)
+		}
+	}
+	return nil
+}
+
+// entryKeysByID maps the IDs of a habit's entries to their keys.
+func entryKeysByID(bucket *bbolt.Bucket, name string) map[string][]byte {
+	keys := map[string][]byte{}
+	c := bucket.Cursor()
+	prefix := []byte(name + "/")
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		if i := bytes.LastIndexByte(k, '/'); i >= 0 {
+			keys[string(k[i+1:])] = append([]byte(nil), k...)
+		}
+	}
+	return keys
+}
+
+func (s *Store) GetHabitEntry(userID, name, id string) (habit.Habit, bool, error) {
+	if err := s.ensureUserHabitsBucketExists(userID); err != nil {
+		return habit.Habit{}, false, fmt.Errorf("failed to ensure bucket exists for user %s: %w", userID, err)
+	}
+	var e habit.Habit
+	var found bool
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		bucket, err := s.getUserHabitsBucket(tx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to get user habits bucket for retrieval: %w", err)
+		}
+		key := findEntryKey(bucket, name, id)
+		if key == nil {
+			return nil
+		}
+		if err := json.Unmarshal(bucket.Get(key), &e); err != nil {
+			return fmt.Errorf("failed to unmarshal habit entry %s: %w", id, err)
+		}
+		found = true
 		return nil
 	})
+	return e, found, err
 }
 
-func (s *Store) PutAPIKey(keyHash, userID string) error {
+func (s *Store) UpdateHabitEntry(userID, name string, e habit.Habit) error {
+	logger.Debug("Updating habit entry", "user_id", userID, "habit_name", name, "habit_entry_id", e.ID)
+	if err := s.ensureUserHabitsBucketExists(userID); err != nil {
+		return fmt.Errorf("failed to ensure bucket exists for user %s: %w", userID, err)
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := s.getUserHabitsBucket(tx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to get user habits bucket for update: %w", err)
+		}
+		oldKey := findEntryKey(bucket, name, e.ID)
+		if oldKey == nil {
+			return storage.ErrNotFound
+		}
+		val, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("failed to marshal habit entry %s: %w", e.ID, err)
+		}
+		// the key embeds the timestamp, so an edited timestamp moves the entry
+		if err := bucket.Delete(oldKey); err != nil {
+			return fmt.Errorf("failed to remove old habit entry %s: %w", e.ID, err)
+		}
+		if err := bucket.Put(entryKey(e), val); err != nil {
+			return fmt.Errorf("failed to store habit entry %s: %w", e.ID, err)
+		}
+		return nil
+	})
+}
+
+func (s *Store) DeleteHabitEntry(userID, name, id string) error {
+	if err := s.ensureUserHabitsBucketExists(userID); err != nil {
+		return fmt.Errorf("failed to ensure bucket exists for user %s: %w", userID, err)
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := s.getUserHabitsBucket(tx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to get user habits bucket for deletion: %w", err)
+		}
+		key := findEntryKey(bucket, name, id)
+		if key == nil {
+			return storage.ErrNotFound
+		}
+		if err := bucket.Delete(key); err != nil {
+			return fmt.Errorf("failed to delete habit entry %s: %w", id, err)
+		}
+		return nil
+	})
+}
+
+func (s *Store) PutAPIKey(key storage.APIKey) error {
 	if err := s.ensureAPIKeyBucketExists(); err != nil {
 		return fmt.Errorf("failed to ensure API key bucket exists: %w", err)
 	}
 
+	val, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal API key: %w", err)
+	}
+
 	return s.db.Update(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket([]byte(rootBucket)).Bucket([]byte("api_keys"))
 		if bucket == nil {
 			return fmt.Errorf("api_keys bucket not found")
 		}
 
-		err := bucket.Put([]byte(keyHash), []byte(userID))
+		err := bucket.Put([]byte(key.Hash), val)
 		if err != nil {
 			return fmt.Errorf("failed to store API key: %w", err)
 		}
 
-		hashPreview := keyHash
+		hashPreview := key.Hash
 		if len(hashPreview) > 8 {
 			hashPreview = hashPreview[:8] + "..."
 		}
-		logger.Debug("API key stored", "keyHash", hashPreview, "userID", userID)
+		logger.Debug("API key stored", "keyHash", hashPreview, "userID", key.UserID)
 		return nil
 	})
 }
 
-func (s *Store) GetAPIKey(keyHash string) (string, bool, error) {
+func (s *Store) GetAPIKey(keyHash string) (storage.APIKey, bool, error) {
 	if err := s.ensureAPIKeyBucketExists(); err != nil {
-		return "", false, fmt.Errorf("failed to ensure API key bucket exists: %w", err)
+		return storage.APIKey{}, false, fmt.Errorf("failed to ensure API key bucket exists: %w", err)
 	}
 
-	var userID string
+	var key storage.APIKey
 	var found bool
 	err := s.db.View(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket([]byte(rootBucket)).Bucket([]byte("api_keys"))
@@ -239,23 +468,26 @@ func (s *Store) GetAPIKey(keyHash string) (string, bool, error) {
 			return fmt.Errorf("api_keys bucket not found")
 		}
 
-		userIDBytes := bucket.Get([]byte(keyHash))
-		if userIDBytes != nil {
-			userID = string(userIDBytes)
-			found = true
+		val := bucket.Get([]byte(keyHash))
+		if val == nil {
+			return nil
+		}
+		if err := json.Unmarshal(val, &key); err != nil {
+			return fmt.Errorf("failed to unmarshal API key: %w", err)
 		}
+		found = true
 		return nil
 	})
 
-	return userID, found, err
+	return key, found, err
 }
 
-func (s *Store) ListAPIKeyHashes(userID string) ([]string, error) {
+func (s *Store) ListAPIKeys(userID string) ([]storage.APIKey, error) {
 	if err := s.ensureAPIKeyBucketExists(); err != nil {
 		return nil, fmt.Errorf("failed to ensure API key bucket exists: %w", err)
 	}
 
-	var hashes []string
+	var keys []storage.APIKey
 	err := s.db.View(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket([]byte(rootBucket)).Bucket([]byte("api_keys"))
 		if bucket == nil {
@@ -263,15 +495,46 @@ func (s *Store) ListAPIKeyHashes(userID string) ([]string, error) {
 		}
 
 		return bucket.ForEach(func(k, v []byte) error {
-			storedUserID := string(v)
-			if storedUserID == userID {
-				hashes = append(hashes, string(k))
+			var key storage.APIKey
+			if err := json.Unmarshal(v, &key); err != nil {
+				return fmt.Errorf("failed to unmarshal API key: %w", err)
+			}
+			if key.UserID == userID {
+				keys = append(keys, key)
 			}
 			return nil
 		})
 	})
 
-	return hashes, err
+	return keys, err
+}
+
+func (s *Store) TouchAPIKey(keyHash string, lastUsedAt int64) error {
+	if err := s.ensureAPIKeyBucketExists(); err != nil {
+		return fmt.Errorf("failed to ensure API key bucket exists: %w", err)
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(rootBucket)).Bucket([]byte("api_keys"))
+		if bucket == nil {
+			return fmt.Errorf("api_keys bucket not found")
+		}
+
+		val := bucket.Get([]byte(keyHash))
+		if val == nil {
+			return nil
+		}
+		var key storage.APIKey
+		if err := json.Unmarshal(val, &key); err != nil {
+			return fmt.Errorf("failed to unmarshal API key: %w", err)
+		}
+		key.LastUsedAt = lastUsedAt
+		val, err := json.Marshal(key)
+		if err != nil {
+			return fmt.Errorf("failed to marshal API key: %w", err)
+		}
+		return bucket.Put([]byte(keyHash), val)
+	})
 }
 
 func (s *Store) DeleteAPIKey(keyHash string) error {
@@ -311,6 +574,10 @@ func (s *Store) PutRefreshToken(userID string, token *oauth2.Token) error {
 			return fmt.Errorf("refresh_tokens bucket not found")
 		}
 
+		token, err := s.cipher.EncryptToken(userID, token)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt token: %w", err)
+		}
 		tokenBytes, err := json.Marshal(token)
 		if err != nil {
 			return fmt.Errorf("failed to marshal token: %w", err)
@@ -349,6 +616,13 @@ func (s *Store) GetRefreshToken(userID string) (*oauth2.Token, bool, error) {
 		}
 		return nil
 	})
+	if err != nil || !found {
+		return nil, false, err
+	}
+	token, err = s.cipher.DecryptToken(userID, token)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decrypt token for %s: %w", userID, err)
+	}
 
 	return token, found, err
 }
@@ -367,4 +641,112 @@ func (s *Store) DeleteRefreshToken(userID string) error {
 	})
 }
 
-var _ storage.Store = (*Store)(nil)
+// SetCipher makes the store encrypt refresh tokens and session ID tokens.
+// Tokens written before are still read, and rewritten by ReencryptSecrets.
+func (s *Store) SetCipher(c *storage.Cipher) {
+	s.cipher = c
+}
+
+func (s *Store) ReencryptSecrets() (int, error) {
+	return s.reencrypt(false)
+}
+
+func (s *Store) PurgeUndecryptableSecrets() (int, error) {
+	return s.reencrypt(true)
+}
+
+func (s *Store) reencrypt(purge bool) (int, error) {
+	if s.cipher == nil {
+		return 0, nil
+	}
+	tokens, err := s.reencryptRefreshTokens(purge)
+	if err != nil {
+		return 0, err
+	}
+	sessions, err := s.reencryptSessions(purge)
+	if err != nil {
+		return 0, err
+	}
+	return tokens + sessions, nil
+}
+
+// reencryptRefreshTokens rewrites the stale refresh tokens. Tokens that
+// can't be decrypted fail the whole run unless purge is set, in which case
+// they are deleted instead and only those are counted.
+func (s *Store) reencryptRefreshTokens(purge bool) (int, error) {
+	if s.cipher == nil {
+		return 0, nil
+	}
+	if err := s.ensureRefreshTokenBucketExists(); err != nil {
+		return 0, fmt.Errorf("failed to ensure refresh token bucket exists: %w", err)
+	}
+
+	var count int
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(rootBucket)).Bucket([]byte("refresh_tokens"))
+		type kv struct{ k, v []byte }
+		var stale []kv
+		var lost [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var token oauth2.Token
+			if err := json.Unmarshal(v, &token); err != nil {
+				return fmt.Errorf("failed to unmarshal token %s: %w", k, err)
+			}
+			if !s.cipher.StaleToken(&token) {
+				return nil
+			}
+			id := string(k)
+			plain, err := s.cipher.DecryptToken(id, &token)
+			if err != nil {
+				logger.Warn("Refresh token can't be decrypted", "id", id, "error", err)
+				lost = append(lost, append([]byte(nil), k...))
+				return nil
+			}
+			if purge {
+				return nil
+			}
+			sealed, err := s.cipher.EncryptToken(id, plain)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt token for %s: %w", id, err)
+			}
+			val, err := json.Marshal(sealed)
+			if err != nil {
+				return err
+			}
+			stale = append(stale, kv{append([]byte(nil), k...), val})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if purge {
+			for _, k := range lost {
+				if err := bucket.Delete(k); err != nil {
+					return err
+				}
+			}
+			count = len(lost)
+			return nil
+		}
+		if len(lost) > 0 {
+			return fmt.Errorf("%d refresh tokens can't be decrypted with the configured keys: %w",
+				len(lost), storage.ErrUndecryptable)
+		}
+		for _, e := range stale {
+			if err := bucket.Put(e.k, e.v); err != nil {
+				return err
+			}
+		}
+		count = len(stale)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to re-encrypt refresh tokens: %w", err)
+	}
+	return count, nil
+}
+
+var (
+	_ storage.Store     = (*Store)(nil)
+	_ storage.Encrypter = (*Store)(nil)
+)
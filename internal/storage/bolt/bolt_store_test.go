@@ -1,11 +1,19 @@
 package bolt
 
 import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/brk3/habits/internal/storage"
 	"github.com/brk3/habits/pkg/habit"
+	"go.etcd.io/bbolt"
+	"golang.org/x/oauth2"
 )
 
 func newTestStore(t *testing.T) (*Store, func()) {
@@ -133,56 +141,75 @@ func TestGetAPIKey_Valid(t *testing.T) {
 	store, cleanup := newTestStore(t)
 	defer cleanup()
 
-	err := store.PutAPIKey("test-hash", "user-123")
+	want := storage.APIKey{
+		Hash:      "test-hash",
+		UserID:    "user-123",
+		Name:      "dashboard",
+		CreatedAt: 1700000000,
+		ExpiresAt: 1800000000,
+		Scopes:    []string{storage.ScopeHabitsRead},
+	}
+	err := store.PutAPIKey(want)
 	if err != nil {
 		t.Fatalf("PutAPIKey failed: %v", err)
 	}
 
-	userID, found, err := store.GetAPIKey("test-hash")
+	key, found, err := store.GetAPIKey("test-hash")
 	if err != nil {
 		t.Fatalf("GetAPIKey failed: %v", err)
 	}
 	if !found {
 		t.Fatal("expected key to be found")
 	}
-	if userID != "user-123" {
-		t.Fatalf("expected userID 'user-123', got '%s'", userID)
+	if !reflect.DeepEqual(key, want) {
+		t.Fatalf("got key %+v, want %+v", key, want)
+	}
+
+	if err := store.TouchAPIKey("test-hash", 1750000000); err != nil {
+		t.Fatalf("TouchAPIKey failed: %v", err)
+	}
+	key, _, _ = store.GetAPIKey("test-hash")
+	if key.LastUsedAt != 1750000000 {
+		t.Fatalf("got last used %d, want 1750000000", key.LastUsedAt)
+	}
+	if err := store.TouchAPIKey("missing-hash", 1750000000); err != nil {
+		t.Fatalf("TouchAPIKey on a missing key failed: %v", err)
 	}
 }
 
-func TestListAPIKeyHashes(t *testing.T) {
+func TestListAPIKeys(t *testing.T) {
 	store, cleanup := newTestStore(t)
 	defer cleanup()
 
-	err := store.PutAPIKey("key1", "user1")
+	err := store.PutAPIKey(storage.APIKey{Hash: "key1", UserID: "user1"})
 	if err != nil {
 		t.Fatalf("PutAPIKey failed: %v", err)
 	}
 
-	err = store.PutAPIKey("key2", "user1")
+	err = store.PutAPIKey(storage.APIKey{Hash: "key2", UserID: "user1"})
 	if err != nil {
 		t.Fatalf("PutAPIKey failed: %v", err)
 	}
 
-	err = store.PutAPIKey("key3", "user2")
+	err = store.PutAPIKey(storage.APIKey{Hash: "key3", UserID: "user2"})
 	if err != nil {
 		t.Fatalf("PutAPIKey failed: %v", err)
 	}
 
-	hashes, err := store.ListAPIKeyHashes("user1")
+	keys, err := store.ListAPIKeys("user1")
 	if err != nil {
-		t.Fatalf("ListAPIKeyHashes failed: %v", err)
+		t.Fatalf("ListAPIKeys failed: %v", err)
 	}
-	if len(hashes) != 2 {
-		t.Fatalf("expected 2 hashes for user1, got %d", len(hashes))
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 keys for user1, got %d", len(keys))
 	}
 
-	hashes, err = store.ListAPIKeyHashes("user2")
+	keys, err = store.ListAPIKeys("user2")
 	if err != nil {
-		t.Fatalf("ListAPIKeyHashes failed: %v", err)
+		t.Fatalf("ListAPIKeys failed: %v", err)
 	}
-	if len(hashes) != 1 {
-		t.Fatalf("expected 1 hash for user2, got %d", len(hashes))
+	if len(keys) != 1 || keys[0].Hash != "key3" {
+		t.Fatalf("expected key3 for user2, got %+v", keys)
 	}
 }
 
@@ -190,7 +217,7 @@ func TestDeleteAPIKey(t *testing.T) {
 	store, cleanup := newTestStore(t)
 	defer cleanup()
 
-	err := store.PutAPIKey("delete-me", "user-123")
+	err := store.PutAPIKey(storage.APIKey{Hash: "delete-me", UserID: "user-123"})
 	if err != nil {
 		t.Fatalf("PutAPIKey failed: %v", err)
 	}
@@ -216,3 +243,933 @@ func TestDeleteAPIKey(t *testing.T) {
 		t.Fatal("expected key not to be found after delete")
 	}
 }
+
+func TestRefreshTokenEncryption(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	// written before encryption was set up
+	if err := store.PutRefreshToken("legacy", &oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}); err != nil {
+		t.Fatalf("PutRefreshToken failed: %v", err)
+	}
+
+	store.SetCipher(testCipher(t, "k1"))
+	if err := store.PutRefreshToken("user1", &oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}); err != nil {
+		t.Fatalf("PutRefreshToken failed: %v", err)
+	}
+	if raw := rawRefreshToken(t, store, "user1"); !strings.HasPrefix(raw, "enc:v1:k1:") {
+		t.Fatalf("expected refresh token encrypted with k1, got %q", raw)
+	}
+	for _, id := range []string{"legacy", "user1"} {
+		got, found, err := store.GetRefreshToken(id)
+		if err != nil || !found {
+			t.Fatalf("GetRefreshToken(%s) = %v, %v", id, found, err)
+		}
+		if got.AccessToken != "access" || got.RefreshToken != "refresh" {
+			t.Fatalf("unexpected token for %s: %+v", id, got)
+		}
+	}
+
+	n, err := store.ReencryptSecrets()
+	if err != nil || n != 1 {
+		t.Fatalf("ReencryptSecrets = %d, %v; want the legacy token", n, err)
+	}
+	if raw := rawRefreshToken(t, store, "legacy"); !strings.HasPrefix(raw, "enc:v1:k1:") {
+		t.Fatalf("expected legacy token encrypted with k1, got %q", raw)
+	}
+
+	// rotate to k2, keeping k1 to read with until re-encrypted
+	store.SetCipher(testCipher(t, "k2", "k1"))
+	if n, err := store.ReencryptSecrets(); err != nil || n != 2 {
+		t.Fatalf("ReencryptSecrets = %d, %v; want both tokens", n, err)
+	}
+	store.SetCipher(testCipher(t, "k2"))
+	for _, id := range []string{"legacy", "user1"} {
+		got, _, err := store.GetRefreshToken(id)
+		if err != nil || got.RefreshToken != "refresh" {
+			t.Fatalf("GetRefreshToken(%s) after rotation = %+v, %v", id, got, err)
+		}
+	}
+
+	store.SetCipher(testCipher(t, "k1"))
+	if _, _, err := store.GetRefreshToken("user1"); err == nil {
+		t.Fatal("expected an error reading a token encrypted with a key that isn't configured")
+	}
+}
+
+func TestSessionEncryption(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	// written before encryption was set up
+	legacy := storage.Session{ID: "legacy", UserID: "user1", ProviderID: "google", IDToken: "jwt", ExpiresAt: 2000}
+	if err := store.PutSession(legacy); err != nil {
+		t.Fatalf("PutSession failed: %v", err)
+	}
+
+	store.SetCipher(testCipher(t, "k1"))
+	sess := storage.Session{ID: "s1", UserID: "user1", ProviderID: "google", IDToken: "jwt", ExpiresAt: 2000}
+	if err := store.PutSession(sess); err != nil {
+		t.Fatalf("PutSession failed: %v", err)
+	}
+	if raw := rawSessionIDToken(t, store, "s1"); !strings.HasPrefix(raw, "enc:v1:k1:") {
+		t.Fatalf("expected ID token encrypted with k1, got %q", raw)
+	}
+	sess.IDToken = "refreshed"
+	if err := store.UpdateSession(sess); err != nil {
+		t.Fatalf("UpdateSession failed: %v", err)
+	}
+	if raw := rawSessionIDToken(t, store, "s1"); !strings.HasPrefix(raw, "enc:v1:k1:") {
+		t.Fatalf("expected updated ID token encrypted with k1, got %q", raw)
+	}
+	if got, found, err := store.GetSession("s1"); err != nil || !found || got.IDToken != "refreshed" {
+		t.Fatalf("GetSession = %+v, %v, %v", got, found, err)
+	}
+	sessions, err := store.ListSessions("user1")
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("ListSessions = %+v, %v", sessions, err)
+	}
+	for _, got := range sessions {
+		if got.IDToken != "jwt" && got.IDToken != "refreshed" {
+			t.Fatalf("unexpected ID token for %s: %q", got.ID, got.IDToken)
+		}
+	}
+
+	if n, err := store.ReencryptSecrets(); err != nil || n != 1 {
+		t.Fatalf("ReencryptSecrets = %d, %v; want the legacy session", n, err)
+	}
+	if raw := rawSessionIDToken(t, store, "legacy"); !strings.HasPrefix(raw, "enc:v1:k1:") {
+		t.Fatalf("expected legacy ID token encrypted with k1, got %q", raw)
+	}
+
+	store.SetCipher(testCipher(t, "k2"))
+	if _, err := store.ReencryptSecrets(); !errors.Is(err, storage.ErrUndecryptable) {
+		t.Fatalf("ReencryptSecrets = %v; want ErrUndecryptable", err)
+	}
+	if n, err := store.PurgeUndecryptableSecrets(); err != nil || n != 2 {
+		t.Fatalf("PurgeUndecryptableSecrets = %d, %v; want both sessions", n, err)
+	}
+	if _, found, err := store.GetSession("s1"); err != nil || found {
+		t.Fatalf("expected the session to be deleted, found=%v err=%v", found, err)
+	}
+}
+
+func TestReencryptSecrets_DroppedKey(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	store.SetCipher(testCipher(t, "k1"))
+	if err := store.PutRefreshToken("user1", &oauth2.Token{RefreshToken: "refresh"}); err != nil {
+		t.Fatalf("PutRefreshToken failed: %v", err)
+	}
+
+	// rotated with --keep 0, or twice without a restart in between
+	store.SetCipher(testCipher(t, "k3", "k2"))
+	if err := store.PutRefreshToken("user2", &oauth2.Token{RefreshToken: "refresh"}); err != nil {
+		t.Fatalf("PutRefreshToken failed: %v", err)
+	}
+	n, err := store.ReencryptSecrets()
+	if !errors.Is(err, storage.ErrUndecryptable) || !strings.Contains(err.Error(), "1 refresh tokens") {
+		t.Fatalf("ReencryptSecrets = %d, %v; want ErrUndecryptable counting 1 token", n, err)
+	}
+	if _, _, err := store.GetRefreshToken("user1"); err == nil {
+		t.Fatal("expected the unreadable token to be kept")
+	}
+
+	n, err = store.PurgeUndecryptableSecrets()
+	if err != nil || n != 1 {
+		t.Fatalf("PurgeUndecryptableSecrets = %d, %v; want 1", n, err)
+	}
+	if _, found, err := store.GetRefreshToken("user1"); err != nil || found {
+		t.Fatalf("expected the unreadable token to be deleted, found=%v err=%v", found, err)
+	}
+	if n, err := store.ReencryptSecrets(); err != nil || n != 0 {
+		t.Fatalf("ReencryptSecrets after purge = %d, %v", n, err)
+	}
+	if got, found, err := store.GetRefreshToken("user2"); err != nil || !found || got.RefreshToken != "refresh" {
+		t.Fatalf("GetRefreshToken(user2) = %+v, %v, %v", got, found, err)
+	}
+}
+
+// testCipher returns a cipher with a fixed key for each ID, newest first.
+func testCipher(t *testing.T, ids ...string) *storage.Cipher {
+	t.Helper()
+	keys := make([]storage.CipherKey, len(ids))
+	for i, id := range ids {
+		key := sha256.Sum256([]byte(id))
+		keys[i] = storage.CipherKey{ID: id, Key: key[:]}
+	}
+	c, err := storage.NewCipher(keys...)
+	if err != nil {
+		t.Fatalf("NewCipher failed: %v", err)
+	}
+	return c
+}
+
+// rawRefreshToken reads the refresh token for id as stored.
+func rawRefreshToken(t *testing.T, store *Store, id string) string {
+	t.Helper()
+	var token oauth2.Token
+	err := store.db.View(func(tx *bbolt.Tx) error {
+		return json.Unmarshal(tx.Bucket([]byte(rootBucket)).Bucket([]byte("refresh_tokens")).Get([]byte(id)), &token)
+	})
+	if err != nil {
+		t.Fatalf("failed to read refresh token: %v", err)
+	}
+	return token.RefreshToken
+}
+
+func TestPutHabit_SameSecond(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	ts := time.Now().Unix()
+	for _, note := range []string{"scales", "chords"} {
+		if err := store.PutHabit("testuser", habit.Habit{Name: "guitar", Note: note, TimeStamp: ts}); err != nil {
+			t.Fatalf("PutHabit failed: %v", err)
+		}
+	}
+
+	entries, err := store.GetHabit("testuser", "guitar")
+	if err != nil {
+		t.Fatalf("GetHabit failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].ID == "" || entries[0].ID == entries[1].ID {
+		t.Fatalf("expected distinct entry IDs, got %q and %q", entries[0].ID, entries[1].ID)
+	}
+}
+
+func TestUpdateHabitEntry(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	now := time.Now().Unix()
+	first := habit.Habit{ID: habit.NewID(now - 86400), Name: "guitar", Note: "scales", TimeStamp: now - 86400}
+	second := habit.Habit{ID: habit.NewID(now), Name: "guitar", Note: "chords", TimeStamp: now}
+	for _, h := range []habit.Habit{first, second} {
+		if err := store.PutHabit("testuser", h); err != nil {
+			t.Fatalf("PutHabit failed: %v", err)
+		}
+	}
+
+	// moving the first entry after the second must reorder them
+	first.Note = "arpeggios"
+	first.TimeStamp = now + 60
+	if err := store.UpdateHabitEntry("testuser", "guitar", first); err != nil {
+		t.Fatalf("UpdateHabitEntry failed: %v", err)
+	}
+
+	entries, err := store.GetHabit("testuser", "guitar")
+	if err != nil {
+		t.Fatalf("GetHabit failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[1].ID != first.ID || entries[1].Note != "arpeggios" {
+		t.Fatalf("expected updated entry last, got %+v", entries)
+	}
+
+	got, found, err := store.GetHabitEntry("testuser", "guitar", first.ID)
+	if err != nil || !found {
+		t.Fatalf("GetHabitEntry failed: found=%v err=%v", found, err)
+	}
+	if got.TimeStamp != now+60 {
+		t.Fatalf("got timestamp %d, want %d", got.TimeStamp, now+60)
+	}
+
+	missing := habit.Habit{ID: "missing", Name: "guitar", TimeStamp: now}
+	if err := store.UpdateHabitEntry("testuser", "guitar", missing); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestDeleteHabitEntry(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	h := habit.Habit{ID: habit.NewID(time.Now().Unix()), Name: "guitar", Note: "scales", TimeStamp: time.Now().Unix()}
+	if err := store.PutHabit("testuser", h); err != nil {
+		t.Fatalf("PutHabit failed: %v", err)
+	}
+
+	if err := store.DeleteHabitEntry("testuser", "guitar", h.ID); err != nil {
+		t.Fatalf("DeleteHabitEntry failed: %v", err)
+	}
+	if _, found, _ := store.GetHabitEntry("testuser", "guitar", h.ID); found {
+		t.Fatal("expected entry to be gone after delete")
+	}
+	if err := store.DeleteHabitEntry("testuser", "guitar", h.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestGetHabitRange(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	// five entries a day apart, two of them in the same second
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()
+	var want []string
+	for i := range 5 {
+		ts := base + int64(i)*86400
+		if i == 4 {
+			ts = base + 3*86400
+		}
+		h := habit.Habit{ID: habit.NewID(ts), Name: "guitar", TimeStamp: ts}
+		if err := store.PutHabit("testuser", h); err != nil {
+			t.Fatalf("PutHabit failed: %v", err)
+		}
+		want = append(want, h.ID)
+	}
+	if err := store.PutHabit("testuser", habit.Habit{Name: "guitarist", TimeStamp: base}); err != nil {
+		t.Fatalf("PutHabit failed: %v", err)
+	}
+
+	entries, next, err := store.GetHabitRange("testuser", "guitar", storage.EntryQuery{From: base + 86400, To: base + 3*86400})
+	if err != nil {
+		t.Fatalf("GetHabitRange failed: %v", err)
+	}
+	if len(entries) != 2 || entries[0].ID != want[1] || entries[1].ID != want[2] || next != "" {
+		t.Fatalf("unexpected range result: %+v next=%q", entries, next)
+	}
+
+	var paged []string
+	q := storage.EntryQuery{Limit: 2}
+	for {
+		entries, next, err := store.GetHabitRange("testuser", "guitar", q)
+		if err != nil {
+			t.Fatalf("GetHabitRange failed: %v", err)
+		}
+		if len(entries) > 2 {
+			t.Fatalf("page larger than limit: %d", len(entries))
+		}
+		for _, e := range entries {
+			paged = append(paged, e.ID)
+		}
+		if next == "" {
+			break
+		}
+		q.Cursor = next
+	}
+	if len(paged) != 5 {
+		t.Fatalf("expected 5 entries across pages, got %d: %v", len(paged), paged)
+	}
+	seen := map[string]bool{}
+	for _, id := range paged {
+		if seen[id] {
+			t.Fatalf("entry %s returned twice", id)
+		}
+		seen[id] = true
+	}
+
+	if _, _, err := store.GetHabitRange("testuser", "guitar", storage.EntryQuery{Cursor: "!!"}); !errors.Is(err, storage.ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestHabitDefinitions(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	now := time.Now().Unix()
+	if err := store.PutHabit("testuser", habit.Habit{ID: habit.NewID(now), Name: "guitar", TimeStamp: now}); err != nil {
+		t.Fatalf("PutHabit failed: %v", err)
+	}
+
+	// tracking a new habit creates a default definition
+	d, found, err := store.GetHabitDefinition("testuser", "guitar")
+	if err != nil || !found {
+		t.Fatalf("expected default definition, found=%v err=%v", found, err)
+	}
+	if d.CreatedAt != now {
+		t.Fatalf("expected created_at %d, got %d", now, d.CreatedAt)
+	}
+
+	d.DisplayName = "Guitar practice"
+	d.Archived = true
+	if err := store.PutHabitDefinition("testuser", d); err != nil {
+		t.Fatalf("PutHabitDefinition failed: %v", err)
+	}
+	// further entries don't reset the definition
+	if err := store.PutHabit("testuser", habit.Habit{ID: habit.NewID(now + 1), Name: "guitar", TimeStamp: now + 1}); err != nil {
+		t.Fatalf("PutHabit failed: %v", err)
+	}
+	got, _, err := store.GetHabitDefinition("testuser", "guitar")
+	if err != nil {
+		t.Fatalf("GetHabitDefinition failed: %v", err)
+	}
+	if got != d {
+		t.Fatalf("got %+v, want %+v", got, d)
+	}
+
+	if err := store.DeleteHabit("testuser", "guitar"); err != nil {
+		t.Fatalf("DeleteHabit failed: %v", err)
+	}
+	if _, found, _ := store.GetHabitDefinition("testuser", "guitar"); found {
+		t.Fatal("expected definition to be removed with the habit")
+	}
+	if err := store.DeleteHabitDefinition("testuser", "guitar"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestUserSettings(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	settings, err := store.GetUserSettings("testuser")
+	if err != nil {
+		t.Fatalf("GetUserSettings failed: %v", err)
+	}
+	if settings.Timezone != "" {
+		t.Fatalf("expected empty settings, got %+v", settings)
+	}
+
+	if err := store.PutUserSettings("testuser", habit.UserSettings{Timezone: "Europe/Dublin"}); err != nil {
+		t.Fatalf("PutUserSettings failed: %v", err)
+	}
+	settings, err = store.GetUserSettings("testuser")
+	if err != nil {
+		t.Fatalf("GetUserSettings failed: %v", err)
+	}
+	if settings.Timezone != "Europe/Dublin" {
+		t.Fatalf("got timezone %q, want Europe/Dublin", settings.Timezone)
+	}
+
+	// settings live beside the habits bucket without upsetting listing
+	names, err := store.ListHabitNames("testuser")
+	if err != nil || len(names) != 0 {
+		t.Fatalf("expected no habits, got %v (err %v)", names, err)
+	}
+}
+
+func TestPutHabits(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	now := time.Now().Unix()
+	batch := []habit.Habit{
+		{Name: "guitar", Note: "scales", TimeStamp: now - 60},
+		{Name: "guitar", Note: "chords", TimeStamp: now},
+		{Name: "reading", TimeStamp: now, Value: 20, Unit: "pages"},
+	}
+	// writing the same batch twice upserts by the IDs assigned the first time
+	for range 2 {
+		if err := store.PutHabits("testuser", batch); err != nil {
+			t.Fatalf("PutHabits failed: %v", err)
+		}
+	}
+	for _, e := range batch {
+		if e.ID == "" {
+			t.Fatalf("expected IDs to be assigned, got %+v", e)
+		}
+	}
+
+	names, err := store.ListHabitNames("testuser")
+	if err != nil {
+		t.Fatalf("ListHabitNames failed: %v", err)
+	}
+	if len(names) != 2 {
+		t.Fatalf("expected 2 habits, got %v", names)
+	}
+	entries, err := store.GetHabit("testuser", "guitar")
+	if err != nil {
+		t.Fatalf("GetHabit failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+}
+
+func TestImportHabits_MovedTimestamp(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	now := time.Now().Unix()
+	e := habit.Habit{Name: "guitar", Note: "scales", TimeStamp: now - 60}
+	if err := store.PutHabit("testuser", e); err != nil {
+		t.Fatalf("PutHabit failed: %v", err)
+	}
+	entries, _ := store.GetHabit("testuser", "guitar")
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+
+	// re-importing the entry with another timestamp replaces it
+	e = entries[0]
+	e.TimeStamp = now
+	if err := store.ImportHabits("testuser", []habit.Habit{e}); err != nil {
+		t.Fatalf("ImportHabits failed: %v", err)
+	}
+	entries, err := store.GetHabit("testuser", "guitar")
+	if err != nil {
+		t.Fatalf("GetHabit failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].TimeStamp != now {
+		t.Fatalf("expected the entry to move to %d, got %+v", now, entries)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	sessions := []storage.Session{
+		{ID: "s1", UserID: "user1", ProviderID: "google", IDToken: "tok1", CreatedAt: 100, LastSeenAt: 100, ExpiresAt: 1000, UserAgent: "firefox", IPAddress: "10.0.0.1"},
+		{ID: "s2", UserID: "user1", ProviderID: "google", IDToken: "tok2", CreatedAt: 100, LastSeenAt: 100, ExpiresAt: 200},
+		{ID: "s3", UserID: "user2", ProviderID: "google", IDToken: "tok3", CreatedAt: 100, LastSeenAt: 100, ExpiresAt: 1000},
+	}
+	for _, sess := range sessions {
+		if err := store.PutSession(sess); err != nil {
+			t.Fatalf("PutSession failed: %v", err)
+		}
+	}
+
+	got, found, err := store.GetSession("s1")
+	if err != nil || !found {
+		t.Fatalf("GetSession failed: found=%v err=%v", found, err)
+	}
+	if !reflect.DeepEqual(got, sessions[0]) {
+		t.Fatalf("got %+v want %+v", got, sessions[0])
+	}
+
+	updated := got
+	updated.IDToken, updated.LastSeenAt, updated.ExpiresAt = "tok1b", 150, 2000
+	if err := store.UpdateSession(updated); err != nil {
+		t.Fatalf("UpdateSession failed: %v", err)
+	}
+	if got, _, _ := store.GetSession("s1"); !reflect.DeepEqual(got, updated) {
+		t.Fatalf("got %+v want %+v", got, updated)
+	}
+	if err := store.UpdateSession(storage.Session{ID: "gone", UserID: "user1"}); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound updating a missing session", err)
+	}
+
+	list, err := store.ListSessions("user1")
+	if err != nil || len(list) != 2 {
+		t.Fatalf("expected 2 sessions for user1, got %d (err %v)", len(list), err)
+	}
+
+	if err := store.DeleteExpiredSessions(500); err != nil {
+		t.Fatalf("DeleteExpiredSessions failed: %v", err)
+	}
+	if _, found, _ := store.GetSession("s2"); found {
+		t.Fatal("expected expired session to be deleted")
+	}
+
+	if err := store.DeleteSession("s1"); err != nil {
+		t.Fatalf("DeleteSession failed: %v", err)
+	}
+	if _, found, _ := store.GetSession("s1"); found {
+		t.Fatal("expected session to be deleted")
+	}
+
+	if err := store.DeleteUserSessions("user2"); err != nil {
+		t.Fatalf("DeleteUserSessions failed: %v", err)
+	}
+	if list, _ := store.ListSessions("user2"); len(list) != 0 {
+		t.Fatalf("expected no sessions for user2, got %v", list)
+	}
+}
+
+func TestIdempotencyRecords(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	claim := storage.IdempotencyRecord{Key: "k1", UserID: "user1", Fingerprint: "f1", ExpiresAt: 160}
+	if _, claimed, err := store.ClaimIdempotencyKey(claim, 100); err != nil || !claimed {
+		t.Fatalf("expected to claim k1, claimed=%v err=%v", claimed, err)
+	}
+	prev, claimed, err := store.ClaimIdempotencyKey(claim, 110)
+	if err != nil || claimed {
+		t.Fatalf("expected k1 to be taken, claimed=%v err=%v", claimed, err)
+	}
+	if prev.Done || prev.Fingerprint != "f1" {
+		t.Fatalf("got %+v, want the pending claim", prev)
+	}
+
+	done := claim
+	done.Done, done.Status, done.ContentType, done.Body, done.ExpiresAt = true, 201, "application/json", []byte(`{"ok":true}`), 1000
+	if err := store.PutIdempotencyRecord(done); err != nil {
+		t.Fatalf("PutIdempotencyRecord failed: %v", err)
+	}
+	if prev, _, _ := store.ClaimIdempotencyKey(claim, 200); !reflect.DeepEqual(prev, done) {
+		t.Fatalf("got %+v want %+v", prev, done)
+	}
+
+	if _, claimed, _ := store.ClaimIdempotencyKey(storage.IdempotencyRecord{Key: "k2", UserID: "user1", ExpiresAt: 300}, 200); !claimed {
+		t.Fatal("expected to claim k2")
+	}
+	if _, claimed, _ := store.ClaimIdempotencyKey(storage.IdempotencyRecord{Key: "k3", UserID: "user2", ExpiresAt: 1000}, 200); !claimed {
+		t.Fatal("expected to claim k3")
+	}
+	if n, err := store.CountIdempotencyRecords("user1", 200); err != nil || n != 2 {
+		t.Fatalf("expected 2 records for user1, got %d (err %v)", n, err)
+	}
+	if n, _ := store.CountIdempotencyRecords("user1", 400); n != 1 {
+		t.Fatalf("expected expired records not to count, got %d", n)
+	}
+
+	// An expired claim can be taken again.
+	if _, claimed, _ := store.ClaimIdempotencyKey(storage.IdempotencyRecord{Key: "k2", UserID: "user1", ExpiresAt: 500}, 400); !claimed {
+		t.Fatal("expected to reclaim expired k2")
+	}
+
+	if err := store.DeleteIdempotencyRecord("k2"); err != nil {
+		t.Fatalf("DeleteIdempotencyRecord failed: %v", err)
+	}
+	if err := store.DeleteExpiredIdempotencyRecords(2000); err != nil {
+		t.Fatalf("DeleteExpiredIdempotencyRecords failed: %v", err)
+	}
+	if n, _ := store.CountIdempotencyRecords("user1", 0); n != 0 {
+		t.Fatalf("expected no records for user1, got %d", n)
+	}
+	if n, _ := store.CountIdempotencyRecords("user2", 0); n != 0 {
+		t.Fatalf("expected no records for user2, got %d", n)
+	}
+}
+
+func TestDeviceAuthorizations(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	a := storage.DeviceAuthorization{DeviceCode: "dev1", UserCode: "BCDFGHJK", ExpiresAt: 1000}
+	if created, err := store.CreateDeviceAuthorization(a); err != nil || !created {
+		t.Fatalf("expected to create dev1, created=%v err=%v", created, err)
+	}
+	if created, _ := store.CreateDeviceAuthorization(storage.DeviceAuthorization{DeviceCode: "dev2", UserCode: a.UserCode, ExpiresAt: 1000}); created {
+		t.Fatal("expected a taken user code to be refused")
+	}
+
+	got, found, err := store.PollDeviceAuthorization("dev1", 100)
+	if err != nil || !found || got.UserCode != a.UserCode || got.ExpiresAt != a.ExpiresAt || got.UserID != "" {
+		t.Fatalf("got %+v found=%v err=%v, want %+v", got, found, err, a)
+	}
+	if got, _, _ := store.PollDeviceAuthorization("dev1", 103); got.LastPollAt != 100 {
+		t.Fatalf("got last poll %d, want 100", got.LastPollAt)
+	}
+
+	if decided, _ := store.DecideDeviceAuthorization(a.UserCode, "user1", storage.Scopes, true, 2000); decided {
+		t.Fatal("expected an expired authorization not to be decided")
+	}
+	if decided, err := store.DecideDeviceAuthorization(a.UserCode, "user1", storage.Scopes, true, 200); err != nil || !decided {
+		t.Fatalf("expected to approve dev1, decided=%v err=%v", decided, err)
+	}
+	if decided, _ := store.DecideDeviceAuthorization(a.UserCode, "user2", nil, false, 200); decided {
+		t.Fatal("expected a decided authorization not to be decided again")
+	}
+
+	got, found, _ = store.PollDeviceAuthorization("dev1", 300)
+	if !found || got.UserID != "user1" || !reflect.DeepEqual(got.Scopes, storage.Scopes) {
+		t.Fatalf("got %+v found=%v, want approval by user1", got, found)
+	}
+	if _, found, _ := store.PollDeviceAuthorization("dev1", 300); found {
+		t.Fatal("expected a redeemed authorization to be deleted")
+	}
+
+	if created, _ := store.CreateDeviceAuthorization(storage.DeviceAuthorization{DeviceCode: "dev3", UserCode: "LMNPQRST", ExpiresAt: 500}); !created {
+		t.Fatal("expected to create dev3")
+	}
+	if err := store.DeleteExpiredDeviceAuthorizations(500); err != nil {
+		t.Fatalf("DeleteExpiredDeviceAuthorizations failed: %v", err)
+	}
+	if _, found, _ := store.PollDeviceAuthorization("dev3", 0); found {
+		t.Fatal("expected expired authorization to be deleted")
+	}
+}
+
+func TestLocalUsers(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	if _, found, err := store.GetLocalUser("alice"); err != nil || found {
+		t.Fatalf("expected no user before put, found=%v err=%v", found, err)
+	}
+
+	alice := storage.LocalUser{Username: "alice", UserID: "user-a", PasswordHash: "hash1", CreatedAt: 100}
+	bob := storage.LocalUser{Username: "bob", UserID: "user-b", PasswordHash: "hash2", CreatedAt: 200}
+	for _, u := range []storage.LocalUser{alice, bob} {
+		if err := store.PutLocalUser(u); err != nil {
+			t.Fatalf("PutLocalUser failed: %v", err)
+		}
+	}
+
+	alice.PasswordHash = "hash3"
+	if err := store.PutLocalUser(alice); err != nil {
+		t.Fatalf("PutLocalUser failed: %v", err)
+	}
+	got, found, err := store.GetLocalUser("alice")
+	if err != nil || !found || !reflect.DeepEqual(got, alice) {
+		t.Fatalf("got %+v (found=%v, err=%v), want %+v", got, found, err, alice)
+	}
+
+	users, err := store.ListLocalUsers()
+	if err != nil || len(users) != 2 {
+		t.Fatalf("expected 2 users, got %v (err %v)", users, err)
+	}
+
+	if err := store.DeleteLocalUser("alice"); err != nil {
+		t.Fatalf("DeleteLocalUser failed: %v", err)
+	}
+	if _, found, _ := store.GetLocalUser("alice"); found {
+		t.Fatal("expected user to be deleted")
+	}
+
+	// local users live beside user buckets without showing up as habits
+	names, err := store.ListHabitNames("alice")
+	if err != nil || len(names) != 0 {
+		t.Fatalf("expected no habits, got %v (err %v)", names, err)
+	}
+}
+
+func TestAccounts(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	if _, found, err := store.GetAccount("user1"); err != nil || found {
+		t.Fatalf("expected no account before put, found=%v err=%v", found, err)
+	}
+	a := storage.Account{UserID: "user1", Email: "a@example.com", Name: "A", Admin: true, CreatedAt: 100, LastLoginAt: 200}
+	if err := store.PutAccount(a); err != nil {
+		t.Fatalf("PutAccount failed: %v", err)
+	}
+	a.Disabled = true
+	if err := store.PutAccount(a); err != nil {
+		t.Fatalf("PutAccount failed: %v", err)
+	}
+	got, found, err := store.GetAccount("user1")
+	if err != nil || !found || !reflect.DeepEqual(got, a) {
+		t.Fatalf("got %+v (found=%v, err=%v), want %+v", got, found, err, a)
+	}
+	if accounts, err := store.ListAccounts(); err != nil || len(accounts) != 1 {
+		t.Fatalf("expected 1 account, got %v (err %v)", accounts, err)
+	}
+}
+
+func TestIdentities(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	if _, found, err := store.GetIdentity("user-b"); err != nil || found {
+		t.Fatalf("expected no identity before put, found=%v err=%v", found, err)
+	}
+	a := storage.Identity{ID: "user-a", UserID: "user-a", ProviderID: "google", Issuer: "https://accounts.google.com", Subject: "1", CreatedAt: 100}
+	b := storage.Identity{ID: "user-b", UserID: "user-a", ProviderID: "github", Issuer: "https://github.com", Subject: "2", Email: "a@example.com", CreatedAt: 200, LastLoginAt: 300}
+	for _, id := range []storage.Identity{b, a} {
+		if err := store.PutIdentity(id); err != nil {
+			t.Fatalf("PutIdentity failed: %v", err)
+		}
+	}
+	got, found, err := store.GetIdentity("user-b")
+	if err != nil || !found || !reflect.DeepEqual(got, b) {
+		t.Fatalf("got %+v (found=%v, err=%v), want %+v", got, found, err, b)
+	}
+	if ids, err := store.ListIdentities("user-a"); err != nil || !reflect.DeepEqual(ids, []storage.Identity{a, b}) {
+		t.Fatalf("got %+v (err %v), want oldest first", ids, err)
+	}
+	if err := store.DeleteIdentity("user-b"); err != nil {
+		t.Fatalf("DeleteIdentity failed: %v", err)
+	}
+	if ids, _ := store.ListIdentities("user-a"); len(ids) != 1 {
+		t.Fatalf("expected 1 identity after delete, got %+v", ids)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	for _, userID := range []string{"user1", "user2"} {
+		if err := store.PutHabits(userID, []habit.Habit{
+			{Name: "guitar", TimeStamp: 100},
+			{Name: "guitar", TimeStamp: 300},
+			{Name: "run", TimeStamp: 200},
+		}); err != nil {
+			t.Fatalf("PutHabits failed: %v", err)
+		}
+		if err := store.PutUserSettings(userID, habit.UserSettings{Timezone: "UTC"}); err != nil {
+			t.Fatalf("PutUserSettings failed: %v", err)
+		}
+		if err := store.PutAPIKey(storage.APIKey{Hash: "key-" + userID, UserID: userID}); err != nil {
+			t.Fatalf("PutAPIKey failed: %v", err)
+		}
+		if err := store.PutSession(storage.Session{ID: "sess-" + userID, UserID: userID, ExpiresAt: 1000}); err != nil {
+			t.Fatalf("PutSession failed: %v", err)
+		}
+		if err := store.PutLocalUser(storage.LocalUser{Username: "name-" + userID, UserID: userID}); err != nil {
+			t.Fatalf("PutLocalUser failed: %v", err)
+		}
+		if err := store.PutRefreshToken(userID, &oauth2.Token{RefreshToken: "refresh"}); err != nil {
+			t.Fatalf("PutRefreshToken failed: %v", err)
+		}
+		if err := store.PutAccount(storage.Account{UserID: userID}); err != nil {
+			t.Fatalf("PutAccount failed: %v", err)
+		}
+		// a linked login, with its refresh token stored under its own ID
+		if err := store.PutIdentity(storage.Identity{ID: "ident-" + userID, UserID: userID}); err != nil {
+			t.Fatalf("PutIdentity failed: %v", err)
+		}
+		if err := store.PutRefreshToken("ident-"+userID, &oauth2.Token{RefreshToken: "refresh"}); err != nil {
+			t.Fatalf("PutRefreshToken failed: %v", err)
+		}
+	}
+
+	stats, err := store.ListUserStats()
+	if err != nil {
+		t.Fatalf("ListUserStats failed: %v", err)
+	}
+	want := []storage.UserStats{
+		{UserID: "user1", HabitCount: 2, EntryCount: 3, LastEntryAt: 300},
+		{UserID: "user2", HabitCount: 2, EntryCount: 3, LastEntryAt: 300},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Fatalf("got stats %+v want %+v", stats, want)
+	}
+
+	if err := store.DeleteUser("user1"); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+
+	check := func(userID string, want bool) {
+		t.Helper()
+		names, _ := store.ListHabitNames(userID)
+		settings, _ := store.GetUserSettings(userID)
+		_, keyFound, _ := store.GetAPIKey("key-" + userID)
+		_, sessFound, _ := store.GetSession("sess-" + userID)
+		_, localFound, _ := store.GetLocalUser("name-" + userID)
+		_, tokenFound, _ := store.GetRefreshToken(userID)
+		_, accountFound, _ := store.GetAccount(userID)
+		_, identityFound, _ := store.GetIdentity("ident-" + userID)
+		_, identityTokenFound, _ := store.GetRefreshToken("ident-" + userID)
+		got := []bool{len(names) > 0, settings.Timezone != "", keyFound, sessFound, localFound, tokenFound, accountFound,
+			identityFound, identityTokenFound}
+		for i, g := range got {
+			if g != want {
+				t.Errorf("%s: record %d present=%v, want %v", userID, i, g, want)
+			}
+		}
+	}
+	check("user1", false)
+	check("user2", true)
+
+	if stats, _ := store.ListUserStats(); len(stats) != 1 || stats[0].UserID != "user2" {
+		t.Fatalf("expected only user2 in stats, got %+v", stats)
+	}
+}
+
+func TestMergeUser(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	if err := store.PutHabits("to", []habit.Habit{{Name: "guitar", TimeStamp: 100}}); err != nil {
+		t.Fatalf("PutHabits failed: %v", err)
+	}
+	if err := store.PutHabitDefinition("to", habit.HabitDefinition{Name: "guitar", DisplayName: "Guitar", CreatedAt: 100}); err != nil {
+		t.Fatalf("PutHabitDefinition failed: %v", err)
+	}
+	if err := store.PutAccount(storage.Account{UserID: "to"}); err != nil {
+		t.Fatalf("PutAccount failed: %v", err)
+	}
+	if err := store.PutHabits("from", []habit.Habit{{Name: "guitar", TimeStamp: 200}, {Name: "run", TimeStamp: 300}}); err != nil {
+		t.Fatalf("PutHabits failed: %v", err)
+	}
+	if err := store.PutUserSettings("from", habit.UserSettings{Timezone: "Europe/Dublin"}); err != nil {
+		t.Fatalf("PutUserSettings failed: %v", err)
+	}
+	if err := store.PutAPIKey(storage.APIKey{Hash: "key-from", UserID: "from"}); err != nil {
+		t.Fatalf("PutAPIKey failed: %v", err)
+	}
+	if err := store.PutSession(storage.Session{ID: "sess-from", UserID: "from", ExpiresAt: 1000}); err != nil {
+		t.Fatalf("PutSession failed: %v", err)
+	}
+	if err := store.PutIdentity(storage.Identity{ID: "from", UserID: "from"}); err != nil {
+		t.Fatalf("PutIdentity failed: %v", err)
+	}
+	if err := store.PutAccount(storage.Account{UserID: "from"}); err != nil {
+		t.Fatalf("PutAccount failed: %v", err)
+	}
+
+	if err := store.MergeUser("from", "to"); err != nil {
+		t.Fatalf("MergeUser failed: %v", err)
+	}
+
+	if entries, _ := store.GetHabit("to", "guitar"); len(entries) != 2 {
+		t.Fatalf("expected 2 guitar entries, got %+v", entries)
+	}
+	if entries, _ := store.GetHabit("to", "run"); len(entries) != 1 {
+		t.Fatalf("expected 1 run entry, got %+v", entries)
+	}
+	if def, _, _ := store.GetHabitDefinition("to", "guitar"); def.DisplayName != "Guitar" {
+		t.Fatalf("expected the target's definition to be kept, got %+v", def)
+	}
+	if settings, _ := store.GetUserSettings("to"); settings.Timezone != "Europe/Dublin" {
+		t.Fatalf("expected settings to move, got %+v", settings)
+	}
+	if key, _, _ := store.GetAPIKey("key-from"); key.UserID != "to" {
+		t.Fatalf("expected the API key to move, got %+v", key)
+	}
+	if sess, _, _ := store.GetSession("sess-from"); sess.UserID != "to" {
+		t.Fatalf("expected the session to move, got %+v", sess)
+	}
+	if ids, _ := store.ListIdentities("to"); len(ids) != 1 || ids[0].ID != "from" {
+		t.Fatalf("expected the identity to move, got %+v", ids)
+	}
+	if _, found, _ := store.GetAccount("from"); found {
+		t.Fatal("expected the merged account to be gone")
+	}
+	if names, _ := store.ListHabitNames("from"); len(names) != 0 {
+		t.Fatalf("expected no habits left, got %v", names)
+	}
+	if stats, _ := store.ListUserStats(); len(stats) != 1 || stats[0].UserID != "to" || stats[0].EntryCount != 3 {
+		t.Fatalf("expected only the target in stats, got %+v", stats)
+	}
+}
+
+func TestMergeUser_SharedEntryID(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	// an export imported into both accounts gives them the same entry IDs
+	id := habit.NewID(100)
+	if err := store.PutHabits("to", []habit.Habit{{ID: id, Name: "guitar", Note: "to", TimeStamp: 100}}); err != nil {
+		t.Fatalf("PutHabits failed: %v", err)
+	}
+	if err := store.PutHabits("from", []habit.Habit{{ID: id, Name: "guitar", Note: "from", TimeStamp: 150}, {Name: "run", TimeStamp: 300}}); err != nil {
+		t.Fatalf("PutHabits failed: %v", err)
+	}
+
+	if err := store.MergeUser("from", "to"); err != nil {
+		t.Fatalf("MergeUser failed: %v", err)
+	}
+
+	if entries, _ := store.GetHabit("to", "guitar"); len(entries) != 1 || entries[0].Note != "to" {
+		t.Fatalf("expected the target's guitar entry to be kept, got %+v", entries)
+	}
+	if entries, _ := store.GetHabit("to", "run"); len(entries) != 1 {
+		t.Fatalf("expected 1 run entry, got %+v", entries)
+	}
+	if names, _ := store.ListHabitNames("from"); len(names) != 0 {
+		t.Fatalf("expected no habits left, got %v", names)
+	}
+}
+
+// rawSessionIDToken reads a session's ID token as stored.
+func rawSessionIDToken(t *testing.T, store *Store, id string) string {
+	t.Helper()
+	var sess storage.Session
+	err := store.db.View(func(tx *bbolt.Tx) error {
+		bucket, err := getSessionsBucket(tx)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(bucket.Get([]byte(id)), &sess)
+	})
+	if err != nil {
+		t.Fatalf("failed to read session: %v", err)
+	}
+	return sess.IDToken
+}
@@ -0,0 +1,130 @@
+package bolt
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/brk3/habits/internal/storage"
+	"github.com/brk3/habits/pkg/habit"
+	"go.etcd.io/bbolt"
+)
+
+func (s *Store) getUserDefinitionsBucket(tx *bbolt.Tx, userID string) (*bbolt.Bucket, error) {
+	usersBucket := tx.Bucket([]byte(rootBucket))
+	if usersBucket == nil {
+		return nil, fmt.Errorf("root bucket does not exist")
+	}
+
+	userBucket := usersBucket.Bucket([]byte(userID))
+	if userBucket == nil {
+		return nil, fmt.Errorf("user bucket for %s does not exist", userID)
+	}
+
+	defsBucket := userBucket.Bucket([]byte("definitions"))
+	if defsBucket == nil {
+		return nil, fmt.Errorf("definitions bucket for %s does not exist", userID)
+	}
+	return defsBucket, nil
+}
+
+// ensureHabitDefinition gives a habit that is being tracked for the first
+// time a default definition, so it shows up in ListHabitNames.
+func (s *Store) ensureHabitDefinition(tx *bbolt.Tx, userID, name string, createdAt int64) error {
+	bucket, err := s.getUserDefinitionsBucket(tx, userID)
+	if err != nil {
+		return err
+	}
+	if bucket.Get([]byte(name)) != nil {
+		return nil
+	}
+	val, err := json.Marshal(habit.HabitDefinition{Name: name, CreatedAt: createdAt})
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(name), val)
+}
+
+func (s *Store) PutHabitDefinition(userID string, d habit.HabitDefinition) error {
+	if err := s.ensureUserHabitsBucketExists(userID); err != nil {
+		return fmt.Errorf("failed to ensure bucket exists for user %s: %w", userID, err)
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := s.getUserDefinitionsBucket(tx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to get user definitions bucket: %w", err)
+		}
+		val, err := json.Marshal(d)
+		if err != nil {
+			return fmt.Errorf("failed to marshal definition %s: %w", d.Name, err)
+		}
+		if err := bucket.Put([]byte(d.Name), val); err != nil {
+			return fmt.Errorf("failed to store definition %s: %w", d.Name, err)
+		}
+		return nil
+	})
+}
+
+func (s *Store) GetHabitDefinition(userID, name string) (habit.HabitDefinition, bool, error) {
+	if err := s.ensureUserHabitsBucketExists(userID); err != nil {
+		return habit.HabitDefinition{}, false, fmt.Errorf("failed to ensure bucket exists for user %s: %w", userID, err)
+	}
+	var d habit.HabitDefinition
+	var found bool
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		bucket, err := s.getUserDefinitionsBucket(tx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to get user definitions bucket: %w", err)
+		}
+		val := bucket.Get([]byte(name))
+		if val == nil {
+			return nil
+		}
+		if err := json.Unmarshal(val, &d); err != nil {
+			return fmt.Errorf("failed to unmarshal definition %s: %w", name, err)
+		}
+		found = true
+		return nil
+	})
+	return d, found, err
+}
+
+func (s *Store) ListHabitDefinitions(userID string) ([]habit.HabitDefinition, error) {
+	if err := s.ensureUserHabitsBucketExists(userID); err != nil {
+		return nil, fmt.Errorf("failed to ensure bucket exists for user %s: %w", userID, err)
+	}
+	out := []habit.HabitDefinition{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		bucket, err := s.getUserDefinitionsBucket(tx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to get user definitions bucket: %w", err)
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var d habit.HabitDefinition
+			if err := json.Unmarshal(v, &d); err != nil {
+				return fmt.Errorf("failed to unmarshal definition %s: %w", k, err)
+			}
+			out = append(out, d)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list definitions for user %s: %w", userID, err)
+	}
+	return out, nil
+}
+
+func (s *Store) DeleteHabitDefinition(userID, name string) error {
+	if err := s.ensureUserHabitsBucketExists(userID); err != nil {
+		return fmt.Errorf("failed to ensure bucket exists for user %s: %w", userID, err)
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := s.getUserDefinitionsBucket(tx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to get user definitions bucket: %w", err)
+		}
+		if bucket.Get([]byte(name)) == nil {
+			return storage.ErrNotFound
+		}
+		return bucket.Delete([]byte(name))
+	})
+}
@@ -0,0 +1,163 @@
+package bolt
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/brk3/habits/internal/storage"
+	"go.etcd.io/bbolt"
+)
+
+// devicesBucket sits in the root bucket next to api_keys, holding device
+// authorizations as JSON by device code.
+const devicesBucket = "devices"
+
+func getDevicesBucket(tx *bbolt.Tx) (*bbolt.Bucket, error) {
+	bucket := tx.Bucket([]byte(rootBucket)).Bucket([]byte(devicesBucket))
+	if bucket == nil {
+		return nil, fmt.Errorf("devices bucket not found")
+	}
+	return bucket, nil
+}
+
+func putDeviceAuthorization(bucket *bbolt.Bucket, a storage.DeviceAuthorization) error {
+	val, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("failed to marshal device authorization: %w", err)
+	}
+	return bucket.Put([]byte(a.DeviceCode), val)
+}
+
+// findDeviceAuthorization returns the first stored authorization that
+// match accepts.
+func findDeviceAuthorization(bucket *bbolt.Bucket, match func(a storage.DeviceAuthorization) bool) (storage.DeviceAuthorization, bool, error) {
+	var found *storage.DeviceAuthorization
+	err := bucket.ForEach(func(k, v []byte) error {
+		if found != nil {
+			return nil
+		}
+		var a storage.DeviceAuthorization
+		if err := json.Unmarshal(v, &a); err != nil {
+			return fmt.Errorf("failed to unmarshal device authorization: %w", err)
+		}
+		if match(a) {
+			found = &a
+		}
+		return nil
+	})
+	if err != nil || found == nil {
+		return storage.DeviceAuthorization{}, false, err
+	}
+	return *found, true, nil
+}
+
+func (s *Store) CreateDeviceAuthorization(a storage.DeviceAuthorization) (bool, error) {
+	var created bool
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := getDevicesBucket(tx)
+		if err != nil {
+			return err
+		}
+		_, taken, err := findDeviceAuthorization(bucket, func(b storage.DeviceAuthorization) bool {
+			return b.UserCode == a.UserCode || b.DeviceCode == a.DeviceCode
+		})
+		if err != nil || taken {
+			return err
+		}
+		created = true
+		return putDeviceAuthorization(bucket, a)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to create device authorization: %w", err)
+	}
+	return created, nil
+}
+
+func (s *Store) DecideDeviceAuthorization(userCode, userID string, scopes []string, approve bool, now int64) (bool, error) {
+	var decided bool
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := getDevicesBucket(tx)
+		if err != nil {
+			return err
+		}
+		a, found, err := findDeviceAuthorization(bucket, func(a storage.DeviceAuthorization) bool {
+			return a.UserCode == userCode
+		})
+		if err != nil || !found || a.ExpiresAt <= now || a.UserID != "" || a.Denied {
+			return err
+		}
+		if approve {
+			a.UserID, a.Scopes = userID, scopes
+		} else {
+			a.Denied = true
+		}
+		decided = true
+		return putDeviceAuthorization(bucket, a)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to decide device authorization: %w", err)
+	}
+	return decided, nil
+}
+
+func (s *Store) PollDeviceAuthorization(deviceCode string, now int64) (storage.DeviceAuthorization, bool, error) {
+	var a storage.DeviceAuthorization
+	var found bool
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := getDevicesBucket(tx)
+		if err != nil {
+			return err
+		}
+		val := bucket.Get([]byte(deviceCode))
+		if val == nil {
+			return nil
+		}
+		if err := json.Unmarshal(val, &a); err != nil {
+			return fmt.Errorf("failed to unmarshal device authorization: %w", err)
+		}
+		found = true
+		switch {
+		case a.ExpiresAt <= now:
+			return nil
+		case a.UserID != "" || a.Denied:
+			return bucket.Delete([]byte(deviceCode))
+		}
+		polled := a
+		polled.LastPollAt = now
+		return putDeviceAuthorization(bucket, polled)
+	})
+	if err != nil {
+		return storage.DeviceAuthorization{}, false, fmt.Errorf("failed to poll device authorization: %w", err)
+	}
+	return a, found, nil
+}
+
+func (s *Store) DeleteExpiredDeviceAuthorizations(now int64) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := getDevicesBucket(tx)
+		if err != nil {
+			return err
+		}
+		// deleting while iterating skips keys, so collect them first
+		var codes []string
+		err = bucket.ForEach(func(k, v []byte) error {
+			var a storage.DeviceAuthorization
+			if err := json.Unmarshal(v, &a); err != nil {
+				return fmt.Errorf("failed to unmarshal device authorization: %w", err)
+			}
+			if a.ExpiresAt <= now {
+				codes = append(codes, a.DeviceCode)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, code := range codes {
+			if err := bucket.Delete([]byte(code)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,132 @@
+package bolt
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/brk3/habits/internal/storage"
+	"go.etcd.io/bbolt"
+)
+
+// idempotencyBucket sits in the root bucket next to api_keys, holding
+// idempotency records as JSON by key.
+const idempotencyBucket = "idempotency"
+
+func getIdempotencyBucket(tx *bbolt.Tx) (*bbolt.Bucket, error) {
+	bucket := tx.Bucket([]byte(rootBucket)).Bucket([]byte(idempotencyBucket))
+	if bucket == nil {
+		return nil, fmt.Errorf("idempotency bucket not found")
+	}
+	return bucket, nil
+}
+
+func putIdempotencyRecord(bucket *bbolt.Bucket, rec storage.IdempotencyRecord) error {
+	val, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal idempotency record: %w", err)
+	}
+	return bucket.Put([]byte(rec.Key), val)
+}
+
+// forEachIdempotencyRecord calls fn with every stored record.
+func forEachIdempotencyRecord(bucket *bbolt.Bucket, fn func(rec storage.IdempotencyRecord) error) error {
+	return bucket.ForEach(func(k, v []byte) error {
+		var rec storage.IdempotencyRecord
+		if err := json.Unmarshal(v, &rec); err != nil {
+			return fmt.Errorf("failed to unmarshal idempotency record: %w", err)
+		}
+		return fn(rec)
+	})
+}
+
+func (s *Store) ClaimIdempotencyKey(rec storage.IdempotencyRecord, now int64) (storage.IdempotencyRecord, bool, error) {
+	var prev storage.IdempotencyRecord
+	var claimed bool
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := getIdempotencyBucket(tx)
+		if err != nil {
+			return err
+		}
+		if val := bucket.Get([]byte(rec.Key)); val != nil {
+			if err := json.Unmarshal(val, &prev); err != nil {
+				return fmt.Errorf("failed to unmarshal idempotency record: %w", err)
+			}
+			if prev.ExpiresAt > now {
+				return nil
+			}
+			prev = storage.IdempotencyRecord{}
+		}
+		claimed = true
+		return putIdempotencyRecord(bucket, rec)
+	})
+	if err != nil {
+		return storage.IdempotencyRecord{}, false, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+	return prev, claimed, nil
+}
+
+func (s *Store) PutIdempotencyRecord(rec storage.IdempotencyRecord) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := getIdempotencyBucket(tx)
+		if err != nil {
+			return err
+		}
+		return putIdempotencyRecord(bucket, rec)
+	})
+}
+
+func (s *Store) DeleteIdempotencyRecord(key string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := getIdempotencyBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bucket.Delete([]byte(key))
+	})
+}
+
+func (s *Store) CountIdempotencyRecords(userID string, now int64) (int, error) {
+	var n int
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		bucket, err := getIdempotencyBucket(tx)
+		if err != nil {
+			return err
+		}
+		return forEachIdempotencyRecord(bucket, func(rec storage.IdempotencyRecord) error {
+			if rec.UserID == userID && rec.ExpiresAt > now {
+				n++
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count idempotency records for user %s: %w", userID, err)
+	}
+	return n, nil
+}
+
+func (s *Store) DeleteExpiredIdempotencyRecords(now int64) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := getIdempotencyBucket(tx)
+		if err != nil {
+			return err
+		}
+		// deleting while iterating skips keys, so collect them first
+		var keys []string
+		err = forEachIdempotencyRecord(bucket, func(rec storage.IdempotencyRecord) error {
+			if rec.ExpiresAt <= now {
+				keys = append(keys, rec.Key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := bucket.Delete([]byte(k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
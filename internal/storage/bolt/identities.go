@@ -0,0 +1,96 @@
+package bolt
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/brk3/habits/internal/storage"
+	"go.etcd.io/bbolt"
+)
+
+// identitiesBucket sits in the root bucket next to api_keys, holding linked
+// logins as JSON by identity ID.
+const identitiesBucket = "identities"
+
+func getIdentitiesBucket(tx *bbolt.Tx) (*bbolt.Bucket, error) {
+	bucket := tx.Bucket([]byte(rootBucket)).Bucket([]byte(identitiesBucket))
+	if bucket == nil {
+		return nil, fmt.Errorf("identities bucket not found")
+	}
+	return bucket, nil
+}
+
+func (s *Store) PutIdentity(id storage.Identity) error {
+	val, err := json.Marshal(id)
+	if err != nil {
+		return fmt.Errorf("failed to marshal identity: %w", err)
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := getIdentitiesBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(id.ID), val)
+	})
+}
+
+func (s *Store) GetIdentity(id string) (storage.Identity, bool, error) {
+	var ident storage.Identity
+	var found bool
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		bucket, err := getIdentitiesBucket(tx)
+		if err != nil {
+			return err
+		}
+		val := bucket.Get([]byte(id))
+		if val == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(val, &ident)
+	})
+	if err != nil {
+		return storage.Identity{}, false, fmt.Errorf("failed to get identity %s: %w", id, err)
+	}
+	return ident, found, nil
+}
+
+func (s *Store) ListIdentities(userID string) ([]storage.Identity, error) {
+	var identities []storage.Identity
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		bucket, err := getIdentitiesBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var ident storage.Identity
+			if err := json.Unmarshal(v, &ident); err != nil {
+				return fmt.Errorf("failed to unmarshal identity %s: %w", k, err)
+			}
+			if ident.UserID == userID {
+				identities = append(identities, ident)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list identities for user %s: %w", userID, err)
+	}
+	slices.SortFunc(identities, func(a, b storage.Identity) int {
+		return cmp.Or(cmp.Compare(a.CreatedAt, b.CreatedAt), strings.Compare(a.ID, b.ID))
+	})
+	return identities, nil
+}
+
+func (s *Store) DeleteIdentity(id string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := getIdentitiesBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bucket.Delete([]byte(id))
+	})
+}
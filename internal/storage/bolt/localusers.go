@@ -0,0 +1,88 @@
+package bolt
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/brk3/habits/internal/storage"
+	"go.etcd.io/bbolt"
+)
+
+// localUsersBucket sits in the root bucket next to api_keys, holding local
+// accounts as JSON by username.
+const localUsersBucket = "local_users"
+
+func getLocalUsersBucket(tx *bbolt.Tx) (*bbolt.Bucket, error) {
+	bucket := tx.Bucket([]byte(rootBucket)).Bucket([]byte(localUsersBucket))
+	if bucket == nil {
+		return nil, fmt.Errorf("local users bucket not found")
+	}
+	return bucket, nil
+}
+
+func (s *Store) PutLocalUser(u storage.LocalUser) error {
+	val, err := json.Marshal(u)
+	if err != nil {
+		return fmt.Errorf("failed to marshal local user: %w", err)
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := getLocalUsersBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(u.Username), val)
+	})
+}
+
+func (s *Store) GetLocalUser(username string) (storage.LocalUser, bool, error) {
+	var u storage.LocalUser
+	var found bool
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		bucket, err := getLocalUsersBucket(tx)
+		if err != nil {
+			return err
+		}
+		val := bucket.Get([]byte(username))
+		if val == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(val, &u)
+	})
+	if err != nil {
+		return storage.LocalUser{}, false, fmt.Errorf("failed to get local user %s: %w", username, err)
+	}
+	return u, found, nil
+}
+
+func (s *Store) ListLocalUsers() ([]storage.LocalUser, error) {
+	var users []storage.LocalUser
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		bucket, err := getLocalUsersBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var u storage.LocalUser
+			if err := json.Unmarshal(v, &u); err != nil {
+				return fmt.Errorf("failed to unmarshal local user %s: %w", k, err)
+			}
+			users = append(users, u)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list local users: %w", err)
+	}
+	return users, nil
+}
+
+func (s *Store) DeleteLocalUser(username string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := getLocalUsersBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bucket.Delete([]byte(username))
+	})
+}
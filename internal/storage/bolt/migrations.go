@@ -0,0 +1,326 @@
+package bolt
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/brk3/habits/internal/logger"
+	"github.com/brk3/habits/internal/storage"
+	"github.com/brk3/habits/pkg/habit"
+	"go.etcd.io/bbolt"
+)
+
+const metaBucket = "meta"
+
+var schemaVersionKey = []byte("schema_version")
+
+// Migration describes a single step of the bolt schema history.
+type Migration struct {
+	Version     int
+	Description string
+
+	apply func(tx *bbolt.Tx) error
+}
+
+// migrations must stay ordered by Version with no gaps. Never change a
+// migration once released; add a new one that transforms the old layout.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create root users bucket",
+		apply: func(tx *bbolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists([]byte(rootBucket))
+			return err
+		},
+	},
+	{
+		Version:     2,
+		Description: "assign entry IDs and re-key entries as name/<RFC3339 UTC>/<id>",
+		apply:       migrateEntryIDs,
+	},
+	{
+		Version:     3,
+		Description: "create habit definitions for existing habits",
+		apply:       migrateHabitDefinitions,
+	},
+	{
+		Version:     4,
+		Description: "store API keys as JSON records with a name, timestamps and scopes",
+		apply:       migrateAPIKeyRecords,
+	},
+	{
+		Version:     5,
+		Description: "create sessions bucket",
+		apply: func(tx *bbolt.Tx) error {
+			_, err := tx.Bucket([]byte(rootBucket)).CreateBucketIfNotExists([]byte(sessionsBucket))
+			return err
+		},
+	},
+	{
+		Version:     6,
+		Description: "create local users bucket",
+		apply: func(tx *bbolt.Tx) error {
+			_, err := tx.Bucket([]byte(rootBucket)).CreateBucketIfNotExists([]byte(localUsersBucket))
+			return err
+		},
+	},
+	{
+		Version:     7,
+		Description: "create accounts bucket",
+		apply: func(tx *bbolt.Tx) error {
+			_, err := tx.Bucket([]byte(rootBucket)).CreateBucketIfNotExists([]byte(accountsBucket))
+			return err
+		},
+	},
+	{
+		Version:     8,
+		Description: "create identities bucket",
+		apply: func(tx *bbolt.Tx) error {
+			_, err := tx.Bucket([]byte(rootBucket)).CreateBucketIfNotExists([]byte(identitiesBucket))
+			return err
+		},
+	},
+	{
+		Version:     9,
+		Description: "create idempotency bucket",
+		apply: func(tx *bbolt.Tx) error {
+			_, err := tx.Bucket([]byte(rootBucket)).CreateBucketIfNotExists([]byte(idempotencyBucket))
+			return err
+		},
+	},
+	{
+		Version:     10,
+		Description: "create devices bucket",
+		apply: func(tx *bbolt.Tx) error {
+			_, err := tx.Bucket([]byte(rootBucket)).CreateBucketIfNotExists([]byte(devicesBucket))
+			return err
+		},
+	},
+}
+
+// LatestSchemaVersion is the schema version this build writes.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+func readSchemaVersion(tx *bbolt.Tx) int {
+	meta := tx.Bucket([]byte(metaBucket))
+	if meta == nil {
+		return 0
+	}
+	v := meta.Get(schemaVersionKey)
+	if len(v) != 8 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(v))
+}
+
+func writeSchemaVersion(tx *bbolt.Tx, version int) error {
+	meta, err := tx.CreateBucketIfNotExists([]byte(metaBucket))
+	if err != nil {
+		return err
+	}
+	return meta.Put(schemaVersionKey, binary.BigEndian.AppendUint64(nil, uint64(version)))
+}
+
+// SchemaVersion returns the schema version recorded in the database. Files
+// created before versioning was introduced report 0.
+func (s *Store) SchemaVersion() (int, error) {
+	var version int
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		version = readSchemaVersion(tx)
+		return nil
+	})
+	return version, err
+}
+
+// PendingMigrations lists the migrations Migrate would apply, oldest first.
+func (s *Store) PendingMigrations() ([]Migration, error) {
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if current > LatestSchemaVersion() {
+		return nil, fmt.Errorf("database schema version %d is newer than supported version %d", current, LatestSchemaVersion())
+	}
+
+	var pending []Migration
+	for _, m := range migrations {
+		if m.Version > current {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies all pending migrations. Each migration runs in its own
+// transaction together with the version bump, so an interrupted run resumes
+// from the last completed step.
+func (s *Store) Migrate() error {
+	pending, err := s.PendingMigrations()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range pending {
+		logger.Info("Applying BoltDB migration", "version", m.Version, "description", m.Description)
+		err := s.db.Update(func(tx *bbolt.Tx) error {
+			if err := m.apply(tx); err != nil {
+				return err
+			}
+			return writeSchemaVersion(tx, m.Version)
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Description, err)
+		}
+	}
+	return nil
+}
+
+// forEachUserBucket calls fn with the bucket of every user. The root bucket
+// also holds shared buckets such as api_keys; those are skipped because they
+// have no habits sub-bucket.
+func forEachUserBucket(tx *bbolt.Tx, fn func(userID string, user *bbolt.Bucket) error) error {
+	root := tx.Bucket([]byte(rootBucket))
+	if root == nil {
+		return fmt.Errorf("root bucket does not exist")
+	}
+
+	var userIDs []string
+	err := root.ForEachBucket(func(k []byte) error {
+		if root.Bucket(k).Bucket([]byte("habits")) != nil {
+			userIDs = append(userIDs, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		if err := fn(userID, root.Bucket([]byte(userID))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateEntryIDs moves entries from the original name/<RFC3339> keys, which
+// collided for entries logged in the same second, to keys carrying an ID.
+func migrateEntryIDs(tx *bbolt.Tx) error {
+	return forEachUserBucket(tx, func(userID string, user *bbolt.Bucket) error {
+		bucket := user.Bucket([]byte("habits"))
+		type kv struct{ k, v []byte }
+		var entries []kv
+		err := bucket.ForEach(func(k, v []byte) error {
+			entries = append(entries, kv{append([]byte(nil), k...), append([]byte(nil), v...)})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			var h habit.Habit
+			if err := json.Unmarshal(e.v, &h); err != nil {
+				return fmt.Errorf("failed to unmarshal entry %s for %s: %w", e.k, userID, err)
+			}
+			if h.ID == "" {
+				h.ID = habit.NewID(h.TimeStamp)
+			}
+			val, err := json.Marshal(h)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Delete(e.k); err != nil {
+				return err
+			}
+			if err := bucket.Put(entryKey(h), val); err != nil {
+				return err
+			}
+		}
+		logger.Info("Migrated habit entries", "user_id", userID, "count", len(entries))
+		return nil
+	})
+}
+
+// migrateHabitDefinitions gives every habit that only existed implicitly as
+// an entry key prefix a definition, created at the time of its first entry.
+func migrateHabitDefinitions(tx *bbolt.Tx) error {
+	return forEachUserBucket(tx, func(userID string, user *bbolt.Bucket) error {
+		first := map[string]int64{}
+		err := user.Bucket([]byte("habits")).ForEach(func(k, v []byte) error {
+			var h habit.Habit
+			if err := json.Unmarshal(v, &h); err != nil {
+				return fmt.Errorf("failed to unmarshal entry %s for %s: %w", k, userID, err)
+			}
+			if ts, ok := first[h.Name]; !ok || h.TimeStamp < ts {
+				first[h.Name] = h.TimeStamp
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		defs, err := user.CreateBucketIfNotExists([]byte("definitions"))
+		if err != nil {
+			return err
+		}
+		for name, createdAt := range first {
+			if defs.Get([]byte(name)) != nil {
+				continue
+			}
+			val, err := json.Marshal(habit.HabitDefinition{Name: name, CreatedAt: createdAt})
+			if err != nil {
+				return err
+			}
+			if err := defs.Put([]byte(name), val); err != nil {
+				return err
+			}
+		}
+		logger.Info("Created habit definitions", "user_id", userID, "count", len(first))
+		return nil
+	})
+}
+
+// migrateAPIKeyRecords replaces the bare user ID stored for each API key
+// with a record. Existing keys keep working as before: they get every scope
+// and never expire.
+func migrateAPIKeyRecords(tx *bbolt.Tx) error {
+	root := tx.Bucket([]byte(rootBucket))
+	if root == nil {
+		return fmt.Errorf("root bucket does not exist")
+	}
+	bucket := root.Bucket([]byte("api_keys"))
+	if bucket == nil {
+		return nil
+	}
+
+	type kv struct{ k, v []byte }
+	var keys []kv
+	err := bucket.ForEach(func(k, v []byte) error {
+		keys = append(keys, kv{append([]byte(nil), k...), append([]byte(nil), v...)})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range keys {
+		val, err := json.Marshal(storage.APIKey{
+			Hash:   string(e.k),
+			UserID: string(e.v),
+			Scopes: storage.Scopes,
+		})
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put(e.k, val); err != nil {
+			return err
+		}
+	}
+	logger.Info("Migrated API keys", "count", len(keys))
+	return nil
+}
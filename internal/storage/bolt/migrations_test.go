@@ -0,0 +1,246 @@
+package bolt
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/brk3/habits/internal/storage"
+	"github.com/brk3/habits/pkg/habit"
+	"go.etcd.io/bbolt"
+)
+
+// newLegacyDB creates a database laid out the way releases before schema
+// versioning left it: a root bucket, no meta bucket, and entries keyed by
+// name/<RFC3339>.
+func newLegacyDB(t *testing.T, userID string, entries ...habit.Habit) string {
+	dbPath := filepath.Join(t.TempDir(), "legacy.db")
+	db, err := bbolt.Open(dbPath, 0600, nil)
+	if err != nil {
+		t.Fatalf("failed to create legacy db: %v", err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte(rootBucket))
+		if err != nil {
+			return err
+		}
+		if _, err := root.CreateBucketIfNotExists([]byte("api_keys")); err != nil {
+			return err
+		}
+		user, err := root.CreateBucketIfNotExists([]byte(userID))
+		if err != nil {
+			return err
+		}
+		bucket, err := user.CreateBucketIfNotExists([]byte("habits"))
+		if err != nil {
+			return err
+		}
+		for _, h := range entries {
+			val, err := json.Marshal(h)
+			if err != nil {
+				return err
+			}
+			key := fmt.Appendf(nil, "%s/%s", h.Name, time.Unix(h.TimeStamp, 0).Format(time.RFC3339))
+			if err := bucket.Put(key, val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to seed legacy db: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("failed to close legacy db: %v", err)
+	}
+	return dbPath
+}
+
+func TestOpen_FreshDBAtLatestVersion(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	version, err := store.SchemaVersion()
+	if err != nil {
+		t.Fatalf("SchemaVersion failed: %v", err)
+	}
+	if version != LatestSchemaVersion() {
+		t.Fatalf("got schema version %d, want %d", version, LatestSchemaVersion())
+	}
+
+	pending, err := store.PendingMigrations()
+	if err != nil {
+		t.Fatalf("PendingMigrations failed: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("expected no pending migrations, got %d", len(pending))
+	}
+}
+
+func TestMigrate_LegacyDB(t *testing.T) {
+	dbPath := newLegacyDB(t, "testuser")
+
+	store, err := OpenWithOptions(dbPath, Options{SkipMigrations: true})
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+
+	pending, err := store.PendingMigrations()
+	if err != nil {
+		t.Fatalf("PendingMigrations failed: %v", err)
+	}
+	if len(pending) != len(migrations) {
+		t.Fatalf("expected %d pending migrations, got %d", len(migrations), len(pending))
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("failed to close store: %v", err)
+	}
+
+	store, err = Open(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open store with migrations: %v", err)
+	}
+	defer store.Close()
+
+	version, err := store.SchemaVersion()
+	if err != nil {
+		t.Fatalf("SchemaVersion failed: %v", err)
+	}
+	if version != LatestSchemaVersion() {
+		t.Fatalf("got schema version %d, want %d", version, LatestSchemaVersion())
+	}
+}
+
+func TestOpen_RejectsNewerSchema(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "future.db")
+	db, err := bbolt.Open(dbPath, 0600, nil)
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		return writeSchemaVersion(tx, LatestSchemaVersion()+1)
+	})
+	if err != nil {
+		t.Fatalf("failed to write schema version: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("failed to close db: %v", err)
+	}
+
+	if _, err := Open(dbPath); err == nil {
+		t.Fatal("expected error opening database with newer schema, got nil")
+	}
+}
+
+func TestMigrations_Ordered(t *testing.T) {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Fatalf("migration at index %d has version %d, want %d", i, m.Version, i+1)
+		}
+	}
+}
+
+func TestMigrate_EntryIDs(t *testing.T) {
+	now := time.Now().Unix()
+	dbPath := newLegacyDB(t, "testuser",
+		habit.Habit{Name: "guitar", Note: "scales", TimeStamp: now - 86400},
+		habit.Habit{Name: "guitar", Note: "chords", TimeStamp: now},
+	)
+
+	store, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	defer store.Close()
+
+	entries, err := store.GetHabit("testuser", "guitar")
+	if err != nil {
+		t.Fatalf("GetHabit failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	for _, e := range entries {
+		if e.ID == "" {
+			t.Fatalf("entry %+v has no ID after migration", e)
+		}
+	}
+	if entries[0].Note != "scales" || entries[1].Note != "chords" {
+		t.Fatalf("entries not in timestamp order after migration: %+v", entries)
+	}
+
+	// entries logged in the same second as a migrated one no longer collide
+	if err := store.PutHabit("testuser", habit.Habit{Name: "guitar", Note: "riffs", TimeStamp: now}); err != nil {
+		t.Fatalf("PutHabit failed: %v", err)
+	}
+	entries, err = store.GetHabit("testuser", "guitar")
+	if err != nil {
+		t.Fatalf("GetHabit failed: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+}
+
+func TestMigrate_HabitDefinitions(t *testing.T) {
+	now := time.Now().Unix()
+	dbPath := newLegacyDB(t, "testuser",
+		habit.Habit{Name: "guitar", TimeStamp: now},
+		habit.Habit{Name: "guitar", TimeStamp: now - 86400},
+		habit.Habit{Name: "reading", TimeStamp: now},
+	)
+
+	store, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	defer store.Close()
+
+	defs, err := store.ListHabitDefinitions("testuser")
+	if err != nil {
+		t.Fatalf("ListHabitDefinitions failed: %v", err)
+	}
+	if len(defs) != 2 {
+		t.Fatalf("expected 2 definitions, got %d", len(defs))
+	}
+	if defs[0].Name != "guitar" || defs[0].CreatedAt != now-86400 {
+		t.Fatalf("expected guitar created at earliest entry, got %+v", defs[0])
+	}
+}
+
+func TestMigrate_APIKeyRecords(t *testing.T) {
+	dbPath := newLegacyDB(t, "testuser")
+	db, err := bbolt.Open(dbPath, 0600, nil)
+	if err != nil {
+		t.Fatalf("failed to open legacy db: %v", err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(rootBucket)).Bucket([]byte("api_keys")).Put([]byte("legacy-hash"), []byte("testuser"))
+	})
+	if err != nil {
+		t.Fatalf("failed to seed API key: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("failed to close legacy db: %v", err)
+	}
+
+	store, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	defer store.Close()
+
+	key, found, err := store.GetAPIKey("legacy-hash")
+	if err != nil {
+		t.Fatalf("GetAPIKey failed: %v", err)
+	}
+	if !found || key.UserID != "testuser" || key.ExpiresAt != 0 {
+		t.Fatalf("legacy key not migrated, got %+v (found=%v)", key, found)
+	}
+	if !reflect.DeepEqual(key.Scopes, storage.Scopes) {
+		t.Fatalf("legacy key should keep every scope, got %v", key.Scopes)
+	}
+}
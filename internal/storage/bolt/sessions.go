@@ -0,0 +1,234 @@
+package bolt
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/brk3/habits/internal/logger"
+	"github.com/brk3/habits/internal/storage"
+	"go.etcd.io/bbolt"
+)
+
+// sessionsBucket sits in the root bucket next to api_keys, holding
+// sessions as JSON by ID.
+const sessionsBucket = "sessions"
+
+func getSessionsBucket(tx *bbolt.Tx) (*bbolt.Bucket, error) {
+	bucket := tx.Bucket([]byte(rootBucket)).Bucket([]byte(sessionsBucket))
+	if bucket == nil {
+		return nil, fmt.Errorf("sessions bucket not found")
+	}
+	return bucket, nil
+}
+
+func putSession(bucket *bbolt.Bucket, sess storage.Session) error {
+	val, err := json.Marshal(sess)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+	return bucket.Put([]byte(sess.ID), val)
+}
+
+// forEachSession calls fn with every stored session.
+func forEachSession(bucket *bbolt.Bucket, fn func(sess storage.Session) error) error {
+	return bucket.ForEach(func(k, v []byte) error {
+		var sess storage.Session
+		if err := json.Unmarshal(v, &sess); err != nil {
+			return fmt.Errorf("failed to unmarshal session: %w", err)
+		}
+		return fn(sess)
+	})
+}
+
+func (s *Store) PutSession(sess storage.Session) error {
+	sess, err := s.cipher.EncryptSession(sess)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt session: %w", err)
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := getSessionsBucket(tx)
+		if err != nil {
+			return err
+		}
+		return putSession(bucket, sess)
+	})
+}
+
+func (s *Store) UpdateSession(sess storage.Session) error {
+	sess, err := s.cipher.EncryptSession(sess)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt session: %w", err)
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := getSessionsBucket(tx)
+		if err != nil {
+			return err
+		}
+		if bucket.Get([]byte(sess.ID)) == nil {
+			return storage.ErrNotFound
+		}
+		return putSession(bucket, sess)
+	})
+}
+
+func (s *Store) GetSession(id string) (storage.Session, bool, error) {
+	var sess storage.Session
+	var found bool
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		bucket, err := getSessionsBucket(tx)
+		if err != nil {
+			return err
+		}
+		val := bucket.Get([]byte(id))
+		if val == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(val, &sess)
+	})
+	if err != nil {
+		return storage.Session{}, false, fmt.Errorf("failed to get session: %w", err)
+	}
+	if !found {
+		return storage.Session{}, false, nil
+	}
+	sess, err = s.cipher.DecryptSession(sess)
+	if err != nil {
+		return storage.Session{}, false, fmt.Errorf("failed to decrypt session: %w", err)
+	}
+	return sess, true, nil
+}
+
+func (s *Store) ListSessions(userID string) ([]storage.Session, error) {
+	var sessions []storage.Session
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		bucket, err := getSessionsBucket(tx)
+		if err != nil {
+			return err
+		}
+		return forEachSession(bucket, func(sess storage.Session) error {
+			if sess.UserID != userID {
+				return nil
+			}
+			sess, err := s.cipher.DecryptSession(sess)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt session: %w", err)
+			}
+			sessions = append(sessions, sess)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions for user %s: %w", userID, err)
+	}
+	return sessions, nil
+}
+
+func (s *Store) DeleteSession(id string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := getSessionsBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bucket.Delete([]byte(id))
+	})
+}
+
+func (s *Store) DeleteUserSessions(userID string) error {
+	return s.deleteSessionsWhere(func(sess storage.Session) bool {
+		return sess.UserID == userID
+	})
+}
+
+func (s *Store) DeleteExpiredSessions(now int64) error {
+	return s.deleteSessionsWhere(func(sess storage.Session) bool {
+		return sess.ExpiresAt <= now
+	})
+}
+
+func (s *Store) deleteSessionsWhere(match func(sess storage.Session) bool) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := getSessionsBucket(tx)
+		if err != nil {
+			return err
+		}
+		// deleting while iterating skips keys, so collect them first
+		var ids []string
+		err = forEachSession(bucket, func(sess storage.Session) error {
+			if match(sess) {
+				ids = append(ids, sess.ID)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := bucket.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// reencryptSessions rewrites the sessions whose ID token is stale, the same
+// way reencryptRefreshTokens does refresh tokens.
+func (s *Store) reencryptSessions(purge bool) (int, error) {
+	var count int
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := getSessionsBucket(tx)
+		if err != nil {
+			return err
+		}
+		var stale []storage.Session
+		var lost []string
+		err = forEachSession(bucket, func(sess storage.Session) error {
+			if !s.cipher.Stale(sess.IDToken) {
+				return nil
+			}
+			plain, err := s.cipher.DecryptSession(sess)
+			if err != nil {
+				logger.Warn("Session can't be decrypted", "user_id", sess.UserID, "error", err)
+				lost = append(lost, sess.ID)
+				return nil
+			}
+			if purge {
+				return nil
+			}
+			sealed, err := s.cipher.EncryptSession(plain)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt session: %w", err)
+			}
+			stale = append(stale, sealed)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if purge {
+			for _, id := range lost {
+				if err := bucket.Delete([]byte(id)); err != nil {
+					return err
+				}
+			}
+			count = len(lost)
+			return nil
+		}
+		if len(lost) > 0 {
+			return fmt.Errorf("%d sessions can't be decrypted with the configured keys: %w",
+				len(lost), storage.ErrUndecryptable)
+		}
+		for _, sess := range stale {
+			if err := putSession(bucket, sess); err != nil {
+				return err
+			}
+		}
+		count = len(stale)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to re-encrypt sessions: %w", err)
+	}
+	return count, nil
+}
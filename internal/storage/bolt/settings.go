@@ -0,0 +1,53 @@
+package bolt
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/brk3/habits/pkg/habit"
+	"go.etcd.io/bbolt"
+)
+
+// settingsKey holds a user's settings as JSON, next to the habits and
+// definitions buckets in the user bucket.
+const settingsKey = "settings"
+
+func (s *Store) GetUserSettings(userID string) (habit.UserSettings, error) {
+	var settings habit.UserSettings
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		usersBucket := tx.Bucket([]byte(rootBucket))
+		if usersBucket == nil {
+			return fmt.Errorf("root bucket does not exist")
+		}
+		userBucket := usersBucket.Bucket([]byte(userID))
+		if userBucket == nil {
+			return nil
+		}
+		val := userBucket.Get([]byte(settingsKey))
+		if val == nil {
+			return nil
+		}
+		return json.Unmarshal(val, &settings)
+	})
+	if err != nil {
+		return habit.UserSettings{}, fmt.Errorf("failed to get settings for user %s: %w", userID, err)
+	}
+	return settings, nil
+}
+
+func (s *Store) PutUserSettings(userID string, settings habit.UserSettings) error {
+	if err := s.ensureUserHabitsBucketExists(userID); err != nil {
+		return fmt.Errorf("failed to ensure bucket exists for user %s: %w", userID, err)
+	}
+	val, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal settings: %w", err)
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		userBucket := tx.Bucket([]byte(rootBucket)).Bucket([]byte(userID))
+		if err := userBucket.Put([]byte(settingsKey), val); err != nil {
+			return fmt.Errorf("failed to store settings for user %s: %w", userID, err)
+		}
+		return nil
+	})
+}
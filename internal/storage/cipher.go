@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// encryptedPrefix marks a value as encrypted, and by which version of the
+// format. Values without it are plaintext from before encryption was
+// configured.
+const encryptedPrefix = "enc:v1:"
+
+// CipherKey is a master key for envelope encryption. ID is stored with
+// every value it encrypts, so it must be unique and contain no colons.
+type CipherKey struct {
+	ID  string
+	Key []byte
+}
+
+// Cipher encrypts secrets before stores write them. Each value gets a
+// fresh data key, which is stored with it encrypted under a master key, so
+// master keys never encrypt values directly. After a rotation, stores
+// decrypt and re-encrypt each value in full with ReencryptSecrets; the
+// secrets are small, so rewrapping only their data keys wouldn't save much.
+//
+// A nil Cipher leaves values as they are.
+type Cipher struct {
+	// the first key encrypts and all of them decrypt
+	keys []cipherKey
+}
+
+type cipherKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// NewCipher builds a Cipher from master keys, the one to encrypt with
+// first. It returns nil without any keys.
+func NewCipher(keys ...CipherKey) (*Cipher, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	c := &Cipher{}
+	seen := map[string]bool{}
+	for _, k := range keys {
+		if k.ID == "" || strings.Contains(k.ID, ":") {
+			return nil, fmt.Errorf("invalid key ID %q", k.ID)
+		}
+		if seen[k.ID] {
+			return nil, fmt.Errorf("duplicate key ID %q", k.ID)
+		}
+		seen[k.ID] = true
+		aead, err := newAEAD(k.Key)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", k.ID, err)
+		}
+		c.keys = append(c.keys, cipherKey{id: k.ID, aead: aead})
+	}
+	return c, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with a random nonce, which it prepends.
+func seal(aead cipher.AEAD, plaintext, context []byte) []byte {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	_, _ = rand.Read(nonce)
+	return aead.Seal(nonce, nonce, plaintext, context)
+}
+
+func open(aead cipher.AEAD, sealed, context []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, context)
+}
+
+// Encrypt encrypts value with the first key. context, such as the ID of
+// the record the value belongs to, must be given again to decrypt it, so
+// values can't be swapped between records. Empty values stay empty.
+func (c *Cipher) Encrypt(value, context string) (string, error) {
+	if c == nil || value == "" {
+		return value, nil
+	}
+	key := c.keys[0]
+	dataKey := make([]byte, 32)
+	_, _ = rand.Read(dataKey)
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	wrapped := seal(key.aead, dataKey, []byte(key.id))
+	sealed := seal(aead, []byte(value), []byte(context))
+	return encryptedPrefix + key.id + ":" +
+		base64.RawStdEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt reverses Encrypt. Plaintext values are returned as they are.
+func (c *Cipher) Decrypt(value, context string) (string, error) {
+	rest, ok := strings.CutPrefix(value, encryptedPrefix)
+	if !ok {
+		return value, nil
+	}
+	parts := strings.Split(rest, ":")
+	if len(parts) != 3 {
+		return "", errors.New("malformed encrypted value")
+	}
+	key, ok := c.key(parts[0])
+	if !ok {
+		return "", fmt.Errorf("value is encrypted with key %q, which isn't configured", parts[0])
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	dataKey, err := open(key.aead, wrapped, []byte(key.id))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(aead, sealed, []byte(context))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+func (c *Cipher) key(id string) (cipherKey, bool) {
+	if c == nil {
+		return cipherKey{}, false
+	}
+	for _, k := range c.keys {
+		if k.id == id {
+			return k, true
+		}
+	}
+	return cipherKey{}, false
+}
+
+// Stale reports whether value should be re-encrypted: it is plaintext, or
+// encrypted with a key other than the first.
+func (c *Cipher) Stale(value string) bool {
+	if c == nil || value == "" {
+		return false
+	}
+	return !strings.HasPrefix(value, encryptedPrefix+c.keys[0].id+":")
+}
+
+// EncryptToken returns a copy of token with its access and refresh tokens
+// encrypted for the identity id.
+func (c *Cipher) EncryptToken(id string, token *oauth2.Token) (*oauth2.Token, error) {
+	return c.mapToken(token, func(v string) (string, error) { return c.Encrypt(v, id) })
+}
+
+// DecryptToken reverses EncryptToken.
+func (c *Cipher) DecryptToken(id string, token *oauth2.Token) (*oauth2.Token, error) {
+	return c.mapToken(token, func(v string) (string, error) { return c.Decrypt(v, id) })
+}
+
+// StaleToken reports whether either secret of token is Stale.
+func (c *Cipher) StaleToken(token *oauth2.Token) bool {
+	return c.Stale(token.AccessToken) || c.Stale(token.RefreshToken)
+}
+
+// EncryptSession returns a copy of sess with its ID token encrypted for
+// the session's ID.
+func (c *Cipher) EncryptSession(sess Session) (Session, error) {
+	var err error
+	sess.IDToken, err = c.Encrypt(sess.IDToken, "session:"+sess.ID)
+	return sess, err
+}
+
+// DecryptSession reverses EncryptSession.
+func (c *Cipher) DecryptSession(sess Session) (Session, error) {
+	var err error
+	sess.IDToken, err = c.Decrypt(sess.IDToken, "session:"+sess.ID)
+	return sess, err
+}
+
+func (c *Cipher) mapToken(token *oauth2.Token, fn func(string) (string, error)) (*oauth2.Token, error) {
+	out := *token
+	var err error
+	if out.AccessToken, err = fn(token.AccessToken); err != nil {
+		return nil, fmt.Errorf("access token: %w", err)
+	}
+	if out.RefreshToken, err = fn(token.RefreshToken); err != nil {
+		return nil, fmt.Errorf("refresh token: %w", err)
+	}
+	return &out, nil
+}
+
+// Encrypter is implemented by stores that can encrypt secrets at rest.
+type Encrypter interface {
+	// SetCipher makes the store encrypt secrets it writes from then on.
+	SetCipher(c *Cipher)
+	// ReencryptSecrets re-encrypts the stored secrets that are Stale,
+	// returning how many records it rewrote. If any can't be decrypted with
+	// the configured keys, nothing is rewritten and the error wraps
+	// ErrUndecryptable.
+	ReencryptSecrets() (int, error)
+	// PurgeUndecryptableSecrets deletes the stored secrets that can't be
+	// decrypted with the configured keys, returning how many it deleted.
+	// Their users have to log in again.
+	PurgeUndecryptableSecrets() (int, error)
+}
+
+// ErrUndecryptable is returned when stored secrets are encrypted with keys
+// that are no longer configured.
+var ErrUndecryptable = errors.New("secrets encrypted with an unknown key")
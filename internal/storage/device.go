@@ -0,0 +1,16 @@
+package storage
+
+// DeviceAuthorization is a device login (RFC 8628) waiting to be approved
+// and redeemed. It is stored so that whichever replica the device polls
+// sees the user's answer.
+type DeviceAuthorization struct {
+	DeviceCode string `json:"device_code"`
+	UserCode   string `json:"user_code"`
+	ExpiresAt  int64  `json:"expires_at"`
+	LastPollAt int64  `json:"last_poll_at"`
+	// UserID is set once a user approves; Denied once they refuse.
+	UserID string `json:"user_id"`
+	Denied bool   `json:"denied"`
+	// Scopes are those of the approving user, which the issued key gets.
+	Scopes []string `json:"scopes"`
+}
@@ -0,0 +1,19 @@
+package storage
+
+// IdempotencyRecord is the response to a request made with an
+// Idempotency-Key, kept so that a retry, possibly to another replica, gets
+// the original response. Key is derived by the server from the user, path
+// and header.
+type IdempotencyRecord struct {
+	Key    string `json:"key"`
+	UserID string `json:"user_id"`
+	// Fingerprint is a hash of the request body, to catch a key being
+	// reused for a different request.
+	Fingerprint string `json:"fingerprint"`
+	// Done is false while the first request is still being handled.
+	Done        bool   `json:"done"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+	ExpiresAt   int64  `json:"expires_at"`
+}
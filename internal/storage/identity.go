@@ -0,0 +1,18 @@
+package storage
+
+// Identity links an OIDC login, an issuer and subject pair, to the user it
+// logs in as. Logins without one log in as the user their ID names, which
+// is how every login worked before identities could be linked.
+type Identity struct {
+	// ID is derived from the issuer and subject, and is also the key the
+	// login's refresh token is stored under.
+	ID         string `json:"id"`
+	UserID     string `json:"user_id"`
+	ProviderID string `json:"provider_id"`
+	Issuer     string `json:"issuer"`
+	Subject    string `json:"subject"`
+	// Email is from the last login, where the provider gave one.
+	Email       string `json:"email,omitempty"`
+	CreatedAt   int64  `json:"created_at"`
+	LastLoginAt int64  `json:"last_login_at,omitempty"`
+}
@@ -0,0 +1,13 @@
+package storage
+
+// LocalUser is an account for the built-in username and password login,
+// for installs without an OIDC provider.
+type LocalUser struct {
+	Username string `json:"username"`
+	// UserID is fixed when the account is created, so renaming the account
+	// later won't orphan its habits.
+	UserID string `json:"user_id"`
+	// PasswordHash is a bcrypt hash.
+	PasswordHash string `json:"password_hash"`
+	CreatedAt    int64  `json:"created_at"`
+}
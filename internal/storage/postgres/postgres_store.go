@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/brk3/habits/internal/logger"
+	"github.com/brk3/habits/internal/storage/sqlstore"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// Options controls the connection pool. Zero values keep database/sql defaults.
+type Options struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+func Open(dsn string, opts Options) (*sqlstore.Store, error) {
+	logger.Debug("Opening Postgres database")
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		logger.Error("Failed to open Postgres database", "error", err)
+		return nil, err
+	}
+
+	if opts.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(opts.MaxOpenConns)
+	}
+	if opts.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(opts.MaxIdleConns)
+	}
+	if opts.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		logger.Error("Failed to connect to Postgres", "error", err)
+		if closeErr := db.Close(); closeErr != nil {
+			logger.Error("Failed to close database after connection error", "error", closeErr)
+		}
+		return nil, err
+	}
+
+	s, err := sqlstore.New(db, sqlstore.Postgres)
+	if err != nil {
+		logger.Error("Failed to migrate Postgres database", "error", err)
+		if closeErr := db.Close(); closeErr != nil {
+			logger.Error("Failed to close database after migration error", "error", closeErr)
+		}
+		return nil, err
+	}
+
+	logger.Info("Postgres database opened successfully")
+	return s, nil
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// EntryQuery selects a page of a habit's entries, ordered by timestamp then ID.
+// From is inclusive and To exclusive (Unix seconds); zero leaves that side
+// open. Cursor resumes after the last entry of a previous page, and a zero
+// Limit returns all remaining entries.
+type EntryQuery struct {
+	From   int64
+	To     int64
+	Limit  int
+	Cursor string
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// EncodeCursor builds an opaque cursor pointing just past the given entry.
+// Cursors are backend neutral so clients can page across a storage migration.
+func EncodeCursor(ts int64, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(ts, 10) + "/" + id))
+}
+
+func DecodeCursor(cursor string) (ts int64, id string, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", ErrInvalidCursor
+	}
+	tsStr, id, ok := strings.Cut(string(b), "/")
+	if !ok || id == "" {
+		return 0, "", ErrInvalidCursor
+	}
+	ts, err = strconv.ParseInt(tsStr, 10, 64)
+	if err != nil {
+		return 0, "", ErrInvalidCursor
+	}
+	return ts, id, nil
+}
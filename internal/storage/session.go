@@ -0,0 +1,25 @@
+package storage
+
+import "time"
+
+// Session is a browser login. The cookie carries a random token and only
+// its hash is stored as the ID, so the stored sessions can't be used to
+// take one over.
+type Session struct {
+	ID         string `json:"id"`
+	UserID     string `json:"user_id"`
+	ProviderID string `json:"provider_id"`
+	// IDToken is the provider's latest ID token, replaced on refresh. Local
+	// logins have none and keep the username here instead. It is accepted
+	// as a bearer token, so stores encrypt it with their Cipher.
+	IDToken    string `json:"id_token"`
+	CreatedAt  int64  `json:"created_at"`
+	LastSeenAt int64  `json:"last_seen_at"`
+	ExpiresAt  int64  `json:"expires_at"`
+	UserAgent  string `json:"user_agent"`
+	IPAddress  string `json:"ip_address"`
+}
+
+func (s Session) Expired(now time.Time) bool {
+	return now.Unix() >= s.ExpiresAt
+}
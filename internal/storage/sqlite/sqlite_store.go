@@ -0,0 +1,41 @@
+package sqlite
+
+import (
+	"database/sql"
+	"net/url"
+
+	"github.com/brk3/habits/internal/logger"
+	"github.com/brk3/habits/internal/storage/sqlstore"
+
+	_ "modernc.org/sqlite"
+)
+
+func Open(path string) (*sqlstore.Store, error) {
+	logger.Debug("Opening SQLite database", "path", path)
+
+	// WAL lets readers (including external tools) run alongside the server's
+	// writer; busy_timeout makes concurrent writers wait instead of failing.
+	q := url.Values{}
+	q.Add("_pragma", "journal_mode(WAL)")
+	q.Add("_pragma", "busy_timeout(5000)")
+	q.Add("_pragma", "foreign_keys(1)")
+	dsn := "file:" + path + "?" + q.Encode()
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		logger.Error("Failed to open SQLite database", "path", path, "error", err)
+		return nil, err
+	}
+
+	s, err := sqlstore.New(db, sqlstore.SQLite)
+	if err != nil {
+		logger.Error("Failed to migrate SQLite database", "path", path, "error", err)
+		if closeErr := db.Close(); closeErr != nil {
+			logger.Error("Failed to close database after migration error", "error", closeErr)
+		}
+		return nil, err
+	}
+
+	logger.Info("SQLite database opened successfully", "path", path)
+	return s, nil
+}
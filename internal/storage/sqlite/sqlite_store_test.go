@@ -0,0 +1,39 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/brk3/habits/pkg/habit"
+)
+
+func TestOpen_Reopen(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.sqlite")
+
+	store, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	if err := store.PutHabit("testuser", habit.Habit{Name: "guitar", TimeStamp: time.Now().Unix()}); err != nil {
+		t.Fatalf("PutHabit failed: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("failed to close store: %v", err)
+	}
+
+	// migrations must be idempotent across restarts
+	store, err = Open(dbPath)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	defer store.Close()
+
+	names, err := store.ListHabitNames("testuser")
+	if err != nil {
+		t.Fatalf("ListHabitNames failed: %v", err)
+	}
+	if len(names) != 1 || names[0] != "guitar" {
+		t.Fatalf("expected [guitar], got %v", names)
+	}
+}
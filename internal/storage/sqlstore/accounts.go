@@ -0,0 +1,151 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/brk3/habits/internal/storage"
+)
+
+const accountColumns = `user_id, email, name, admin, disabled, created_at, last_login_at`
+
+func scanAccount(scan func(dest ...any) error) (storage.Account, error) {
+	var a storage.Account
+	err := scan(&a.UserID, &a.Email, &a.Name, &a.Admin, &a.Disabled, &a.CreatedAt, &a.LastLoginAt)
+	return a, err
+}
+
+func (s *Store) PutAccount(a storage.Account) error {
+	_, err := s.exec(`INSERT INTO accounts (`+accountColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			email = excluded.email,
+			name = excluded.name,
+			admin = excluded.admin,
+			disabled = excluded.disabled,
+			created_at = excluded.created_at,
+			last_login_at = excluded.last_login_at`,
+		a.UserID, a.Email, a.Name, a.Admin, a.Disabled, a.CreatedAt, a.LastLoginAt)
+	if err != nil {
+		return fmt.Errorf("failed to store account for user %s: %w", a.UserID, err)
+	}
+	return nil
+}
+
+func (s *Store) GetAccount(userID string) (storage.Account, bool, error) {
+	a, err := scanAccount(s.queryRow(`SELECT `+accountColumns+` FROM accounts WHERE user_id = ?`, userID).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Account{}, false, nil
+	}
+	if err != nil {
+		return storage.Account{}, false, fmt.Errorf("failed to get account for user %s: %w", userID, err)
+	}
+	return a, true, nil
+}
+
+func (s *Store) ListAccounts() ([]storage.Account, error) {
+	rows, err := s.query(`SELECT ` + accountColumns + ` FROM accounts ORDER BY user_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list accounts: %w", err)
+	}
+	defer rows.Close()
+
+	var accounts []storage.Account
+	for rows.Next() {
+		a, err := scanAccount(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan account: %w", err)
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, rows.Err()
+}
+
+func (s *Store) ListUserStats() ([]storage.UserStats, error) {
+	// every habit has a definition, so users with habits are exactly the
+	// users with definitions
+	rows, err := s.query(`SELECT d.user_id, d.habits, COALESCE(e.entries, 0), COALESCE(e.last_entry, 0)
+		FROM (SELECT user_id, COUNT(*) AS habits FROM habit_definitions GROUP BY user_id) d
+		LEFT JOIN (SELECT user_id, COUNT(*) AS entries, MAX(timestamp) AS last_entry FROM entries GROUP BY user_id) e
+			ON e.user_id = d.user_id
+		ORDER BY d.user_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user stats: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []storage.UserStats
+	for rows.Next() {
+		var st storage.UserStats
+		if err := rows.Scan(&st.UserID, &st.HabitCount, &st.EntryCount, &st.LastEntryAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user stats: %w", err)
+		}
+		stats = append(stats, st)
+	}
+	return stats, rows.Err()
+}
+
+func (s *Store) DeleteUser(userID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// refresh tokens are stored by identity
+	if _, err := tx.Exec(s.rebind(`DELETE FROM refresh_tokens WHERE user_id IN (SELECT id FROM identities WHERE user_id = ?)`), userID); err != nil {
+		return fmt.Errorf("failed to delete refresh tokens of user %s: %w", userID, err)
+	}
+	for _, table := range []string{"entries", "habit_definitions", "user_settings", "api_keys",
+		"sessions", "refresh_tokens", "local_users", "identities", "idempotency_records", "device_authorizations", "accounts"} {
+		if _, err := tx.Exec(s.rebind(`DELETE FROM `+table+` WHERE user_id = ?`), userID); err != nil {
+			return fmt.Errorf("failed to delete user %s from %s: %w", userID, table, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Store) MergeUser(fromUserID, toUserID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmts := []struct {
+		stmt string
+		args []any
+	}{
+		// entries are keyed by their ID, which an import can give both
+		// users; the target's entry is kept, as for definitions and settings
+		{`INSERT INTO entries (user_id, ` + entryColumns + `)
+			SELECT ?, ` + entryColumns + ` FROM entries
+			WHERE user_id = ? AND id NOT IN (SELECT id FROM entries WHERE user_id = ?)`,
+			[]any{toUserID, fromUserID, toUserID}},
+		{`DELETE FROM entries WHERE user_id = ?`, []any{fromUserID}},
+		{`INSERT INTO habit_definitions (user_id, ` + definitionColumns + `)
+			SELECT ?, ` + definitionColumns + ` FROM habit_definitions
+			WHERE user_id = ? AND name NOT IN (SELECT name FROM habit_definitions WHERE user_id = ?)`,
+			[]any{toUserID, fromUserID, toUserID}},
+		{`DELETE FROM habit_definitions WHERE user_id = ?`, []any{fromUserID}},
+		{`INSERT INTO user_settings (user_id, timezone)
+			SELECT ?, timezone FROM user_settings
+			WHERE user_id = ? AND NOT EXISTS (SELECT 1 FROM user_settings WHERE user_id = ?)`,
+			[]any{toUserID, fromUserID, toUserID}},
+		{`DELETE FROM user_settings WHERE user_id = ?`, []any{fromUserID}},
+		{`UPDATE api_keys SET user_id = ? WHERE user_id = ?`, []any{toUserID, fromUserID}},
+		{`UPDATE sessions SET user_id = ? WHERE user_id = ?`, []any{toUserID, fromUserID}},
+		{`UPDATE local_users SET user_id = ? WHERE user_id = ?`, []any{toUserID, fromUserID}},
+		{`UPDATE identities SET user_id = ? WHERE user_id = ?`, []any{toUserID, fromUserID}},
+		{`UPDATE device_authorizations SET user_id = ? WHERE user_id = ?`, []any{toUserID, fromUserID}},
+		// keys are derived from the user, so the records can't be moved
+		{`DELETE FROM idempotency_records WHERE user_id = ?`, []any{fromUserID}},
+		{`DELETE FROM accounts WHERE user_id = ?`, []any{fromUserID}},
+	}
+	for _, st := range stmts {
+		if _, err := tx.Exec(s.rebind(st.stmt), st.args...); err != nil {
+			return fmt.Errorf("failed to merge user %s into %s: %w", fromUserID, toUserID, err)
+		}
+	}
+	return tx.Commit()
+}
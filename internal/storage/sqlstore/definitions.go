@@ -0,0 +1,115 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/brk3/habits/pkg/habit"
+)
+
+const definitionColumns = `name, display_name, description, color, icon, created_at, archived, schedule, target`
+
+func scanDefinition(row interface{ Scan(...any) error }) (habit.HabitDefinition, error) {
+	var d habit.HabitDefinition
+	var schedule, target string
+	err := row.Scan(&d.Name, &d.DisplayName, &d.Description, &d.Color, &d.Icon, &d.CreatedAt, &d.Archived, &schedule, &target)
+	if err != nil {
+		return d, err
+	}
+	if d.Schedule, err = decodeJSONColumn[habit.Schedule](schedule); err != nil {
+		return d, fmt.Errorf("failed to decode schedule of %s: %w", d.Name, err)
+	}
+	if d.Target, err = decodeJSONColumn[habit.Target](target); err != nil {
+		return d, fmt.Errorf("failed to decode target of %s: %w", d.Name, err)
+	}
+	return d, nil
+}
+
+// encodeJSONColumn stores optional structured fields as JSON text, with nil
+// as the empty string.
+func encodeJSONColumn[T any](v *T) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func decodeJSONColumn[T any](s string) (*T, error) {
+	if s == "" {
+		return nil, nil
+	}
+	v := new(T)
+	if err := json.Unmarshal([]byte(s), v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (s *Store) PutHabitDefinition(userID string, d habit.HabitDefinition) error {
+	schedule, err := encodeJSONColumn(d.Schedule)
+	if err != nil {
+		return fmt.Errorf("failed to encode schedule of %s: %w", d.Name, err)
+	}
+	target, err := encodeJSONColumn(d.Target)
+	if err != nil {
+		return fmt.Errorf("failed to encode target of %s: %w", d.Name, err)
+	}
+	_, err = s.exec(`INSERT INTO habit_definitions (user_id, `+definitionColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, name) DO UPDATE SET
+			display_name = excluded.display_name,
+			description = excluded.description,
+			color = excluded.color,
+			icon = excluded.icon,
+			created_at = excluded.created_at,
+			archived = excluded.archived,
+			schedule = excluded.schedule,
+			target = excluded.target`,
+		userID, d.Name, d.DisplayName, d.Description, d.Color, d.Icon, d.CreatedAt, d.Archived, schedule, target)
+	if err != nil {
+		return fmt.Errorf("failed to store definition %s: %w", d.Name, err)
+	}
+	return nil
+}
+
+func (s *Store) GetHabitDefinition(userID, name string) (habit.HabitDefinition, bool, error) {
+	d, err := scanDefinition(s.queryRow(`SELECT `+definitionColumns+` FROM habit_definitions
+		WHERE user_id = ? AND name = ?`, userID, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return habit.HabitDefinition{}, false, nil
+	}
+	if err != nil {
+		return habit.HabitDefinition{}, false, fmt.Errorf("failed to get definition %s: %w", name, err)
+	}
+	return d, true, nil
+}
+
+func (s *Store) ListHabitDefinitions(userID string) ([]habit.HabitDefinition, error) {
+	rows, err := s.query(`SELECT `+definitionColumns+` FROM habit_definitions
+		WHERE user_id = ? ORDER BY name`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list definitions for user %s: %w", userID, err)
+	}
+	defer rows.Close()
+
+	out := []habit.HabitDefinition{}
+	for rows.Next() {
+		d, err := scanDefinition(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan definition: %w", err)
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) DeleteHabitDefinition(userID, name string) error {
+	res, err := s.exec(`DELETE FROM habit_definitions WHERE user_id = ? AND name = ?`, userID, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete definition %s: %w", name, err)
+	}
+	return requireAffected(res)
+}
@@ -0,0 +1,92 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/brk3/habits/internal/storage"
+)
+
+// Scopes are stored space separated, as for API keys.
+const deviceColumns = `device_code, user_code, expires_at, last_poll_at, user_id, denied, scopes`
+
+func (s *Store) CreateDeviceAuthorization(a storage.DeviceAuthorization) (bool, error) {
+	// both codes are unique, so a clash inserts nothing
+	res, err := s.exec(`INSERT INTO device_authorizations (`+deviceColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING`,
+		a.DeviceCode, a.UserCode, a.ExpiresAt, a.LastPollAt, a.UserID, a.Denied, strings.Join(a.Scopes, " "))
+	if err != nil {
+		return false, fmt.Errorf("failed to create device authorization: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (s *Store) DecideDeviceAuthorization(userCode, userID string, scopes []string, approve bool, now int64) (bool, error) {
+	if !approve {
+		userID, scopes = "", nil
+	}
+	res, err := s.exec(`UPDATE device_authorizations SET user_id = ?, scopes = ?, denied = ?
+		WHERE user_code = ? AND expires_at > ? AND user_id = '' AND NOT denied`,
+		userID, strings.Join(scopes, " "), !approve, userCode, now)
+	if err != nil {
+		return false, fmt.Errorf("failed to decide device authorization: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (s *Store) PollDeviceAuthorization(deviceCode string, now int64) (storage.DeviceAuthorization, bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return storage.DeviceAuthorization{}, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var a storage.DeviceAuthorization
+	var scopes string
+	err = tx.QueryRow(s.rebind(`SELECT `+deviceColumns+` FROM device_authorizations WHERE device_code = ?`), deviceCode).
+		Scan(&a.DeviceCode, &a.UserCode, &a.ExpiresAt, &a.LastPollAt, &a.UserID, &a.Denied, &scopes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.DeviceAuthorization{}, false, nil
+	}
+	if err != nil {
+		return storage.DeviceAuthorization{}, false, fmt.Errorf("failed to poll device authorization: %w", err)
+	}
+	a.Scopes = strings.Fields(scopes)
+
+	switch {
+	case a.ExpiresAt <= now:
+		return a, true, nil
+	case a.UserID != "" || a.Denied:
+		// another replica may be redeeming the same code; only the poll
+		// that deletes it gets it
+		res, err := tx.Exec(s.rebind(`DELETE FROM device_authorizations WHERE device_code = ?`), deviceCode)
+		if err != nil {
+			return storage.DeviceAuthorization{}, false, fmt.Errorf("failed to redeem device authorization: %w", err)
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return storage.DeviceAuthorization{}, false, err
+		}
+	default:
+		if _, err := tx.Exec(s.rebind(`UPDATE device_authorizations SET last_poll_at = ? WHERE device_code = ?`), now, deviceCode); err != nil {
+			return storage.DeviceAuthorization{}, false, fmt.Errorf("failed to poll device authorization: %w", err)
+		}
+	}
+	return a, true, tx.Commit()
+}
+
+func (s *Store) DeleteExpiredDeviceAuthorizations(now int64) error {
+	if _, err := s.exec(`DELETE FROM device_authorizations WHERE expires_at <= ?`, now); err != nil {
+		return fmt.Errorf("failed to delete expired device authorizations: %w", err)
+	}
+	return nil
+}
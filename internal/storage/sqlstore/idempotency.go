@@ -0,0 +1,95 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/brk3/habits/internal/storage"
+)
+
+const idempotencyColumns = `id, user_id, fingerprint, done, status, content_type, body, expires_at`
+
+func scanIdempotencyRecord(scan func(dest ...any) error) (storage.IdempotencyRecord, error) {
+	var rec storage.IdempotencyRecord
+	var body string
+	err := scan(&rec.Key, &rec.UserID, &rec.Fingerprint, &rec.Done, &rec.Status, &rec.ContentType, &body, &rec.ExpiresAt)
+	rec.Body = []byte(body)
+	return rec, err
+}
+
+func (s *Store) ClaimIdempotencyKey(rec storage.IdempotencyRecord, now int64) (storage.IdempotencyRecord, bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return storage.IdempotencyRecord{}, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(s.rebind(`DELETE FROM idempotency_records WHERE id = ? AND expires_at <= ?`), rec.Key, now); err != nil {
+		return storage.IdempotencyRecord{}, false, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+	// another replica may claim the key at the same time; the primary key
+	// lets exactly one of them insert it
+	res, err := tx.Exec(s.rebind(`INSERT INTO idempotency_records (`+idempotencyColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO NOTHING`),
+		rec.Key, rec.UserID, rec.Fingerprint, rec.Done, rec.Status, rec.ContentType, string(rec.Body), rec.ExpiresAt)
+	if err != nil {
+		return storage.IdempotencyRecord{}, false, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return storage.IdempotencyRecord{}, false, err
+	}
+	if n == 1 {
+		return storage.IdempotencyRecord{}, true, tx.Commit()
+	}
+	prev, err := scanIdempotencyRecord(tx.QueryRow(s.rebind(`SELECT `+idempotencyColumns+` FROM idempotency_records WHERE id = ?`), rec.Key).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		// released by a request that failed since; the caller can retry
+		return storage.IdempotencyRecord{Key: rec.Key}, false, nil
+	}
+	if err != nil {
+		return storage.IdempotencyRecord{}, false, fmt.Errorf("failed to get idempotency record: %w", err)
+	}
+	return prev, false, tx.Commit()
+}
+
+func (s *Store) PutIdempotencyRecord(rec storage.IdempotencyRecord) error {
+	_, err := s.exec(`INSERT INTO idempotency_records (`+idempotencyColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			user_id = excluded.user_id,
+			fingerprint = excluded.fingerprint,
+			done = excluded.done,
+			status = excluded.status,
+			content_type = excluded.content_type,
+			body = excluded.body,
+			expires_at = excluded.expires_at`,
+		rec.Key, rec.UserID, rec.Fingerprint, rec.Done, rec.Status, rec.ContentType, string(rec.Body), rec.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to store idempotency record: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) DeleteIdempotencyRecord(key string) error {
+	if _, err := s.exec(`DELETE FROM idempotency_records WHERE id = ?`, key); err != nil {
+		return fmt.Errorf("failed to delete idempotency record: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) CountIdempotencyRecords(userID string, now int64) (int, error) {
+	var n int
+	err := s.queryRow(`SELECT COUNT(*) FROM idempotency_records WHERE user_id = ? AND expires_at > ?`, userID, now).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count idempotency records for user %s: %w", userID, err)
+	}
+	return n, nil
+}
+
+func (s *Store) DeleteExpiredIdempotencyRecords(now int64) error {
+	if _, err := s.exec(`DELETE FROM idempotency_records WHERE expires_at <= ?`, now); err != nil {
+		return fmt.Errorf("failed to delete expired idempotency records: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/brk3/habits/internal/storage"
+)
+
+const identityColumns = `id, user_id, provider_id, issuer, subject, email, created_at, last_login_at`
+
+func scanIdentity(scan func(dest ...any) error) (storage.Identity, error) {
+	var id storage.Identity
+	err := scan(&id.ID, &id.UserID, &id.ProviderID, &id.Issuer, &id.Subject, &id.Email, &id.CreatedAt, &id.LastLoginAt)
+	return id, err
+}
+
+func (s *Store) PutIdentity(id storage.Identity) error {
+	_, err := s.exec(`INSERT INTO identities (`+identityColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			user_id = excluded.user_id,
+			provider_id = excluded.provider_id,
+			issuer = excluded.issuer,
+			subject = excluded.subject,
+			email = excluded.email,
+			created_at = excluded.created_at,
+			last_login_at = excluded.last_login_at`,
+		id.ID, id.UserID, id.ProviderID, id.Issuer, id.Subject, id.Email, id.CreatedAt, id.LastLoginAt)
+	if err != nil {
+		return fmt.Errorf("failed to store identity %s: %w", id.ID, err)
+	}
+	return nil
+}
+
+func (s *Store) GetIdentity(id string) (storage.Identity, bool, error) {
+	ident, err := scanIdentity(s.queryRow(`SELECT `+identityColumns+` FROM identities WHERE id = ?`, id).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Identity{}, false, nil
+	}
+	if err != nil {
+		return storage.Identity{}, false, fmt.Errorf("failed to get identity %s: %w", id, err)
+	}
+	return ident, true, nil
+}
+
+func (s *Store) ListIdentities(userID string) ([]storage.Identity, error) {
+	rows, err := s.query(`SELECT `+identityColumns+` FROM identities WHERE user_id = ? ORDER BY created_at, id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list identities for user %s: %w", userID, err)
+	}
+	defer rows.Close()
+
+	var identities []storage.Identity
+	for rows.Next() {
+		ident, err := scanIdentity(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan identity: %w", err)
+		}
+		identities = append(identities, ident)
+	}
+	return identities, rows.Err()
+}
+
+func (s *Store) DeleteIdentity(id string) error {
+	if _, err := s.exec(`DELETE FROM identities WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete identity %s: %w", id, err)
+	}
+	return nil
+}
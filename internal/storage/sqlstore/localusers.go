@@ -0,0 +1,66 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/brk3/habits/internal/storage"
+)
+
+const localUserColumns = `username, user_id, password_hash, created_at`
+
+func scanLocalUser(scan func(dest ...any) error) (storage.LocalUser, error) {
+	var u storage.LocalUser
+	err := scan(&u.Username, &u.UserID, &u.PasswordHash, &u.CreatedAt)
+	return u, err
+}
+
+func (s *Store) PutLocalUser(u storage.LocalUser) error {
+	_, err := s.exec(`INSERT INTO local_users (`+localUserColumns+`) VALUES (?, ?, ?, ?)
+		ON CONFLICT (username) DO UPDATE SET
+			user_id = excluded.user_id,
+			password_hash = excluded.password_hash,
+			created_at = excluded.created_at`,
+		u.Username, u.UserID, u.PasswordHash, u.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to store local user %s: %w", u.Username, err)
+	}
+	return nil
+}
+
+func (s *Store) GetLocalUser(username string) (storage.LocalUser, bool, error) {
+	u, err := scanLocalUser(s.queryRow(`SELECT `+localUserColumns+` FROM local_users WHERE username = ?`, username).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.LocalUser{}, false, nil
+	}
+	if err != nil {
+		return storage.LocalUser{}, false, fmt.Errorf("failed to get local user %s: %w", username, err)
+	}
+	return u, true, nil
+}
+
+func (s *Store) ListLocalUsers() ([]storage.LocalUser, error) {
+	rows, err := s.query(`SELECT ` + localUserColumns + ` FROM local_users ORDER BY username`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list local users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []storage.LocalUser
+	for rows.Next() {
+		u, err := scanLocalUser(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan local user: %w", err)
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (s *Store) DeleteLocalUser(username string) error {
+	if _, err := s.exec(`DELETE FROM local_users WHERE username = ?`, username); err != nil {
+		return fmt.Errorf("failed to delete local user %s: %w", username, err)
+	}
+	return nil
+}
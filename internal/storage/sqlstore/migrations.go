@@ -0,0 +1,250 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/brk3/habits/internal/logger"
+	"github.com/brk3/habits/pkg/habit"
+)
+
+// migrationLockID is an arbitrary key for pg_advisory_lock so that replicas
+// starting at the same time don't race each other through the migrations.
+const migrationLockID = 7_348_221
+
+type migration struct {
+	stmt string
+	// data optionally runs after stmt in the same transaction, for row
+	// changes that can't be written portably in SQL.
+	data func(ctx context.Context, s *Store, tx *sql.Tx) error
+}
+
+// migrations are applied in order by New. Never edit or reorder an existing
+// entry; append a new one instead. Statements must be valid for both SQLite
+// and Postgres, so stick to TEXT/BIGINT/BOOLEAN/DOUBLE PRECISION column
+// types.
+var migrations = []migration{
+	{stmt: `CREATE TABLE entries (
+		user_id   TEXT   NOT NULL,
+		name      TEXT   NOT NULL,
+		timestamp BIGINT NOT NULL,
+		note      TEXT   NOT NULL DEFAULT '',
+		PRIMARY KEY (user_id, name, timestamp)
+	);
+	CREATE TABLE api_keys (
+		key_hash TEXT PRIMARY KEY,
+		user_id  TEXT NOT NULL
+	);
+	CREATE INDEX api_keys_user_id ON api_keys (user_id);
+	CREATE TABLE refresh_tokens (
+		user_id       TEXT PRIMARY KEY,
+		access_token  TEXT   NOT NULL DEFAULT '',
+		token_type    TEXT   NOT NULL DEFAULT '',
+		refresh_token TEXT   NOT NULL DEFAULT '',
+		expiry        BIGINT NOT NULL DEFAULT 0
+	);`},
+	{
+		// Entries get a stable ID so several entries in the same second no
+		// longer collide on the (user_id, name, timestamp) key. The new
+		// table is built beside the old one and renamed into place, since
+		// on Postgres a renamed table keeps its entries_pkey constraint.
+		stmt: `CREATE TABLE entries_v2 (
+			user_id   TEXT   NOT NULL,
+			id        TEXT   NOT NULL,
+			name      TEXT   NOT NULL,
+			timestamp BIGINT NOT NULL,
+			note      TEXT   NOT NULL DEFAULT '',
+			PRIMARY KEY (user_id, id)
+		);
+		CREATE INDEX entries_user_name_timestamp ON entries_v2 (user_id, name, timestamp);`,
+		data: migrateEntryIDs,
+	},
+	{stmt: `CREATE TABLE habit_definitions (
+		user_id      TEXT    NOT NULL,
+		name         TEXT    NOT NULL,
+		display_name TEXT    NOT NULL DEFAULT '',
+		description  TEXT    NOT NULL DEFAULT '',
+		color        TEXT    NOT NULL DEFAULT '',
+		icon         TEXT    NOT NULL DEFAULT '',
+		created_at   BIGINT  NOT NULL,
+		archived     BOOLEAN NOT NULL DEFAULT FALSE,
+		PRIMARY KEY (user_id, name)
+	);
+	INSERT INTO habit_definitions (user_id, name, created_at)
+		SELECT user_id, name, MIN(timestamp) FROM entries GROUP BY user_id, name;`},
+	// schedule holds a JSON encoded habit.Schedule, empty for daily habits.
+	{stmt: `ALTER TABLE habit_definitions ADD COLUMN schedule TEXT NOT NULL DEFAULT ''`},
+	{stmt: `ALTER TABLE entries ADD COLUMN value DOUBLE PRECISION NOT NULL DEFAULT 0;
+	ALTER TABLE entries ADD COLUMN unit TEXT NOT NULL DEFAULT '';
+	ALTER TABLE habit_definitions ADD COLUMN target TEXT NOT NULL DEFAULT '';`},
+	{stmt: `CREATE TABLE user_settings (
+		user_id  TEXT PRIMARY KEY,
+		timezone TEXT NOT NULL DEFAULT ''
+	);`},
+	// Existing keys get every scope so they keep working as before.
+	{stmt: `ALTER TABLE api_keys ADD COLUMN name TEXT NOT NULL DEFAULT '';
+	ALTER TABLE api_keys ADD COLUMN created_at BIGINT NOT NULL DEFAULT 0;
+	ALTER TABLE api_keys ADD COLUMN expires_at BIGINT NOT NULL DEFAULT 0;
+	ALTER TABLE api_keys ADD COLUMN last_used_at BIGINT NOT NULL DEFAULT 0;
+	ALTER TABLE api_keys ADD COLUMN scopes TEXT NOT NULL DEFAULT '';
+	UPDATE api_keys SET scopes = 'habits:read habits:write admin';`},
+	{stmt: `CREATE TABLE sessions (
+		id           TEXT PRIMARY KEY,
+		user_id      TEXT   NOT NULL,
+		provider_id  TEXT   NOT NULL,
+		id_token     TEXT   NOT NULL,
+		created_at   BIGINT NOT NULL,
+		last_seen_at BIGINT NOT NULL,
+		expires_at   BIGINT NOT NULL,
+		user_agent   TEXT   NOT NULL DEFAULT '',
+		ip_address   TEXT   NOT NULL DEFAULT ''
+	);
+	CREATE INDEX sessions_user_id ON sessions (user_id);
+	CREATE INDEX sessions_expires_at ON sessions (expires_at);`},
+	{stmt: `CREATE TABLE local_users (
+		username      TEXT PRIMARY KEY,
+		user_id       TEXT   NOT NULL,
+		password_hash TEXT   NOT NULL,
+		created_at    BIGINT NOT NULL
+	);`},
+	{stmt: `CREATE TABLE accounts (
+		user_id       TEXT PRIMARY KEY,
+		email         TEXT    NOT NULL DEFAULT '',
+		name          TEXT    NOT NULL DEFAULT '',
+		admin         BOOLEAN NOT NULL DEFAULT FALSE,
+		disabled      BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at    BIGINT  NOT NULL,
+		last_login_at BIGINT  NOT NULL DEFAULT 0
+	);`},
+	{stmt: `CREATE TABLE identities (
+		id            TEXT PRIMARY KEY,
+		user_id       TEXT   NOT NULL,
+		provider_id   TEXT   NOT NULL,
+		issuer        TEXT   NOT NULL,
+		subject       TEXT   NOT NULL,
+		email         TEXT   NOT NULL DEFAULT '',
+		created_at    BIGINT NOT NULL,
+		last_login_at BIGINT NOT NULL DEFAULT 0
+	);
+	CREATE INDEX identities_user_id ON identities (user_id);`},
+	// body holds the response as text; responses are JSON.
+	{stmt: `CREATE TABLE idempotency_records (
+		id           TEXT PRIMARY KEY,
+		user_id      TEXT    NOT NULL,
+		fingerprint  TEXT    NOT NULL,
+		done         BOOLEAN NOT NULL DEFAULT FALSE,
+		status       BIGINT  NOT NULL DEFAULT 0,
+		content_type TEXT    NOT NULL DEFAULT '',
+		body         TEXT    NOT NULL DEFAULT '',
+		expires_at   BIGINT  NOT NULL
+	);
+	CREATE INDEX idempotency_records_user_id ON idempotency_records (user_id);
+	CREATE INDEX idempotency_records_expires_at ON idempotency_records (expires_at);`},
+	{stmt: `CREATE TABLE device_authorizations (
+		device_code  TEXT PRIMARY KEY,
+		user_code    TEXT    NOT NULL UNIQUE,
+		expires_at   BIGINT  NOT NULL,
+		last_poll_at BIGINT  NOT NULL DEFAULT 0,
+		user_id      TEXT    NOT NULL DEFAULT '',
+		denied       BOOLEAN NOT NULL DEFAULT FALSE,
+		scopes       TEXT    NOT NULL DEFAULT ''
+	);
+	CREATE INDEX device_authorizations_user_id ON device_authorizations (user_id);`},
+}
+
+func (s *Store) migrate(ctx context.Context) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection for migrations: %w", err)
+	}
+	defer conn.Close()
+
+	if s.dialect == Postgres {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+			return fmt.Errorf("failed to take migration lock: %w", err)
+		}
+		defer func() {
+			if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockID); err != nil {
+				logger.Warn("Failed to release migration lock", "error", err)
+			}
+		}()
+	}
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at BIGINT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	var current int
+	if err := conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		logger.Info("Applying SQL migration", "dialect", s.dialect, "version", version)
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, migrations[i].stmt); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", version, err)
+		}
+		if migrations[i].data != nil {
+			if err := migrations[i].data(ctx, s, tx); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %d failed: %w", version, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`),
+			version, time.Now().Unix()); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", version, err)
+		}
+	}
+	return nil
+}
+
+func migrateEntryIDs(ctx context.Context, s *Store, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `SELECT user_id, name, timestamp, note FROM entries`)
+	if err != nil {
+		return err
+	}
+	type row struct {
+		userID string
+		h      habit.Habit
+	}
+	var old []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.userID, &r.h.Name, &r.h.TimeStamp, &r.h.Note); err != nil {
+			rows.Close()
+			return err
+		}
+		old = append(old, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	insert := s.rebind(`INSERT INTO entries_v2 (user_id, id, name, timestamp, note) VALUES (?, ?, ?, ?, ?)`)
+	for _, r := range old {
+		if _, err := tx.ExecContext(ctx, insert, r.userID, habit.NewID(r.h.TimeStamp), r.h.Name, r.h.TimeStamp, r.h.Note); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DROP TABLE entries`); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `ALTER TABLE entries_v2 RENAME TO entries`)
+	return err
+}
@@ -0,0 +1,185 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/brk3/habits/internal/logger"
+	"github.com/brk3/habits/internal/storage"
+)
+
+const sessionColumns = `id, user_id, provider_id, id_token, created_at, last_seen_at, expires_at, user_agent, ip_address`
+
+func scanSession(scan func(dest ...any) error) (storage.Session, error) {
+	var sess storage.Session
+	err := scan(&sess.ID, &sess.UserID, &sess.ProviderID, &sess.IDToken,
+		&sess.CreatedAt, &sess.LastSeenAt, &sess.ExpiresAt, &sess.UserAgent, &sess.IPAddress)
+	return sess, err
+}
+
+func (s *Store) PutSession(sess storage.Session) error {
+	sess, err := s.cipher.EncryptSession(sess)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt session: %w", err)
+	}
+	_, err = s.exec(`INSERT INTO sessions (`+sessionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sess.ID, sess.UserID, sess.ProviderID, sess.IDToken,
+		sess.CreatedAt, sess.LastSeenAt, sess.ExpiresAt, sess.UserAgent, sess.IPAddress)
+	if err != nil {
+		return fmt.Errorf("failed to store session: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) UpdateSession(sess storage.Session) error {
+	sess, err := s.cipher.EncryptSession(sess)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt session: %w", err)
+	}
+	res, err := s.exec(`UPDATE sessions SET id_token = ?, last_seen_at = ?, expires_at = ? WHERE id = ?`,
+		sess.IDToken, sess.LastSeenAt, sess.ExpiresAt, sess.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) GetSession(id string) (storage.Session, bool, error) {
+	sess, err := scanSession(s.queryRow(`SELECT `+sessionColumns+` FROM sessions WHERE id = ?`, id).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Session{}, false, nil
+	}
+	if err != nil {
+		return storage.Session{}, false, fmt.Errorf("failed to get session: %w", err)
+	}
+	sess, err = s.cipher.DecryptSession(sess)
+	if err != nil {
+		return storage.Session{}, false, fmt.Errorf("failed to decrypt session: %w", err)
+	}
+	return sess, true, nil
+}
+
+func (s *Store) ListSessions(userID string) ([]storage.Session, error) {
+	rows, err := s.query(`SELECT `+sessionColumns+` FROM sessions WHERE user_id = ? ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions for user %s: %w", userID, err)
+	}
+	defer rows.Close()
+
+	var sessions []storage.Session
+	for rows.Next() {
+		sess, err := scanSession(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sess, err = s.cipher.DecryptSession(sess)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt session: %w", err)
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *Store) DeleteSession(id string) error {
+	if _, err := s.exec(`DELETE FROM sessions WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) DeleteUserSessions(userID string) error {
+	if _, err := s.exec(`DELETE FROM sessions WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete sessions for user %s: %w", userID, err)
+	}
+	return nil
+}
+
+func (s *Store) DeleteExpiredSessions(now int64) error {
+	if _, err := s.exec(`DELETE FROM sessions WHERE expires_at <= ?`, now); err != nil {
+		return fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+	return nil
+}
+
+// reencryptSessions rewrites the sessions whose ID token is stale, the same
+// way reencryptRefreshTokens does refresh tokens.
+func (s *Store) reencryptSessions(purge bool) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT ` + sessionColumns + ` FROM sessions`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	var stale []storage.Session
+	for rows.Next() {
+		sess, err := scanSession(rows.Scan)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan session: %w", err)
+		}
+		if s.cipher.Stale(sess.IDToken) {
+			stale = append(stale, sess)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	var sealed []storage.Session
+	var lost []string
+	for _, sess := range stale {
+		plain, err := s.cipher.DecryptSession(sess)
+		if err != nil {
+			logger.Warn("Session can't be decrypted", "user_id", sess.UserID, "error", err)
+			lost = append(lost, sess.ID)
+			continue
+		}
+		if purge {
+			continue
+		}
+		sess, err := s.cipher.EncryptSession(plain)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encrypt session: %w", err)
+		}
+		sealed = append(sealed, sess)
+	}
+
+	if purge {
+		for _, id := range lost {
+			if _, err := tx.Exec(s.rebind(`DELETE FROM sessions WHERE id = ?`), id); err != nil {
+				return 0, fmt.Errorf("failed to delete session: %w", err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, fmt.Errorf("failed to purge sessions: %w", err)
+		}
+		return len(lost), nil
+	}
+	if len(lost) > 0 {
+		return 0, fmt.Errorf("failed to re-encrypt sessions: %d sessions can't be decrypted with the configured keys: %w",
+			len(lost), storage.ErrUndecryptable)
+	}
+	for _, sess := range sealed {
+		if _, err := tx.Exec(s.rebind(`UPDATE sessions SET id_token = ? WHERE id = ?`), sess.IDToken, sess.ID); err != nil {
+			return 0, fmt.Errorf("failed to update session: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to re-encrypt sessions: %w", err)
+	}
+	return len(sealed), nil
+}
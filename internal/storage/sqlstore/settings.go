@@ -0,0 +1,32 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/brk3/habits/pkg/habit"
+)
+
+func (s *Store) GetUserSettings(userID string) (habit.UserSettings, error) {
+	var settings habit.UserSettings
+	err := s.queryRow(`SELECT timezone FROM user_settings WHERE user_id = ?`, userID).
+		Scan(&settings.Timezone)
+	if errors.Is(err, sql.ErrNoRows) {
+		return habit.UserSettings{}, nil
+	}
+	if err != nil {
+		return habit.UserSettings{}, fmt.Errorf("failed to get settings for user %s: %w", userID, err)
+	}
+	return settings, nil
+}
+
+func (s *Store) PutUserSettings(userID string, settings habit.UserSettings) error {
+	_, err := s.exec(`INSERT INTO user_settings (user_id, timezone) VALUES (?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET timezone = excluded.timezone`,
+		userID, settings.Timezone)
+	if err != nil {
+		return fmt.Errorf("failed to store settings for user %s: %w", userID, err)
+	}
+	return nil
+}
@@ -0,0 +1,537 @@
+// Package sqlstore implements storage.Store on top of database/sql. It is
+// shared by the sqlite and postgres backends, which only differ in driver,
+// placeholder syntax and how migrations are serialised.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brk3/habits/internal/logger"
+	"github.com/brk3/habits/internal/storage"
+	"github.com/brk3/habits/pkg/habit"
+	"golang.org/x/oauth2"
+)
+
+type Dialect int
+
+const (
+	SQLite Dialect = iota
+	Postgres
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case SQLite:
+		return "sqlite"
+	case Postgres:
+		return "postgres"
+	default:
+		return "unknown"
+	}
+}
+
+type Store struct {
+	db      *sql.DB
+	dialect Dialect
+	cipher  *storage.Cipher
+}
+
+// New wraps an open database handle and brings its schema up to date.
+// The Store takes ownership of db and closes it in Close.
+func New(db *sql.DB, dialect Dialect) (*Store, error) {
+	s := &Store{db: db, dialect: dialect}
+	if err := s.migrate(context.Background()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// rebind rewrites ? placeholders into the $N form Postgres expects. Queries
+// in this package never contain a literal question mark.
+func (s *Store) rebind(query string) string {
+	if s.dialect != Postgres {
+		return query
+	}
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *Store) exec(query string, args ...any) (sql.Result, error) {
+	return s.db.Exec(s.rebind(query), args...)
+}
+
+func (s *Store) query(query string, args ...any) (*sql.Rows, error) {
+	return s.db.Query(s.rebind(query), args...)
+}
+
+func (s *Store) queryRow(query string, args ...any) *sql.Row {
+	return s.db.QueryRow(s.rebind(query), args...)
+}
+
+func (s *Store) Close() error {
+	logger.Debug("Closing database")
+	if err := s.db.Close(); err != nil {
+		logger.Error("Failed to close database", "error", err)
+		return fmt.Errorf("failed to close database: %w", err)
+	}
+	logger.Debug("database closed successfully")
+	return nil
+}
+
+const entryColumns = `id, name, note, timestamp, value, unit`
+
+func scanEntry(row interface{ Scan(...any) error }) (habit.Habit, error) {
+	var e habit.Habit
+	err := row.Scan(&e.ID, &e.Name, &e.Note, &e.TimeStamp, &e.Value, &e.Unit)
+	return e, err
+}
+
+func (s *Store) PutHabit(userID string, h habit.Habit) error {
+	return s.PutHabits(userID, []habit.Habit{h})
+}
+
+func (s *Store) PutHabits(userID string, entries []habit.Habit) error {
+	logger.Debug("Storing habits", "user_id", userID, "count", len(entries))
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for i := range entries {
+		h := &entries[i]
+		if h.ID == "" {
+			h.ID = habit.NewID(h.TimeStamp)
+		}
+		if _, err := tx.Exec(s.rebind(`INSERT INTO entries (user_id, `+entryColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (user_id, id) DO UPDATE SET
+				name = excluded.name,
+				note = excluded.note,
+				timestamp = excluded.timestamp,
+				value = excluded.value,
+				unit = excluded.unit`),
+			userID, h.ID, h.Name, h.Note, h.TimeStamp, h.Value, h.Unit); err != nil {
+			return fmt.Errorf("failed to store habit %s: %w", h.Name, err)
+		}
+		if _, err := tx.Exec(s.rebind(`INSERT INTO habit_definitions (user_id, name, created_at) VALUES (?, ?, ?)
+			ON CONFLICT (user_id, name) DO NOTHING`),
+			userID, h.Name, h.TimeStamp); err != nil {
+			return fmt.Errorf("failed to create definition for habit %s: %w", h.Name, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ImportHabits is PutHabits, as entries are upserted by ID whatever their
+// timestamp.
+func (s *Store) ImportHabits(userID string, entries []habit.Habit) error {
+	return s.PutHabits(userID, entries)
+}
+
+func (s *Store) ListHabitNames(userID string) ([]string, error) {
+	rows, err := s.query(`SELECT name FROM habit_definitions WHERE user_id = ? ORDER BY name`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list habit names for user %s: %w", userID, err)
+	}
+	defer rows.Close()
+
+	out := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan habit name: %w", err)
+		}
+		out = append(out, name)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) GetHabit(userID, name string) ([]habit.Habit, error) {
+	rows, err := s.query(`SELECT `+entryColumns+` FROM entries
+		WHERE user_id = ? AND name = ? ORDER BY timestamp, id`, userID, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get habit %s for user %s: %w", name, userID, err)
+	}
+	defer rows.Close()
+
+	var out []habit.Habit
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan habit entry for %s: %w", name, err)
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) GetHabitRange(userID, name string, q storage.EntryQuery) ([]habit.Habit, string, error) {
+	query := `SELECT ` + entryColumns + ` FROM entries WHERE user_id = ? AND name = ?`
+	args := []any{userID, name}
+	if q.From != 0 {
+		query += ` AND timestamp >= ?`
+		args = append(args, q.From)
+	}
+	if q.To != 0 {
+		query += ` AND timestamp < ?`
+		args = append(args, q.To)
+	}
+	if q.Cursor != "" {
+		ts, id, err := storage.DecodeCursor(q.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query += ` AND (timestamp > ? OR (timestamp = ? AND id > ?))`
+		args = append(args, ts, ts, id)
+	}
+	query += ` ORDER BY timestamp, id`
+	if q.Limit > 0 {
+		// fetch one extra row to learn whether there is a next page
+		query += ` LIMIT ?`
+		args = append(args, q.Limit+1)
+	}
+
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get habit range %s for user %s: %w", name, userID, err)
+	}
+	defer rows.Close()
+
+	var out []habit.Habit
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to scan habit entry for %s: %w", name, err)
+		}
+		out = append(out, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[:q.Limit]
+		last := out[len(out)-1]
+		next = storage.EncodeCursor(last.TimeStamp, last.ID)
+	}
+	return out, next, nil
+}
+
+func (s *Store) DeleteHabit(userID, name string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(s.rebind(`DELETE FROM entries WHERE user_id = ? AND name = ?`), userID, name); err != nil {
+		return fmt.Errorf("failed to delete habit %s: %w", name, err)
+	}
+	if _, err := tx.Exec(s.rebind(`DELETE FROM habit_definitions WHERE user_id = ? AND name = ?`), userID, name); err != nil {
+		return fmt.Errorf("failed to delete definition for habit %s: %w", name, err)
+	}
+	return tx.Commit()
+}
+
+func (s *Store) GetHabitEntry(userID, name, id string) (habit.Habit, bool, error) {
+	e, err := scanEntry(s.queryRow(`SELECT `+entryColumns+` FROM entries
+		WHERE user_id = ? AND name = ? AND id = ?`, userID, name, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return habit.Habit{}, false, nil
+	}
+	if err != nil {
+		return habit.Habit{}, false, fmt.Errorf("failed to get habit entry %s: %w", id, err)
+	}
+	return e, true, nil
+}
+
+func (s *Store) UpdateHabitEntry(userID, name string, e habit.Habit) error {
+	res, err := s.exec(`UPDATE entries SET timestamp = ?, note = ?, value = ?, unit = ?
+		WHERE user_id = ? AND name = ? AND id = ?`,
+		e.TimeStamp, e.Note, e.Value, e.Unit, userID, name, e.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update habit entry %s: %w", e.ID, err)
+	}
+	return requireAffected(res)
+}
+
+func (s *Store) DeleteHabitEntry(userID, name, id string) error {
+	res, err := s.exec(`DELETE FROM entries WHERE user_id = ? AND name = ? AND id = ?`, userID, name, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete habit entry %s: %w", id, err)
+	}
+	return requireAffected(res)
+}
+
+// requireAffected maps a write that touched no rows to storage.ErrNotFound.
+func requireAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+// Scopes are stored space separated, as in an OAuth scope parameter.
+const apiKeyColumns = `key_hash, user_id, name, created_at, expires_at, last_used_at, scopes`
+
+func (s *Store) PutAPIKey(key storage.APIKey) error {
+	_, err := s.exec(`INSERT INTO api_keys (`+apiKeyColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (key_hash) DO UPDATE SET
+			user_id = excluded.user_id,
+			name = excluded.name,
+			created_at = excluded.created_at,
+			expires_at = excluded.expires_at,
+			last_used_at = excluded.last_used_at,
+			scopes = excluded.scopes`,
+		key.Hash, key.UserID, key.Name, key.CreatedAt, key.ExpiresAt, key.LastUsedAt, strings.Join(key.Scopes, " "))
+	if err != nil {
+		return fmt.Errorf("failed to store API key: %w", err)
+	}
+	return nil
+}
+
+func scanAPIKey(scan func(dest ...any) error) (storage.APIKey, error) {
+	var key storage.APIKey
+	var scopes string
+	if err := scan(&key.Hash, &key.UserID, &key.Name, &key.CreatedAt, &key.ExpiresAt, &key.LastUsedAt, &scopes); err != nil {
+		return storage.APIKey{}, err
+	}
+	key.Scopes = strings.Fields(scopes)
+	return key, nil
+}
+
+func (s *Store) GetAPIKey(keyHash string) (storage.APIKey, bool, error) {
+	key, err := scanAPIKey(s.queryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = ?`, keyHash).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.APIKey{}, false, nil
+	}
+	if err != nil {
+		return storage.APIKey{}, false, fmt.Errorf("failed to get API key: %w", err)
+	}
+	return key, true, nil
+}
+
+func (s *Store) ListAPIKeys(userID string) ([]storage.APIKey, error) {
+	rows, err := s.query(`SELECT `+apiKeyColumns+` FROM api_keys WHERE user_id = ? ORDER BY created_at, key_hash`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []storage.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (s *Store) TouchAPIKey(keyHash string, lastUsedAt int64) error {
+	if _, err := s.exec(`UPDATE api_keys SET last_used_at = ? WHERE key_hash = ?`, lastUsedAt, keyHash); err != nil {
+		return fmt.Errorf("failed to touch API key: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) DeleteAPIKey(keyHash string) error {
+	if _, err := s.exec(`DELETE FROM api_keys WHERE key_hash = ?`, keyHash); err != nil {
+		return fmt.Errorf("failed to delete API key: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) PutRefreshToken(userID string, token *oauth2.Token) error {
+	var expiry int64
+	if !token.Expiry.IsZero() {
+		expiry = token.Expiry.Unix()
+	}
+	token, err := s.cipher.EncryptToken(userID, token)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt refresh token: %w", err)
+	}
+	_, err = s.exec(`INSERT INTO refresh_tokens (user_id, access_token, token_type, refresh_token, expiry)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			access_token = excluded.access_token,
+			token_type = excluded.token_type,
+			refresh_token = excluded.refresh_token,
+			expiry = excluded.expiry`,
+		userID, token.AccessToken, token.TokenType, token.RefreshToken, expiry)
+	if err != nil {
+		return fmt.Errorf("failed to store refresh token: %w", err)
+	}
+	logger.Debug("Refresh token stored", "userID", userID)
+	return nil
+}
+
+func (s *Store) GetRefreshToken(userID string) (*oauth2.Token, bool, error) {
+	token := &oauth2.Token{}
+	var expiry int64
+	err := s.queryRow(`SELECT access_token, token_type, refresh_token, expiry
+		FROM refresh_tokens WHERE user_id = ?`, userID).
+		Scan(&token.AccessToken, &token.TokenType, &token.RefreshToken, &expiry)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	if expiry != 0 {
+		token.Expiry = time.Unix(expiry, 0)
+	}
+	token, err = s.cipher.DecryptToken(userID, token)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decrypt refresh token for %s: %w", userID, err)
+	}
+	return token, true, nil
+}
+
+func (s *Store) DeleteRefreshToken(userID string) error {
+	if _, err := s.exec(`DELETE FROM refresh_tokens WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete refresh token: %w", err)
+	}
+	return nil
+}
+
+// SetCipher makes the store encrypt refresh tokens and session ID tokens.
+// Tokens written before are still read, and rewritten by ReencryptSecrets.
+func (s *Store) SetCipher(c *storage.Cipher) {
+	s.cipher = c
+}
+
+func (s *Store) ReencryptSecrets() (int, error) {
+	return s.reencrypt(false)
+}
+
+func (s *Store) PurgeUndecryptableSecrets() (int, error) {
+	return s.reencrypt(true)
+}
+
+func (s *Store) reencrypt(purge bool) (int, error) {
+	if s.cipher == nil {
+		return 0, nil
+	}
+	tokens, err := s.reencryptRefreshTokens(purge)
+	if err != nil {
+		return 0, err
+	}
+	sessions, err := s.reencryptSessions(purge)
+	if err != nil {
+		return 0, err
+	}
+	return tokens + sessions, nil
+}
+
+// reencryptRefreshTokens rewrites the stale refresh tokens. Tokens that
+// can't be decrypted fail the whole run unless purge is set, in which case
+// they are deleted instead and only those are counted.
+func (s *Store) reencryptRefreshTokens(purge bool) (int, error) {
+	if s.cipher == nil {
+		return 0, nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT user_id, access_token, refresh_token FROM refresh_tokens`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list refresh tokens: %w", err)
+	}
+	type row struct {
+		id    string
+		token *oauth2.Token
+	}
+	var stale []row
+	for rows.Next() {
+		r := row{token: &oauth2.Token{}}
+		if err := rows.Scan(&r.id, &r.token.AccessToken, &r.token.RefreshToken); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan refresh token: %w", err)
+		}
+		if s.cipher.StaleToken(r.token) {
+			stale = append(stale, r)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to list refresh tokens: %w", err)
+	}
+
+	var sealed []row
+	var lost []string
+	for _, r := range stale {
+		plain, err := s.cipher.DecryptToken(r.id, r.token)
+		if err != nil {
+			logger.Warn("Refresh token can't be decrypted", "id", r.id, "error", err)
+			lost = append(lost, r.id)
+			continue
+		}
+		if purge {
+			continue
+		}
+		token, err := s.cipher.EncryptToken(r.id, plain)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encrypt refresh token for %s: %w", r.id, err)
+		}
+		sealed = append(sealed, row{r.id, token})
+	}
+
+	if purge {
+		for _, id := range lost {
+			if _, err := tx.Exec(s.rebind(`DELETE FROM refresh_tokens WHERE user_id = ?`), id); err != nil {
+				return 0, fmt.Errorf("failed to delete refresh token for %s: %w", id, err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, fmt.Errorf("failed to purge refresh tokens: %w", err)
+		}
+		return len(lost), nil
+	}
+	if len(lost) > 0 {
+		return 0, fmt.Errorf("failed to re-encrypt refresh tokens: %d refresh tokens can't be decrypted with the configured keys: %w",
+			len(lost), storage.ErrUndecryptable)
+	}
+	for _, r := range sealed {
+		_, err = tx.Exec(s.rebind(`UPDATE refresh_tokens SET access_token = ?, refresh_token = ? WHERE user_id = ?`),
+			r.token.AccessToken, r.token.RefreshToken, r.id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update refresh token for %s: %w", r.id, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to re-encrypt refresh tokens: %w", err)
+	}
+	return len(sealed), nil
+}
+
+var (
+	_ storage.Store     = (*Store)(nil)
+	_ storage.Encrypter = (*Store)(nil)
+)
@@ -1,24 +1,143 @@
 package storage
 
 import (
+	"errors"
+	"io"
+
 	"github.com/brk3/habits/pkg/habit"
 	"golang.org/x/oauth2"
 )
 
+// ErrNotFound is returned when a write targets a record that does not exist.
+var ErrNotFound = errors.New("not found")
+
 type Store interface {
+	// PutHabit stores an entry, creating a default definition for the habit
+	// if it doesn't have one yet.
 	PutHabit(userID string, e habit.Habit) error
+	// PutHabits stores a batch of entries in a single transaction, so either
+	// all of them are written or none are. Entries without an ID are
+	// assigned one in place.
+	PutHabits(userID string, entries []habit.Habit) error
+	// ImportHabits stores entries like PutHabits, for entries that may
+	// already be stored with another timestamp, such as those from an
+	// export, and replaces those. Some stores have to look that up for each
+	// entry, so PutHabits, which is given new entries, doesn't.
+	ImportHabits(userID string, entries []habit.Habit) error
 	ListHabitNames(userID string) ([]string, error)
 	GetHabit(userID, name string) ([]habit.Habit, error)
+	// DeleteHabit removes a habit's entries and its definition.
 	DeleteHabit(userID, name string) error
+	// GetHabitRange returns one page of entries matching q and a cursor for
+	// the next page, which is empty once there are no more entries.
+	GetHabitRange(userID, name string, q EntryQuery) ([]habit.Habit, string, error)
+
+	GetHabitEntry(userID, name, id string) (habit.Habit, bool, error)
+	// UpdateHabitEntry replaces the entry with e.ID, returning ErrNotFound if
+	// the habit has no such entry.
+	UpdateHabitEntry(userID, name string, e habit.Habit) error
+	DeleteHabitEntry(userID, name, id string) error
+
+	PutHabitDefinition(userID string, d habit.HabitDefinition) error
+	GetHabitDefinition(userID, name string) (habit.HabitDefinition, bool, error)
+	ListHabitDefinitions(userID string) ([]habit.HabitDefinition, error)
+	DeleteHabitDefinition(userID, name string) error
 
-	PutAPIKey(keyHash, userID string) error
-	GetAPIKey(keyHash string) (userID string, found bool, err error)
-	ListAPIKeyHashes(userID string) ([]string, error)
+	// GetUserSettings returns the zero value for users that never saved any.
+	GetUserSettings(userID string) (habit.UserSettings, error)
+	PutUserSettings(userID string, settings habit.UserSettings) error
+
+	// PutAPIKey stores key under key.Hash, replacing any key with that hash.
+	PutAPIKey(key APIKey) error
+	GetAPIKey(keyHash string) (APIKey, bool, error)
+	ListAPIKeys(userID string) ([]APIKey, error)
+	// TouchAPIKey records when a key was last used. Touching a key that
+	// was deleted is not an error.
+	TouchAPIKey(keyHash string, lastUsedAt int64) error
 	DeleteAPIKey(keyHash string) error
 
+	PutSession(sess Session) error
+	// UpdateSession saves a session's new ID token and timestamps. It
+	// returns ErrNotFound if the session was deleted, so a request racing a
+	// revocation can't bring it back.
+	UpdateSession(sess Session) error
+	GetSession(id string) (Session, bool, error)
+	ListSessions(userID string) ([]Session, error)
+	DeleteSession(id string) error
+	// DeleteUserSessions logs a user out everywhere.
+	DeleteUserSessions(userID string) error
+	// DeleteExpiredSessions removes sessions that expired at or before now.
+	DeleteExpiredSessions(now int64) error
+
+	// ClaimIdempotencyKey stores rec unless a record with its key that
+	// expires after now exists, in which case that record is returned and
+	// claimed is false.
+	ClaimIdempotencyKey(rec IdempotencyRecord, now int64) (prev IdempotencyRecord, claimed bool, err error)
+	// PutIdempotencyRecord replaces the record under rec.Key.
+	PutIdempotencyRecord(rec IdempotencyRecord) error
+	DeleteIdempotencyRecord(key string) error
+	// CountIdempotencyRecords counts a user's records that expire after now.
+	CountIdempotencyRecords(userID string, now int64) (int, error)
+	// DeleteExpiredIdempotencyRecords removes records that expired at or
+	// before now.
+	DeleteExpiredIdempotencyRecords(now int64) error
+
+	// CreateDeviceAuthorization stores a unless an authorization with its
+	// user code exists, reporting whether it was stored.
+	CreateDeviceAuthorization(a DeviceAuthorization) (bool, error)
+	// DecideDeviceAuthorization records a user's answer for the undecided
+	// authorization with userCode that expires after now, reporting whether
+	// there was one.
+	DecideDeviceAuthorization(userCode, userID string, scopes []string, approve bool, now int64) (bool, error)
+	// PollDeviceAuthorization returns the authorization with deviceCode as
+	// it was before the poll, recording now as its last poll. Unless it
+	// expired, a decided authorization is deleted, so that only one poll
+	// can redeem it.
+	PollDeviceAuthorization(deviceCode string, now int64) (a DeviceAuthorization, found bool, err error)
+	// DeleteExpiredDeviceAuthorizations removes authorizations that expired
+	// at or before now.
+	DeleteExpiredDeviceAuthorizations(now int64) error
+
+	// PutLocalUser stores u under u.Username, replacing any user with that
+	// name.
+	PutLocalUser(u LocalUser) error
+	GetLocalUser(username string) (LocalUser, bool, error)
+	ListLocalUsers() ([]LocalUser, error)
+	DeleteLocalUser(username string) error
+
+	// Refresh tokens are stored by identity ID, which is the user ID for
+	// users without linked identities.
 	PutRefreshToken(userID string, token *oauth2.Token) error
 	GetRefreshToken(userID string) (*oauth2.Token, bool, error)
 	DeleteRefreshToken(userID string) error
 
+	// PutIdentity stores id under id.ID, replacing any identity with that ID.
+	PutIdentity(id Identity) error
+	GetIdentity(id string) (Identity, bool, error)
+	ListIdentities(userID string) ([]Identity, error)
+	DeleteIdentity(id string) error
+
+	PutAccount(a Account) error
+	GetAccount(userID string) (Account, bool, error)
+	ListAccounts() ([]Account, error)
+	// ListUserStats summarises every user with habits, whether or not they
+	// have an account.
+	ListUserStats() ([]UserStats, error)
+	// DeleteUser removes everything stored for a user: habits, settings,
+	// API keys, sessions, identities and their refresh tokens, idempotency
+	// records, approved device logins, local login and account.
+	DeleteUser(userID string) error
+	// MergeUser moves everything stored for fromUserID to toUserID in one
+	// transaction and deletes fromUserID's account. Where both have a
+	// habit definition or settings, toUserID's are kept; entries are all
+	// moved.
+	MergeUser(fromUserID, toUserID string) error
+
 	Close() error
 }
+
+// Backupper is implemented by stores that can write a consistent snapshot of
+// their whole database while serving requests.
+type Backupper interface {
+	Backup(w io.Writer) (int64, error)
+}
@@ -0,0 +1,40 @@
+package habit
+
+// ExportVersion is the version of the Export format written by this build.
+// It is bumped whenever a change would stop an older build from reading an
+// export correctly; adding optional fields does not bump it.
+const ExportVersion = 1
+
+// Export is the portable JSON form of everything stored for one user, as
+// returned by GET /export and accepted by POST /import:
+//
+//	{
+//	  "version": 1,
+//	  "exported_at": 1735689600,
+//	  "settings": {"timezone": "Europe/Dublin"},
+//	  "habits": [
+//	    {
+//	      "definition": {"name": "guitar", "display_name": "Guitar", "created_at": 1704067200, "archived": false},
+//	      "entries": [
+//	        {"id": "01HN...", "name": "guitar", "note": "scales", "timestamp": 1704067200, "value": 30, "unit": "min"}
+//	      ]
+//	    }
+//	  ]
+//	}
+//
+// Exports carry no user ID, so they can be imported into any account,
+// including the anonymous user of a server with auth disabled. Entries keep
+// their IDs, which makes importing the same file twice a no-op.
+type Export struct {
+	Version    int             `json:"version"`
+	ExportedAt int64           `json:"exported_at"`
+	Settings   UserSettings    `json:"settings"`
+	Habits     []ExportedHabit `json:"habits"`
+}
+
+// ExportedHabit is a habit's definition with all of its entries, oldest
+// first. Entry names always match Definition.Name.
+type ExportedHabit struct {
+	Definition HabitDefinition `json:"definition"`
+	Entries    []Habit         `json:"entries"`
+}
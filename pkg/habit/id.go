@@ -0,0 +1,19 @@
+package habit
+
+import (
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// NewID returns a unique entry ID for an entry logged at ts (Unix seconds).
+// IDs are ULIDs carrying the entry time, so they sort chronologically.
+func NewID(ts int64) string {
+	return ulid.MustNew(ulid.Timestamp(time.Unix(ts, 0)), ulid.DefaultEntropy()).String()
+}
+
+// ValidID reports whether id is a well-formed entry ID.
+func ValidID(id string) bool {
+	_, err := ulid.ParseStrict(id)
+	return err == nil
+}
@@ -0,0 +1,138 @@
+package habit
+
+import (
+	"slices"
+	"time"
+)
+
+const daySec = 24 * 60 * 60
+
+// Day converts a Unix timestamp (seconds since 1970) into a "day index".
+// A day index is the number of days between 1970-01-01 and the calendar
+// date of ts in loc, making it easy to compare days and detect consecutive
+// streaks in the user's own timezone.
+func Day(ts int64, loc *time.Location) int64 {
+	y, m, d := time.Unix(ts, 0).In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / daySec
+}
+
+// DayStart returns the Unix time at which a day index begins in loc.
+func DayStart(day int64, loc *time.Location) int64 {
+	y, m, d := time.Unix(day*daySec, 0).UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc).Unix()
+}
+
+// SchedulePeriods splits days into the periods of a schedule. Periods are
+// numbered so that consecutive periods differ by one.
+type SchedulePeriods struct {
+	// of returns the period a day index falls in, or false for days outside
+	// every period, such as unscheduled weekdays.
+	of func(day int64) (int64, bool)
+	// Target is the number of distinct days needed to satisfy a period.
+	Target int
+	Unit   string
+}
+
+func NewSchedulePeriods(sched Schedule) SchedulePeriods {
+	switch sched.Frequency {
+	case FrequencyWeekly:
+		return SchedulePeriods{of: weekOf, Target: max(sched.Times, 1), Unit: "week"}
+	case FrequencyMonthly:
+		return SchedulePeriods{of: monthOf, Target: max(sched.Times, 1), Unit: "month"}
+	case FrequencyWeekdays:
+		if len(sched.Weekdays) > 0 {
+			return SchedulePeriods{of: weekdaysOf(sched.Weekdays), Target: 1, Unit: "day"}
+		}
+	}
+	return SchedulePeriods{
+		of:     func(day int64) (int64, bool) { return day, true },
+		Target: 1,
+		Unit:   "day",
+	}
+}
+
+// Of returns the period day falls in, or false if it's in none.
+func (p SchedulePeriods) Of(day int64) (int64, bool) {
+	return p.of(day)
+}
+
+// Count returns the number of distinct days done in each period.
+func (p SchedulePeriods) Count(entries []Habit, loc *time.Location) map[int64]int {
+	days := make(map[int64]struct{}, len(entries))
+	for _, e := range entries {
+		days[Day(e.TimeStamp, loc)] = struct{}{}
+	}
+	counts := make(map[int64]int)
+	for d := range days {
+		if period, ok := p.of(d); ok {
+			counts[period]++
+		}
+	}
+	return counts
+}
+
+// Current returns the period in progress on day. On an unscheduled weekday
+// that's the next scheduled one.
+func (p SchedulePeriods) Current(day int64) int64 {
+	for i := range int64(7) {
+		if period, ok := p.of(day + i); ok {
+			return period
+		}
+	}
+	period, _ := p.of(day)
+	return period
+}
+
+// End returns the day after the last day of period, searching forward from
+// day, which must not be later than period.
+func (p SchedulePeriods) End(period, day int64) int64 {
+	var seen bool
+	for ; ; day++ {
+		q, ok := p.of(day)
+		switch {
+		case ok && q > period, !ok && seen:
+			return day
+		case ok && q == period:
+			seen = true
+		}
+	}
+}
+
+// WeekOf numbers weeks starting on Monday. Day 0, 1970-01-01, was a
+// Thursday.
+func WeekOf(day int64) int64 {
+	return (day + 3) / 7
+}
+
+func weekOf(day int64) (int64, bool) {
+	return WeekOf(day), true
+}
+
+func monthOf(day int64) (int64, bool) {
+	t := time.Unix(day*daySec, 0).UTC()
+	return int64(t.Year())*12 + int64(t.Month()) - 1, true
+}
+
+// weekdaysOf numbers the scheduled days of each week in order, so that the
+// next scheduled day after a Friday in a Mon/Wed/Fri schedule is the
+// following Monday.
+func weekdaysOf(weekdays []time.Weekday) func(day int64) (int64, bool) {
+	// position within a Monday-first week
+	pos := func(wd time.Weekday) int { return (int(wd) + 6) % 7 }
+	var scheduled []int
+	for _, wd := range weekdays {
+		if !slices.Contains(scheduled, pos(wd)) {
+			scheduled = append(scheduled, pos(wd))
+		}
+	}
+	slices.Sort(scheduled)
+
+	return func(day int64) (int64, bool) {
+		wd := time.Weekday((day + 4) % 7)
+		i := slices.Index(scheduled, pos(wd))
+		if i < 0 {
+			return 0, false
+		}
+		return WeekOf(day)*int64(len(scheduled)) + int64(i), true
+	}
+}
@@ -0,0 +1,51 @@
+package habit
+
+import (
+	"testing"
+	"time"
+)
+
+func day(y int, m time.Month, d int) int64 {
+	return Day(time.Date(y, m, d, 12, 0, 0, 0, time.UTC).Unix(), time.UTC)
+}
+
+func TestWeekdaysOf(t *testing.T) {
+	p := NewSchedulePeriods(Schedule{Frequency: FrequencyWeekdays, Weekdays: []time.Weekday{time.Friday, time.Monday, time.Wednesday}})
+
+	fri, _ := p.Of(day(2024, 3, 8))
+	mon, _ := p.Of(day(2024, 3, 11))
+	if mon-fri != 1 {
+		t.Fatalf("expected Monday to follow Friday, got periods %d and %d", fri, mon)
+	}
+	if _, ok := p.Of(day(2024, 3, 12)); ok {
+		t.Fatal("expected Tuesday to be unscheduled")
+	}
+
+	// on an unscheduled day the period in progress is the next scheduled one
+	wed, _ := p.Of(day(2024, 3, 13))
+	if got := p.Current(day(2024, 3, 12)); got != wed {
+		t.Fatalf("got current period %d on Tuesday, want %d", got, wed)
+	}
+}
+
+func TestSchedulePeriodsEnd(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		sched Schedule
+		from  int64
+		want  int64
+	}{
+		{"daily", Schedule{Frequency: FrequencyDaily}, day(2024, 3, 13), day(2024, 3, 14)},
+		// 2024-03-13 was a Wednesday
+		{"weekly", Schedule{Frequency: FrequencyWeekly, Times: 3}, day(2024, 3, 13), day(2024, 3, 18)},
+		{"monthly", Schedule{Frequency: FrequencyMonthly, Times: 4}, day(2024, 2, 10), day(2024, 3, 1)},
+		// Wednesday's period ends on the unscheduled Thursday
+		{"weekdays", Schedule{Frequency: FrequencyWeekdays, Weekdays: []time.Weekday{time.Monday, time.Wednesday, time.Friday}}, day(2024, 3, 12), day(2024, 3, 14)},
+	} {
+		p := NewSchedulePeriods(tc.sched)
+		period := p.Current(tc.from)
+		if got := p.End(period, tc.from); got != tc.want {
+			t.Errorf("%s: got end %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package habit
+
+import "time"
+
+type Frequency string
+
+const (
+	FrequencyDaily    Frequency = "daily"
+	FrequencyWeekly   Frequency = "weekly"
+	FrequencyMonthly  Frequency = "monthly"
+	FrequencyWeekdays Frequency = "weekdays"
+)
+
+// Schedule is how often a habit is meant to be done. Times is the number of
+// distinct days needed per week or month; Weekdays lists the days a
+// weekdays habit is due. A habit with no schedule is daily.
+type Schedule struct {
+	Frequency Frequency      `json:"frequency"`
+	Times     int            `json:"times,omitempty"`
+	Weekdays  []time.Weekday `json:"weekdays,omitempty"`
+}
+
+type TargetPeriod string
+
+const (
+	TargetPerDay  TargetPeriod = "day"
+	TargetPerWeek TargetPeriod = "week"
+)
+
+// Target is an amount of a quantitative habit to do each day or week, e.g.
+// 30 "min" per day.
+type Target struct {
+	Amount float64      `json:"amount"`
+	Unit   string       `json:"unit"`
+	Period TargetPeriod `json:"period"`
+}
@@ -1,18 +1,64 @@
 package habit
 
+// Habit is a single logged entry. Value and Unit optionally record how
+// much was done, e.g. 30 "min" or 5 "km".
 type Habit struct {
-	Name      string `json:"name"`
-	Note      string `json:"note"`
-	TimeStamp int64  `json:"timestamp"`
+	ID        string  `json:"id,omitempty"`
+	Name      string  `json:"name"`
+	Note      string  `json:"note"`
+	TimeStamp int64   `json:"timestamp"`
+	Value     float64 `json:"value,omitempty"`
+	Unit      string  `json:"unit,omitempty"`
 }
 
+// HabitDefinition holds the metadata of a habit. Name is the habit's ID, as
+// used in entry names and URLs.
+type HabitDefinition struct {
+	Name        string    `json:"name"`
+	DisplayName string    `json:"display_name,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Color       string    `json:"color,omitempty"`
+	Icon        string    `json:"icon,omitempty"`
+	CreatedAt   int64     `json:"created_at"`
+	Archived    bool      `json:"archived"`
+	Schedule    *Schedule `json:"schedule,omitempty"`
+	Target      *Target   `json:"target,omitempty"`
+}
+
+// HabitSummary streaks count consecutive satisfied periods of the habit's
+// schedule: days, weeks, months or scheduled weekdays, as named by
+// StreakUnit. ThisPeriod is the number of days done so far in the current
+// period, out of PeriodTarget.
 type HabitSummary struct {
 	Name          string `json:"name"`
 	CurrentStreak int    `json:"current_streak"`
 	LongestStreak int    `json:"longest_streak"`
+	StreakUnit    string `json:"streak_unit"`
+	ThisPeriod    int    `json:"this_period"`
+	PeriodTarget  int    `json:"period_target"`
 	FirstLogged   int64  `json:"first_logged"`
 	TotalDaysDone int    `json:"total_days_done"`
 	BestMonth     int    `json:"best_month"`
 	ThisMonth     int    `json:"this_month"`
 	LastWrite     int64  `json:"last_write"`
+	// Timezone is where the summary's days start.
+	Timezone string `json:"timezone"`
+	// Schedule is the habit's schedule, which sets its streak periods.
+	Schedule Schedule `json:"schedule"`
+
+	// Quantity totals, over entries in Unit only.
+	Unit          string  `json:"unit,omitempty"`
+	Total         float64 `json:"total,omitempty"`
+	AveragePerDay float64 `json:"average_per_day,omitempty"`
+	BestDay       int64   `json:"best_day,omitempty"`
+	BestDayTotal  float64 `json:"best_day_total,omitempty"`
+	// TargetDone is the amount done so far towards the habit's Target in
+	// the current day or week.
+	TargetDone float64 `json:"target_done,omitempty"`
+}
+
+// UserSettings are per-user preferences kept by the server. Timezone is an
+// IANA name such as "America/Los_Angeles" and decides where days start.
+type UserSettings struct {
+	Timezone string `json:"timezone,omitempty"`
 }